@@ -2,6 +2,14 @@
 // (unique photo identifier), description and tags (such geocoding tags)
 package album
 
+import (
+	"encoding/json"
+	"time"
+)
+
+// type of the albums whose photos are selected by a query
+const ALBUM_SMART = "smart"
+
 // structure AlbumMessage which used for the UI and internal by the backend.
 type AlbumMessage struct {
 	// Album name
@@ -12,8 +20,17 @@ type AlbumMessage struct {
 	// description wrote by the user
 	Description string `json:"description,omitempty"`
 	// tags are all tags of the album (geo location, name, key words ...)
-	Tags []string `json:"tags, omitempty"`
-	Type string   `json:"type,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+	// type of the album, smart if the photos are selected by the query
+	Type string `json:"type,omitempty"`
+	// query of a smart album (body of /search), evaluated each time the album is read
+	Query json.RawMessage `json:"query,omitempty"`
+	// name of the parent album, empty for a root album
+	Parent string `json:"parent,omitempty"`
+	// md5sum of the cover photo chosen by the user
+	Cover string `json:"cover,omitempty"`
+	// name of the user who created the album, empty for the albums created before the user accounts
+	Owner string `json:"owner,omitempty"`
 }
 
 // structure returns the number of photo by origin (machine or cloud account)
@@ -41,6 +58,103 @@ type LocationMessage struct {
 	Count     int     `json:"count"`
 }
 
+// structure of a cluster of photos on the map, the bounding box (north, south, east, west) contains all its photos
+type LocationClusterMessage struct {
+	Geohash   string  `json:"geohash"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Count     int     `json:"count"`
+	North     float64 `json:"north"`
+	South     float64 `json:"south"`
+	East      float64 `json:"east"`
+	West      float64 `json:"west"`
+}
+
+// structure returns the clusters of photos for the zoom level of the map
+type LocationClustersMessage struct {
+	Zoom     int                       `json:"zoom"`
+	Clusters []*LocationClusterMessage `json:"clusters"`
+}
+
+// structure returns the number of photos by place (country, region or city)
+type PlaceStatsMessage struct {
+	Level string              `json:"level"`
+	Stats []*PlaceStatMessage `json:"stats"`
+}
+
+type PlaceStatMessage struct {
+	Country string `json:"country"`
+	Region  string `json:"region,omitempty"`
+	City    string `json:"city,omitempty"`
+	Count   int    `json:"count"`
+}
+
+// structure of the keywords added to or removed from the photos
+type PhotoKeywordsMessage struct {
+	Md5sums  []string `json:"md5sums"`
+	Keywords []string `json:"keywords"`
+}
+
+// structure of the curation update of the photos, only the set fields are updated
+type CurationMessage struct {
+	Md5sums    []string `json:"md5sums"`
+	Rating     *int     `json:"rating,omitempty"`
+	Favourite  *bool    `json:"favourite,omitempty"`
+	ColorLabel *string  `json:"color_label,omitempty"`
+}
+
+// structure returns the keywords with their number of photos
+type KeywordsMessage struct {
+	Keywords []*KeywordMessage `json:"keywords"`
+}
+
+type KeywordMessage struct {
+	Keyword string `json:"keyword"`
+	Count   int    `json:"count"`
+}
+
+// structure returns an album of the albums tree with its subalbums, count is the number of photos
+// of the album and total the number of photos of the album and its subalbums
+type AlbumTreeMessage struct {
+	AlbumName string              `json:"album_name"`
+	Type      string              `json:"type,omitempty"`
+	Count     int                 `json:"count"`
+	Total     int                 `json:"total"`
+	Children  []*AlbumTreeMessage `json:"children"`
+}
+
+// structure of the order of the photos of an album, md5sums moved first (reorder) or inserted at the position
+// (insert, at the end without position), sort by date or -date (sort) and cover photo (cover)
+type AlbumOrderMessage struct {
+	AlbumName string   `json:"album_name"`
+	Md5sums   []string `json:"md5sums,omitempty"`
+	Position  *int     `json:"position,omitempty"`
+	Sort      string   `json:"sort,omitempty"`
+	Cover     string   `json:"cover,omitempty"`
+}
+
+// structure of the move of an album under the parent album, an empty parent moves the album to the root
+type MoveAlbumMessage struct {
+	AlbumName string `json:"album_name"`
+	Parent    string `json:"parent"`
+}
+
+// structure of a share link of an album, the visitors of the gallery of the link see the photos of the album
+// until the expiry date. the password is only received when the link is created and download allows
+// the visitors to download the originals
+type ShareMessage struct {
+	Token     string    `json:"token,omitempty"`
+	AlbumName string    `json:"album_name"`
+	Expires   time.Time `json:"expires"`
+	Password  string    `json:"password,omitempty"`
+	Download  bool      `json:"download"`
+	// true if the gallery asks the password
+	Protected bool      `json:"protected"`
+	Created   time.Time `json:"created"`
+	// path of the gallery of the link
+	Url string `json:"url,omitempty"`
+}
+
 // function to get a new pointer of an empty AlbumMessage
 func NewAlbumMessage(albumName string, md5sums []string) *AlbumMessage {
 	a := &AlbumMessage{
@@ -62,3 +176,19 @@ func NewLocationStatsMessage() *LocationStatsMessage {
 func NewTimeStatsMessage() *TimeStatsMessage {
 	return &TimeStatsMessage{Stats: make([]*TimeStatMessage, 0)}
 }
+
+func NewLocationClustersMessage(zoom int) *LocationClustersMessage {
+	return &LocationClustersMessage{Zoom: zoom, Clusters: make([]*LocationClusterMessage, 0)}
+}
+
+func NewPlaceStatsMessage(level string) *PlaceStatsMessage {
+	return &PlaceStatsMessage{Level: level, Stats: make([]*PlaceStatMessage, 0)}
+}
+
+func NewAlbumTreeMessage(albumName string) *AlbumTreeMessage {
+	return &AlbumTreeMessage{AlbumName: albumName, Children: make([]*AlbumTreeMessage, 0)}
+}
+
+func NewKeywordsMessage() *KeywordsMessage {
+	return &KeywordsMessage{Keywords: make([]*KeywordMessage, 0)}
+}
@@ -0,0 +1,349 @@
+// package writes and restores the library (photos, albums, share links, thumbnails, slaves and cloud accounts)
+// as a portable zip archive, it does not depend on the database type (tiedot or sqlite)
+package backup
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/configurationapp"
+	"github.com/jeromelesaux/photo/database"
+	"github.com/jeromelesaux/photo/flickr_client"
+	google_photos_client "github.com/jeromelesaux/photo/google-photos_client"
+	"github.com/jeromelesaux/photo/modele"
+	"github.com/jeromelesaux/photo/slavehandler"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+// version of the archive format, an archive with a greater version is refused
+const VERSION = 1
+
+// files of the archive, the manifest is always the first file
+const (
+	MANIFEST_FILE  = "manifest.json"
+	PHOTOS_FILE    = "photos.ndjson"
+	ALBUMS_FILE    = "albums.ndjson"
+	SHARES_FILE    = "shares.ndjson"
+	SLAVES_FILE    = "slaves.json"
+	CLOUD_FILE     = "cloud.json"
+	THUMBNAILS_DIR = "thumbnails/"
+)
+
+// structure describing the archive
+type Manifest struct {
+	Version    int       `json:"version"`
+	AppVersion string    `json:"app_version"`
+	Created    time.Time `json:"created"`
+}
+
+// cloud accounts configurations stored in the archive
+type CloudConfiguration struct {
+	Google *google_photos_client.GooglePhotoClient `json:"google,omitempty"`
+	Flickr *flickr_client.Flickr                   `json:"flickr,omitempty"`
+}
+
+// structure returns the number of elements written or restored
+type Report struct {
+	Photos        int `json:"photos"`
+	PhotosSkipped int `json:"photos_skipped,omitempty"`
+	Albums        int `json:"albums"`
+	Shares        int `json:"shares"`
+	Thumbnails    int `json:"thumbnails"`
+	Slaves        int `json:"slaves"`
+}
+
+// function writes the archive of the library in w, the writes in the database
+// are blocked while the archive is written
+func Write(w io.Writer, db database.DatabaseInterface) (*Report, error) {
+	unblock := database.BlockWrites()
+	defer unblock()
+
+	report := &Report{}
+	archive := zip.NewWriter(w)
+	if err := writeJson(archive, MANIFEST_FILE, &Manifest{Version: VERSION, AppVersion: modele.VERSION, Created: time.Now()}); err != nil {
+		return report, err
+	}
+
+	f, err := archive.Create(PHOTOS_FILE)
+	if err != nil {
+		return report, err
+	}
+	encoder := json.NewEncoder(f)
+	err = db.ExportPhotos(func(photo *database.BackupPhotoRecord) error {
+		report.Photos++
+		return encoder.Encode(photo)
+	})
+	if err != nil {
+		logger.Error("Error while writing photos in backup with error " + err.Error())
+		return report, err
+	}
+
+	f, err = archive.Create(ALBUMS_FILE)
+	if err != nil {
+		return report, err
+	}
+	encoder = json.NewEncoder(f)
+	err = db.ExportAlbums(func(a *album.AlbumMessage) error {
+		report.Albums++
+		return encoder.Encode(a)
+	})
+	if err != nil {
+		logger.Error("Error while writing albums in backup with error " + err.Error())
+		return report, err
+	}
+
+	shares, err := db.GetShares("")
+	if err != nil {
+		logger.Error("Error while reading share links for backup with error " + err.Error())
+		return report, err
+	}
+	f, err = archive.Create(SHARES_FILE)
+	if err != nil {
+		return report, err
+	}
+	encoder = json.NewEncoder(f)
+	for _, share := range shares {
+		if err := encoder.Encode(share); err != nil {
+			return report, err
+		}
+		report.Shares++
+	}
+
+	// second pass on the photos to not keep all the thumbnails in memory
+	err = db.ExportPhotos(func(photo *database.BackupPhotoRecord) error {
+		if photo.Thumbnail == "" {
+			return nil
+		}
+		content, err := base64.StdEncoding.DecodeString(photo.Thumbnail)
+		if err != nil {
+			logger.Errorf("Thumbnail of %s is not a base64 content and is skipped", photo.Md5sum)
+			return nil
+		}
+		f, err := archive.Create(THUMBNAILS_DIR + photo.Md5sum + ".png")
+		if err != nil {
+			return err
+		}
+		report.Thumbnails++
+		_, err = f.Write(content)
+		return err
+	})
+	if err != nil {
+		logger.Error("Error while writing thumbnails in backup with error " + err.Error())
+		return report, err
+	}
+
+	// the secrets of the slaves are not saved, the slaves enrol again after a restoration
+	slaves := slavehandler.GetSlaves()
+	for name, slave := range slaves.Slaves {
+		withoutSecret := *slave
+		withoutSecret.Secret = ""
+		slaves.Slaves[name] = &withoutSecret
+	}
+	report.Slaves = len(slaves.Slaves)
+	if err := writeJson(archive, SLAVES_FILE, slaves); err != nil {
+		return report, err
+	}
+	if err := writeJson(archive, CLOUD_FILE, cloudConfiguration()); err != nil {
+		return report, err
+	}
+	if err := archive.Close(); err != nil {
+		return report, err
+	}
+	logger.Infof("Backup written with %d photos, %d albums, %d share links, %d thumbnails and %d slaves", report.Photos, report.Albums, report.Shares, report.Thumbnails, report.Slaves)
+	return report, nil
+}
+
+// function restores the archive in the database, the photos already stored are skipped,
+// the albums and the share links of the archive replace the albums with the same name and the share links with the same token.
+// the writes in the database are blocked during the restoration.
+func Restore(r io.ReaderAt, size int64, db database.DatabaseInterface) (*Report, error) {
+	report := &Report{}
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		logger.Error("Error while opening backup with error " + err.Error())
+		return report, err
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+	manifest := &Manifest{}
+	if err := readJson(files, MANIFEST_FILE, manifest); err != nil {
+		return report, err
+	}
+	if manifest.Version < 1 || manifest.Version > VERSION {
+		return report, fmt.Errorf("Backup version %d is not supported (version %d expected)", manifest.Version, VERSION)
+	}
+
+	unblock := database.BlockWrites()
+	defer unblock()
+
+	err = readLines(files, PHOTOS_FILE, func(line []byte) error {
+		photo := &database.BackupPhotoRecord{}
+		if err := json.Unmarshal(line, photo); err != nil {
+			return err
+		}
+		if thumbnail, ok := files[THUMBNAILS_DIR+photo.Md5sum+".png"]; ok {
+			content, err := readFile(thumbnail)
+			if err != nil {
+				return err
+			}
+			photo.Thumbnail = base64.StdEncoding.EncodeToString(content)
+			report.Thumbnails++
+		}
+		switch err := db.RestorePhoto(photo); err {
+		case nil:
+			report.Photos++
+		case database.PictureAlreadyExists:
+			report.PhotosSkipped++
+		default:
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("Error while restoring photos with error " + err.Error())
+		return report, err
+	}
+
+	err = readLines(files, ALBUMS_FILE, func(line []byte) error {
+		a := &album.AlbumMessage{}
+		if err := json.Unmarshal(line, a); err != nil {
+			return err
+		}
+		report.Albums++
+		return db.RestoreAlbum(a)
+	})
+	if err != nil {
+		logger.Error("Error while restoring albums with error " + err.Error())
+		return report, err
+	}
+
+	// the archives written before the share links have no shares file
+	if _, ok := files[SHARES_FILE]; ok {
+		err = readLines(files, SHARES_FILE, func(line []byte) error {
+			share := &database.DatabaseShareRecord{}
+			if err := json.Unmarshal(line, share); err != nil {
+				return err
+			}
+			report.Shares++
+			return db.RestoreShare(share)
+		})
+		if err != nil {
+			logger.Error("Error while restoring share links with error " + err.Error())
+			return report, err
+		}
+	}
+
+	slaves := &slavehandler.SlavesConfiguration{}
+	if err := readJson(files, SLAVES_FILE, slaves); err == nil && len(slaves.Slaves) > 0 {
+		report.Slaves = len(slaves.Slaves)
+		if err := slavehandler.RestoreSlaves(slaves); err != nil {
+			return report, err
+		}
+	}
+	cloud := &CloudConfiguration{}
+	if err := readJson(files, CLOUD_FILE, cloud); err == nil {
+		if err := restoreCloudConfiguration(cloud); err != nil {
+			return report, err
+		}
+	}
+	logger.Infof("Backup of %s restored with %d photos (%d skipped), %d albums, %d share links and %d slaves",
+		manifest.Created.String(), report.Photos, report.PhotosSkipped, report.Albums, report.Shares, report.Slaves)
+	return report, nil
+}
+
+// function returns the cloud accounts configurations to save
+func cloudConfiguration() *CloudConfiguration {
+	cloud := &CloudConfiguration{}
+	if conf := configurationapp.GetConfiguration(); conf != nil && conf.GoogleID != "" {
+		cloud.Google = google_photos_client.NewGooglePhotoClient(conf.GoogleUser, conf.GoogleID, conf.GoogleSecret)
+	}
+	flickrconf := flickr_client.GetCurrentFlickrClient()
+	if flickrconf.ApiKey == "" {
+		flickrconf = &flickr_client.Flickr{}
+		flickrconf.LoadConfiguration()
+	}
+	if flickrconf.ApiKey != "" {
+		cloud.Flickr = flickrconf
+	}
+	return cloud
+}
+
+// function saves the cloud accounts configurations of the archive
+func restoreCloudConfiguration(cloud *CloudConfiguration) error {
+	if conf := configurationapp.GetConfiguration(); conf != nil && cloud.Google != nil {
+		conf.GoogleID = cloud.Google.ID
+		conf.GoogleUser = cloud.Google.UserID
+		conf.GoogleSecret = cloud.Google.Secret
+		if err := conf.Save(); err != nil {
+			return err
+		}
+	}
+	if cloud.Flickr != nil {
+		flickr_client.GetCurrentFlickrClient()
+		flickr_client.SaveCurrentFlickrClient(cloud.Flickr)
+	}
+	return nil
+}
+
+func writeJson(archive *zip.Writer, name string, v interface{}) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(f).Encode(v)
+}
+
+func readFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func readJson(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return errors.New("No " + name + " found in backup")
+	}
+	content, err := readFile(f)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+// function calls fn for each line of the ndjson file name
+func readLines(files map[string]*zip.File, name string, fn func(line []byte) error) error {
+	f, ok := files[name]
+	if !ok {
+		return errors.New("No " + name + " found in backup")
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		if err := fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
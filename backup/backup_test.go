@@ -0,0 +1,99 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/configurationapp"
+	"github.com/jeromelesaux/photo/database"
+	"github.com/jeromelesaux/photo/slavehandler"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	source, _ := database.NewDataBaseMock()
+	thumbnail := base64.StdEncoding.EncodeToString([]byte("png content"))
+	source.RestorePhoto(&database.BackupPhotoRecord{Md5sum: "md5-1", MachineId: "mymachineid", Filename: "IMG_0001.JPG",
+		Filepath: "/photos/IMG_0001.JPG", Type: ".jpg", Size: 10, ExifTags: map[string]interface{}{"Model": "NIKON D80"}, Thumbnail: thumbnail})
+	source.RestorePhoto(&database.BackupPhotoRecord{Md5sum: "md5-2", MachineId: "mymachineid", Filename: "DSC_0002.NEF",
+		Filepath: "/photos/l'été/DSC_0002.NEF", Type: ".nef"})
+	source.InsertNewAlbum(&album.AlbumMessage{AlbumName: `Noël "chez" mamie`, Md5sums: []string{"md5-2", "md5-1"}, Description: "noël", Tags: []string{"famille"}})
+	share, err := database.NewDatabaseShareRecord(&album.ShareMessage{AlbumName: `Noël "chez" mamie`, Expires: time.Now().Add(time.Hour), Password: "secret", Download: true}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source.InsertShare(share)
+
+	if err := slavehandler.LoadSlaves(filepath.Join(t.TempDir(), "slaves.json")); err != nil {
+		t.Fatal(err)
+	}
+	slavehandler.AddSlave(&slavehandler.Slave{Name: "nas", Url: "http://192.168.0.2", Port: 3002, Secret: "slave secret"})
+
+	archive := new(bytes.Buffer)
+	report, err := Write(archive, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Slaves != 1 || bytes.Contains(archive.Bytes(), []byte("slave secret")) {
+		t.Fatalf("expected the slave saved without its secret, received %v", report)
+	}
+	if report.Photos != 2 || report.Albums != 1 || report.Shares != 1 || report.Thumbnails != 1 {
+		t.Fatalf("unexpected backup report %v", report)
+	}
+
+	// restore in a sqlite library
+	dir := t.TempDir()
+	confFile := filepath.Join(dir, "conf.json")
+	os.WriteFile(confFile, []byte(`{"database_path":"`+filepath.Join(dir, "photo.db")+`","database_type":"sqlite"}`), 0644)
+	configurationapp.LoadPhotoExifConfiguration(confFile)
+	target, err := database.NewDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = Restore(bytes.NewReader(archive.Bytes()), int64(archive.Len()), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Photos != 2 || report.PhotosSkipped != 0 || report.Albums != 1 || report.Shares != 1 || report.Thumbnails != 1 {
+		t.Fatalf("unexpected restore report %v", report)
+	}
+	if restored, err := target.GetShare(share.Token); err != nil || !restored.CheckPassword("secret") || !restored.Download || !restored.Expires.Equal(share.Expires) {
+		t.Fatalf("share link not restored, received %v %v", restored, err)
+	}
+	collection := target.GetAlbumData(`Noël "chez" mamie`)
+	if len(collection.Records) != 2 || collection.Description != "noël" || len(collection.Tags) != 1 {
+		t.Fatalf("album not restored, received %v", collection)
+	}
+	restored, err := target.GetThumbnail("md5-1")
+	if err != nil || string(restored.Content) != "png content" {
+		t.Fatal("thumbnail of md5-1 not restored")
+	}
+
+	// a second restore skips the photos already stored
+	report, err = Restore(bytes.NewReader(archive.Bytes()), int64(archive.Len()), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shares, _ := target.GetShares(""); report.Photos != 0 || report.PhotosSkipped != 2 || len(shares) != 1 {
+		t.Fatalf("photos already stored must be skipped, received %v", report)
+	}
+}
+
+func TestRestoreInvalidArchive(t *testing.T) {
+	source, _ := database.NewDataBaseMock()
+	if _, err := Restore(bytes.NewReader([]byte("not a zip")), 9, source); err == nil {
+		t.Fatal("restore of an invalid archive must be on error")
+	}
+	archive := new(bytes.Buffer)
+	w := zip.NewWriter(archive)
+	writeJson(w, MANIFEST_FILE, &Manifest{Version: VERSION + 1})
+	w.Close()
+	if _, err := Restore(bytes.NewReader(archive.Bytes()), int64(archive.Len()), source); err == nil {
+		t.Fatal("restore of an archive of a newer version must be on error")
+	}
+}
@@ -10,13 +10,18 @@ import (
 )
 
 // global application configuration structure
-// it stores the database location path (file system)
-// and google account informations
+// it stores the database location path (file system), the database type
+// (tiedot directory or sqlite file), the thumbnails location, the gazetteer of the places,
+// the file of the users accounts and google account informations
 type Configuration struct {
-	DatabasePath string `json:"database_path"`
-	GoogleID     string `json:"google_id"`
-	GoogleUser   string `json:"google_user"`
-	GoogleSecret string `json:"google_secret"`
+	DatabasePath   string `json:"database_path"`
+	DatabaseType   string `json:"database_type,omitempty"`
+	ThumbnailsPath string `json:"thumbnails_path,omitempty"`
+	GazetteerPath  string `json:"gazetteer_path,omitempty"`
+	UsersPath      string `json:"users_path,omitempty"`
+	GoogleID       string `json:"google_id"`
+	GoogleUser     string `json:"google_user"`
+	GoogleSecret   string `json:"google_secret"`
 }
 
 var confPhotoExifMut sync.Mutex
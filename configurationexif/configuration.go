@@ -4,19 +4,27 @@ package configurationexif
 import (
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 
+	"github.com/pkg/errors"
 	logger "github.com/sirupsen/logrus"
 )
 
 var confFileExtensionMut sync.Mutex
 
-// list of the file extensions available
+// list of the file extensions available and the directories of the slave the master may read
 type FileExtension struct {
 	Extensions []string
+	ScanRoots  []string `json:",omitempty"`
+	// absolute directory of the copies of the files written by the slave, next to the configuration file if empty
+	MetadataBackupDirectory string `json:",omitempty"`
 }
 
+// directory of the copies of the files written by the slave, next to the configuration file
+const METADATA_BACKUP_DIRECTORY = "metadata_backup"
+
 // function loads the list of the file extensions available from the file path (configurationFile)
 func LoadConfiguration(configurationFile string) FileExtension {
 	configuration := FileExtension{}
@@ -31,12 +39,60 @@ func LoadConfiguration(configurationFile string) FileExtension {
 		logger.Error("error:", err)
 	}
 	confFileExtensionMut.Unlock()
+	if configuration.MetadataBackupDirectory == "" {
+		if directory, err := filepath.Abs(filepath.Dir(configurationFile)); err == nil {
+			configuration.MetadataBackupDirectory = filepath.Join(directory, METADATA_BACKUP_DIRECTORY)
+		}
+	}
 	logger.Info("File extensions supported : " + strings.Join(configuration.Extensions, ","))
 
 	return configuration
 }
 
+// static file path of the file extensions configuration
+const CONFIGURATION_FILE = "extension-file.json"
+
 // function loads the structure from the static file path "extension-file.json"
 func LoadConfigurationAtOnce() FileExtension {
-	return LoadConfiguration("extension-file.json")
+	return LoadConfiguration(CONFIGURATION_FILE)
+}
+
+// function returns an error if no scan root is configured, the slave would refuse every file of the master
+func (f FileExtension) CheckScanRoots(configurationFile string) error {
+	if len(f.ScanRoots) == 0 {
+		return errors.Errorf("the setting ScanRoots of %s is empty, add the directories the master may scan", configurationFile)
+	}
+	for _, root := range f.ScanRoots {
+		if _, err := absolutePath(root); err != nil {
+			logger.Warnf("The scan root %s of %s is not available with error %v", root, configurationFile, err)
+		}
+	}
+	return nil
+}
+
+// function returns true if the path is inside one of the scan roots, the symbolic links are resolved
+func (f FileExtension) InScanRoots(path string) bool {
+	resolved, err := absolutePath(path)
+	if err != nil {
+		return false
+	}
+	for _, root := range f.ScanRoots {
+		root, err := absolutePath(root)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(root, resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// function returns the absolute path of the file without symbolic link
+func absolutePath(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(resolved)
 }
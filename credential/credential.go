@@ -0,0 +1,64 @@
+// package generates the random tokens and hashes the tokens and the passwords of the application,
+// it depends on no other package of the application
+package credential
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// number of random bytes of the tokens
+	TOKEN_BYTES = 32
+	// bcrypt cost of the passwords, it is stored in the hash so a new cost applies to the new passwords only
+	PASSWORD_COST = 12
+)
+
+var (
+	// hash compared when the hash of the password is missing, so the answer takes the same time
+	missingHash     []byte
+	missingHashOnce sync.Once
+)
+
+// function returns a new random token (base64 url encoding)
+func NewRandomToken() (string, error) {
+	b := make([]byte, TOKEN_BYTES)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "Cannot generate a random token")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// function returns the sha256 of the token, the tokens are random so they need no salt
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// function returns the bcrypt hash of the password, the salt and the cost are stored in the hash
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), PASSWORD_COST)
+	if err != nil {
+		return "", errors.Wrap(err, "Cannot hash the password")
+	}
+	return string(hash), nil
+}
+
+// function returns true if the password is the password of the bcrypt hash, an empty or invalid hash
+// takes the time of a valid one
+func CheckPassword(hash string, password string) bool {
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		missingHashOnce.Do(func() {
+			missingHash, _ = bcrypt.GenerateFromPassword([]byte("missing password"), PASSWORD_COST)
+		})
+		bcrypt.CompareHashAndPassword(missingHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,41 @@
+package credential
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPassword(t *testing.T) {
+	hash, err := HashPassword("alice-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$2a$12$") || !CheckPassword(hash, "alice-password") || CheckPassword(hash, "bob-password") {
+		t.Fatalf("expected the bcrypt hash of the password, received %s", hash)
+	}
+	if other, _ := HashPassword("alice-password"); other == hash {
+		t.Fatal("expected a new salt for each hash")
+	}
+	for _, invalid := range []string{"", "salt$hash", hash[:len(hash)-1]} {
+		if CheckPassword(invalid, "alice-password") {
+			t.Fatalf("expected the invalid hash %s refused", invalid)
+		}
+	}
+	if _, err := HashPassword(strings.Repeat("a", 73)); err == nil {
+		t.Fatal("expected an error for a password longer than bcrypt accepts")
+	}
+}
+
+func TestToken(t *testing.T) {
+	token, err := NewRandomToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := NewRandomToken()
+	if token == other || len(token) != 43 {
+		t.Fatalf("expected random tokens of %d bytes, received %s and %s", TOKEN_BYTES, token, other)
+	}
+	if HashToken(token) != HashToken(token) || HashToken(token) == HashToken(other) {
+		t.Fatal("expected the hash of the token only")
+	}
+}
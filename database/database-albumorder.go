@@ -0,0 +1,195 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// album order of the database implementations
+type albumOrderStore interface {
+	DatabaseInterface
+	albumItems(albumName string) ([]string, error)
+	albumQuery(albumName string) (*SearchRequest, error)
+	// replaces the ordered items of the album
+	setAlbumItems(albumName string, md5sums []string) error
+	setAlbumCover(albumName string, md5sum string) error
+}
+
+// function sorts the records in the order of the md5sums, the records of the other md5sums are at the end
+func SortRecords(records []*DatabasePhotoRecord, md5sums []string) {
+	positions := make(map[string]int, len(md5sums))
+	for i, md5sum := range md5sums {
+		if _, ok := positions[md5sum]; !ok {
+			positions[md5sum] = i
+		}
+	}
+	position := func(md5sum string) int {
+		if p, ok := positions[md5sum]; ok {
+			return p
+		}
+		return len(md5sums)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return position(records[i].Md5sum) < position(records[j].Md5sum)
+	})
+}
+
+func containsItem(items []string, md5sum string) bool {
+	for _, item := range items {
+		if item == md5sum {
+			return true
+		}
+	}
+	return false
+}
+
+// function returns the items followed by the md5sums which are not already in the items
+func appendItems(items []string, md5sums []string) []string {
+	appended := append([]string{}, items...)
+	for _, md5sum := range md5sums {
+		if !containsItem(appended, md5sum) {
+			appended = append(appended, md5sum)
+		}
+	}
+	return appended
+}
+
+// function returns the items with the md5sums first in their order, followed by the other items in their order.
+// an error is returned if a md5sum is not an item of the album
+func reorderItems(items []string, md5sums []string) ([]string, error) {
+	for _, md5sum := range md5sums {
+		if !containsItem(items, md5sum) {
+			return nil, fmt.Errorf("Photo %s is not in the album", md5sum)
+		}
+	}
+	return insertItems(items, md5sums, 0), nil
+}
+
+// function returns the items with the md5sums inserted at the position (0 for the first one), the md5sums
+// already in the items are moved. a negative position or a position after the last item appends the md5sums
+func insertItems(items []string, md5sums []string, position int) []string {
+	added := make([]string, 0, len(md5sums))
+	for _, md5sum := range md5sums {
+		if !containsItem(added, md5sum) {
+			added = append(added, md5sum)
+		}
+	}
+	kept := make([]string, 0, len(items))
+	for _, item := range items {
+		if !containsItem(added, item) {
+			kept = append(kept, item)
+		}
+	}
+	if position < 0 || position > len(kept) {
+		position = len(kept)
+	}
+	ordered := make([]string, 0, len(kept)+len(added))
+	ordered = append(ordered, kept[:position]...)
+	ordered = append(ordered, added...)
+	return append(ordered, kept[position:]...)
+}
+
+// function returns the items sorted by the date taken of the photos, the photos without date keep their order at the end
+func sortItemsByDate(items []string, records []*DatabasePhotoRecord, descending bool) []string {
+	dates := make(map[string]int64)
+	for _, record := range records {
+		if date, ok := PhotoDate(record.ExifTags, record.ModTime); ok {
+			dates[record.Md5sum] = date.UnixNano()
+		}
+	}
+	sorted := append([]string{}, items...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, aok := dates[sorted[i]]
+		b, bok := dates[sorted[j]]
+		if !aok || !bok {
+			return aok && !bok
+		}
+		if descending {
+			return a > b
+		}
+		return a < b
+	})
+	return sorted
+}
+
+// function returns the cover of the album, the cover set by the user if it is a photo of the album
+// or the first photo, empty for an empty album
+func albumCover(records []*DatabasePhotoRecord, cover string) string {
+	for _, record := range records {
+		if record.Md5sum == cover {
+			return cover
+		}
+	}
+	if len(records) > 0 {
+		return records[0].Md5sum
+	}
+	return ""
+}
+
+// function replaces the items of the static album with the result of order applied on its items
+func orderAlbum(d albumOrderStore, albumName string, order func(items []string) ([]string, error)) error {
+	exists, err := d.AlbumExists(albumName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.Wrap(AlbumNotFound, albumName)
+	}
+	if request, err := d.albumQuery(albumName); err != nil || request != nil {
+		if err != nil {
+			return err
+		}
+		return SmartAlbumPhotos
+	}
+	items, err := d.albumItems(albumName)
+	if err != nil {
+		return err
+	}
+	ordered, err := order(items)
+	if err != nil {
+		return err
+	}
+	return d.setAlbumItems(albumName, ordered)
+}
+
+// function moves the md5sums at the beginning of the album, in their order
+func reorderAlbum(d albumOrderStore, albumName string, md5sums []string) error {
+	return orderAlbum(d, albumName, func(items []string) ([]string, error) {
+		return reorderItems(items, md5sums)
+	})
+}
+
+// function inserts the photos md5sums at the position of the album (moved if already in the album)
+func insertAlbumPhotos(d albumOrderStore, albumName string, md5sums []string, position int) error {
+	if err := picturesExist(d, md5sums); err != nil {
+		return err
+	}
+	return orderAlbum(d, albumName, func(items []string) ([]string, error) {
+		return insertItems(items, md5sums, position), nil
+	})
+}
+
+// function sorts the photos of the album by date taken
+func sortAlbumByDate(d albumOrderStore, albumName string, descending bool) error {
+	records := d.GetAlbumData(albumName).Records
+	return orderAlbum(d, albumName, func(items []string) ([]string, error) {
+		return sortItemsByDate(items, records, descending), nil
+	})
+}
+
+// function sets the cover of the album, the photo must be in the album. an empty md5sum sets the first photo as cover
+func updateAlbumCover(d albumOrderStore, albumName string, md5sum string) error {
+	exists, err := d.AlbumExists(albumName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.Wrap(AlbumNotFound, albumName)
+	}
+	if md5sum != "" && albumCover(d.GetAlbumData(albumName).Records, md5sum) != md5sum {
+		return fmt.Errorf("Photo %s is not in the album %s", md5sum, albumName)
+	}
+	return d.setAlbumCover(albumName, md5sum)
+}
@@ -0,0 +1,161 @@
+package database
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/modele"
+	"github.com/pkg/errors"
+)
+
+func TestInsertItems(t *testing.T) {
+	items := []string{"md5-1", "md5-2", "md5-3"}
+	if ordered := insertItems(items, []string{"md5-4"}, 1); !reflect.DeepEqual(ordered, []string{"md5-1", "md5-4", "md5-2", "md5-3"}) {
+		t.Fatalf("expected md5-4 in second position, received %v", ordered)
+	}
+	if ordered := insertItems(items, []string{"md5-1"}, 2); !reflect.DeepEqual(ordered, []string{"md5-2", "md5-3", "md5-1"}) {
+		t.Fatalf("expected md5-1 moved at the end, received %v", ordered)
+	}
+	if ordered := insertItems(items, []string{"md5-4"}, -1); !reflect.DeepEqual(ordered, []string{"md5-1", "md5-2", "md5-3", "md5-4"}) {
+		t.Fatalf("expected md5-4 appended, received %v", ordered)
+	}
+	if ordered, err := reorderItems(items, []string{"md5-3", "md5-2"}); err != nil || !reflect.DeepEqual(ordered, []string{"md5-3", "md5-2", "md5-1"}) {
+		t.Fatalf("expected md5-3 md5-2 md5-1, received %v %v", ordered, err)
+	}
+	if _, err := reorderItems(items, []string{"md5-4"}); err == nil {
+		t.Fatal("expected an error for a photo not in the album")
+	}
+}
+
+func TestSortItemsByDate(t *testing.T) {
+	records := []*DatabasePhotoRecord{
+		{Md5sum: "md5-1", ExifTags: map[string]interface{}{"DateTimeOriginal": "2020:01:01 10:00:00"}},
+		{Md5sum: "md5-2"},
+		{Md5sum: "md5-3", ExifTags: map[string]interface{}{"DateTimeOriginal": "2019:01:01 10:00:00"}},
+	}
+	items := []string{"md5-1", "md5-2", "md5-3"}
+	if sorted := sortItemsByDate(items, records, false); !reflect.DeepEqual(sorted, []string{"md5-3", "md5-1", "md5-2"}) {
+		t.Fatalf("expected md5-3 md5-1 md5-2, received %v", sorted)
+	}
+	if sorted := sortItemsByDate(items, records, true); !reflect.DeepEqual(sorted, []string{"md5-1", "md5-3", "md5-2"}) {
+		t.Fatalf("expected md5-1 md5-3 md5-2, received %v", sorted)
+	}
+}
+
+func TestAlbumOrder(t *testing.T) {
+	for name, d := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			testAlbumOrder(t, d)
+		})
+	}
+}
+
+func albumOrder(d DatabaseInterface, albumName string) []string {
+	md5sums := make([]string, 0)
+	for _, record := range d.GetAlbumData(albumName).Records {
+		md5sums = append(md5sums, record.Md5sum)
+	}
+	return md5sums
+}
+
+func testAlbumOrder(t *testing.T, d DatabaseInterface) {
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "a.jpg", Filepath: "/a.jpg", Tags: map[string]string{"DateTimeOriginal": "2020:01:01 10:00:00"}},
+		{Md5Sum: "md5-2", Filename: "b.jpg", Filepath: "/b.jpg", Tags: map[string]string{"DateTimeOriginal": "2018:01:01 10:00:00"}},
+		{Md5Sum: "md5-3", Filename: "c.jpg", Filepath: "/c.jpg", Tags: map[string]string{"DateTimeOriginal": "2019:01:01 10:00:00"}},
+		{Md5Sum: "md5-4", Filename: "d.jpg", Filepath: "/d.jpg"},
+	}))
+	if err := d.InsertNewAlbum(album.NewAlbumMessage("holidays", []string{"md5-3", "md5-1"})); err != nil {
+		t.Fatal(err)
+	}
+	if order := albumOrder(d, "holidays"); !reflect.DeepEqual(order, []string{"md5-3", "md5-1"}) {
+		t.Fatalf("expected md5-3 md5-1, received %v", order)
+	}
+	// the photos added are at the end of the album
+	if err := d.UpdateAlbum(album.NewAlbumMessage("holidays", []string{"md5-2", "md5-1"})); err != nil {
+		t.Fatal(err)
+	}
+	if order := albumOrder(d, "holidays"); !reflect.DeepEqual(order, []string{"md5-3", "md5-1", "md5-2"}) {
+		t.Fatalf("expected md5-3 md5-1 md5-2, received %v", order)
+	}
+	if content := d.GetAlbumData("holidays"); content.Cover != "md5-3" {
+		t.Fatalf("expected the first photo as cover, received %s", content.Cover)
+	}
+
+	if err := d.ReorderAlbum("holidays", []string{"md5-2", "md5-3"}); err != nil {
+		t.Fatal(err)
+	}
+	if order := albumOrder(d, "holidays"); !reflect.DeepEqual(order, []string{"md5-2", "md5-3", "md5-1"}) {
+		t.Fatalf("expected md5-2 md5-3 md5-1, received %v", order)
+	}
+	if err := d.ReorderAlbum("holidays", []string{"md5-4"}); err == nil {
+		t.Fatal("expected an error for a photo not in the album")
+	}
+	if err := d.InsertAlbumPhotos("holidays", []string{"md5-4"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if order := albumOrder(d, "holidays"); !reflect.DeepEqual(order, []string{"md5-2", "md5-4", "md5-3", "md5-1"}) {
+		t.Fatalf("expected md5-2 md5-4 md5-3 md5-1, received %v", order)
+	}
+	if err := d.InsertAlbumPhotos("holidays", []string{"md5-5"}, 0); errors.Cause(err) != PictureNotFound {
+		t.Fatalf("expected PictureNotFound and received %v", err)
+	}
+	if err := d.InsertAlbumPhotos("asia", []string{"md5-1"}, 0); errors.Cause(err) != AlbumNotFound {
+		t.Fatalf("expected AlbumNotFound and received %v", err)
+	}
+	if err := d.SortAlbumByDate("holidays", true); err != nil {
+		t.Fatal(err)
+	}
+	if order := albumOrder(d, "holidays"); !reflect.DeepEqual(order, []string{"md5-1", "md5-3", "md5-2", "md5-4"}) {
+		t.Fatalf("expected md5-1 md5-3 md5-2 md5-4, received %v", order)
+	}
+
+	if err := d.SetAlbumCover("holidays", "md5-5"); err == nil {
+		t.Fatal("expected an error for a cover not in the album")
+	}
+	if err := d.SetAlbumCover("holidays", "md5-2"); err != nil {
+		t.Fatal(err)
+	}
+	if content := d.GetAlbumData("holidays"); content.Cover != "md5-2" {
+		t.Fatalf("expected md5-2 as cover, received %s", content.Cover)
+	}
+	// the cover removed from the album is replaced by the first photo
+	if err := d.DeletePhotoAlbum(album.NewAlbumMessage("holidays", []string{"md5-2"})); err != nil {
+		t.Fatal(err)
+	}
+	if content := d.GetAlbumData("holidays"); content.Cover != "md5-1" {
+		t.Fatalf("expected md5-1 as cover, received %s", content.Cover)
+	}
+	if err := d.SetAlbumCover("holidays", "md5-3"); err != nil {
+		t.Fatal(err)
+	}
+
+	smart := album.NewAlbumMessage("smart", []string{})
+	smart.Query = json.RawMessage(`{"field":"filename","value":"a.jpg"}`)
+	if err := d.InsertNewAlbum(smart); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SortAlbumByDate("smart", false); err != SmartAlbumPhotos {
+		t.Fatalf("expected SmartAlbumPhotos and received %v", err)
+	}
+
+	var exported *album.AlbumMessage
+	d.ExportAlbums(func(a *album.AlbumMessage) error {
+		if a.AlbumName == "holidays" {
+			exported = a
+		}
+		return nil
+	})
+	if exported == nil || exported.Cover != "md5-3" || !reflect.DeepEqual(exported.Md5sums, []string{"md5-1", "md5-3", "md5-4"}) {
+		t.Fatalf("expected the order and the cover of holidays exported, received %v", exported)
+	}
+	d.DeleteAlbum(exported)
+	if err := d.RestoreAlbum(exported); err != nil {
+		t.Fatal(err)
+	}
+	if content := d.GetAlbumData("holidays"); content.Cover != "md5-3" || !reflect.DeepEqual(albumOrder(d, "holidays"), []string{"md5-1", "md5-3", "md5-4"}) {
+		t.Fatalf("expected the order and the cover of holidays restored, received %v", content)
+	}
+}
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/pkg/errors"
+)
+
+var AlbumNotFound = errors.New("Album not found in database.")
+
+// albums tree of the database implementations
+type albumTreeStore interface {
+	albumStore
+	// parent of each album, empty for a root album
+	albumParents() (map[string]string, error)
+}
+
+// function checks that the album can be moved under parent (parents contains the parent of each album),
+// the parent must exist and cannot be the album or one of its subalbums. an empty parent is the root
+func checkAlbumParent(parents map[string]string, albumName string, parent string) error {
+	if parent == "" {
+		return nil
+	}
+	if _, ok := parents[parent]; !ok {
+		return errors.Wrap(AlbumNotFound, parent)
+	}
+	for p, depth := parent, 0; p != "" && depth <= len(parents); p, depth = parents[p], depth+1 {
+		if p == albumName {
+			return fmt.Errorf("Album %s cannot be moved in its subalbum %s", albumName, parent)
+		}
+	}
+	return nil
+}
+
+// function checks that the album exists and can be moved under parent
+func checkAlbumMove(d albumTreeStore, albumName string, parent string) error {
+	parents, err := d.albumParents()
+	if err != nil {
+		return err
+	}
+	if _, ok := parents[albumName]; !ok {
+		return errors.Wrap(AlbumNotFound, albumName)
+	}
+	return checkAlbumParent(parents, albumName, parent)
+}
+
+// function returns the root albums with their subalbums sorted by name, the albums whose parent
+// does not exist anymore are root albums
+func albumTree(d albumTreeStore) ([]*album.AlbumTreeMessage, error) {
+	roots := make([]*album.AlbumTreeMessage, 0)
+	parents, err := d.albumParents()
+	if err != nil {
+		return roots, err
+	}
+	items := albumPhotos(d)
+	nodes := make(map[string]*album.AlbumTreeMessage)
+	photos := make(map[string][]string)
+	for name := range parents {
+		node := album.NewAlbumTreeMessage(name)
+		if photos[name], err = items(name); err != nil {
+			return roots, err
+		}
+		if request, _ := d.albumQuery(name); request != nil {
+			node.Type = album.ALBUM_SMART
+		}
+		node.Count = len(photos[name])
+		nodes[name] = node
+	}
+	for name, node := range nodes {
+		parent, ok := nodes[parents[name]]
+		if ok && checkAlbumParent(parents, name, parents[name]) == nil {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	sortAlbumTree(roots)
+	for _, root := range roots {
+		countAlbumTree(root, photos)
+	}
+	return roots, nil
+}
+
+func sortAlbumTree(nodes []*album.AlbumTreeMessage) {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].AlbumName < nodes[j].AlbumName })
+	for _, node := range nodes {
+		sortAlbumTree(node.Children)
+	}
+}
+
+// function sets the total of the node and its subalbums, the photos of several subalbums are counted once
+func countAlbumTree(node *album.AlbumTreeMessage, photos map[string][]string) map[string]struct{} {
+	md5sums := make(map[string]struct{})
+	for _, md5sum := range photos[node.AlbumName] {
+		md5sums[md5sum] = struct{}{}
+	}
+	for _, child := range node.Children {
+		for md5sum := range countAlbumTree(child, photos) {
+			md5sums[md5sum] = struct{}{}
+		}
+	}
+	node.Total = len(md5sums)
+	return md5sums
+}
+
+// function returns the names of the album and of its subalbums, nil if the album is not in the tree
+func albumSubtree(nodes []*album.AlbumTreeMessage, albumName string) []string {
+	for _, node := range nodes {
+		if node.AlbumName == albumName {
+			names := []string{node.AlbumName}
+			for _, child := range node.Children {
+				names = append(names, albumSubtree([]*album.AlbumTreeMessage{child}, child.AlbumName)...)
+			}
+			return names
+		}
+		if names := albumSubtree(node.Children, albumName); names != nil {
+			return names
+		}
+	}
+	return nil
+}
+
+// function returns the album with the photos of the album and of all its subalbums
+func GetAlbumTreeData(d DatabaseInterface, albumName string) (*DatabaseAlbumRecord, error) {
+	roots, err := d.GetAlbumTree()
+	if err != nil {
+		return NewDatabaseAlbumRecord(), err
+	}
+	collection := d.GetAlbumData(albumName)
+	for _, name := range albumSubtree(roots, albumName) {
+		if name != albumName {
+			collection.Records = append(collection.Records, d.GetAlbumData(name).Records...)
+		}
+	}
+	return ReduceAlbumMessage(collection, ""), nil
+}
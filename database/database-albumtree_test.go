@@ -0,0 +1,127 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/modele"
+	"github.com/pkg/errors"
+)
+
+func TestCheckAlbumParent(t *testing.T) {
+	parents := map[string]string{"travel": "", "europe": "travel", "paris": "europe"}
+	if err := checkAlbumParent(parents, "paris", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkAlbumParent(parents, "travel", "paris"); err == nil {
+		t.Fatal("expected an error for a move in a subalbum")
+	}
+	if err := checkAlbumParent(parents, "travel", "travel"); err == nil {
+		t.Fatal("expected an error for a move in itself")
+	}
+	if err := checkAlbumParent(parents, "paris", "asia"); errors.Cause(err) != AlbumNotFound {
+		t.Fatalf("expected AlbumNotFound and received %v", err)
+	}
+}
+
+func TestAlbumTree(t *testing.T) {
+	for name, d := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			testAlbumTree(t, d)
+		})
+	}
+}
+
+func testAlbumTree(t *testing.T, d DatabaseInterface) {
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "a.jpg", Filepath: "/a.jpg"},
+		{Md5Sum: "md5-2", Filename: "b.jpg", Filepath: "/b.jpg"},
+		{Md5Sum: "md5-3", Filename: "c.jpg", Filepath: "/c.jpg"},
+	}))
+	for _, a := range []*album.AlbumMessage{
+		{AlbumName: "travel", Md5sums: []string{"md5-1"}},
+		{AlbumName: "europe", Md5sums: []string{"md5-1", "md5-2"}, Parent: "travel"},
+		{AlbumName: "paris", Md5sums: []string{"md5-3"}, Parent: "europe", Owner: "alice"},
+		{AlbumName: "family", Md5sums: []string{}},
+	} {
+		if err := d.InsertNewAlbum(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.InsertNewAlbum(&album.AlbumMessage{AlbumName: "tokyo", Parent: "asia"}); errors.Cause(err) != AlbumNotFound {
+		t.Fatalf("expected AlbumNotFound and received %v", err)
+	}
+
+	tree, err := d.GetAlbumTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree) != 2 || tree[0].AlbumName != "family" || tree[1].AlbumName != "travel" {
+		t.Fatalf("expected the roots family and travel, received %v", tree)
+	}
+	travel := tree[1]
+	if travel.Count != 1 || travel.Total != 3 || len(travel.Children) != 1 {
+		t.Fatalf("expected 1 photo and 3 photos with the subalbums in travel, received %v", travel)
+	}
+	if europe := travel.Children[0]; europe.AlbumName != "europe" || europe.Count != 2 || europe.Total != 3 || len(europe.Children) != 1 {
+		t.Fatalf("expected 2 photos and 3 photos with the subalbums in europe, received %v", europe)
+	}
+	if content, err := GetAlbumTreeData(d, "travel"); err != nil || len(content.Records) != 3 {
+		t.Fatalf("expected the 3 photos of the travel subtree, received %v %v", content, err)
+	}
+
+	if err := d.MoveAlbum("travel", "paris"); err == nil {
+		t.Fatal("expected an error for a move in a subalbum")
+	}
+	if err := d.MoveAlbum("asia", ""); errors.Cause(err) != AlbumNotFound {
+		t.Fatalf("expected AlbumNotFound and received %v", err)
+	}
+	if err := d.MoveAlbum("paris", "family"); err != nil {
+		t.Fatal(err)
+	}
+	if content := d.GetAlbumData("paris"); content.Parent != "family" {
+		t.Fatalf("expected paris in family, received %s", content.Parent)
+	}
+	// the subalbums of a deleted album are moved to its parent
+	if err := d.MoveAlbum("paris", "europe"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeleteAlbum(&album.AlbumMessage{AlbumName: "europe"}); err != nil {
+		t.Fatal(err)
+	}
+	if content := d.GetAlbumData("paris"); content.Parent != "travel" {
+		t.Fatalf("expected paris in travel, received %s", content.Parent)
+	}
+	// an update keeps the parent
+	if err := d.UpdateAlbum(&album.AlbumMessage{AlbumName: "paris", Md5sums: []string{"md5-2"}, Description: "paris"}); err != nil {
+		t.Fatal(err)
+	}
+	if content := d.GetAlbumData("paris"); content.Parent != "travel" || len(content.Records) != 2 || content.Owner != "alice" {
+		t.Fatalf("expected paris of alice in travel with 2 photos, received %v", content)
+	}
+	if owner, err := d.GetAlbumOwner("paris"); owner != "alice" || err != nil {
+		t.Fatalf("expected alice as owner of paris, received %s %v", owner, err)
+	}
+	if _, err := d.GetAlbumOwner("asia"); err != AlbumNotFound {
+		t.Fatalf("expected AlbumNotFound and received %v", err)
+	}
+
+	var exported *album.AlbumMessage
+	d.ExportAlbums(func(a *album.AlbumMessage) error {
+		if a.AlbumName == "paris" {
+			exported = a
+		}
+		return nil
+	})
+	if exported == nil || exported.Parent != "travel" || exported.Owner != "alice" {
+		t.Fatalf("expected the parent and the owner of paris exported, received %v", exported)
+	}
+	exported.Parent = "family"
+	exported.Owner = "bob"
+	if err := d.RestoreAlbum(exported); err != nil {
+		t.Fatal(err)
+	}
+	if content := d.GetAlbumData("paris"); content.Parent != "family" || content.Owner != "bob" {
+		t.Fatalf("expected paris of bob restored in family, received %v", content)
+	}
+}
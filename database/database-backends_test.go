@@ -0,0 +1,36 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/HouzuoGuo/tiedot/db"
+)
+
+// function returns the tiedot database of the path opened as openDB does, closed at the end of the test
+func testTiedot(t *testing.T, path string) *DatabaseHandler {
+	connection, err := db.OpenDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { connection.Close() })
+	d := &DatabaseHandler{DBConnection: connection, Thumbnails: NewThumbnailStore(path)}
+	if err := d.createCollections(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.createIndexes(); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// function returns the mock, the sqlite and the tiedot databases by name, closed at the end of the test
+func testDatabases(t *testing.T) map[string]DatabaseInterface {
+	mock, _ := NewDataBaseMock()
+	sqlite, err := newSqliteDatabaseHandler(filepath.Join(t.TempDir(), "photo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	return map[string]DatabaseInterface{"mock": mock, "sqlite": sqlite, "tiedot": testTiedot(t, filepath.Join(t.TempDir(), "db"))}
+}
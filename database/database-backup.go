@@ -0,0 +1,37 @@
+package database
+
+import (
+	"sync"
+)
+
+// the writes in the database share this lock, a backup or a restore holds it
+// exclusively to work on a library which does not change
+var writesLock sync.RWMutex
+
+// structure of a photo stored in a backup archive, unlike DatabasePhotoRecord
+// it keeps the raw filepath and the import time of the photo
+type BackupPhotoRecord struct {
+	Md5sum     string                 `json:"md5sum"`
+	MachineId  string                 `json:"machineid"`
+	Filename   string                 `json:"filename"`
+	Filepath   string                 `json:"filepath"`
+	Type       string                 `json:"type"`
+	Size       int64                  `json:"size,omitempty"`
+	ImportTime int64                  `json:"import_time,omitempty"`
+	ModTime    int64                  `json:"modtime,omitempty"`
+	ExifTags   map[string]interface{} `json:"exiftags"`
+	Locations  []*PhotoLocation       `json:"locations,omitempty"`
+	Keywords   []string               `json:"keywords,omitempty"`
+	Rating     int                    `json:"rating,omitempty"`
+	Favourite  bool                   `json:"favourite,omitempty"`
+	ColorLabel string                 `json:"color_label,omitempty"`
+	// the base64 thumbnail is stored in its own file of the archive
+	Thumbnail string `json:"-"`
+}
+
+// function blocks the writes in the database until the returned function is called,
+// the reads are not blocked
+func BlockWrites() func() {
+	writesLock.Lock()
+	return writesLock.Unlock
+}
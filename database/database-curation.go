@@ -0,0 +1,216 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maximum number of stars of the photos
+	RATING_MAX = 5
+	// exif tags of the rating (exif, xmp) and of the rating in percent (windows)
+	RATINGEXIFTAG        = "Rating"
+	RATINGPERCENTEXIFTAG = "RatingPercent"
+	// xmp tag of the colour label
+	LABELXMPTAG = "Label"
+)
+
+// colour labels of the photos
+var ColorLabels = []string{"red", "yellow", "green", "blue", "purple"}
+
+// function returns true if the label is a colour label or empty (no label)
+func ValidColorLabel(label string) bool {
+	if label == "" {
+		return true
+	}
+	for _, l := range ColorLabels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// curation of the photos set by the user : stars, favourite and colour label
+type photoCuration struct {
+	rating     int
+	favourite  bool
+	colorLabel string
+}
+
+// function returns the value of the exif tag (exif names, xmp names with a namespace prefix or a space
+// separated group), case insensitive
+func exifTagValue(exif map[string]interface{}, tag string) (string, bool) {
+	tag = strings.ToLower(tag)
+	for key, value := range exif {
+		k := strings.ToLower(key)
+		if k == tag || strings.HasSuffix(k, ":"+tag) || strings.HasSuffix(k, " "+tag) {
+			if s, ok := value.(string); ok {
+				return strings.TrimSpace(s), true
+			}
+			if f, ok := value.(float64); ok {
+				return strconv.FormatFloat(f, 'f', -1, 64), true
+			}
+		}
+	}
+	return "", false
+}
+
+// function returns the curation seeded from the exif or xmp rating and label of the photo
+func exifCuration(exif map[string]interface{}) photoCuration {
+	c := photoCuration{}
+	if value, ok := exifTagValue(exif, RATINGEXIFTAG); ok {
+		if rating, err := strconv.ParseFloat(value, 64); err == nil {
+			c.rating = clampRating(int(rating))
+		}
+	} else if value, ok := exifTagValue(exif, RATINGPERCENTEXIFTAG); ok {
+		// windows percents 1, 25, 50, 75 and 99 are 1 to 5 stars
+		if percent, err := strconv.ParseFloat(value, 64); err == nil && percent > 0 {
+			c.rating = clampRating(int(percent)/25 + 1)
+		}
+	}
+	if value, ok := exifTagValue(exif, LABELXMPTAG); ok {
+		if label := strings.ToLower(value); ValidColorLabel(label) {
+			c.colorLabel = label
+		}
+	}
+	return c
+}
+
+// function returns the rating between 0 and RATING_MAX, the rejected photos (-1 in xmp) have no star
+func clampRating(rating int) int {
+	if rating < 0 {
+		return 0
+	}
+	if rating > RATING_MAX {
+		return RATING_MAX
+	}
+	return rating
+}
+
+// function checks the curation update, the md5sums and at least one of rating, favourite and color_label are needed
+func ValidateCuration(message *album.CurationMessage) error {
+	if message == nil || len(message.Md5sums) == 0 {
+		return errors.New("No photo given")
+	}
+	if message.Rating == nil && message.Favourite == nil && message.ColorLabel == nil {
+		return errors.New("The update needs rating, favourite or color_label")
+	}
+	if message.Rating != nil && (*message.Rating < 0 || *message.Rating > RATING_MAX) {
+		return fmt.Errorf("The rating must be between 0 and %d", RATING_MAX)
+	}
+	if message.ColorLabel != nil && !ValidColorLabel(strings.ToLower(*message.ColorLabel)) {
+		return fmt.Errorf("The color label must be empty or one of %s", strings.Join(ColorLabels, ", "))
+	}
+	return nil
+}
+
+// function returns the curation of the photo after the update
+func (c photoCuration) update(message *album.CurationMessage) photoCuration {
+	if message.Rating != nil {
+		c.rating = *message.Rating
+	}
+	if message.Favourite != nil {
+		c.favourite = *message.Favourite
+	}
+	if message.ColorLabel != nil {
+		c.colorLabel = strings.ToLower(*message.ColorLabel)
+	}
+	return c
+}
+
+// function sets the curation fields of the record
+func (c photoCuration) setRecord(record *DatabasePhotoRecord) {
+	record.Rating, record.Favourite, record.ColorLabel = c.rating, c.favourite, c.colorLabel
+}
+
+// filter of the query routes on the curation, the photos have at least MinRating stars,
+// are favourites if Favourite is set and have the colour label ColorLabel if not empty
+type CurationFilter struct {
+	MinRating  int
+	Favourite  bool
+	ColorLabel string
+}
+
+// function returns the filter of the parameters of the query routes, nil if no parameter is set
+func NewCurationFilter(minRating string, favourite string, colorLabel string) (*CurationFilter, error) {
+	if minRating == "" && favourite == "" && colorLabel == "" {
+		return nil, nil
+	}
+	f := &CurationFilter{ColorLabel: strings.ToLower(colorLabel)}
+	var err error
+	if minRating != "" {
+		if f.MinRating, err = strconv.Atoi(minRating); err != nil || f.MinRating < 0 || f.MinRating > RATING_MAX {
+			return nil, fmt.Errorf("The rating must be between 0 and %d", RATING_MAX)
+		}
+	}
+	if favourite != "" {
+		if f.Favourite, err = strconv.ParseBool(favourite); err != nil {
+			return nil, errors.New("favourite must be true or false")
+		}
+	}
+	if !ValidColorLabel(f.ColorLabel) {
+		return nil, fmt.Errorf("The color label must be one of %s", strings.Join(ColorLabels, ", "))
+	}
+	return f, nil
+}
+
+// function returns true if the curation of the photo matches the filter, a nil filter matches all the photos
+func (f *CurationFilter) matches(c photoCuration) bool {
+	if f == nil {
+		return true
+	}
+	return c.rating >= f.MinRating && (!f.Favourite || c.favourite) && (f.ColorLabel == "" || c.colorLabel == f.ColorLabel)
+}
+
+// function returns the records matching the filter
+func (f *CurationFilter) Records(records []*DatabasePhotoRecord) []*DatabasePhotoRecord {
+	if f == nil {
+		return records
+	}
+	filtered := make([]*DatabasePhotoRecord, 0, len(records))
+	for _, r := range records {
+		if f.matches(photoCuration{rating: r.Rating, favourite: r.Favourite, colorLabel: r.ColorLabel}) {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
+// function returns the request of the photos matching the request and the filter
+// (the photos matching the filter if request is nil)
+func (f *CurationFilter) Search(request *SearchRequest) *SearchRequest {
+	if f == nil {
+		return request
+	}
+	predicates := make([]*SearchRequest, 0)
+	if request != nil {
+		predicates = append(predicates, request)
+	}
+	if f.MinRating > 0 {
+		predicates = append(predicates, &SearchRequest{Field: SEARCH_RATING, Value: strconv.Itoa(f.MinRating)})
+	}
+	if f.Favourite {
+		predicates = append(predicates, &SearchRequest{Field: SEARCH_FAVOURITE, Value: "true"})
+	}
+	if f.ColorLabel != "" {
+		predicates = append(predicates, &SearchRequest{Field: SEARCH_COLOR_LABEL, Value: f.ColorLabel})
+	}
+	if len(predicates) == 0 {
+		return request
+	}
+	return &SearchRequest{And: predicates}
+}
+
+// function returns the curation of the backup, seeded from the exif if the backup has no curation
+func (photo *BackupPhotoRecord) curation() photoCuration {
+	c := photoCuration{rating: clampRating(photo.Rating), favourite: photo.Favourite, colorLabel: photo.ColorLabel}
+	if c == (photoCuration{}) {
+		return exifCuration(photo.ExifTags)
+	}
+	return c
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/modele"
+	"github.com/pkg/errors"
+)
+
+func TestExifCuration(t *testing.T) {
+	if c := exifCuration(map[string]interface{}{"Rating": "4", "xmp:Label": "Red"}); c.rating != 4 || c.colorLabel != "red" {
+		t.Fatalf("expected 4 stars and red, received %v", c)
+	}
+	if c := exifCuration(map[string]interface{}{"RatingPercent": "75"}); c.rating != 4 {
+		t.Fatalf("expected 4 stars for 75 percents, received %d", c.rating)
+	}
+	if c := exifCuration(map[string]interface{}{"XMP Rating": "-1", "Label": "To do"}); c.rating != 0 || c.colorLabel != "" {
+		t.Fatalf("expected no star and no label for a rejected photo, received %v", c)
+	}
+	if _, err := NewCurationFilter("6", "", ""); err == nil {
+		t.Fatal("expected an error for 6 stars")
+	}
+	if f, _ := NewCurationFilter("", "", ""); f != nil {
+		t.Fatal("expected no filter without parameter")
+	}
+}
+
+func TestCuration(t *testing.T) {
+	databases := testDatabases(t)
+
+	for name, d := range databases {
+		t.Run(name, func(t *testing.T) {
+			testCuration(t, d)
+		})
+	}
+
+	// the photos stored before the curation are seeded at startup
+	sqlite := databases["sqlite"].(*SqliteDatabaseHandler)
+	sqlite.DBConnection.Exec("UPDATE photos SET rating = NULL, color_label = ''")
+	if err := sqlite.migrateCuration(); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := sqlite.Search(&SearchRequest{Field: SEARCH_RATING, Value: "3"}); len(records) != 1 || records[0].Md5sum != "md5-1" {
+		t.Fatalf("expected the rating of md5-1 read from the exif, received %v", records)
+	}
+}
+
+func testCuration(t *testing.T, d DatabaseInterface) {
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "a.jpg", Filepath: "/a.jpg", Tags: map[string]string{"Rating": "3", "Label": "Green"}},
+		{Md5Sum: "md5-2", Filename: "b.jpg", Filepath: "/b.jpg"},
+		{Md5Sum: "md5-3", Filename: "c.jpg", Filepath: "/c.jpg"},
+	}))
+	records, _ := d.Search(&SearchRequest{Field: SEARCH_FILENAME, Value: "a.jpg"})
+	if len(records) != 1 || records[0].Rating != 3 || records[0].ColorLabel != "green" {
+		t.Fatalf("expected the rating and the label of the exif, received %v", records)
+	}
+
+	five, favourite, red := 5, true, "Red"
+	if err := d.UpdateCuration(&album.CurationMessage{Md5sums: []string{"md5-2", "md5-3"}, Rating: &five, Favourite: &favourite}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.UpdateCuration(&album.CurationMessage{Md5sums: []string{"md5-3"}, ColorLabel: &red}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.UpdateCuration(&album.CurationMessage{Md5sums: []string{"unknown"}, Rating: &five}); errors.Cause(err) != PictureNotFound {
+		t.Fatalf("expected PictureNotFound and received %v", err)
+	}
+	six := 6
+	if err := d.UpdateCuration(&album.CurationMessage{Md5sums: []string{"md5-1"}, Rating: &six}); err == nil {
+		t.Fatal("expected an error for 6 stars")
+	}
+
+	filter, _ := NewCurationFilter("4", "true", "red")
+	records, _ = d.Search(filter.Search(nil))
+	if len(records) != 1 || records[0].Md5sum != "md5-3" || records[0].Rating != 5 || !records[0].Favourite {
+		t.Fatalf("expected the favourite red photo md5-3, received %v", records)
+	}
+	all, _ := d.QueryAll()
+	if filtered := filter.Records(all); len(filtered) != 1 || filtered[0].Md5sum != "md5-3" {
+		t.Fatalf("expected the favourite red photo md5-3, received %v", filtered)
+	}
+	if records, _ := d.Search(&SearchRequest{Field: SEARCH_RATING, Value: "3"}); len(records) != 3 {
+		t.Fatalf("expected 3 photos with 3 stars or more, received %d", len(records))
+	}
+	if records, _ := d.Search(&SearchRequest{Field: SEARCH_FAVOURITE, Value: "false"}); len(records) != 1 {
+		t.Fatalf("expected 1 photo which is not a favourite, received %d", len(records))
+	}
+
+	d.InsertNewAlbum(album.NewAlbumMessage("best", []string{"md5-1", "md5-3"}))
+	for _, r := range d.GetAlbumData("best").Records {
+		if r.Md5sum == "md5-3" && (r.Rating != 5 || r.ColorLabel != "red") {
+			t.Fatalf("expected the curation in the album records, received %v", r)
+		}
+	}
+
+	exported := make(map[string]*BackupPhotoRecord)
+	d.ExportPhotos(func(photo *BackupPhotoRecord) error {
+		exported[photo.Md5sum] = photo
+		return nil
+	})
+	if p := exported["md5-3"]; p == nil || p.Rating != 5 || !p.Favourite || p.ColorLabel != "red" {
+		t.Fatalf("expected the curation in the backup, received %v", p)
+	}
+}
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// date format of the groups and of the date ranges
+const DATE_FORMAT = "2006-01-02"
+
+// exif tags of a date with its sub-second and its offset tags, the libexif titles (local photos)
+// are listed with the exif tag names
+type exifDateTags struct {
+	date   []string
+	subsec []string
+	offset []string
+}
+
+// exif dates read in this order, the first valid one is the date of the photo
+var exifDates = []exifDateTags{
+	{
+		date:   []string{DATEFLICKRTAG, "DateTimeOriginal"},
+		subsec: []string{"Sub-second Time (Original)", "SubSecTimeOriginal"},
+		offset: []string{"Offset Time For DateTimeOriginal", "OffsetTimeOriginal"},
+	},
+	{
+		date:   []string{"Date and Time (Digitized)", "DateTimeDigitized"},
+		subsec: []string{"Sub-second Time (Digitized)", "SubSecTimeDigitized"},
+		offset: []string{"Offset Time For DateTimeDigitized", "OffsetTimeDigitized"},
+	},
+	{
+		date:   []string{"Date and Time", "DateTime"},
+		subsec: []string{"Sub-second Time", "SubSecTime"},
+		offset: []string{"Offset Time For DateTime", "OffsetTime"},
+	},
+}
+
+var exifDateLayouts = []string{"2006:01:02 15:04:05", "2006-01-02 15:04:05", "2006:01:02T15:04:05", "2006-01-02T15:04:05"}
+
+// function returns the first string value of the tags
+func exifValue(exif map[string]interface{}, tags []string) string {
+	for _, tag := range tags {
+		if value, ok := exif[tag].(string); ok && strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// function parses the exif date with its sub-second and offset values, a date without offset
+// keeps the time of the camera
+func parseExifDate(value string, subsec string, offset string) (time.Time, bool) {
+	location := time.UTC
+	if offset != "" {
+		if tm, err := time.Parse("-07:00", offset); err == nil {
+			_, seconds := tm.Zone()
+			location = time.FixedZone(offset, seconds)
+		}
+	}
+	for _, layout := range exifDateLayouts {
+		tm, err := time.ParseInLocation(layout, value, location)
+		if err != nil {
+			continue
+		}
+		if digits, err := strconv.Atoi(subsec); err == nil && digits > 0 {
+			nanoseconds := digits
+			for i := len(subsec); i < 9; i++ {
+				nanoseconds *= 10
+			}
+			tm = tm.Add(time.Duration(nanoseconds))
+		}
+		return tm, true
+	}
+	return time.Time{}, false
+}
+
+// function returns the date the photo was taken from the exif tags (google timestamp, original,
+// digitized then modification date), the modification time of the file (unix seconds) is used
+// if the exif has no valid date. false is returned if no date is known
+func PhotoDate(exif map[string]interface{}, modtime int64) (time.Time, bool) {
+	if v, ok := exif[DATEGOOGLETAG].(string); ok {
+		if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(ms/1000, (ms%1000)*int64(time.Millisecond)), true
+		}
+	}
+	for _, tags := range exifDates {
+		value := exifValue(exif, tags.date)
+		if value == "" {
+			continue
+		}
+		if tm, ok := parseExifDate(value, exifValue(exif, tags.subsec), exifValue(exif, tags.offset)); ok {
+			return tm, true
+		}
+	}
+	if modtime > 0 {
+		return time.Unix(modtime, 0), true
+	}
+	return time.Time{}, false
+}
+
+// function returns true if the groupby is known (day, week, month or year)
+func ValidGroupby(groupby string) bool {
+	for _, g := range statsGroupbys {
+		if g == groupby {
+			return true
+		}
+	}
+	return false
+}
+
+// function returns the first day of the period of the groupby containing the date,
+// the weeks start on monday
+func GroupDate(date time.Time, groupby string) string {
+	switch groupby {
+	case STATS_DAY:
+		return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC).Format(DATE_FORMAT)
+	case STATS_WEEK:
+		day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7)).Format(DATE_FORMAT)
+	case STATS_MONTH:
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC).Format(DATE_FORMAT)
+	case STATS_YEAR:
+		return time.Date(date.Year(), 1, 1, 0, 0, 0, 0, time.UTC).Format(DATE_FORMAT)
+	default:
+		return ""
+	}
+}
+
+// function returns the period of the groupby of the photo, an empty string if the photo has no date
+func photoGroupDate(exif map[string]interface{}, modtime int64, groupby string) string {
+	date, ok := PhotoDate(exif, modtime)
+	if !ok {
+		return ""
+	}
+	return GroupDate(date, groupby)
+}
+
+// function returns the period of the groupby of the exif date, an empty string if the exif has no date
+func ToUnixTime(exif map[string]interface{}, groupby string) string {
+	return photoGroupDate(exif, 0, groupby)
+}
+
+// range of dates of the time queries, the bounds are included and empty for no bound
+type DateRange struct {
+	From string
+	To   string
+}
+
+// function returns the range of the dates from and to (formatted 2006-01-02, may be empty)
+func NewDateRange(from string, to string) (*DateRange, error) {
+	for _, date := range []string{from, to} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(DATE_FORMAT, date); err != nil {
+			return nil, fmt.Errorf("Invalid date %s, expected format is yyyy-mm-dd", date)
+		}
+	}
+	if from != "" && to != "" && from > to {
+		return nil, fmt.Errorf("Invalid range from %s to %s", from, to)
+	}
+	return &DateRange{From: from, To: to}, nil
+}
+
+// function returns true if the range has at least one bound
+func (r *DateRange) bounded() bool {
+	return r != nil && (r.From != "" || r.To != "")
+}
+
+// function returns true if the date (formatted 2006-01-02) is in the range, a nil range contains all the dates
+// and a range with a bound does not contain the empty date
+func (r *DateRange) Contains(date string) bool {
+	if !r.bounded() {
+		return true
+	}
+	if date == "" {
+		return false
+	}
+	return (r.From == "" || date >= r.From) && (r.To == "" || date <= r.To)
+}
+
+// function returns true if the photo is in the period date of the groupby (if date is set) and in the range
+func photoInPeriod(exif map[string]interface{}, modtime int64, queryDate string, groupby string, dates *DateRange) bool {
+	photoDate, ok := PhotoDate(exif, modtime)
+	if queryDate != "" && (!ok || GroupDate(photoDate, groupby) != queryDate) {
+		return false
+	}
+	day := ""
+	if ok {
+		day = GroupDate(photoDate, STATS_DAY)
+	}
+	return dates.Contains(day)
+}
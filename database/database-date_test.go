@@ -0,0 +1,90 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jeromelesaux/photo/modele"
+)
+
+func TestPhotoDate(t *testing.T) {
+	date, ok := PhotoDate(map[string]interface{}{
+		"Date and Time":                    "2016:07:01 08:00:00",
+		"DateTimeOriginal":                 "2016:07:14 23:30:00",
+		"Sub-second Time (Original)":       "25",
+		"Offset Time For DateTimeOriginal": "+02:00"}, 0)
+	if !ok || date.UTC() != time.Date(2016, 7, 14, 21, 30, 0, 250000000, time.UTC) {
+		t.Fatalf("expected the original date with its offset and sub-seconds, received %v", date)
+	}
+	if GroupDate(date, STATS_DAY) != "2016-07-14" {
+		t.Fatalf("the day must be the day of the camera, received %s", GroupDate(date, STATS_DAY))
+	}
+	date, ok = PhotoDate(map[string]interface{}{"Date and Time (Digitized)": "not a date"}, 1468488600)
+	if !ok || date.Unix() != 1468488600 {
+		t.Fatalf("expected the modification time for an invalid exif date, received %v", date)
+	}
+	if _, ok := PhotoDate(nil, 0); ok {
+		t.Fatal("a photo without exif date and modification time has no date")
+	}
+}
+
+func TestGroupDate(t *testing.T) {
+	date := time.Date(2016, 7, 14, 10, 0, 0, 0, time.UTC)
+	for groupby, expected := range map[string]string{STATS_DAY: "2016-07-14", STATS_WEEK: "2016-07-11",
+		STATS_MONTH: "2016-07-01", STATS_YEAR: "2016-01-01"} {
+		if received := GroupDate(date, groupby); received != expected {
+			t.Fatalf("expected %s for %s and received %s", expected, groupby, received)
+		}
+	}
+	if received := GroupDate(time.Date(2016, 7, 17, 10, 0, 0, 0, time.UTC), STATS_WEEK); received != "2016-07-11" {
+		t.Fatalf("sunday must be in the week of the previous monday, received %s", received)
+	}
+}
+
+func TestNewDateRange(t *testing.T) {
+	if _, err := NewDateRange("2016-07", ""); err == nil {
+		t.Fatal("a date must be formatted yyyy-mm-dd")
+	}
+	if _, err := NewDateRange("2016-07-15", "2016-07-14"); err == nil {
+		t.Fatal("from must be before to")
+	}
+	dates, err := NewDateRange("2016-07-14", "")
+	if err != nil || !dates.Contains("2016-07-14") || dates.Contains("2016-07-13") || dates.Contains("") {
+		t.Fatalf("unexpected range %v with error %v", dates, err)
+	}
+}
+
+func TestPhotosFromTime(t *testing.T) {
+	for name, d := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			testPhotosFromTime(t, d)
+		})
+	}
+}
+
+func testPhotosFromTime(t *testing.T, d DatabaseInterface) {
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "a.jpg", Filepath: "/a.jpg", Tags: map[string]string{"DateTimeOriginal": "2016:07:14 10:00:00"}},
+		{Md5Sum: "md5-2", Filename: "b.jpg", Filepath: "/b.jpg", Tags: map[string]string{DATEFLICKRTAG: "2016:08:01 10:00:00"}},
+		// photo without exif date, the modification time is 2016-07-16
+		{Md5Sum: "md5-3", Filename: "c.jpg", Filepath: "/c.jpg", ModTime: time.Date(2016, 7, 16, 12, 0, 0, 0, time.UTC).Unix()},
+	}))
+
+	if records, _ := d.GetPhotosFromTime("2016-07-11", STATS_WEEK, nil); len(records) != 2 {
+		t.Fatalf("expected 2 photos in the week of 2016-07-11, received %d", len(records))
+	}
+	dates, _ := NewDateRange("2016-07-15", "2016-08-31")
+	if records, _ := d.GetPhotosFromTime("2016-07-01", STATS_MONTH, dates); len(records) != 1 || records[0].Md5sum != "md5-3" {
+		t.Fatalf("expected the photo of the 2016-07-16 in the range, received %v", records)
+	}
+	if records, _ := d.GetPhotosFromTime("", "", dates); len(records) != 2 {
+		t.Fatalf("expected 2 photos in the range, received %d", len(records))
+	}
+	months, _ := d.GetTimeStats(STATS_MONTH, dates)
+	if len(months.Stats) != 2 || months.Stats[0].Date != "2016-07-01" || months.Stats[0].Count != 1 {
+		t.Fatalf("expected 1 photo in july and 1 in august, received %v", months.Stats)
+	}
+	if weeks, _ := d.GetTimeStats(STATS_WEEK, nil); len(weeks.Stats) != 2 || weeks.Stats[0].Count != 2 {
+		t.Fatalf("expected 2 weeks, received %v", weeks.Stats)
+	}
+}
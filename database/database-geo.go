@@ -0,0 +1,239 @@
+package database
+
+import (
+	"math"
+	"sort"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/geocoder"
+	"github.com/pkg/errors"
+)
+
+const (
+	// precision of the geohash stored with the photos (cells of about 5 meters)
+	GEOHASH_PRECISION = 9
+	// precision of the geohash cells indexed by tiedot (cells of about 40 km)
+	GEOCELL_PRECISION = 4
+	// maximum number of indexed cells read for an area, larger areas are scanned
+	GEOCELL_MAX = 64
+)
+
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// function returns the geohash of the coordinates with precision characters
+func Geohash(latitude float64, longitude float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lngRange := [2]float64{-180, 180}
+	hash := make([]byte, 0, precision)
+	even := true
+	bit, ch := 0, 0
+	for len(hash) < precision {
+		var value float64
+		var bounds *[2]float64
+		if even {
+			value, bounds = longitude, &lngRange
+		} else {
+			value, bounds = latitude, &latRange
+		}
+		middle := (bounds[0] + bounds[1]) / 2
+		ch <<= 1
+		if value >= middle {
+			ch |= 1
+			bounds[0] = middle
+		} else {
+			bounds[1] = middle
+		}
+		even = !even
+		if bit++; bit == 5 {
+			hash = append(hash, geohashBase32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
+
+// function returns the size in degrees (latitude, longitude) of the geohash cells of the precision
+func geohashCellSize(precision int) (float64, float64) {
+	bits := 5 * precision
+	lngBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Pow(2, float64(latBits)), 360 / math.Pow(2, float64(lngBits))
+}
+
+// function returns the geohash of the photo exif, an empty string if the photo is not located
+func photoGeohash(exif map[string]interface{}) string {
+	latitude, longitude := ExifCoordinates(exif)
+	if latitude == 0. && longitude == 0. {
+		return ""
+	}
+	return Geohash(latitude, longitude, GEOHASH_PRECISION)
+}
+
+// area of the geographic queries, a bounding box (west greater than east crosses the antimeridian)
+// and optionally the circle of radius meters around the center
+type GeoArea struct {
+	North     float64 `json:"north"`
+	South     float64 `json:"south"`
+	East      float64 `json:"east"`
+	West      float64 `json:"west"`
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	Radius    float64 `json:"radius,omitempty"`
+}
+
+// function returns the area of the bounding box
+func NewBoundingBox(north float64, south float64, east float64, west float64) (*GeoArea, error) {
+	if north < south || north > 90 || south < -90 {
+		return nil, errors.New("Invalid latitudes of the bounding box")
+	}
+	if east < -180 || east > 180 || west < -180 || west > 180 {
+		return nil, errors.New("Invalid longitudes of the bounding box")
+	}
+	return &GeoArea{North: north, South: south, East: east, West: west}, nil
+}
+
+// function returns the area of the circle of radius meters around the coordinates
+func NewRadiusArea(latitude float64, longitude float64, radius float64) (*GeoArea, error) {
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return nil, errors.New("Invalid coordinates of the center")
+	}
+	if radius <= 0 {
+		return nil, errors.New("The radius must be positive")
+	}
+	a := &GeoArea{Latitude: latitude, Longitude: longitude, Radius: radius, West: -180, East: 180}
+	delta := radius / geocoder.EARTH_RADIUS * 180 / math.Pi
+	a.North = math.Min(90, latitude+delta)
+	a.South = math.Max(-90, latitude-delta)
+	if a.North < 90 && a.South > -90 {
+		lngDelta := delta / math.Cos(latitude*math.Pi/180)
+		if lngDelta < 180 {
+			a.West = normalizeLongitude(longitude - lngDelta)
+			a.East = normalizeLongitude(longitude + lngDelta)
+		}
+	}
+	return a, nil
+}
+
+func normalizeLongitude(longitude float64) float64 {
+	if longitude < -180 {
+		return longitude + 360
+	}
+	if longitude > 180 {
+		return longitude - 360
+	}
+	return longitude
+}
+
+// function returns the distance in meters between two coordinates
+func Distance(lat1 float64, lng1 float64, lat2 float64, lng2 float64) float64 {
+	return geocoder.Distance(lat1, lng1, lat2, lng2)
+}
+
+// function returns the longitude ranges of the area, two ranges if the area crosses the antimeridian
+func (a *GeoArea) longitudes() [][2]float64 {
+	if a.West <= a.East {
+		return [][2]float64{{a.West, a.East}}
+	}
+	return [][2]float64{{a.West, 180}, {-180, a.East}}
+}
+
+// function returns true if the coordinates are in the area, a nil area contains all the coordinates
+func (a *GeoArea) Contains(latitude float64, longitude float64) bool {
+	if a == nil {
+		return true
+	}
+	if latitude < a.South || latitude > a.North {
+		return false
+	}
+	inside := false
+	for _, lng := range a.longitudes() {
+		if longitude >= lng[0] && longitude <= lng[1] {
+			inside = true
+		}
+	}
+	if !inside {
+		return false
+	}
+	return a.Radius == 0 || Distance(a.Latitude, a.Longitude, latitude, longitude) <= a.Radius
+}
+
+// function returns the geohash cells of the precision covering the area,
+// false if more than max cells are needed
+func (a *GeoArea) geohashCells(precision int, max int) ([]string, bool) {
+	height, width := geohashCellSize(precision)
+	cells := make(map[string]bool)
+	for _, lng := range a.longitudes() {
+		for lat := math.Floor(a.South/height) * height; lat <= a.North; lat += height {
+			for lon := math.Floor(lng[0]/width) * width; lon <= lng[1]; lon += width {
+				cells[Geohash(math.Min(lat+height/2, 90), math.Min(lon+width/2, 180), precision)] = true
+				if len(cells) > max {
+					return nil, false
+				}
+			}
+		}
+	}
+	result := make([]string, 0, len(cells))
+	for cell := range cells {
+		result = append(result, cell)
+	}
+	sort.Strings(result)
+	return result, true
+}
+
+// function returns the precision of the geohash cells of the clusters for the zoom level of the map (0 to 21)
+func ClusterPrecision(zoom int) int {
+	switch {
+	case zoom <= 2:
+		return 1
+	case zoom <= 4:
+		return 2
+	case zoom <= 7:
+		return 3
+	case zoom <= 9:
+		return 4
+	case zoom <= 12:
+		return 5
+	case zoom <= 14:
+		return 6
+	case zoom <= 17:
+		return 7
+	default:
+		return 8
+	}
+}
+
+// clusters of the photos by geohash cell of the zoom precision
+type geoClusters struct {
+	precision int
+	clusters  map[string]*album.LocationClusterMessage
+}
+
+func newGeoClusters(zoom int) *geoClusters {
+	return &geoClusters{precision: ClusterPrecision(zoom), clusters: make(map[string]*album.LocationClusterMessage)}
+}
+
+// function adds the photo located at the coordinates to its cluster
+func (g *geoClusters) add(latitude float64, longitude float64) {
+	hash := Geohash(latitude, longitude, g.precision)
+	c, ok := g.clusters[hash]
+	if !ok {
+		c = &album.LocationClusterMessage{Geohash: hash, North: latitude, South: latitude, East: longitude, West: longitude}
+		g.clusters[hash] = c
+	}
+	// the centroid is the mean of the coordinates of the photos
+	c.Latitude = (c.Latitude*float64(c.Count) + latitude) / float64(c.Count+1)
+	c.Longitude = (c.Longitude*float64(c.Count) + longitude) / float64(c.Count+1)
+	c.Count++
+	c.North, c.South = math.Max(c.North, latitude), math.Min(c.South, latitude)
+	c.East, c.West = math.Max(c.East, longitude), math.Min(c.West, longitude)
+}
+
+// function returns the clusters sorted by geohash
+func (g *geoClusters) message(zoom int) *album.LocationClustersMessage {
+	response := album.NewLocationClustersMessage(zoom)
+	for _, c := range g.clusters {
+		response.Clusters = append(response.Clusters, c)
+	}
+	sort.Slice(response.Clusters, func(i, j int) bool { return response.Clusters[i].Geohash < response.Clusters[j].Geohash })
+	return response
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/jeromelesaux/photo/modele"
+)
+
+func TestGeohash(t *testing.T) {
+	if hash := Geohash(42.6, -5.6, 5); hash != "ezs42" {
+		t.Fatalf("expected geohash ezs42 and received %s", hash)
+	}
+	if hash := Geohash(48.8584, 2.2945, GEOHASH_PRECISION); len(hash) != GEOHASH_PRECISION || hash[:3] != "u09" {
+		t.Fatalf("expected a geohash of Paris starting by u09 and received %s", hash)
+	}
+}
+
+func TestGeoArea(t *testing.T) {
+	area, err := NewRadiusArea(48.8584, 2.2945, 2000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if area.Contains(48.8606, 2.3376) || area.Contains(48.8049, 2.1204) {
+		t.Fatal("the Louvre is 3 km from the Eiffel tower and Versailles 14 km")
+	}
+	if !area.Contains(48.8738, 2.2950) {
+		t.Fatal("the Arc de Triomphe is 1.7 km from the Eiffel tower")
+	}
+	pacific, _ := NewBoundingBox(10, -10, -170, 170)
+	if !pacific.Contains(0, 179) || !pacific.Contains(0, -179) || pacific.Contains(0, 0) {
+		t.Fatal("the bounding box must cross the antimeridian")
+	}
+	if _, err := NewBoundingBox(10, 20, 0, 0); err == nil {
+		t.Fatal("north must be greater than south")
+	}
+	if cells, ok := area.geohashCells(GEOCELL_PRECISION, GEOCELL_MAX); !ok || len(cells) == 0 || len(cells) > 4 {
+		t.Fatalf("the circle must be covered by a few cells, received %v", cells)
+	}
+	world, _ := NewBoundingBox(90, -90, 180, -180)
+	if _, ok := world.geohashCells(GEOCELL_PRECISION, GEOCELL_MAX); ok {
+		t.Fatal("the world must not be read by cells")
+	}
+}
+
+func TestPhotosFromArea(t *testing.T) {
+	databases := testDatabases(t)
+
+	for name, d := range databases {
+		t.Run(name, func(t *testing.T) {
+			testPhotosFromArea(t, d)
+		})
+	}
+
+	// the photos stored before the geohash column are located at startup
+	sqlite := databases["sqlite"].(*SqliteDatabaseHandler)
+	sqlite.DBConnection.Exec("UPDATE photos SET latitude = NULL, longitude = NULL, geohash = NULL")
+	if err := sqlite.migrateGeohash(); err != nil {
+		t.Fatal(err)
+	}
+	area, _ := NewRadiusArea(48.8584, 2.2945, 2000)
+	if records, _ := sqlite.GetPhotosFromArea(area); len(records) != 2 {
+		t.Fatalf("expected 2 photos after the migration, received %d", len(records))
+	}
+}
+
+func located(latitude string, longitude string) map[string]string {
+	return map[string]string{LATITUDEGOOGLETAG: latitude, LONGITUDEGOOGLETAG: longitude}
+}
+
+func testPhotosFromArea(t *testing.T, d DatabaseInterface) {
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "eiffel.jpg", Filepath: "/eiffel.jpg", Tags: located("48.8584", "2.2945")},
+		{Md5Sum: "md5-2", Filename: "arc.jpg", Filepath: "/arc.jpg", Tags: located("48.8738", "2.2950")},
+		{Md5Sum: "md5-3", Filename: "versailles.jpg", Filepath: "/versailles.jpg", Tags: located("48.8049", "2.1204")},
+		{Md5Sum: "md5-4", Filename: "tokyo.jpg", Filepath: "/tokyo.jpg", Tags: located("35.6586", "139.7454")},
+		{Md5Sum: "md5-5", Filename: "nowhere.jpg", Filepath: "/nowhere.jpg"},
+	}))
+
+	area, _ := NewRadiusArea(48.8584, 2.2945, 2000)
+	if records, _ := d.GetPhotosFromArea(area); len(records) != 2 {
+		t.Fatalf("expected 2 photos around the Eiffel tower, received %d", len(records))
+	}
+	ile, _ := NewBoundingBox(49.2, 48.1, 3.5, 1.4)
+	if records, _ := d.GetPhotosFromArea(ile); len(records) != 3 {
+		t.Fatalf("expected 3 photos in Ile-de-France, received %d", len(records))
+	}
+	world, _ := NewBoundingBox(90, -90, 180, -180)
+	if records, _ := d.GetPhotosFromArea(world); len(records) != 4 {
+		t.Fatalf("expected the 4 located photos, received %d", len(records))
+	}
+
+	clusters, _ := d.GetLocationClusters(2, nil)
+	if len(clusters.Clusters) != 2 || clusters.Clusters[0].Count != 3 {
+		t.Fatalf("expected the clusters of Paris and of Tokyo, received %v", clusters.Clusters)
+	}
+	paris := clusters.Clusters[0]
+	cluster, _ := NewBoundingBox(paris.North, paris.South, paris.East, paris.West)
+	if records, _ := d.GetPhotosFromArea(cluster); len(records) != paris.Count {
+		t.Fatalf("the area of the cluster must contain its %d photos, received %d", paris.Count, len(records))
+	}
+	if clusters, _ := d.GetLocationClusters(12, ile); len(clusters.Clusters) != 3 {
+		t.Fatalf("expected 3 clusters in Ile-de-France at zoom 12, received %v", clusters.Clusters)
+	}
+}
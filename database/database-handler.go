@@ -1,6 +1,7 @@
 package database
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -14,7 +15,7 @@ import (
 	"github.com/jeromelesaux/photo/album"
 	"github.com/jeromelesaux/photo/configurationapp"
 	"github.com/jeromelesaux/photo/modele"
-	"github.com/jeromelesaux/photo/slavehandler"
+	"github.com/jeromelesaux/photo/query"
 	"github.com/pkg/errors"
 	logger "github.com/sirupsen/logrus"
 )
@@ -24,6 +25,7 @@ var globalDBConnection *db.DB
 
 type DatabaseHandler struct {
 	DBConnection *db.DB
+	Thumbnails   *ThumbnailStore
 }
 
 func (d *DatabaseHandler) Close() error {
@@ -42,6 +44,19 @@ func NewDatabaseHandler() (*DatabaseHandler, error) {
 		if err = databaseTiedotHandler.createIndexes(); err != nil {
 			return
 		}
+		if err = databaseTiedotHandler.migrateThumbnails(); err != nil {
+			return
+		}
+		if err = databaseTiedotHandler.migrateGeohash(); err != nil {
+			return
+		}
+		if err = databaseTiedotHandler.updatePlaces(false); err != nil {
+			return
+		}
+		if err = databaseTiedotHandler.migrateCuration(); err != nil {
+			return
+		}
+		err = databaseTiedotHandler.migrateStats()
 	})
 
 	return databaseTiedotHandler, err
@@ -58,6 +73,9 @@ var (
 const (
 	DBPHOTO_COLLECTION      = "photos_collection"
 	DBALBUM_COLLECTION      = "albums_collection"
+	DBSTATS_COLLECTION      = "stats_collection"
+	DBKEYWORDS_COLLECTION   = "keywords_collection"
+	DBSHARES_COLLECTION     = "shares_collection"
 	MACHINEID_INDEX         = "MachineId"
 	FILENAME_INDEX          = "Filename"
 	FILENAMES_INDEX         = "Filenames"
@@ -66,9 +84,20 @@ const (
 	MD5SUM_INDEX            = "Md5sum"
 	FILETYPE_INDEX          = "Type"
 	THUMBNAIL_INDEX         = "Thumbnail"
+	THUMBNAILID_INDEX       = "ThumbnailId"
+	THUMBNAILSIZE_INDEX     = "ThumbnailSize"
 	ALBUM_INDEX             = "Album"
 	ALBUM_ITEMS             = "Album_Items"
 	ALBUM_DESCRIPTION       = "Album_Description"
+	ALBUM_QUERY             = "Album_Query"
+	ALBUM_PARENT            = "Album_Parent"
+	ALBUM_COVER             = "Album_Cover"
+	ALBUM_OWNER             = "Album_Owner"
+	SHARE_TOKEN             = "Token"
+	SHARE_EXPIRES           = "Expires"
+	SHARE_PASSWORD          = "Password"
+	SHARE_DOWNLOAD          = "Download"
+	SHARE_CREATED           = "Created"
 	EXIFTAGS_INDEX          = ""
 	LONGITUDEGOOGLETAG      = "longitude"
 	LATITUDEGOOGLETAG       = "latitude"
@@ -83,13 +112,33 @@ const (
 	DATEFLICKRTAG           = "Date and Time (Original)"
 	DATEGOOGLETAG           = "timestamp"
 	ALBUM_TAGS              = "Album tags"
+	SIZE_INDEX              = "Size"
+	IMPORTTIME_INDEX        = "ImportTime"
+	MODTIME_INDEX           = "ModTime"
+	GEOHASH_INDEX           = "Geohash"
+	GEOCELL_INDEX           = "Geocell"
+	CITY_INDEX              = "City"
+	REGION_INDEX            = "Region"
+	COUNTRY_INDEX           = "Country"
+	KEYWORDS_INDEX          = "Keywords"
+	RATING_INDEX            = "Rating"
+	FAVOURITE_INDEX         = "Favourite"
+	COLORLABEL_INDEX        = "ColorLabel"
+	LOCATIONS_INDEX         = "Locations"
+	STATS_KEY_INDEX         = "Key"
+	STATS_GROUPBY           = "Groupby"
+	STATS_DATE              = "Date"
+	STATS_LATITUDE          = "Latitude"
+	STATS_LONGITUDE         = "Longitude"
+	STATS_COUNT             = "Count"
+	// key of the document of the stats version, the stats of a previous version are computed again
+	STATS_VERSION_KEY = "version"
+	STATS_VERSION     = 2
 )
 
 func (d *DatabaseHandler) openDB() error {
 	var err error
 
-	collectionExists := false
-	albumExists := false
 	databasePath := configurationapp.GetConfiguration().DatabasePath
 	if databasePath == "" {
 		err = errors.New("No database path defined")
@@ -103,7 +152,16 @@ func (d *DatabaseHandler) openDB() error {
 		}
 	}
 	d.DBConnection = globalDBConnection
+	d.Thumbnails = NewThumbnailStore(databasePath)
+	return d.createCollections()
+}
+
+// function creates the collections missing in the database
+func (d *DatabaseHandler) createCollections() error {
+	var err error
 
+	collectionExists := false
+	albumExists := false
 	for _, colname := range d.DBConnection.AllCols() {
 		if colname == DBPHOTO_COLLECTION {
 			collectionExists = true
@@ -136,6 +194,42 @@ func (d *DatabaseHandler) openDB() error {
 		}
 	}
 
+	statsExists := false
+	keywordsExists := false
+	sharesExists := false
+	for _, colname := range d.DBConnection.AllCols() {
+		if colname == DBSTATS_COLLECTION {
+			statsExists = true
+		}
+		if colname == DBKEYWORDS_COLLECTION {
+			keywordsExists = true
+		}
+		if colname == DBSHARES_COLLECTION {
+			sharesExists = true
+		}
+	}
+	if !statsExists {
+		if err = d.DBConnection.Create(DBSTATS_COLLECTION); err != nil {
+			logger.Error("Error while creating collection stats_collection with error : " + err.Error())
+			return err
+		}
+		logger.Info("Creating collection " + DBSTATS_COLLECTION)
+	}
+	if !keywordsExists {
+		if err = d.DBConnection.Create(DBKEYWORDS_COLLECTION); err != nil {
+			logger.Error("Error while creating collection keywords_collection with error : " + err.Error())
+			return err
+		}
+		logger.Info("Creating collection " + DBKEYWORDS_COLLECTION)
+	}
+	if !sharesExists {
+		if err = d.DBConnection.Create(DBSHARES_COLLECTION); err != nil {
+			logger.Error("Error while creating collection shares_collection with error : " + err.Error())
+			return err
+		}
+		logger.Info("Creating collection " + DBSHARES_COLLECTION)
+	}
+
 	return err
 }
 
@@ -173,6 +267,9 @@ func (d *DatabaseHandler) createIndexes() error {
 	if err = feedsPhoto.Index([]string{FILENAME_INDEX, FILEPATH_INDEX, FILETYPE_INDEX}); err != nil {
 		logger.Errorf("Error while indexing Filename,Filepath,Type with error : %v", err.Error())
 	}
+	if err = feedsPhoto.Index([]string{GEOCELL_INDEX}); err != nil {
+		logger.Errorf("Error while indexing Geocell with error : %v", err.Error())
+	}
 
 	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
 	if err = feedsAlbum.Index([]string{ALBUM_INDEX}); err != nil {
@@ -184,6 +281,22 @@ func (d *DatabaseHandler) createIndexes() error {
 	if err = feedsAlbum.Index([]string{ALBUM_INDEX, ALBUM_TAGS}); err != nil {
 		logger.Errorf("Error while indexing Albums tags with error %v", err)
 	}
+	if err = feedsAlbum.Index([]string{ALBUM_PARENT}); err != nil {
+		logger.Errorf("Error while indexing Albums parent with error %v", err)
+	}
+
+	feedsStats := d.DBConnection.Use(DBSTATS_COLLECTION)
+	if err = feedsStats.Index([]string{STATS_KEY_INDEX}); err != nil {
+		logger.Errorf("Error while indexing stats key with error %v", err)
+	}
+
+	feedsKeywords := d.DBConnection.Use(DBKEYWORDS_COLLECTION)
+	if err = feedsKeywords.Index([]string{MD5SUM_INDEX}); err != nil {
+		logger.Errorf("Error while indexing keywords md5sum with error %v", err)
+	}
+	if err = feedsKeywords.Index([]string{KEYWORDS_INDEX}); err != nil {
+		logger.Errorf("Error while indexing keywords with error %v", err)
+	}
 
 	return nil
 }
@@ -202,42 +315,6 @@ func Round(val float64, roundOn float64, places int) (newVal float64) {
 	return
 }
 
-func ToUnixTime(exif map[string]interface{}, groupby string) string {
-	if exif[DATEGOOGLETAG] != nil {
-		v, err := strconv.ParseInt(exif[DATEGOOGLETAG].(string), 10, 64)
-		if err != nil {
-			logger.Errorf("Error while parsing date %s, with error %v", exif[DATEGOOGLETAG].(string), err)
-			return ""
-		}
-		tm := time.Unix((v / 1000), 0)
-		switch groupby {
-		case "month":
-			return time.Date(tm.Year(), tm.Month(), 0, 0, 0, 0, 0, tm.Location()).Format("2006-01-02")
-		case "year":
-			return time.Date(tm.Year(), 0, 0, 0, 0, 0, 0, tm.Location()).Format("2006-01-02")
-		default:
-			return ""
-		}
-	} else {
-		if exif[DATEFLICKRTAG] != nil {
-			tm, err := time.Parse("2006:01:02 15:04:05", exif[DATEFLICKRTAG].(string))
-			if err != nil {
-				logger.Errorf("Error while parsing date %s, with error %v", exif[DATEFLICKRTAG].(string), err)
-				return ""
-			}
-			switch groupby {
-			case "month":
-				return time.Date(tm.Year(), tm.Month(), 0, 0, 0, 0, 0, tm.Location()).Format("2006-01-02")
-			case "year":
-				return time.Date(tm.Year(), 0, 0, 0, 0, 0, 0, tm.Location()).Format("2006-01-02")
-			default:
-				return ""
-			}
-		}
-	}
-	return ""
-}
-
 func SplitAll(pattern string) []string {
 	var result []string
 	patternupper := strings.ToUpper(pattern)
@@ -260,12 +337,28 @@ func SplitAll(pattern string) []string {
 	return result
 }
 
+// function returns the coordinates of the exif rounded to 2 decimals, 0, 0 if the photo is not located
 func CoordinatesFromExif(exif map[string]interface{}) (float64, float64) {
+	return coordinatesFromExif(exif, true)
+}
+
+// function returns the coordinates of the exif without rounding, 0, 0 if the photo is not located
+func ExifCoordinates(exif map[string]interface{}) (float64, float64) {
+	return coordinatesFromExif(exif, false)
+}
+
+func coordinatesFromExif(exif map[string]interface{}, rounded bool) (float64, float64) {
+	round := func(val float64) float64 {
+		if !rounded {
+			return val
+		}
+		return Round(val, .5, 2)
+	}
 
 	if exif[LONGITUDEGOOGLETAG] != nil && exif[LATITUDEGOOGLETAG] != nil {
 		longitude, _ := strconv.ParseFloat(exif[LONGITUDEGOOGLETAG].(string), 64)
 		latitude, _ := strconv.ParseFloat(exif[LATITUDEGOOGLETAG].(string), 64)
-		return Round(latitude, .5, 2), Round(longitude, .5, 2)
+		return round(latitude), round(longitude)
 	} else {
 		if exif[LONGITUDEFLICKRTAG] != nil && exif[LATITUDEFLICKRTAG] != nil {
 			var d, m, s float64
@@ -274,13 +367,13 @@ func CoordinatesFromExif(exif map[string]interface{}) (float64, float64) {
 			if err != nil {
 				logger.Errorf("Error while parsing flickr Latitude string %s %v ", exif[LATITUDEFLICKRTAG].(string), err)
 			} else {
-				latitude = Round(d+(m/60)+(s/3600), .5, 2)
+				latitude = round(d + (m / 60) + (s / 3600))
 			}
 			_, err = fmt.Sscanf(exif[LONGITUDEFLICKRTAG].(string), "%f deg %f' %f", &d, &m, &s)
 			if err != nil {
 				logger.Errorf("Error while parsing flickr Longitude string %s %v", exif[LONGITUDEFLICKRTAG].(string), err)
 			} else {
-				longitude = Round(d+(m/60)+(s/3600), .5, 2)
+				longitude = round(d + (m / 60) + (s / 3600))
 			}
 			if exif[LATITUDEREFFLICKTAG].(string) == "South" {
 				latitude *= -1
@@ -288,7 +381,7 @@ func CoordinatesFromExif(exif map[string]interface{}) (float64, float64) {
 			if exif[LONGITUDEREFFLICKTAG].(string) == "West" {
 				longitude *= -1
 			}
-			return Round(latitude, .5, 2), Round(longitude, .5, 2)
+			return round(latitude), round(longitude)
 		} else {
 			if exif[LONGITUDEEXIFTOOLTAG] != nil && exif[LATITUDEEXIFTOOLTAG] != nil {
 				var d, m, s float64
@@ -297,13 +390,13 @@ func CoordinatesFromExif(exif map[string]interface{}) (float64, float64) {
 				if err != nil {
 					logger.Errorf("Error while parsing flickr Latitude string %s %v ", exif[LATITUDEEXIFTOOLTAG].(string), err)
 				} else {
-					latitude = Round(d+(m/60)+(s/3600), .5, 2)
+					latitude = round(d + (m / 60) + (s / 3600))
 				}
 				_, err = fmt.Sscanf(exif[LONGITUDEEXIFTOOLTAG].(string), "%f, %f, %f", &d, &m, &s)
 				if err != nil {
 					logger.Errorf("Error while parsing flickr Longitude string %s %v", exif[LONGITUDEEXIFTOOLTAG].(string), err)
 				} else {
-					longitude = Round(d+(m/60)+(s/3600), .5, 2)
+					longitude = round(d + (m / 60) + (s / 3600))
 				}
 				if exif[LATITUDEREFEXIFTOOLTAG].(string) == "S" {
 					latitude *= -1
@@ -311,7 +404,7 @@ func CoordinatesFromExif(exif map[string]interface{}) (float64, float64) {
 				if exif[LONGITUDEREFEXIFTOOLTAG].(string) == "W" {
 					longitude *= -1
 				}
-				return Round(latitude, .5, 2), Round(longitude, .5, 2)
+				return round(latitude), round(longitude)
 			}
 		}
 	}
@@ -322,11 +415,10 @@ func (d *DatabaseHandler) QueryByTag(tag string) ([]*DatabasePhotoRecord, error)
 	response := make([]*DatabasePhotoRecord, 0)
 
 	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
-	queryResult := make(map[int]struct{})
-	var query interface{}
-	json.Unmarshal([]byte(`["all"]`), &query)
-	logger.Info(query)
-	if err := db.EvalQuery(query, feedsAlbum, &queryResult); err != nil {
+	q := query.All()
+	logger.Info(q)
+	queryResult, err := query.Eval(q, feedsAlbum)
+	if err != nil {
 		logger.Error("Error while querying with error :" + err.Error())
 		return response, err
 	}
@@ -358,18 +450,17 @@ func (d *DatabaseHandler) QueryByTag(tag string) ([]*DatabasePhotoRecord, error)
 		}
 	}
 
-	return response, nil
+	return appendKeywordPhotos(d, response, tag)
 }
 
 func (d *DatabaseHandler) GetOriginStats() (*album.OriginStatsMessage, error) {
 	o := album.NewOriginStatsMessage()
 
 	feedsCollection := d.DBConnection.Use(DBPHOTO_COLLECTION)
-	queryResult := make(map[int]struct{})
-	var query interface{}
-	json.Unmarshal([]byte(`["all"]`), &query)
-	logger.Info(query)
-	if err := db.EvalQuery(query, feedsCollection, &queryResult); err != nil {
+	q := query.All()
+	logger.Info(q)
+	queryResult, err := query.Eval(q, feedsCollection)
+	if err != nil {
 		logger.Error("Error while querying with error :" + err.Error())
 	}
 	for id := range queryResult {
@@ -390,117 +481,77 @@ func (d *DatabaseHandler) GetPhotosUrl(md5sums []string) ([]*DatabasePhotoRecord
 
 	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
 
-	for _, m := range md5sums {
-		queryResult := make(map[int]struct{})
-		var query interface{}
-		json.Unmarshal([]byte(`[{"eq": "`+m+`", "in": ["`+MD5SUM_INDEX+`"]}]`), &query)
-		logger.Info(query)
-		if err := db.EvalQuery(query, feeds, &queryResult); err != nil {
-			logger.Error("Error while querying with error :" + err.Error())
-		}
-		for id := range queryResult {
-			readBack, err := feeds.Read(id)
-			if err != nil {
-				logger.Errorf("Error while retrieving id %d by md5sum with error : %v", id, err.Error())
-			} else {
-				logger.Debug(readBack)
-			}
-			origin := readBack[MACHINEID_INDEX].(string)
-			filepath := readBack[FILEPATH_INDEX].(string)
-			if origin != modele.ORIGIN_FLICKR && origin != modele.ORIGIN_GOOGLE {
-				filepath = fmt.Sprintf("/photo?filepath=%s&machineid=%s", readBack[FILEPATH_INDEX].(string), origin)
-			}
-			response = append(response, NewDatabasePhotoResponse(
-				readBack[MD5SUM_INDEX].(string),
-				readBack[FILENAME_INDEX].(string),
-				filepath,
-				readBack[MACHINEID_INDEX].(string),
-				"",
-				nil))
-		}
-	}
-	return Reduce(response, ""), nil
-}
-
-func (d *DatabaseHandler) GetPhotosFromTime(queryDate string, groupby string) ([]*DatabasePhotoRecord, error) {
-	response := make([]*DatabasePhotoRecord, 0)
-
-	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
-	queryResult := make(map[int]struct{})
-	var query interface{}
-	json.Unmarshal([]byte(`["all"]`), &query)
-	logger.Info(query)
-	if err := db.EvalQuery(query, feeds, &queryResult); err != nil {
+	q := query.In(MD5SUM_INDEX, md5sums...)
+	logger.Info(q)
+	queryResult, err := query.Eval(q, feeds)
+	if err != nil {
 		logger.Error("Error while querying with error :" + err.Error())
 	}
 	for id := range queryResult {
 		readBack, err := feeds.Read(id)
 		if err != nil {
-			logger.Errorf("Error while retrieving id %d with error : %v", id, err.Error())
-		} else {
-			logger.Debug(readBack)
-		}
-		var exif map[string]interface{}
-		if readBack[EXIFTAGS_INDEX] != nil {
-			exif = readBack[EXIFTAGS_INDEX].(map[string]interface{})
-			photoDate := ToUnixTime(exif, groupby)
-			if photoDate == queryDate {
-				origin := readBack[MACHINEID_INDEX].(string)
-				filepath := readBack[FILEPATH_INDEX].(string)
-				if origin != modele.ORIGIN_FLICKR && origin != modele.ORIGIN_GOOGLE {
-					filepath = fmt.Sprintf("/photo?filepath=%s&machineid=%s", readBack[FILEPATH_INDEX].(string), origin)
-				}
-				response = append(response, NewDatabasePhotoResponse(
-					readBack[MD5SUM_INDEX].(string),
-					readBack[FILENAME_INDEX].(string),
-					filepath,
-					readBack[MACHINEID_INDEX].(string),
-					readBack[THUMBNAIL_INDEX].(string),
-					exif))
-			}
+			logger.Errorf("Error while retrieving id %d by md5sum with error : %v", id, err.Error())
+			continue
 		}
-
-	}
+		logger.Debug(readBack)
+		record := NewDatabasePhotoResponse(
+			readBack[MD5SUM_INDEX].(string),
+			readBack[FILENAME_INDEX].(string),
+			photoUri(readBack[MD5SUM_INDEX].(string), readBack[MACHINEID_INDEX].(string), readBack[FILEPATH_INDEX].(string)),
+			readBack[MACHINEID_INDEX].(string),
+			"",
+			nil)
+		record.Locations = documentLocations(readBack)
+		response = append(response, record)
+	}
+	response = Reduce(response, "")
+	SortRecords(response, md5sums)
 	return response, nil
 }
 
-func (d *DatabaseHandler) GetTimeStats(groupby string) (*album.TimeStatsMessage, error) {
-	response := album.NewTimeStatsMessage()
-
+// function returns the photos of the period queryDate of the groupby (all the periods if queryDate is empty)
+// taken in the range of dates
+func (d *DatabaseHandler) GetPhotosFromTime(queryDate string, groupby string, dates *DateRange) ([]*DatabasePhotoRecord, error) {
+	response := make([]*DatabasePhotoRecord, 0)
 	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
-	queryResult := make(map[int]struct{})
-	var query interface{}
-	json.Unmarshal([]byte(`["all"]`), &query)
-	logger.Info(query)
-	if err := db.EvalQuery(query, feeds, &queryResult); err != nil {
-		logger.Error("Error while querying with error :" + err.Error())
-	}
-	for id := range queryResult {
-		readBack, err := feeds.Read(id)
-		if err != nil {
-			logger.Errorf("Error while retreiveing id %d with error : %v", id, err.Error())
-		} else {
-			logger.Debug(readBack)
+	feeds.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		var a map[string]interface{}
+		if err := json.Unmarshal(docContent, &a); err != nil {
+			logger.Error("Error while unmarshalling document with error : " + err.Error())
+			return true
 		}
-		var exif map[string]interface{}
-		if readBack[EXIFTAGS_INDEX] != nil {
-			exif = readBack[EXIFTAGS_INDEX].(map[string]interface{})
-			timeStat := &album.TimeStatMessage{Date: ToUnixTime(exif, groupby), Count: 1}
-			var found = false
-			for _, v := range response.Stats {
-				if v.Date == timeStat.Date {
-					found = true
-					v.Count++
-					break
-				}
-			}
-			if !found {
-				response.Stats = append(response.Stats, timeStat)
-			}
+		if photoInPeriod(documentExif(a), documentInt(a, MODTIME_INDEX), queryDate, groupby, dates) {
+			response = append(response, documentRecord(a))
 		}
+		return true
+	})
+	return response, nil
+}
 
+// function returns the number of photos by date of the groupby (day, week, month or year) from the stats counters,
+// only the photos taken in the range of dates are counted
+func (d *DatabaseHandler) GetTimeStats(groupby string, dates *DateRange) (*album.TimeStatsMessage, error) {
+	if dates.bounded() {
+		days, err := d.GetTimeStats(STATS_DAY, nil)
+		if err != nil {
+			return days, err
+		}
+		return rangeTimeStats(days, groupby, dates), nil
 	}
-
+	response := album.NewTimeStatsMessage()
+	feeds := d.DBConnection.Use(DBSTATS_COLLECTION)
+	feeds.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		var a map[string]interface{}
+		if err := json.Unmarshal(docContent, &a); err != nil {
+			logger.Error("Error while unmarshalling document with error : " + err.Error())
+			return true
+		}
+		if documentString(a, STATS_GROUPBY) == groupby && documentInt(a, STATS_COUNT) > 0 {
+			response.Stats = append(response.Stats, &album.TimeStatMessage{Date: documentString(a, STATS_DATE), Count: int(documentInt(a, STATS_COUNT))})
+		}
+		return true
+	})
+	sortTimeStats(response)
 	return response, nil
 }
 
@@ -510,11 +561,10 @@ func (d *DatabaseHandler) GetPhotosFromCoordinates(lat, lng string) ([]*Database
 	response := make([]*DatabasePhotoRecord, 0)
 
 	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
-	queryResult := make(map[int]struct{})
-	var query interface{}
-	json.Unmarshal([]byte(`["all"]`), &query)
-	logger.Info(query)
-	if err := db.EvalQuery(query, feeds, &queryResult); err != nil {
+	q := query.All()
+	logger.Info(q)
+	queryResult, err := query.Eval(q, feeds)
+	if err != nil {
 		logger.Error("Error while querying with error :" + err.Error())
 	}
 	for id := range queryResult {
@@ -528,18 +578,7 @@ func (d *DatabaseHandler) GetPhotosFromCoordinates(lat, lng string) ([]*Database
 				exif = readBack[EXIFTAGS_INDEX].(map[string]interface{})
 				latitude, longitude := CoordinatesFromExif(exif)
 				if Round(longitude, .5, 2) == qlongitude && Round(latitude, .5, 2) == qlatitude {
-					origin := readBack[MACHINEID_INDEX].(string)
-					filepath := readBack[FILEPATH_INDEX].(string)
-					if origin != modele.ORIGIN_FLICKR && origin != modele.ORIGIN_GOOGLE {
-						filepath = fmt.Sprintf("/photo?filepath=%s&machineid=%s", readBack[FILEPATH_INDEX].(string), origin)
-					}
-					response = append(response, NewDatabasePhotoResponse(
-						readBack[MD5SUM_INDEX].(string),
-						readBack[FILENAME_INDEX].(string),
-						filepath,
-						readBack[MACHINEID_INDEX].(string),
-						readBack[THUMBNAIL_INDEX].(string),
-						exif))
+					response = append(response, documentRecord(readBack))
 				}
 			}
 		}
@@ -548,125 +587,530 @@ func (d *DatabaseHandler) GetPhotosFromCoordinates(lat, lng string) ([]*Database
 	return response, nil
 }
 
-func (d *DatabaseHandler) GetLocationStats() (*album.LocationStatsMessage, error) {
-	l := album.NewLocationStatsMessage()
-
-	feedsPhotos := d.DBConnection.Use(DBPHOTO_COLLECTION)
-	queryResult := make(map[int]struct{})
-	var query interface{}
-	json.Unmarshal([]byte(`["all"]`), &query)
-	logger.Info(query)
-	if err := db.EvalQuery(query, feedsPhotos, &queryResult); err != nil {
+// function returns the number of photos by location grid cell from the stats counters
+// function returns the photos located in the area, the photos of the indexed geohash cells
+// covering the area are read (all the photos for large areas)
+func (d *DatabaseHandler) GetPhotosFromArea(area *GeoArea) ([]*DatabasePhotoRecord, error) {
+	response := make([]*DatabasePhotoRecord, 0)
+	add := func(a map[string]interface{}) {
+		if documentString(a, GEOHASH_INDEX) == "" {
+			return
+		}
+		if latitude, longitude := ExifCoordinates(documentExif(a)); area.Contains(latitude, longitude) {
+			response = append(response, documentRecord(a))
+		}
+	}
+	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	cells, indexed := area.geohashCells(GEOCELL_PRECISION, GEOCELL_MAX)
+	if !indexed {
+		feeds.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+			var a map[string]interface{}
+			if err := json.Unmarshal(docContent, &a); err != nil {
+				logger.Error("Error while unmarshalling document with error : " + err.Error())
+				return true
+			}
+			add(a)
+			return true
+		})
+		return response, nil
+	}
+	ids, err := query.Eval(query.In(GEOCELL_INDEX, cells...), feeds)
+	if err != nil {
 		logger.Error("Error while querying with error :" + err.Error())
+		return response, err
 	}
-	for id := range queryResult {
-		readBack, err := feedsPhotos.Read(id)
+	for id := range ids {
+		readBack, err := feeds.Read(id)
 		if err != nil {
-			logger.Errorf("Error while retreiveing id %d with error : %v", id, err.Error())
-		} else {
-			var exif map[string]interface{}
-			if readBack[EXIFTAGS_INDEX] != nil {
-				exif = readBack[EXIFTAGS_INDEX].(map[string]interface{})
-				latitude, longitude := CoordinatesFromExif(exif)
-				if longitude != 0. && latitude != 0. {
-					gps := &album.LocationMessage{
-						Longitude: Round(longitude, .5, 2),
-						Latitude:  Round(latitude, .5, 2)}
-					var found = false
-					for i, v := range l.Stats {
-						if v.Longitude == gps.Longitude && v.Latitude == gps.Latitude {
-							l.Stats[i].Count++
-							found = true
-							break
-						}
-					}
-					if !found {
-						gps.Count = 1
-						l.Stats = append(l.Stats, gps)
-					}
-				}
-			}
-
+			logger.Errorf("Error while retrieving id %d with error : %v", id, err.Error())
+			continue
 		}
+		add(readBack)
 	}
+	return response, nil
+}
 
-	return l, nil
+// function returns the clusters of the photos located in the area (all the photos if area is nil) for the zoom level of the map
+func (d *DatabaseHandler) GetLocationClusters(zoom int, area *GeoArea) (*album.LocationClustersMessage, error) {
+	clusters := newGeoClusters(zoom)
+	d.DBConnection.Use(DBPHOTO_COLLECTION).ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		var a map[string]interface{}
+		if err := json.Unmarshal(docContent, &a); err != nil {
+			logger.Error("Error while unmarshalling document with error : " + err.Error())
+			return true
+		}
+		if documentString(a, GEOHASH_INDEX) == "" {
+			return true
+		}
+		if latitude, longitude := ExifCoordinates(documentExif(a)); area.Contains(latitude, longitude) {
+			clusters.add(latitude, longitude)
+		}
+		return true
+	})
+	return clusters.message(zoom), nil
+}
+
+// function returns the number of photos by place of the level (country, region or city)
+func (d *DatabaseHandler) GetPlaceStats(level string) (*album.PlaceStatsMessage, error) {
+	counters := newPlaceCounters(level)
+	d.DBConnection.Use(DBPHOTO_COLLECTION).ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		var a map[string]interface{}
+		if err := json.Unmarshal(docContent, &a); err != nil {
+			logger.Error("Error while unmarshalling document with error : " + err.Error())
+			return true
+		}
+		counters.add(documentString(a, CITY_INDEX), documentString(a, REGION_INDEX), documentString(a, COUNTRY_INDEX))
+		return true
+	})
+	return counters.message(), nil
+}
 
+// function resolves the places of the photos stored before the places (all the photos if all is set)
+func (d *DatabaseHandler) updatePlaces(all bool) error {
+	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	ids := make([]int, 0)
+	feeds.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		var a map[string]interface{}
+		if err := json.Unmarshal(docContent, &a); err == nil {
+			if _, ok := a[CITY_INDEX]; all || !ok {
+				ids = append(ids, id)
+			}
+		}
+		return true
+	})
+	if len(ids) == 0 {
+		return nil
+	}
+	logger.Infof("Resolving the places of %d photos", len(ids))
+	for _, id := range ids {
+		readBack, err := feeds.Read(id)
+		if err != nil {
+			continue
+		}
+		setDocumentPlace(readBack, documentExif(readBack))
+		if err := feeds.Update(id, readBack); err != nil {
+			logger.Errorf("Cannot update document %d with error : %v", id, err)
+			return err
+		}
+	}
+	return nil
 }
 
-func (d *DatabaseHandler) GetAlbumList() []string {
-	albumsNames := make([]string, 0)
+// function returns the keywords of the documents of the keywords collection
+func documentKeywords(a map[string]interface{}) []string {
+	keywords := make([]string, 0)
+	if values, ok := a[KEYWORDS_INDEX].([]interface{}); ok {
+		for _, v := range values {
+			if keyword, ok := v.(string); ok {
+				keywords = append(keywords, keyword)
+			}
+		}
+	}
+	return keywords
+}
 
-	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
-	queryResult := make(map[int]struct{})
-	var query interface{}
-	json.Unmarshal([]byte(`["all"]`), &query)
-	logger.Info(query)
-	if err := db.EvalQuery(query, feedsAlbum, &queryResult); err != nil {
+// function returns the id and the keywords of the keywords document of the photo, false if the photo has no keyword
+func (d *DatabaseHandler) keywordsDocument(md5sum string) (int, []string, bool, error) {
+	feeds := d.DBConnection.Use(DBKEYWORDS_COLLECTION)
+	queryResult, err := query.Eval(query.Eq(MD5SUM_INDEX, md5sum), feeds)
+	if err != nil {
 		logger.Error("Error while querying with error :" + err.Error())
+		return 0, nil, false, err
 	}
 	for id := range queryResult {
-		readBack, err := feedsAlbum.Read(id)
+		readBack, err := feeds.Read(id)
 		if err != nil {
-			logger.Errorf("Error while retreiveing id %d with error : %v", id, err.Error())
-		} else {
-			name := readBack[ALBUM_INDEX].(string)
-			alreadyInSlice := false
-			for _, v := range albumsNames {
-				if v == name {
-					alreadyInSlice = true
-					break
-				}
-			}
-			if !alreadyInSlice {
-				albumsNames = append(albumsNames, name)
-			}
+			logger.Errorf("Error while retrieving id %d with error : %v", id, err)
+			continue
 		}
+		return id, documentKeywords(readBack), true, nil
 	}
-	return albumsNames
+	return 0, []string{}, false, nil
 }
 
-func (d *DatabaseHandler) AlbumExists(albumName string) (bool, error) {
-
-	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
-	queryResult := make(map[int]struct{})
-	var query interface{}
+// function stores the keywords of the photo, the document is removed if the photo has no keyword
+func (d *DatabaseHandler) setKeywords(md5sum string, update func(current []string) []string) error {
+	feeds := d.DBConnection.Use(DBKEYWORDS_COLLECTION)
+	id, current, found, err := d.keywordsDocument(md5sum)
+	if err != nil {
+		return err
+	}
+	keywords := update(current)
+	switch {
+	case len(keywords) == 0 && found:
+		err = feeds.Delete(id)
+	case len(keywords) == 0:
+	case found:
+		err = feeds.Update(id, map[string]interface{}{MD5SUM_INDEX: md5sum, KEYWORDS_INDEX: keywords})
+	default:
+		_, err = feeds.Insert(map[string]interface{}{MD5SUM_INDEX: md5sum, KEYWORDS_INDEX: keywords})
+	}
+	if err != nil {
+		logger.Errorf("Cannot store the keywords of %s with error : %v", md5sum, err)
+	}
+	return err
+}
 
-	json.Unmarshal([]byte(`[{"eq": "`+albumName+`", "in": ["`+ALBUM_INDEX+`"]}]`), &query)
-	logger.Info(query)
-	if err := db.EvalQuery(query, feedsAlbum, &queryResult); err != nil {
-		logger.Error("Error while querying with error :" + err.Error())
+// function adds the keywords to the photos, PictureNotFound is returned if a photo is not stored
+func (d *DatabaseHandler) AddKeywords(md5sums []string, keywords []string) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	keywords, err := NormalizeKeywords(keywords)
+	if err != nil {
+		return err
 	}
-	if len(queryResult) == 0 {
-		return false, nil
-	} else {
-		return true, nil
+	if err := picturesExist(d, md5sums); err != nil {
+		return err
+	}
+	for _, md5sum := range md5sums {
+		if err := d.setKeywords(md5sum, func(current []string) []string { return mergeKeywords(current, keywords) }); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func (d *DatabaseHandler) GetAlbumData(albumName string) *DatabaseAlbumRecord {
-	collection := NewDatabaseAlbumRecord()
-	collection.AlbumName = albumName
+// function removes the keywords from the photos
+func (d *DatabaseHandler) RemoveKeywords(md5sums []string, keywords []string) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	keywords, err := NormalizeKeywords(keywords)
+	if err != nil {
+		return err
+	}
+	for _, md5sum := range md5sums {
+		if err := d.setKeywords(md5sum, func(current []string) []string { return removeKeywords(current, keywords) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
-	feedsCollection := d.DBConnection.Use(DBPHOTO_COLLECTION)
-	queryResult := make(map[int]struct{})
-	var query interface{}
+// function returns the sorted keywords of the photo
+func (d *DatabaseHandler) GetPhotoKeywords(md5sum string) ([]string, error) {
+	_, keywords, _, err := d.keywordsDocument(md5sum)
+	return keywords, err
+}
 
-	json.Unmarshal([]byte(`[{"eq": "`+albumName+`", "in": ["`+ALBUM_INDEX+`"]}]`), &query)
-	logger.Info(query)
-	if err := db.EvalQuery(query, feedsAlbum, &queryResult); err != nil {
-		logger.Error("Error while querying with error :" + err.Error())
+// function returns the keywords starting with prefix and their number of photos, the most used first
+func (d *DatabaseHandler) SuggestKeywords(prefix string, limit int) (*album.KeywordsMessage, error) {
+	counters := make(keywordCounters)
+	for _, keywords := range d.photosKeywords() {
+		counters.add(keywords)
 	}
+	return counters.message(prefix, limit), nil
+}
 
-	for id := range queryResult {
-		readBack, err := feedsAlbum.Read(id)
-		if err != nil {
-			logger.Errorf("Error while retreiveing id %d  with error : %v", id, err.Error())
-		} else {
-			logger.Infof("description : %s", readBack[ALBUM_DESCRIPTION].(string))
-			collection.Description = readBack[ALBUM_DESCRIPTION].(string)
-			if readBack[ALBUM_TAGS] != nil {
+// function returns the keywords of all the photos by md5sum
+func (d *DatabaseHandler) photosKeywords() map[string][]string {
+	keywords := make(map[string][]string)
+	d.DBConnection.Use(DBKEYWORDS_COLLECTION).ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		var a map[string]interface{}
+		if err := json.Unmarshal(docContent, &a); err != nil {
+			logger.Error("Error while unmarshalling document with error : " + err.Error())
+			return true
+		}
+		keywords[documentString(a, MD5SUM_INDEX)] = documentKeywords(a)
+		return true
+	})
+	return keywords
+}
+
+// function returns the keywords of the photos by md5sum if the request searches keywords
+func (d *DatabaseHandler) searchKeywords(request *SearchRequest) map[string][]string {
+	if !request.uses(SEARCH_KEYWORD) {
+		return map[string][]string{}
+	}
+	return d.photosKeywords()
+}
+
+// function removes the keywords of the photos removed from the database
+func (d *DatabaseHandler) removeOrphanKeywords() error {
+	feeds := d.DBConnection.Use(DBKEYWORDS_COLLECTION)
+	ids := make([]int, 0)
+	feeds.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		var a map[string]interface{}
+		if err := json.Unmarshal(docContent, &a); err != nil {
+			return true
+		}
+		if exists, err := d.PictureExists(documentString(a, MD5SUM_INDEX)); err == nil && !exists {
+			ids = append(ids, id)
+		}
+		return true
+	})
+	for _, id := range ids {
+		if err := feeds.Delete(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// function updates the rating, the favourite flag and the colour label of the photos,
+// PictureNotFound is returned if a photo is not stored
+func (d *DatabaseHandler) UpdateCuration(message *album.CurationMessage) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	if err := ValidateCuration(message); err != nil {
+		return err
+	}
+	if err := picturesExist(d, message.Md5sums); err != nil {
+		return err
+	}
+	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	for _, md5sum := range message.Md5sums {
+		queryResult, err := query.Eval(query.Eq(MD5SUM_INDEX, md5sum), feeds)
+		if err != nil {
+			logger.Error("Error while querying with error :" + err.Error())
+			return ErrorWhileRetreivingPicture
+		}
+		for id := range queryResult {
+			readBack, err := feeds.Read(id)
+			if err != nil {
+				logger.Errorf("Error while retrieving id %d with error : %v", id, err)
+				continue
+			}
+			setDocumentCuration(readBack, documentCuration(readBack).update(message))
+			if err := feeds.Update(id, readBack); err != nil {
+				logger.Errorf("Cannot update the curation of %s with error : %v", md5sum, err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// function applies the corrections written back into the photo update.Md5Sum, md5sum is the md5sum of the photo
+// after the write : the photo, its keywords and the albums are updated. PictureNotFound is returned if the photo is not stored
+func (d *DatabaseHandler) UpdatePhotoMetadata(update *modele.MetadataUpdate, md5sum string) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	keywords, err := metadataKeywords(update)
+	if err != nil {
+		return err
+	}
+	if err := picturesExist(d, []string{update.Md5Sum}); err != nil {
+		return err
+	}
+	if md5sum != update.Md5Sum {
+		if exists, err := d.PictureExists(md5sum); err != nil || exists {
+			return errors.Wrap(PictureAlreadyExists, md5sum)
+		}
+	}
+	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	queryResult, err := query.Eval(query.Eq(MD5SUM_INDEX, update.Md5Sum), feeds)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return ErrorWhileRetreivingPicture
+	}
+	for id := range queryResult {
+		readBack, err := feeds.Read(id)
+		if err != nil {
+			logger.Errorf("Error while retrieving id %d with error : %v", id, err)
+			continue
+		}
+		exif := documentExif(readBack)
+		tags := metadataTags(exif, update)
+		readBack[MD5SUM_INDEX] = md5sum
+		readBack[EXIFTAGS_INDEX] = tags
+		setDocumentGeohash(readBack, tags)
+		setDocumentPlace(readBack, tags)
+		if update.Rating != nil {
+			c := documentCuration(readBack)
+			c.rating = *update.Rating
+			setDocumentCuration(readBack, c)
+		}
+		if err := feeds.Update(id, readBack); err != nil {
+			logger.Errorf("Cannot update the metadata of %s with error : %v", update.Md5Sum, err)
+			return err
+		}
+		modtime := documentInt(readBack, MODTIME_INDEX)
+		d.addStats(exif, modtime, -1)
+		d.addStats(tags, modtime, 1)
+	}
+	if keywords == nil {
+		if _, keywords, _, err = d.keywordsDocument(update.Md5Sum); err != nil {
+			return err
+		}
+	}
+	if md5sum != update.Md5Sum {
+		if err := d.setKeywords(update.Md5Sum, func(current []string) []string { return nil }); err != nil {
+			return err
+		}
+		if err := d.updateAlbums(query.All(), func(doc map[string]interface{}) {
+			if items, ok := doc[ALBUM_ITEMS].([]interface{}); ok {
+				md5sums := make([]string, 0, len(items))
+				for _, item := range items {
+					if m, ok := item.(string); ok {
+						md5sums = append(md5sums, m)
+					}
+				}
+				doc[ALBUM_ITEMS] = replaceMd5sum(md5sums, update.Md5Sum, md5sum)
+			}
+			if documentString(doc, ALBUM_COVER) == update.Md5Sum {
+				doc[ALBUM_COVER] = md5sum
+			}
+		}); err != nil {
+			return err
+		}
+	}
+	return d.setKeywords(md5sum, func(current []string) []string { return keywords })
+}
+
+// function seeds the curation of the photos stored before the curation from their exif rating and label
+func (d *DatabaseHandler) migrateCuration() error {
+	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	ids := make([]int, 0)
+	feeds.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		var a map[string]interface{}
+		if err := json.Unmarshal(docContent, &a); err == nil {
+			if _, ok := a[RATING_INDEX]; !ok {
+				ids = append(ids, id)
+			}
+		}
+		return true
+	})
+	if len(ids) == 0 {
+		return nil
+	}
+	logger.Infof("Reading the rating of %d photos", len(ids))
+	for _, id := range ids {
+		readBack, err := feeds.Read(id)
+		if err != nil {
+			continue
+		}
+		setDocumentCuration(readBack, exifCuration(documentExif(readBack)))
+		if err := feeds.Update(id, readBack); err != nil {
+			logger.Errorf("Cannot update document %d with error : %v", id, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// function computes the geohash of the photos stored before the geohash index
+func (d *DatabaseHandler) migrateGeohash() error {
+	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	ids := make([]int, 0)
+	feeds.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		var a map[string]interface{}
+		if err := json.Unmarshal(docContent, &a); err == nil {
+			if _, ok := a[GEOHASH_INDEX]; !ok {
+				ids = append(ids, id)
+			}
+		}
+		return true
+	})
+	if len(ids) == 0 {
+		return nil
+	}
+	logger.Infof("Computing the geohash of %d photos", len(ids))
+	for _, id := range ids {
+		readBack, err := feeds.Read(id)
+		if err != nil {
+			continue
+		}
+		setDocumentGeohash(readBack, documentExif(readBack))
+		if err := feeds.Update(id, readBack); err != nil {
+			logger.Errorf("Cannot update document %d with error : %v", id, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DatabaseHandler) GetLocationStats() (*album.LocationStatsMessage, error) {
+	l := album.NewLocationStatsMessage()
+	feeds := d.DBConnection.Use(DBSTATS_COLLECTION)
+	feeds.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		var a map[string]interface{}
+		if err := json.Unmarshal(docContent, &a); err != nil {
+			logger.Error("Error while unmarshalling document with error : " + err.Error())
+			return true
+		}
+		if _, ok := a[STATS_LATITUDE].(float64); ok && documentInt(a, STATS_COUNT) > 0 {
+			l.Stats = append(l.Stats, &album.LocationMessage{
+				Latitude:  a[STATS_LATITUDE].(float64),
+				Longitude: a[STATS_LONGITUDE].(float64),
+				Count:     int(documentInt(a, STATS_COUNT))})
+		}
+		return true
+	})
+	sortLocationStats(l)
+	return l, nil
+}
+
+func (d *DatabaseHandler) GetAlbumList() []string {
+	albumsNames := make([]string, 0)
+
+	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
+	q := query.All()
+	logger.Info(q)
+	queryResult, err := query.Eval(q, feedsAlbum)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+	}
+	for id := range queryResult {
+		readBack, err := feedsAlbum.Read(id)
+		if err != nil {
+			logger.Errorf("Error while retreiveing id %d with error : %v", id, err.Error())
+		} else {
+			name := readBack[ALBUM_INDEX].(string)
+			alreadyInSlice := false
+			for _, v := range albumsNames {
+				if v == name {
+					alreadyInSlice = true
+					break
+				}
+			}
+			if !alreadyInSlice {
+				albumsNames = append(albumsNames, name)
+			}
+		}
+	}
+	return albumsNames
+}
+
+func (d *DatabaseHandler) AlbumExists(albumName string) (bool, error) {
+
+	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
+	q := query.Eq(ALBUM_INDEX, albumName)
+	logger.Info(q)
+	queryResult, err := query.Eval(q, feedsAlbum)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+	}
+	if len(queryResult) == 0 {
+		return false, nil
+	} else {
+		return true, nil
+	}
+}
+
+func (d *DatabaseHandler) GetAlbumData(albumName string) *DatabaseAlbumRecord {
+	collection := NewDatabaseAlbumRecord()
+	collection.AlbumName = albumName
+
+	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
+	feedsCollection := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	q := query.Eq(ALBUM_INDEX, albumName)
+	logger.Info(q)
+	queryResult, err := query.Eval(q, feedsAlbum)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+	}
+
+	for id := range queryResult {
+		readBack, err := feedsAlbum.Read(id)
+		if err != nil {
+			logger.Errorf("Error while retreiveing id %d  with error : %v", id, err.Error())
+		} else {
+			logger.Infof("description : %s", readBack[ALBUM_DESCRIPTION].(string))
+			collection.Description = readBack[ALBUM_DESCRIPTION].(string)
+			collection.Parent = documentString(readBack, ALBUM_PARENT)
+			collection.Cover = documentString(readBack, ALBUM_COVER)
+			collection.Owner = documentString(readBack, ALBUM_OWNER)
+			if readBack[ALBUM_TAGS] != nil {
 
 				tags := readBack[ALBUM_TAGS].([]interface{})
 				for _, v := range tags {
@@ -674,12 +1118,24 @@ func (d *DatabaseHandler) GetAlbumData(albumName string) *DatabaseAlbumRecord {
 					logger.Infof("Tag :%s", v.(string))
 				}
 			}
+			if collection.Query = decodeAlbumQuery(albumName, documentString(readBack, ALBUM_QUERY)); collection.Query != nil {
+				records, err := d.Search(collection.Query)
+				if err != nil {
+					logger.Errorf("Error while searching the photos of the smart album %s with error : %v", albumName, err)
+				}
+				for _, record := range records {
+					// album records send the thumbnail in the thumbnail field
+					record.Thumbnail = record.Image
+					record.Image = ""
+					collection.Records = append(collection.Records, record)
+				}
+				continue
+			}
 			for _, md5sum := range readBack[ALBUM_ITEMS].([]interface{}) {
-				queryResultImg := make(map[int]struct{})
-				var queryImg interface{}
-				json.Unmarshal([]byte(`[{"eq": "`+md5sum.(string)+`", "in": ["`+MD5SUM_INDEX+`"]}]`), &queryImg)
-				logger.Info(query)
-				if err := db.EvalQuery(queryImg, feedsCollection, &queryResultImg); err != nil {
+				queryImg := query.Eq(MD5SUM_INDEX, md5sum.(string))
+				logger.Info(queryImg)
+				queryResultImg, err := query.Eval(queryImg, feedsCollection)
+				if err != nil {
 					logger.Error("Error while querying with error :" + err.Error())
 				}
 				for id := range queryResultImg {
@@ -688,24 +1144,11 @@ func (d *DatabaseHandler) GetAlbumData(albumName string) *DatabaseAlbumRecord {
 						logger.Errorf("Error while retreiveing id %d with error : %v ", id, err.Error())
 					} else {
 						logger.Debug(readBack)
-						var exif map[string]interface{}
-						if readBack[EXIFTAGS_INDEX] != nil {
-							exif = readBack[EXIFTAGS_INDEX].(map[string]interface{})
-						}
-						origin := readBack[MACHINEID_INDEX].(string)
-						filepath := readBack[FILEPATH_INDEX].(string)
-						if origin != modele.ORIGIN_FLICKR && origin != modele.ORIGIN_GOOGLE {
-							filepath = fmt.Sprintf("/photo?filepath=%s&machineid=%s", readBack[FILEPATH_INDEX].(string), origin)
-						}
-						collection.Records = append(collection.Records,
-							&DatabasePhotoRecord{
-								MachineId: readBack[MACHINEID_INDEX].(string),
-								Md5sum:    readBack[MD5SUM_INDEX].(string),
-								Filename:  readBack[FILENAME_INDEX].(string),
-								Filepath:  filepath,
-								Thumbnail: readBack[THUMBNAIL_INDEX].(string),
-								ExifTags:  exif,
-							})
+						record := documentRecord(readBack)
+						// album records send the thumbnail in the thumbnail field
+						record.Thumbnail = record.Image
+						record.Image = ""
+						collection.Records = append(collection.Records, record)
 					}
 
 				}
@@ -717,15 +1160,15 @@ func (d *DatabaseHandler) GetAlbumData(albumName string) *DatabaseAlbumRecord {
 }
 
 func (d *DatabaseHandler) DeletePhotoAlbum(response *album.AlbumMessage) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
 	var err error
 
 	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
-	queryResult := make(map[int]struct{})
-	var query interface{}
-
-	json.Unmarshal([]byte(`[{"eq": "`+response.AlbumName+`", "in": ["`+ALBUM_INDEX+`"]}]`), &query)
-	logger.Info(query)
-	if err = db.EvalQuery(query, feedsAlbum, &queryResult); err != nil {
+	q := query.Eq(ALBUM_INDEX, response.AlbumName)
+	logger.Info(q)
+	queryResult, err := query.Eval(q, feedsAlbum)
+	if err != nil {
 		logger.Error("Error while querying with error :" + err.Error())
 	}
 	photosToKeep := make([]string, 0)
@@ -735,6 +1178,9 @@ func (d *DatabaseHandler) DeletePhotoAlbum(response *album.AlbumMessage) error {
 		if err != nil {
 			logger.Errorf("Error while retreiveing id  %d with error : %v", id, err.Error())
 		} else {
+			if documentString(readback, ALBUM_QUERY) != "" {
+				return SmartAlbumPhotos
+			}
 			for _, item := range readback[ALBUM_ITEMS].([]interface{}) {
 				mustBeDeleted := false
 				for _, md5sum := range response.Md5sums {
@@ -752,6 +1198,9 @@ func (d *DatabaseHandler) DeletePhotoAlbum(response *album.AlbumMessage) error {
 				ALBUM_ITEMS:       photosToKeep,
 				ALBUM_DESCRIPTION: response.Description,
 				ALBUM_TAGS:        response.Tags,
+				ALBUM_PARENT:      documentString(readback, ALBUM_PARENT),
+				ALBUM_COVER:       documentString(readback, ALBUM_COVER),
+				ALBUM_OWNER:       documentString(readback, ALBUM_OWNER),
 			})
 			if err != nil {
 				logger.Error("Cannot insert data in database with error : " + err.Error())
@@ -765,6 +1214,8 @@ func (d *DatabaseHandler) DeletePhotoAlbum(response *album.AlbumMessage) error {
 }
 
 func (d *DatabaseHandler) InsertNewAlbum(response *album.AlbumMessage) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
 
 	exists, err := d.AlbumExists(response.AlbumName)
 	if err != nil {
@@ -774,14 +1225,28 @@ func (d *DatabaseHandler) InsertNewAlbum(response *album.AlbumMessage) error {
 	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
 
 	if exists {
-		return d.UpdateAlbum(response)
+		return d.updateAlbum(response)
 	} else {
-
+		request, err := updatedAlbumQuery(nil, response)
+		if err != nil {
+			return err
+		}
+		parents, err := d.albumParents()
+		if err != nil {
+			return err
+		}
+		if err = checkAlbumParent(parents, response.AlbumName, response.Parent); err != nil {
+			return err
+		}
 		id, err := feedsAlbum.Insert(map[string]interface{}{
 			ALBUM_INDEX:       response.AlbumName,
 			ALBUM_ITEMS:       response.Md5sums,
 			ALBUM_DESCRIPTION: response.Description,
 			ALBUM_TAGS:        response.Tags,
+			ALBUM_QUERY:       encodeAlbumQuery(request),
+			ALBUM_PARENT:      response.Parent,
+			ALBUM_COVER:       response.Cover,
+			ALBUM_OWNER:       response.Owner,
 		})
 		if err != nil {
 			logger.Errorf("Cannot insert album %s in database with error : %v", response.AlbumName, err)
@@ -794,21 +1259,26 @@ func (d *DatabaseHandler) InsertNewAlbum(response *album.AlbumMessage) error {
 }
 
 func (d *DatabaseHandler) DeleteAlbum(response *album.AlbumMessage) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
 
 	var err error
 	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
-	queryResult := make(map[int]struct{})
-	var query interface{}
-	json.Unmarshal([]byte(`[{"eq": "`+response.AlbumName+`", "in": ["`+ALBUM_INDEX+`"]}]`), &query)
-	logger.Info(query)
-	if err = db.EvalQuery(query, feedsAlbum, &queryResult); err != nil {
+	q := query.Eq(ALBUM_INDEX, response.AlbumName)
+	logger.Info(q)
+	queryResult, err := query.Eval(q, feedsAlbum)
+	if err != nil {
 		logger.Error("Error while querying with error :" + err.Error())
 		return err
 	}
 	if len(queryResult) == 0 {
 		return errors.New("no records found")
 	}
+	parent := ""
 	for id := range queryResult {
+		if readBack, err := feedsAlbum.Read(id); err == nil {
+			parent = documentString(readBack, ALBUM_PARENT)
+		}
 		err = feedsAlbum.Delete(id)
 
 		if err != nil {
@@ -818,50 +1288,67 @@ func (d *DatabaseHandler) DeleteAlbum(response *album.AlbumMessage) error {
 		}
 
 	}
+	// the subalbums are moved to the parent of the deleted album
+	if err == nil {
+		err = d.setAlbumsParent(query.Eq(ALBUM_PARENT, response.AlbumName), parent)
+	}
+	// and its share links are removed
+	if err == nil {
+		_, err = d.deleteShares(func(share *DatabaseShareRecord) bool { return share.AlbumName == response.AlbumName })
+	}
 	return err
 }
 
 func (d *DatabaseHandler) UpdateAlbum(response *album.AlbumMessage) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	return d.updateAlbum(response)
+}
+
+func (d *DatabaseHandler) updateAlbum(response *album.AlbumMessage) error {
 
 	var err error
 	md5sumsMerged := make([]string, 0)
 
 	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
-	queryResult := make(map[int]struct{})
-	var query interface{}
-	json.Unmarshal([]byte(`[{"eq": "`+response.AlbumName+`", "in": ["`+ALBUM_INDEX+`"]}]`), &query)
-	logger.Info(query)
-	if err = db.EvalQuery(query, feedsAlbum, &queryResult); err != nil {
+	q := query.Eq(ALBUM_INDEX, response.AlbumName)
+	logger.Info(q)
+	queryResult, err := query.Eval(q, feedsAlbum)
+	if err != nil {
 		logger.Error("Error while querying with error :" + err.Error())
 		return err
 	}
 	if len(queryResult) == 0 {
 		return errors.New("no records found")
 	}
-	md5sumsMerged = append(md5sumsMerged, response.Md5sums...)
 	for id := range queryResult {
 		var readback map[string]interface{}
 		readback, err = feedsAlbum.Read(id)
 		if err != nil {
 			logger.Errorf("Error while retreiveing id %d with error : %v", id, err.Error())
 		} else {
-			for _, item := range readback[ALBUM_ITEMS].([]interface{}) {
-				existing := false
-				for _, md5sum := range md5sumsMerged {
-					if md5sum == item.(string) {
-						existing = true
-						break
-					}
-				}
-				if !existing {
-					md5sumsMerged = append(md5sumsMerged, item.(string))
+			var request *SearchRequest
+			request, err = updatedAlbumQuery(decodeAlbumQuery(response.AlbumName, documentString(readback, ALBUM_QUERY)), response)
+			if err != nil {
+				return err
+			}
+			stored := make([]string, 0)
+			if items, ok := readback[ALBUM_ITEMS].([]interface{}); ok && request == nil {
+				// the photos of a smart album are not stored
+				for _, item := range items {
+					stored = append(stored, item.(string))
 				}
 			}
+			md5sumsMerged = appendItems(stored, response.Md5sums)
 			err = feedsAlbum.Update(id, map[string]interface{}{
 				ALBUM_INDEX:       response.AlbumName,
 				ALBUM_ITEMS:       md5sumsMerged,
 				ALBUM_DESCRIPTION: response.Description,
 				ALBUM_TAGS:        response.Tags,
+				ALBUM_QUERY:       encodeAlbumQuery(request),
+				ALBUM_PARENT:      documentString(readback, ALBUM_PARENT),
+				ALBUM_COVER:       documentString(readback, ALBUM_COVER),
+				ALBUM_OWNER:       documentString(readback, ALBUM_OWNER),
 			})
 			if err != nil {
 				logger.Error("Cannot insert data in database with error : " + err.Error())
@@ -876,10 +1363,8 @@ func (d *DatabaseHandler) UpdateAlbum(response *album.AlbumMessage) error {
 func (d *DatabaseHandler) PictureExists(md5sum string) (bool, error) {
 
 	feedsCollection := d.DBConnection.Use(DBPHOTO_COLLECTION)
-	queryResult := make(map[int]struct{})
-	var query interface{}
-	json.Unmarshal([]byte(`[{"eq": "`+md5sum+`", "in": ["`+MD5SUM_INDEX+`"]}]`), &query)
-	if err := db.EvalQuery(query, feedsCollection, &queryResult); err != nil {
+	queryResult, err := query.Eval(query.Eq(MD5SUM_INDEX, md5sum), feedsCollection)
+	if err != nil {
 		logger.Error("Error while querying with error :" + err.Error())
 		return true, ErrorWhileRetreivingPicture
 	}
@@ -890,33 +1375,127 @@ func (d *DatabaseHandler) PictureExists(md5sum string) (bool, error) {
 	return true, nil
 }
 
+// function updates the path of the copy of the photo md5sum stored on the machine
+func (d *DatabaseHandler) MovePhoto(machineid string, move *modele.PhotoMove) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	queryResult, err := query.Eval(query.Eq(MD5SUM_INDEX, move.Md5Sum), feeds)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return ErrorWhileRetreivingPicture
+	}
+	for id := range queryResult {
+		readBack, err := feeds.Read(id)
+		if err != nil {
+			logger.Errorf("Error while retrieving id %d with error : %v", id, err.Error())
+			continue
+		}
+		locations, primary := moveLocation(documentLocations(readBack), machineid, move)
+		readBack[LOCATIONS_INDEX] = locations
+		if primary {
+			readBack[MACHINEID_INDEX] = machineid
+			readBack[FILENAME_INDEX] = move.Filename
+			readBack[FILENAMES_INDEX] = SplitAll(move.Filename)
+			readBack[FILEPATH_INDEX] = move.Filepath
+			readBack[FILEPATHS_INDEX] = SplitAll(move.Filepath)
+			readBack[FILETYPE_INDEX] = strings.ToLower(filepath.Ext(move.Filename))
+		}
+		if err = feeds.Update(id, readBack); err != nil {
+			logger.Errorf("Error while moving %s to %s with error : %v", move.Md5Sum, move.Filepath, err)
+			return err
+		}
+		logger.Infof("Photo %s moved from %s to %s", move.Md5Sum, move.PreviousFilepath, move.Filepath)
+	}
+	return nil
+}
+
+// function removes the copy of the photo md5sum of the machine if it is still recorded at the photo filepath,
+// the photo is removed with its last copy
+func (d *DatabaseHandler) DeletePhoto(machineid string, photo *modele.PhotoInformations) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	queryResult, err := query.Eval(query.Eq(MD5SUM_INDEX, photo.Md5Sum), feeds)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return ErrorWhileRetreivingPicture
+	}
+	for id := range queryResult {
+		readBack, err := feeds.Read(id)
+		if err != nil {
+			logger.Errorf("Error while retrieving id %d with error : %v", id, err.Error())
+			continue
+		}
+		locations := documentLocations(readBack)
+		kept := removeLocation(locations, machineid, photo.Filepath)
+		if len(kept) == len(locations) {
+			continue
+		}
+		if len(kept) == 0 {
+			if err = feeds.Delete(id); err == nil {
+				d.addStats(documentExif(readBack), documentInt(readBack, MODTIME_INDEX), -1)
+			}
+		} else {
+			setDocumentLocations(readBack, kept)
+			err = feeds.Update(id, readBack)
+		}
+		if err != nil {
+			logger.Errorf("Error while deleting %s with error : %v", photo.Md5Sum, err)
+			return err
+		}
+		logger.Infof("Photo %s deleted from %s, %d copies left", photo.Md5Sum, photo.Filepath, len(kept))
+	}
+	return nil
+}
+
 func (d *DatabaseHandler) InsertNewData(response *modele.PhotoResponse) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
 
 	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
 	for _, item := range response.Photos {
 		exists, err := d.PictureExists(item.Md5Sum)
-		if !exists && err == nil {
-			id, err := feeds.Insert(map[string]interface{}{
-				MACHINEID_INDEX: response.MachineId,
-				FILENAME_INDEX:  item.Filename,
-				FILENAMES_INDEX: SplitAll(item.Filename),
-				FILEPATH_INDEX:  item.Filepath,
-				FILEPATHS_INDEX: SplitAll(item.Filepath),
-				MD5SUM_INDEX:    item.Md5Sum,
-				EXIFTAGS_INDEX:  item.Tags,
-				THUMBNAIL_INDEX: item.Thumbnail,
-				FILETYPE_INDEX:  strings.ToLower(filepath.Ext(item.Filename))})
+		if exists && err == nil {
+			d.addPhotoLocation(item.Md5Sum, response.MachineId, item.Filepath)
+			d.rescanPhoto(item)
+			d.addPhotoKeywords(item)
+			continue
+		}
+		if err == nil {
+			tags := photoTags(item)
+			thumbnailId, thumbnailSize, err := d.Thumbnails.PutBase64(item.Thumbnail)
+			if err != nil {
+				logger.Errorf("Cannot store thumbnail of %s with error : %v", item.Md5Sum, err)
+			}
+			doc := map[string]interface{}{
+				MACHINEID_INDEX:     response.MachineId,
+				FILENAME_INDEX:      item.Filename,
+				FILENAMES_INDEX:     SplitAll(item.Filename),
+				FILEPATH_INDEX:      item.Filepath,
+				FILEPATHS_INDEX:     SplitAll(item.Filepath),
+				MD5SUM_INDEX:        item.Md5Sum,
+				EXIFTAGS_INDEX:      tags,
+				THUMBNAILID_INDEX:   thumbnailId,
+				THUMBNAILSIZE_INDEX: thumbnailSize,
+				SIZE_INDEX:          item.Size,
+				IMPORTTIME_INDEX:    time.Now().UnixMicro(),
+				MODTIME_INDEX:       item.ModTime,
+				LOCATIONS_INDEX:     addLocation(nil, response.MachineId, item.Filepath),
+				FILETYPE_INDEX:      strings.ToLower(filepath.Ext(item.Filename))}
+			setDocumentGeohash(doc, exifTags(tags))
+			setDocumentPlace(doc, exifTags(tags))
+			setDocumentCuration(doc, exifCuration(exifTags(tags)))
+			id, err := feeds.Insert(doc)
 			if err != nil {
 				logger.Error("Cannot insert data in database with error : " + err.Error())
 			} else {
+				d.addStats(exifTags(tags), item.ModTime, 1)
+				d.addPhotoKeywords(item)
 				logger.Infof("DB return id %d for filepath:%s\n", id, item.Filepath)
 			}
 		} else {
-			if err == nil {
-				logger.Infof("This picture %s already exists in database skipped.", item.Md5Sum)
-			} else {
-				logger.Infof("Error for %s with error %v", item.Md5Sum, err)
-			}
+			logger.Infof("Error for %s with error %v", item.Md5Sum, err)
 		}
 
 	}
@@ -924,29 +1503,90 @@ func (d *DatabaseHandler) InsertNewData(response *modele.PhotoResponse) error {
 	return nil
 }
 
-func (d *DatabaseHandler) removeDuplicateAlbums() error {
+// function adds the keywords of the xmp and of the iptc of the photo to its keywords
+func (d *DatabaseHandler) addPhotoKeywords(item *modele.PhotoInformations) {
+	if keywords := photoKeywords(item); len(keywords) > 0 {
+		d.setKeywords(item.Md5Sum, func(current []string) []string { return mergeKeywords(current, keywords) })
+	}
+}
 
-	// suppress album more than 1
-	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
-	var queryAlbum interface{}
-	json.Unmarshal([]byte(`["all"]`), &queryAlbum)
-	queryResultAlbum := make(map[int]struct{})
-	logger.Info(queryAlbum)
-	if err := db.EvalQuery(queryAlbum, feedsAlbum, &queryResultAlbum); err != nil {
+// function adds the copy of the machine to the photo md5sum already stored
+func (d *DatabaseHandler) addPhotoLocation(md5sum string, machineid string, path string) {
+	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	queryResult, err := query.Eval(query.Eq(MD5SUM_INDEX, md5sum), feeds)
+	if err != nil {
 		logger.Error("Error while querying with error :" + err.Error())
+		return
 	}
-	// suppress pictures more than 1
+	for id := range queryResult {
+		readBack, err := feeds.Read(id)
+		if err != nil {
+			logger.Errorf("Error while retrieving id %d with error : %v", id, err.Error())
+			continue
+		}
+		readBack[LOCATIONS_INDEX] = addLocation(documentLocations(readBack), machineid, path)
+		if err = feeds.Update(id, readBack); err != nil {
+			logger.Errorf("Error while adding location %s of %s with error : %v", path, md5sum, err)
+			continue
+		}
+		logger.Infof("This picture %s already exists in database, location %s of %s recorded.", md5sum, path, machineid)
+	}
+}
+
+// function applies the xmp of the copy scanned again to the photo already stored (see rescanTags)
+func (d *DatabaseHandler) rescanPhoto(item *modele.PhotoInformations) {
+	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	queryResult, err := query.Eval(query.Eq(MD5SUM_INDEX, item.Md5Sum), feeds)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return
+	}
+	for id := range queryResult {
+		readBack, err := feeds.Read(id)
+		if err != nil {
+			logger.Errorf("Error while retrieving id %d with error : %v", id, err)
+			continue
+		}
+		exif := documentExif(readBack)
+		tags, changed := rescanTags(exif, item)
+		if !changed {
+			continue
+		}
+		readBack[EXIFTAGS_INDEX] = tags
+		setDocumentGeohash(readBack, tags)
+		setDocumentPlace(readBack, tags)
+		setDocumentCuration(readBack, rescanCuration(documentCuration(readBack), exif, tags))
+		if err := feeds.Update(id, readBack); err != nil {
+			logger.Errorf("Cannot update the xmp of %s with error : %v", item.Md5Sum, err)
+			continue
+		}
+		modtime := documentInt(readBack, MODTIME_INDEX)
+		d.addStats(exif, modtime, -1)
+		d.addStats(tags, modtime, 1)
+	}
+}
+
+func (d *DatabaseHandler) removeDuplicateAlbums() error {
+
+	// suppress album more than 1
+	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
+	queryAlbum := query.All()
+	logger.Info(queryAlbum)
+	queryResultAlbum, err := query.Eval(queryAlbum, feedsAlbum)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+	}
+	// suppress pictures more than 1
 	for id := range queryResultAlbum {
 		readBack, err := feedsAlbum.Read(id)
 		if err != nil {
-			logger.Errorf("Error while retrieving id %d  with error : ", id, err.Error())
+			logger.Errorf("Error while retrieving id %d  with error : %v", id, err.Error())
+			continue
 		}
 		albumName := readBack[ALBUM_INDEX]
 		if albumName != nil {
-			var subquery interface{}
-			json.Unmarshal([]byte(`[{"eq": "`+albumName.(string)+`", "in": ["`+ALBUM_INDEX+`"]}]`), &subquery)
-			subqueryResult := make(map[int]struct{})
-			if err := db.EvalQuery(subquery, feedsAlbum, &queryResultAlbum); err != nil {
+			subqueryResult, err := query.Eval(query.Eq(ALBUM_INDEX, albumName.(string)), feedsAlbum)
+			if err != nil {
 				logger.Error("Error while querying with error :" + err.Error())
 			}
 			if len(subqueryResult) > 1 {
@@ -974,42 +1614,49 @@ func (d *DatabaseHandler) removeDuplicateAlbums() error {
 func (d *DatabaseHandler) removeDuplicatePhotos() error {
 
 	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
-	var query interface{}
-	queryResult := make(map[int]struct{})
-	json.Unmarshal([]byte(`["all"]`), &query)
-	logger.Info(query)
-	if err := db.EvalQuery(query, feeds, &queryResult); err != nil {
+	q := query.All()
+	logger.Info(q)
+	queryResult, err := query.Eval(q, feeds)
+	if err != nil {
 		logger.Error("Error while querying with error :" + err.Error())
 	}
 	// suppress pictures more than 1
 	for id := range queryResult {
 		readBack, err := feeds.Read(id)
 		if err != nil {
-			logger.Errorf("Error while retreiveing id %d  with error : ", id, err.Error())
+			logger.Errorf("Error while retreiveing id %d  with error : %v", id, err.Error())
+			continue
 		}
 		md5sum := readBack[MD5SUM_INDEX]
 		if md5sum != nil {
-			var subquery interface{}
-			json.Unmarshal([]byte(`[{"eq": "`+md5sum.(string)+`", "in": ["`+MD5SUM_INDEX+`"]}]`), &subquery)
-			subqueryResult := make(map[int]struct{})
-			if err := db.EvalQuery(subquery, feeds, &subqueryResult); err != nil {
+			subqueryResult, err := query.Eval(query.Eq(MD5SUM_INDEX, md5sum.(string)), feeds)
+			if err != nil {
 				logger.Error("Error while querying with error :" + err.Error())
 			}
 			if len(subqueryResult) > 1 {
-				index := 0
+				keptId := 0
+				var kept map[string]interface{}
 				for id := range subqueryResult {
 					readBack, err := feeds.Read(id)
 					if err != nil {
-						logger.Errorf("Error while retreiveing id %d  with error : ", id, err.Error())
+						logger.Errorf("Error while retreiveing id %d  with error : %v", id, err.Error())
 					} else {
-						if index == 0 {
+						if kept == nil {
 							logger.Infof("Keeping image %d %s", id, readBack[MD5SUM_INDEX])
+							keptId, kept = id, readBack
+							kept[LOCATIONS_INDEX] = documentLocations(kept)
 						} else {
 							logger.Infof("Deleting image %d %s", id, readBack[MD5SUM_INDEX])
+							// the copies of the duplicate are kept by the remaining photo
+							kept[LOCATIONS_INDEX] = mergeLocations(kept[LOCATIONS_INDEX].([]*PhotoLocation), documentLocations(readBack))
 							feeds.Delete(id)
 						}
 					}
-					index++
+				}
+				if kept != nil {
+					if err := feeds.Update(keptId, kept); err != nil {
+						logger.Errorf("Error while updating id %d with error : %v", keptId, err)
+					}
 				}
 			}
 		}
@@ -1018,15 +1665,14 @@ func (d *DatabaseHandler) removeDuplicatePhotos() error {
 }
 
 func (d *DatabaseHandler) CleanDatabase() error {
-	slaves := slavehandler.GetSlaves()
+	writesLock.RLock()
+	defer writesLock.RUnlock()
 
 	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
-	var query interface{}
-	json.Unmarshal([]byte(`["all"]`), &query)
-	queryResult := make(map[int]struct{})
-
-	logger.Info(query)
-	if err := db.EvalQuery(query, feeds, &queryResult); err != nil {
+	q := query.All()
+	logger.Info(q)
+	queryResult, err := query.Eval(q, feeds)
+	if err != nil {
 		logger.Error("Error while querying with error :" + err.Error())
 	}
 	for id := range queryResult {
@@ -1034,15 +1680,16 @@ func (d *DatabaseHandler) CleanDatabase() error {
 		if err != nil {
 			logger.Errorf("Error while retreiveing id %d with error : %v", id, err.Error())
 		} else {
-			if readBack[MACHINEID_INDEX] == "" {
+			// the photo is removed only if none of its copies is on an active machine
+			locations := documentLocations(readBack)
+			kept := removeInactiveLocations(locations)
+			if len(kept) == 0 {
 				logger.Infof("Removing %d", id)
 				feeds.Delete(id)
-			}
-			for _, slave := range slaves.Slaves {
-				if !slave.IsActive() && slave.Name == readBack[MACHINEID_INDEX] {
-					logger.Infof("Removing %d", id)
-					feeds.Delete(id)
-				}
+			} else if len(kept) != len(locations) {
+				logger.Infof("Removing %d copies of %d", len(locations)-len(kept), id)
+				setDocumentLocations(readBack, kept)
+				feeds.Update(id, readBack)
 			}
 		}
 	}
@@ -1055,6 +1702,22 @@ func (d *DatabaseHandler) CleanDatabase() error {
 		logger.Errorf("Error while removing duplicates albums with error %v", err)
 	}
 
+	if err := d.removeOrphanKeywords(); err != nil {
+		logger.Errorf("Error while removing the keywords of the removed photos with error %v", err)
+	}
+
+	if err := d.sweepThumbnails(); err != nil {
+		logger.Errorf("Error while removing the thumbnails of the removed photos with error %v", err)
+	}
+
+	if err := d.rebuildStats(); err != nil {
+		logger.Errorf("Error while computing the stats with error %v", err)
+	}
+
+	if err := d.updatePlaces(true); err != nil {
+		logger.Errorf("Error while computing the places with error %v", err)
+	}
+
 	if err := d.DBConnection.Scrub(DBPHOTO_COLLECTION); err != nil {
 		logger.Errorf("Error while scrubbing collection %s with error %v", DBPHOTO_COLLECTION, err)
 		return err
@@ -1064,6 +1727,10 @@ func (d *DatabaseHandler) CleanDatabase() error {
 		return err
 	}
 
+	if err := d.DBConnection.Scrub(DBKEYWORDS_COLLECTION); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -1071,11 +1738,10 @@ func (d *DatabaseHandler) QueryAll() ([]*DatabasePhotoRecord, error) {
 	response := make([]*DatabasePhotoRecord, 0)
 
 	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
-	queryResult := make(map[int]struct{})
-	var query interface{}
-	json.Unmarshal([]byte(`["all"]`), &query)
-	logger.Info(query)
-	if err := db.EvalQuery(query, feeds, &queryResult); err != nil {
+	q := query.All()
+	logger.Info(q)
+	queryResult, err := query.Eval(q, feeds)
+	if err != nil {
 		logger.Error("Error while querying with error :" + err.Error())
 	}
 	for id := range queryResult {
@@ -1084,22 +1750,7 @@ func (d *DatabaseHandler) QueryAll() ([]*DatabasePhotoRecord, error) {
 			logger.Errorf("Error while retreiveing id %d with error : %v", id, err.Error())
 		} else {
 			logger.Debug(readBack)
-			var exif map[string]interface{}
-			if readBack[EXIFTAGS_INDEX] != nil {
-				exif = readBack[EXIFTAGS_INDEX].(map[string]interface{})
-			}
-			origin := readBack[MACHINEID_INDEX].(string)
-			filepath := readBack[FILEPATH_INDEX].(string)
-			if origin != modele.ORIGIN_FLICKR && origin != modele.ORIGIN_GOOGLE {
-				filepath = fmt.Sprintf("/photo?filepath=%s&machineid=%s", readBack[FILEPATH_INDEX].(string), origin)
-			}
-			response = append(response, NewDatabasePhotoResponse(
-				readBack[MD5SUM_INDEX].(string),
-				readBack[FILENAME_INDEX].(string),
-				filepath,
-				readBack[MACHINEID_INDEX].(string),
-				readBack[THUMBNAIL_INDEX].(string),
-				exif))
+			response = append(response, documentRecord(readBack))
 		}
 
 	}
@@ -1109,12 +1760,10 @@ func (d *DatabaseHandler) QueryAll() ([]*DatabasePhotoRecord, error) {
 func (d *DatabaseHandler) QueryExtension(pattern string) ([]*DatabasePhotoRecord, error) {
 	response := make([]*DatabasePhotoRecord, 0)
 	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
-	queryResult := make(map[int]struct{})
-	var query interface{}
-
-	json.Unmarshal([]byte(`[{"eq": "`+pattern+`", "in": ["`+FILETYPE_INDEX+`"]}]`), &query)
-	logger.Info(query)
-	if err := db.EvalQuery(query, feeds, &queryResult); err != nil {
+	q := query.Eq(FILETYPE_INDEX, pattern)
+	logger.Info(q)
+	queryResult, err := query.Eval(q, feeds)
+	if err != nil {
 		logger.Error("Error while querying with error :" + err.Error())
 	}
 	logger.Infof("request returns %d results for extension %s\n", len(queryResult), pattern)
@@ -1124,22 +1773,7 @@ func (d *DatabaseHandler) QueryExtension(pattern string) ([]*DatabasePhotoRecord
 			logger.Errorf("Error while retrieving id %d with error : %v", id, err.Error())
 		} else {
 			//logger.LogLn(readBack)
-			var exif map[string]interface{}
-			if readBack[EXIFTAGS_INDEX] != nil {
-				exif = readBack[EXIFTAGS_INDEX].(map[string]interface{})
-			}
-			origin := readBack[MACHINEID_INDEX].(string)
-			filepath := readBack[FILEPATH_INDEX].(string)
-			if origin != modele.ORIGIN_FLICKR && origin != modele.ORIGIN_GOOGLE {
-				filepath = fmt.Sprintf("/photo?filepath=%s&machineid=%s", readBack[FILEPATH_INDEX].(string), origin)
-			}
-			response = append(response, NewDatabasePhotoResponse(
-				readBack[MD5SUM_INDEX].(string),
-				readBack[FILENAME_INDEX].(string),
-				filepath,
-				readBack[MACHINEID_INDEX].(string),
-				readBack[THUMBNAIL_INDEX].(string),
-				exif))
+			response = append(response, documentRecord(readBack))
 		}
 
 	}
@@ -1162,22 +1796,7 @@ func (d *DatabaseHandler) QueryFilename(pattern string) ([]*DatabasePhotoRecord,
 		if a[FILENAMES_INDEX] != nil {
 			for _, val := range a[FILENAMES_INDEX].([]interface{}) {
 				if strings.Contains(strings.ToLower(val.(string)), strings.ToLower(pattern)) {
-					var exif map[string]interface{}
-					if a[EXIFTAGS_INDEX] != nil {
-						exif = a[EXIFTAGS_INDEX].(map[string]interface{})
-					}
-					origin := a[MACHINEID_INDEX].(string)
-					filepath := a[FILEPATH_INDEX].(string)
-					if origin != modele.ORIGIN_FLICKR && origin != modele.ORIGIN_GOOGLE {
-						filepath = fmt.Sprintf("/photo?filepath=%s&machineid=%s", a[FILEPATH_INDEX].(string), origin)
-					}
-					response = append(response, NewDatabasePhotoResponse(
-						a[MD5SUM_INDEX].(string),
-						a[FILENAME_INDEX].(string),
-						filepath,
-						a[MACHINEID_INDEX].(string),
-						a[THUMBNAIL_INDEX].(string),
-						exif))
+					response = append(response, documentRecord(a))
 				}
 
 			}
@@ -1185,22 +1804,7 @@ func (d *DatabaseHandler) QueryFilename(pattern string) ([]*DatabasePhotoRecord,
 		if a[FILEPATHS_INDEX] != nil {
 			for _, val := range a[FILEPATHS_INDEX].([]interface{}) {
 				if strings.Contains(strings.ToLower(val.(string)), strings.ToLower(pattern)) {
-					var exif map[string]interface{}
-					if a[EXIFTAGS_INDEX] != nil {
-						exif = a[EXIFTAGS_INDEX].(map[string]interface{})
-					}
-					origin := a[MACHINEID_INDEX].(string)
-					filepath := a[FILEPATH_INDEX].(string)
-					if origin != modele.ORIGIN_FLICKR && origin != modele.ORIGIN_GOOGLE {
-						filepath = fmt.Sprintf("/photo?filepath=%s&machineid=%s", a[FILEPATH_INDEX].(string), origin)
-					}
-					response = append(response, NewDatabasePhotoResponse(
-						a[MD5SUM_INDEX].(string),
-						a[FILENAME_INDEX].(string),
-						filepath,
-						a[MACHINEID_INDEX].(string),
-						a[THUMBNAIL_INDEX].(string),
-						exif))
+					response = append(response, documentRecord(a))
 				}
 
 			}
@@ -1226,22 +1830,7 @@ func (d *DatabaseHandler) QueryExifTag(pattern string, exiftag string) ([]*Datab
 			for key, val := range a[EXIFTAGS_INDEX].(map[string]interface{}) {
 				if strings.Contains(strings.ToLower(key), strings.ToLower(exiftag)) {
 					if strings.Contains(strings.ToLower(val.(string)), strings.ToLower(pattern)) {
-						var exif map[string]interface{}
-						if a[EXIFTAGS_INDEX] != nil {
-							exif = a[EXIFTAGS_INDEX].(map[string]interface{})
-						}
-						origin := a[MACHINEID_INDEX].(string)
-						filepath := a[FILEPATH_INDEX].(string)
-						if origin != modele.ORIGIN_FLICKR && origin != modele.ORIGIN_GOOGLE {
-							filepath = fmt.Sprintf("/photo?filepath=%s&machineid=%s", a[FILEPATH_INDEX].(string), origin)
-						}
-						response = append(response, NewDatabasePhotoResponse(
-							a[MD5SUM_INDEX].(string),
-							a[FILENAME_INDEX].(string),
-							filepath,
-							a[MACHINEID_INDEX].(string),
-							a[THUMBNAIL_INDEX].(string),
-							exif))
+						response = append(response, documentRecord(a))
 					}
 				}
 			}
@@ -1253,6 +1842,723 @@ func (d *DatabaseHandler) QueryExifTag(pattern string, exiftag string) ([]*Datab
 	return response, nil
 }
 
+// function returns the string value of the document field or an empty string
+func documentString(a map[string]interface{}, field string) string {
+	if value, ok := a[field].(string); ok {
+		return value
+	}
+	return ""
+}
+
+// function returns the integer value of the document field (stored as float by tiedot) or 0
+func documentInt(a map[string]interface{}, field string) int64 {
+	if value, ok := a[field].(float64); ok {
+		return int64(value)
+	}
+	return 0
+}
+
+// function returns the exif tags of the photo document, nil if the photo has no tags
+func documentExif(a map[string]interface{}) map[string]interface{} {
+	exif, _ := a[EXIFTAGS_INDEX].(map[string]interface{})
+	return exif
+}
+
+// function returns the fields of the photo document evaluated by the searches
+func documentSearch(a map[string]interface{}) *searchDocument {
+	exif := documentExif(a)
+	return &searchDocument{
+		md5sum:     documentString(a, MD5SUM_INDEX),
+		filename:   documentString(a, FILENAME_INDEX),
+		filepath:   documentString(a, FILEPATH_INDEX),
+		filetype:   documentString(a, FILETYPE_INDEX),
+		machineid:  documentString(a, MACHINEID_INDEX),
+		machineids: locationMachines(documentLocations(a)),
+		exif:       exif,
+		size:       documentInt(a, SIZE_INDEX),
+		imported:   documentInt(a, IMPORTTIME_INDEX),
+		modtime:    documentInt(a, MODTIME_INDEX),
+		city:       documentString(a, CITY_INDEX),
+		region:     documentString(a, REGION_INDEX),
+		country:    documentString(a, COUNTRY_INDEX),
+		curation:   documentCuration(a),
+	}
+}
+
+// function returns the curation of the photo document
+func documentCuration(a map[string]interface{}) photoCuration {
+	favourite, _ := a[FAVOURITE_INDEX].(bool)
+	return photoCuration{rating: int(documentInt(a, RATING_INDEX)), favourite: favourite, colorLabel: documentString(a, COLORLABEL_INDEX)}
+}
+
+// function sets the curation of the photo document
+func setDocumentCuration(a map[string]interface{}, c photoCuration) {
+	a[RATING_INDEX] = c.rating
+	a[FAVOURITE_INDEX] = c.favourite
+	a[COLORLABEL_INDEX] = c.colorLabel
+}
+
+// function sets the geohash of the photo document and its indexed cell, empty if the photo is not located
+func setDocumentGeohash(a map[string]interface{}, exif map[string]interface{}) {
+	hash := photoGeohash(exif)
+	a[GEOHASH_INDEX] = hash
+	if len(hash) > GEOCELL_PRECISION {
+		a[GEOCELL_INDEX] = hash[:GEOCELL_PRECISION]
+	} else {
+		a[GEOCELL_INDEX] = hash
+	}
+}
+
+// function sets the city, region and country of the photo document, empty if the photo has no place
+func setDocumentPlace(a map[string]interface{}, exif map[string]interface{}) {
+	place := photoPlace(exif)
+	a[CITY_INDEX] = place.City
+	a[REGION_INDEX] = place.Region
+	a[COUNTRY_INDEX] = place.Country
+}
+
+// function returns the copies of the photo document, the documents recorded before
+// the locations only have the copy of their machineid and filepath
+func documentLocations(a map[string]interface{}) []*PhotoLocation {
+	locations := make([]*PhotoLocation, 0)
+	switch values := a[LOCATIONS_INDEX].(type) {
+	case []*PhotoLocation:
+		locations = values
+	case []interface{}:
+		for _, value := range values {
+			if location, ok := value.(map[string]interface{}); ok {
+				locations = append(locations, &PhotoLocation{
+					MachineId: documentString(location, "machineid"),
+					Filepath:  documentString(location, "filepath"),
+					LastSeen:  documentInt(location, "last_seen"),
+				})
+			}
+		}
+	}
+	return recordLocations(locations, documentString(a, MACHINEID_INDEX), documentString(a, FILEPATH_INDEX), documentInt(a, IMPORTTIME_INDEX)/1000000)
+}
+
+// function stores the copies of the photo document, the first copy becomes the machineid and filepath of the document
+func setDocumentLocations(a map[string]interface{}, locations []*PhotoLocation) {
+	a[LOCATIONS_INDEX] = locations
+	primary := locations[0]
+	if primary.MachineId == documentString(a, MACHINEID_INDEX) && primary.Filepath == documentString(a, FILEPATH_INDEX) {
+		return
+	}
+	filename := locationFilename(primary, documentString(a, FILENAME_INDEX))
+	a[MACHINEID_INDEX] = primary.MachineId
+	a[FILEPATH_INDEX] = primary.Filepath
+	a[FILEPATHS_INDEX] = SplitAll(primary.Filepath)
+	a[FILENAME_INDEX] = filename
+	a[FILENAMES_INDEX] = SplitAll(filename)
+}
+
+// function returns the record of the photo document
+func documentRecord(a map[string]interface{}) *DatabasePhotoRecord {
+	doc := documentSearch(a)
+	record := NewDatabasePhotoResponse(
+		doc.md5sum,
+		doc.filename,
+		photoUri(doc.md5sum, doc.machineid, doc.filepath),
+		doc.machineid,
+		documentString(a, THUMBNAIL_INDEX),
+		doc.exif)
+	record.Type = doc.filetype
+	record.Size = doc.size
+	record.ModTime = doc.modtime
+	record.City, record.Region, record.Country = doc.city, doc.region, doc.country
+	doc.curation.setRecord(record)
+	record.ThumbnailUri = thumbnailUri(doc.md5sum, documentString(a, THUMBNAILID_INDEX))
+	record.ThumbnailSize = documentInt(a, THUMBNAILSIZE_INDEX)
+	record.Locations = documentLocations(a)
+	return record
+}
+
+func (d *DatabaseHandler) albumItems(albumName string) ([]string, error) {
+	md5sums := make([]string, 0)
+	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
+	queryResult, err := query.Eval(query.Eq(ALBUM_INDEX, albumName), feedsAlbum)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return md5sums, err
+	}
+	for id := range queryResult {
+		readBack, err := feedsAlbum.Read(id)
+		if err != nil {
+			logger.Errorf("Error while retrieving id %d with error : %v", id, err.Error())
+			continue
+		}
+		if items, ok := readBack[ALBUM_ITEMS].([]interface{}); ok {
+			for _, md5sum := range items {
+				md5sums = append(md5sums, md5sum.(string))
+			}
+		}
+	}
+	return md5sums, nil
+}
+
+func (d *DatabaseHandler) albumQuery(albumName string) (*SearchRequest, error) {
+	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
+	queryResult, err := query.Eval(query.Eq(ALBUM_INDEX, albumName), feedsAlbum)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return nil, err
+	}
+	for id := range queryResult {
+		readBack, err := feedsAlbum.Read(id)
+		if err != nil {
+			logger.Errorf("Error while retrieving id %d with error : %v", id, err.Error())
+			continue
+		}
+		if request := decodeAlbumQuery(albumName, documentString(readBack, ALBUM_QUERY)); request != nil {
+			return request, nil
+		}
+	}
+	return nil, nil
+}
+
+func (d *DatabaseHandler) albumParents() (map[string]string, error) {
+	parents := make(map[string]string)
+	var err error
+	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
+	feedsAlbum.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		var a map[string]interface{}
+		if err = json.Unmarshal(docContent, &a); err != nil {
+			logger.Error("Error while unmarshalling document with error : " + err.Error())
+			return false
+		}
+		parents[documentString(a, ALBUM_INDEX)] = documentString(a, ALBUM_PARENT)
+		return true
+	})
+	return parents, err
+}
+
+// function applies update on the documents of the albums of the query
+func (d *DatabaseHandler) updateAlbums(q query.Query, update func(doc map[string]interface{})) error {
+	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
+	queryResult, err := query.Eval(q, feedsAlbum)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return err
+	}
+	for id := range queryResult {
+		readBack, err := feedsAlbum.Read(id)
+		if err != nil {
+			logger.Errorf("Error while retrieving id %d with error : %v", id, err.Error())
+			return err
+		}
+		update(readBack)
+		if err = feedsAlbum.Update(id, readBack); err != nil {
+			logger.Errorf("Cannot update the album %s with error : %v", documentString(readBack, ALBUM_INDEX), err)
+			return err
+		}
+	}
+	return nil
+}
+
+// function sets the parent of the albums of the query
+func (d *DatabaseHandler) setAlbumsParent(q query.Query, parent string) error {
+	return d.updateAlbums(q, func(doc map[string]interface{}) { doc[ALBUM_PARENT] = parent })
+}
+
+func (d *DatabaseHandler) setAlbumItems(albumName string, md5sums []string) error {
+	return d.updateAlbums(query.Eq(ALBUM_INDEX, albumName), func(doc map[string]interface{}) { doc[ALBUM_ITEMS] = md5sums })
+}
+
+func (d *DatabaseHandler) setAlbumCover(albumName string, md5sum string) error {
+	return d.updateAlbums(query.Eq(ALBUM_INDEX, albumName), func(doc map[string]interface{}) { doc[ALBUM_COVER] = md5sum })
+}
+
+func (d *DatabaseHandler) ReorderAlbum(albumName string, md5sums []string) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	return reorderAlbum(d, albumName, md5sums)
+}
+
+func (d *DatabaseHandler) InsertAlbumPhotos(albumName string, md5sums []string, position int) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	return insertAlbumPhotos(d, albumName, md5sums, position)
+}
+
+func (d *DatabaseHandler) SortAlbumByDate(albumName string, descending bool) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	return sortAlbumByDate(d, albumName, descending)
+}
+
+func (d *DatabaseHandler) SetAlbumCover(albumName string, md5sum string) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	return updateAlbumCover(d, albumName, md5sum)
+}
+
+func (d *DatabaseHandler) GetAlbumTree() ([]*album.AlbumTreeMessage, error) {
+	return albumTree(d)
+}
+
+// function moves the album under the parent album, an empty parent moves the album to the root
+func (d *DatabaseHandler) MoveAlbum(albumName string, parent string) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	if err := checkAlbumMove(d, albumName, parent); err != nil {
+		return err
+	}
+	return d.setAlbumsParent(query.Eq(ALBUM_INDEX, albumName), parent)
+}
+
+func (d *DatabaseHandler) Search(request *SearchRequest) ([]*DatabasePhotoRecord, error) {
+	response := make([]*DatabasePhotoRecord, 0)
+	if err := request.Validate(); err != nil {
+		return response, err
+	}
+	albums, err := searchAlbums(request, albumPhotos(d))
+	if err != nil {
+		return response, err
+	}
+
+	keywords := d.searchKeywords(request)
+	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	feeds.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		var a map[string]interface{}
+		if err := json.Unmarshal(docContent, &a); err != nil {
+			logger.Error("Error while unmarshalling document with error : " + err.Error())
+			return true
+		}
+		doc := documentSearch(a)
+		doc.keywords = keywords[doc.md5sum]
+		if request.match(doc, albums) {
+			response = append(response, documentRecord(a))
+		}
+		return true
+	})
+
+	logger.Infof("request returns %d results for search %v\n", len(response), request)
+	return response, nil
+}
+
+func (d *DatabaseHandler) SearchPage(request *SearchRequest, page *PageRequest) (*PhotoPage, error) {
+	response := &PhotoPage{Records: make([]*DatabasePhotoRecord, 0)}
+	if request != nil {
+		if err := request.Validate(); err != nil {
+			return response, err
+		}
+	}
+	albums, err := searchAlbums(request, albumPhotos(d))
+	if err != nil {
+		return response, err
+	}
+
+	keywords := d.searchKeywords(request)
+	entries := make([]pageEntry, 0)
+	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	feeds.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		var a map[string]interface{}
+		if err := json.Unmarshal(docContent, &a); err != nil {
+			logger.Error("Error while unmarshalling document with error : " + err.Error())
+			return true
+		}
+		doc := documentSearch(a)
+		doc.keywords = keywords[doc.md5sum]
+		if request.match(doc, albums) {
+			entries = append(entries, pageEntry{key: page.key(doc), id: id})
+		}
+		return true
+	})
+
+	selected, total, next, err := page.selectPage(entries)
+	if err != nil {
+		return response, err
+	}
+	response.Total = &total
+	response.NextCursor = next
+	for _, entry := range selected {
+		readBack, err := feeds.Read(entry.id)
+		if err != nil {
+			logger.Errorf("Error while retrieving id %d with error : %v", entry.id, err.Error())
+			continue
+		}
+		response.Records = append(response.Records, documentRecord(readBack))
+	}
+	return response, nil
+}
+
+// function calls fn for each photo of the database, the writes must be blocked by the caller (see BlockWrites)
+func (d *DatabaseHandler) ExportPhotos(fn func(photo *BackupPhotoRecord) error) error {
+	var err error
+	keywords := d.photosKeywords()
+	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	feeds.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		var a map[string]interface{}
+		if err = json.Unmarshal(docContent, &a); err != nil {
+			logger.Error("Error while unmarshalling document with error : " + err.Error())
+			return false
+		}
+		doc := documentSearch(a)
+		err = fn(&BackupPhotoRecord{
+			Md5sum:     doc.md5sum,
+			MachineId:  doc.machineid,
+			Filename:   doc.filename,
+			Filepath:   doc.filepath,
+			Type:       doc.filetype,
+			Size:       doc.size,
+			ImportTime: doc.imported,
+			ModTime:    doc.modtime,
+			ExifTags:   doc.exif,
+			Locations:  documentLocations(a),
+			Keywords:   keywords[doc.md5sum],
+			Rating:     doc.curation.rating,
+			Favourite:  doc.curation.favourite,
+			ColorLabel: doc.curation.colorLabel,
+			Thumbnail:  d.documentThumbnail(a),
+		})
+		return err == nil
+	})
+	return err
+}
+
+// function calls fn for each album of the database, the writes must be blocked by the caller (see BlockWrites)
+func (d *DatabaseHandler) ExportAlbums(fn func(a *album.AlbumMessage) error) error {
+	var err error
+	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
+	feedsAlbum.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		var a map[string]interface{}
+		if err = json.Unmarshal(docContent, &a); err != nil {
+			logger.Error("Error while unmarshalling document with error : " + err.Error())
+			return false
+		}
+		message := album.NewAlbumMessage(documentString(a, ALBUM_INDEX), make([]string, 0))
+		message.Description = documentString(a, ALBUM_DESCRIPTION)
+		if items, ok := a[ALBUM_ITEMS].([]interface{}); ok {
+			for _, md5sum := range items {
+				message.Md5sums = append(message.Md5sums, md5sum.(string))
+			}
+		}
+		if tags, ok := a[ALBUM_TAGS].([]interface{}); ok {
+			for _, tag := range tags {
+				message.Tags = append(message.Tags, tag.(string))
+			}
+		}
+		message.Parent = documentString(a, ALBUM_PARENT)
+		message.Cover = documentString(a, ALBUM_COVER)
+		message.Owner = documentString(a, ALBUM_OWNER)
+		setAlbumMessageQuery(message, decodeAlbumQuery(message.AlbumName, documentString(a, ALBUM_QUERY)))
+		err = fn(message)
+		return err == nil
+	})
+	return err
+}
+
+// function inserts the photo of a backup, PictureAlreadyExists is returned if the md5sum is already stored.
+// the writes must be blocked by the caller (see BlockWrites)
+func (d *DatabaseHandler) RestorePhoto(photo *BackupPhotoRecord) error {
+	exists, err := d.PictureExists(photo.Md5sum)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return PictureAlreadyExists
+	}
+	thumbnailId, thumbnailSize, err := d.Thumbnails.PutBase64(photo.Thumbnail)
+	if err != nil {
+		logger.Errorf("Cannot store thumbnail of %s with error : %v", photo.Md5sum, err)
+	}
+	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	doc := map[string]interface{}{
+		MACHINEID_INDEX:     photo.MachineId,
+		FILENAME_INDEX:      photo.Filename,
+		FILENAMES_INDEX:     SplitAll(photo.Filename),
+		FILEPATH_INDEX:      photo.Filepath,
+		FILEPATHS_INDEX:     SplitAll(photo.Filepath),
+		MD5SUM_INDEX:        photo.Md5sum,
+		EXIFTAGS_INDEX:      photo.ExifTags,
+		THUMBNAILID_INDEX:   thumbnailId,
+		THUMBNAILSIZE_INDEX: thumbnailSize,
+		SIZE_INDEX:          photo.Size,
+		IMPORTTIME_INDEX:    photo.ImportTime,
+		MODTIME_INDEX:       photo.ModTime,
+		LOCATIONS_INDEX:     recordLocations(photo.Locations, photo.MachineId, photo.Filepath, photo.ImportTime/1000000),
+		FILETYPE_INDEX:      photo.Type}
+	setDocumentGeohash(doc, photo.ExifTags)
+	setDocumentPlace(doc, photo.ExifTags)
+	setDocumentCuration(doc, photo.curation())
+	if _, err = feeds.Insert(doc); err != nil {
+		logger.Errorf("Cannot restore photo %s in database with error : %v", photo.Md5sum, err)
+		return err
+	}
+	d.addStats(photo.ExifTags, photo.ModTime, 1)
+	if len(photo.Keywords) > 0 {
+		return d.setKeywords(photo.Md5sum, func(current []string) []string { return mergeKeywords(current, photo.Keywords) })
+	}
+	return nil
+}
+
+// function creates the album of a backup or replaces the stored album with the same name.
+// the writes must be blocked by the caller (see BlockWrites)
+func (d *DatabaseHandler) RestoreAlbum(a *album.AlbumMessage) error {
+	request, err := SmartAlbumQuery(a)
+	if err != nil {
+		return err
+	}
+	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
+	queryResult, err := query.Eval(query.Eq(ALBUM_INDEX, a.AlbumName), feedsAlbum)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return err
+	}
+	doc := map[string]interface{}{
+		ALBUM_INDEX:       a.AlbumName,
+		ALBUM_ITEMS:       a.Md5sums,
+		ALBUM_DESCRIPTION: a.Description,
+		ALBUM_TAGS:        a.Tags,
+		ALBUM_QUERY:       encodeAlbumQuery(request),
+		ALBUM_PARENT:      a.Parent,
+		ALBUM_COVER:       a.Cover,
+		ALBUM_OWNER:       a.Owner,
+	}
+	if len(queryResult) == 0 {
+		_, err = feedsAlbum.Insert(doc)
+	}
+	for id := range queryResult {
+		err = feedsAlbum.Update(id, doc)
+	}
+	if err != nil {
+		logger.Errorf("Cannot restore album %s in database with error : %v", a.AlbumName, err)
+	}
+	return err
+}
+
+// function returns the copies of the photo md5sum
+func (d *DatabaseHandler) GetPhotoLocations(md5sum string) ([]*PhotoLocation, error) {
+	locations := make([]*PhotoLocation, 0)
+	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	queryResult, err := query.Eval(query.Eq(MD5SUM_INDEX, md5sum), feeds)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return locations, ErrorWhileRetreivingPicture
+	}
+	for id := range queryResult {
+		readBack, err := feeds.Read(id)
+		if err != nil {
+			logger.Errorf("Error while retrieving id %d with error : %v", id, err.Error())
+			continue
+		}
+		locations = mergeLocations(locations, documentLocations(readBack))
+	}
+	return locations, nil
+}
+
+// function returns the base64 thumbnail of the photo document, read from the thumbnail store
+// or from the document itself if it has not been migrated
+func (d *DatabaseHandler) documentThumbnail(a map[string]interface{}) string {
+	if thumbnail := documentString(a, THUMBNAIL_INDEX); thumbnail != "" {
+		return thumbnail
+	}
+	return d.Thumbnails.Base64(documentString(a, THUMBNAILID_INDEX))
+}
+
+// function returns the thumbnail of the photo md5sum
+func (d *DatabaseHandler) GetThumbnail(md5sum string) (*Thumbnail, error) {
+	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	queryResult, err := query.Eval(query.Eq(MD5SUM_INDEX, md5sum), feeds)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return nil, ErrorWhileRetreivingPicture
+	}
+	for id := range queryResult {
+		readBack, err := feeds.Read(id)
+		if err != nil {
+			logger.Errorf("Error while retrieving id %d with error : %v", id, err.Error())
+			continue
+		}
+		if thumbnailId := documentString(readBack, THUMBNAILID_INDEX); thumbnailId != "" {
+			return d.Thumbnails.Get(thumbnailId)
+		}
+		if thumbnail := documentString(readBack, THUMBNAIL_INDEX); thumbnail != "" {
+			content, err := base64.StdEncoding.DecodeString(thumbnail)
+			if err != nil {
+				return nil, err
+			}
+			return &Thumbnail{Id: ThumbnailId(content), Content: content}, nil
+		}
+	}
+	return nil, ThumbnailNotFound
+}
+
+// function removes the thumbnails of the store which no photo references
+func (d *DatabaseHandler) sweepThumbnails() error {
+	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	queryResult, err := query.Eval(query.All(), feeds)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return err
+	}
+	referenced := make(map[string]bool)
+	for id := range queryResult {
+		readBack, err := feeds.Read(id)
+		if err != nil {
+			logger.Errorf("Error while retrieving id %d with error : %v", id, err.Error())
+			return err
+		}
+		if thumbnailId := documentString(readBack, THUMBNAILID_INDEX); thumbnailId != "" {
+			referenced[thumbnailId] = true
+		}
+	}
+	_, err = d.Thumbnails.Sweep(referenced, time.Now())
+	return err
+}
+
+// function moves the base64 thumbnails stored in the photo documents to the thumbnail store
+func (d *DatabaseHandler) migrateThumbnails() error {
+	feeds := d.DBConnection.Use(DBPHOTO_COLLECTION)
+	ids := make([]int, 0)
+	feeds.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		var a map[string]interface{}
+		if err := json.Unmarshal(docContent, &a); err != nil {
+			logger.Error("Error while unmarshalling document with error : " + err.Error())
+			return true
+		}
+		if _, ok := a[THUMBNAIL_INDEX]; ok {
+			ids = append(ids, id)
+		}
+		return true
+	})
+	if len(ids) == 0 {
+		return nil
+	}
+	logger.Infof("Moving %d thumbnails to the thumbnail store %s", len(ids), d.Thumbnails.Path)
+	for _, id := range ids {
+		readBack, err := feeds.Read(id)
+		if err != nil {
+			logger.Errorf("Error while retrieving id %d with error : %v", id, err.Error())
+			continue
+		}
+		thumbnailId, thumbnailSize, err := d.Thumbnails.PutBase64(documentString(readBack, THUMBNAIL_INDEX))
+		if err != nil {
+			logger.Errorf("Cannot store thumbnail of document %d with error : %v", id, err)
+			continue
+		}
+		delete(readBack, THUMBNAIL_INDEX)
+		readBack[THUMBNAILID_INDEX] = thumbnailId
+		readBack[THUMBNAILSIZE_INDEX] = thumbnailSize
+		if err = feeds.Update(id, readBack); err != nil {
+			logger.Errorf("Cannot update document %d with error : %v", id, err)
+			return err
+		}
+	}
+	return d.DBConnection.Scrub(DBPHOTO_COLLECTION)
+}
+
+// function adds delta to the stats counters of the photo exif
+func (d *DatabaseHandler) addStats(exif map[string]interface{}, modtime int64, delta int) {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	for groupby, date := range statsDates(exif, modtime) {
+		d.addStat(groupby+"|"+date, map[string]interface{}{STATS_GROUPBY: groupby, STATS_DATE: date}, delta)
+	}
+	if cell, ok := statsLocation(exif); ok {
+		d.addStat(fmt.Sprintf("location|%v|%v", cell[0], cell[1]), map[string]interface{}{STATS_LATITUDE: cell[0], STATS_LONGITUDE: cell[1]}, delta)
+	}
+}
+
+// function adds delta to the counter key, the document is inserted for a new key
+// and removed when the counter is 0
+func (d *DatabaseHandler) addStat(key string, doc map[string]interface{}, delta int) {
+	feeds := d.DBConnection.Use(DBSTATS_COLLECTION)
+	queryResult, err := query.Eval(query.Eq(STATS_KEY_INDEX, key), feeds)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return
+	}
+	for id := range queryResult {
+		readBack, err := feeds.Read(id)
+		if err != nil || documentString(readBack, STATS_KEY_INDEX) != key {
+			continue
+		}
+		count := documentInt(readBack, STATS_COUNT) + int64(delta)
+		if count <= 0 {
+			err = feeds.Delete(id)
+		} else {
+			readBack[STATS_COUNT] = count
+			err = feeds.Update(id, readBack)
+		}
+		if err != nil {
+			logger.Errorf("Error while updating stats %s with error : %v", key, err)
+		}
+		return
+	}
+	if delta > 0 {
+		doc[STATS_KEY_INDEX] = key
+		doc[STATS_COUNT] = delta
+		if _, err := feeds.Insert(doc); err != nil {
+			logger.Errorf("Error while inserting stats %s with error : %v", key, err)
+		}
+	}
+}
+
+// function computes again the stats counters from all the photos
+func (d *DatabaseHandler) rebuildStats() error {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+	counters := newStatsCounters()
+	d.DBConnection.Use(DBPHOTO_COLLECTION).ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		var a map[string]interface{}
+		if err := json.Unmarshal(docContent, &a); err != nil {
+			logger.Error("Error while unmarshalling document with error : " + err.Error())
+			return true
+		}
+		counters.add(documentExif(a), documentInt(a, MODTIME_INDEX), 1)
+		return true
+	})
+
+	feeds := d.DBConnection.Use(DBSTATS_COLLECTION)
+	ids := make([]int, 0)
+	feeds.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		ids = append(ids, id)
+		return true
+	})
+	for _, id := range ids {
+		if err := feeds.Delete(id); err != nil {
+			return err
+		}
+	}
+	for groupby, dates := range counters.times {
+		for date, count := range dates {
+			if _, err := feeds.Insert(map[string]interface{}{STATS_KEY_INDEX: groupby + "|" + date,
+				STATS_GROUPBY: groupby, STATS_DATE: date, STATS_COUNT: count}); err != nil {
+				return err
+			}
+		}
+	}
+	for cell, count := range counters.locations {
+		if _, err := feeds.Insert(map[string]interface{}{STATS_KEY_INDEX: fmt.Sprintf("location|%v|%v", cell[0], cell[1]),
+			STATS_LATITUDE: cell[0], STATS_LONGITUDE: cell[1], STATS_COUNT: count}); err != nil {
+			return err
+		}
+	}
+	if _, err := feeds.Insert(map[string]interface{}{STATS_KEY_INDEX: STATS_VERSION_KEY, STATS_COUNT: STATS_VERSION}); err != nil {
+		return err
+	}
+	logger.Infof("Stats computed for %d dates and %d locations", len(counters.times[STATS_DAY]), len(counters.locations))
+	return nil
+}
+
+// function computes the stats counters of the photos stored before the counters
+// or counted by a previous version of the stats
+func (d *DatabaseHandler) migrateStats() error {
+	feeds := d.DBConnection.Use(DBSTATS_COLLECTION)
+	queryResult, err := query.Eval(query.Eq(STATS_KEY_INDEX, STATS_VERSION_KEY), feeds)
+	if err != nil {
+		return err
+	}
+	for id := range queryResult {
+		if readBack, err := feeds.Read(id); err == nil && documentInt(readBack, STATS_COUNT) == STATS_VERSION {
+			return nil
+		}
+	}
+	return d.rebuildStats()
+}
+
 func Reduce(responses []*DatabasePhotoRecord, size string) []*DatabasePhotoRecord {
 
 	finalResponses := make([]*DatabasePhotoRecord, 0)
@@ -1270,11 +2576,11 @@ func Reduce(responses []*DatabasePhotoRecord, size string) []*DatabasePhotoRecor
 			case modele.FILESIZE_LITTLE:
 				finalResponses = append(finalResponses, response)
 			case modele.FILESIZE_MEDIUM:
-				if len(response.Image) > 15000 {
+				if thumbnailLength(response) > 15000 {
 					finalResponses = append(finalResponses, response)
 				}
 			case modele.FILESIZE_BIG:
-				if len(response.Image) > 25000 {
+				if thumbnailLength(response) > 25000 {
 					finalResponses = append(finalResponses, response)
 				}
 			default:
@@ -1290,6 +2596,9 @@ func ReduceAlbumMessage(album *DatabaseAlbumRecord, size string) *DatabaseAlbumR
 	finalResponses.AlbumName = album.AlbumName
 	finalResponses.Description = album.Description
 	finalResponses.Tags = album.Tags
+	finalResponses.Query = album.Query
+	finalResponses.Parent = album.Parent
+	finalResponses.Owner = album.Owner
 	for _, response := range album.Records {
 		alreadyStored := false
 		for _, r := range finalResponses.Records {
@@ -1304,11 +2613,11 @@ func ReduceAlbumMessage(album *DatabaseAlbumRecord, size string) *DatabaseAlbumR
 			case modele.FILESIZE_LITTLE:
 				finalResponses.Records = append(finalResponses.Records, response)
 			case modele.FILESIZE_MEDIUM:
-				if len(response.Image) > 15000 {
+				if thumbnailLength(response) > 15000 {
 					finalResponses.Records = append(finalResponses.Records, response)
 				}
 			case modele.FILESIZE_BIG:
-				if len(response.Image) > 25000 {
+				if thumbnailLength(response) > 25000 {
 					finalResponses.Records = append(finalResponses.Records, response)
 				}
 			default:
@@ -1316,5 +2625,143 @@ func ReduceAlbumMessage(album *DatabaseAlbumRecord, size string) *DatabaseAlbumR
 			}
 		}
 	}
+	finalResponses.Cover = albumCover(finalResponses.Records, album.Cover)
 	return finalResponses
 }
+
+// function returns the share link of the document
+func documentShare(a map[string]interface{}) *DatabaseShareRecord {
+	download, _ := a[SHARE_DOWNLOAD].(bool)
+	return &DatabaseShareRecord{
+		Token:     documentString(a, SHARE_TOKEN),
+		AlbumName: documentString(a, ALBUM_INDEX),
+		Expires:   time.Unix(documentInt(a, SHARE_EXPIRES), 0).UTC(),
+		Password:  documentString(a, SHARE_PASSWORD),
+		Download:  download,
+		Created:   time.Unix(documentInt(a, SHARE_CREATED), 0).UTC(),
+	}
+}
+
+// function returns the ids and the share links selected, the share links are few and not indexed
+func (d *DatabaseHandler) shares(selected func(share *DatabaseShareRecord) bool) (map[int]*DatabaseShareRecord, error) {
+	shares := make(map[int]*DatabaseShareRecord)
+	feeds := d.DBConnection.Use(DBSHARES_COLLECTION)
+	feeds.ForEachDoc(func(id int, docContent []byte) (willMoveOn bool) {
+		var a map[string]interface{}
+		if err := json.Unmarshal(docContent, &a); err != nil {
+			logger.Error("Error while unmarshalling document with error : " + err.Error())
+			return true
+		}
+		if share := documentShare(a); selected(share) {
+			shares[id] = share
+		}
+		return true
+	})
+	return shares, nil
+}
+
+// function removes the share links selected and returns the number of share links removed
+func (d *DatabaseHandler) deleteShares(selected func(share *DatabaseShareRecord) bool) (int, error) {
+	shares, err := d.shares(selected)
+	if err != nil {
+		return 0, err
+	}
+	feeds := d.DBConnection.Use(DBSHARES_COLLECTION)
+	for id := range shares {
+		if err := feeds.Delete(id); err != nil {
+			logger.Errorf("Cannot delete the share link %d with error : %v", id, err)
+			return 0, err
+		}
+	}
+	return len(shares), nil
+}
+
+// function stores the share link of an album
+func (d *DatabaseHandler) InsertShare(share *DatabaseShareRecord) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	return d.insertShare(share)
+}
+
+// function creates the share link of a backup or replaces the stored share link with the same token.
+// the writes must be blocked by the caller (see BlockWrites)
+func (d *DatabaseHandler) RestoreShare(share *DatabaseShareRecord) error {
+	if _, err := d.deleteShares(func(stored *DatabaseShareRecord) bool { return stored.Token == share.Token }); err != nil {
+		return err
+	}
+	return d.insertShare(share)
+}
+
+func (d *DatabaseHandler) insertShare(share *DatabaseShareRecord) error {
+	if err := checkShareAlbum(d, share.AlbumName); err != nil {
+		return err
+	}
+	feeds := d.DBConnection.Use(DBSHARES_COLLECTION)
+	_, err := feeds.Insert(map[string]interface{}{
+		SHARE_TOKEN:    share.Token,
+		ALBUM_INDEX:    share.AlbumName,
+		SHARE_EXPIRES:  share.Expires.Unix(),
+		SHARE_PASSWORD: share.Password,
+		SHARE_DOWNLOAD: share.Download,
+		SHARE_CREATED:  share.Created.Unix(),
+	})
+	if err != nil {
+		logger.Errorf("Cannot store the share link of the album %s with error : %v", share.AlbumName, err)
+	}
+	return err
+}
+
+// function returns the share link of the token, ShareNotFound if the token does not exist
+func (d *DatabaseHandler) GetShare(token string) (*DatabaseShareRecord, error) {
+	shares, err := d.shares(func(share *DatabaseShareRecord) bool { return share.Token == token })
+	if err != nil {
+		return nil, err
+	}
+	for _, share := range shares {
+		return share, nil
+	}
+	return nil, ShareNotFound
+}
+
+// function returns the share links of the album sorted by creation date, all the share links without album
+func (d *DatabaseHandler) GetShares(albumName string) ([]*DatabaseShareRecord, error) {
+	shares, err := d.shares(func(share *DatabaseShareRecord) bool { return albumName == "" || share.AlbumName == albumName })
+	records := make([]*DatabaseShareRecord, 0, len(shares))
+	for _, share := range shares {
+		records = append(records, share)
+	}
+	return sortShares(records), err
+}
+
+// function removes the share link of the token, ShareNotFound if the token does not exist
+func (d *DatabaseHandler) DeleteShare(token string) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	deleted, err := d.deleteShares(func(share *DatabaseShareRecord) bool { return share.Token == token })
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ShareNotFound
+	}
+	return nil
+}
+
+// function returns the owner of the album, AlbumNotFound if the album does not exist
+func (d *DatabaseHandler) GetAlbumOwner(albumName string) (string, error) {
+	feedsAlbum := d.DBConnection.Use(DBALBUM_COLLECTION)
+	queryResult, err := query.Eval(query.Eq(ALBUM_INDEX, albumName), feedsAlbum)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return "", err
+	}
+	for id := range queryResult {
+		readBack, err := feedsAlbum.Read(id)
+		if err != nil {
+			logger.Errorf("Error while retrieving id %d with error : %v", id, err)
+			return "", err
+		}
+		return documentString(readBack, ALBUM_OWNER), nil
+	}
+	return "", AlbumNotFound
+}
@@ -2,17 +2,90 @@
 package database
 
 import (
+	"fmt"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/configurationapp"
 	"github.com/jeromelesaux/photo/modele"
+	"github.com/pkg/errors"
+)
+
+const (
+	DATABASE_TIEDOT = "tiedot"
+	DATABASE_SQLITE = "sqlite"
 )
 
 // interface of all mandatories functions
 type DatabaseInterface interface {
 	InsertNewData(response *modele.PhotoResponse) error
+	PictureExists(md5sum string) (bool, error)
+	MovePhoto(machineid string, move *modele.PhotoMove) error
+	DeletePhoto(machineid string, photo *modele.PhotoInformations) error
 	QueryAll() ([]*DatabasePhotoRecord, error)
 	QueryExtension(pattern string) ([]*DatabasePhotoRecord, error)
 	QueryFilename(pattern string) ([]*DatabasePhotoRecord, error)
 	QueryExifTag(pattern string, exiftag string) ([]*DatabasePhotoRecord, error)
+	QueryByTag(tag string) ([]*DatabasePhotoRecord, error)
+	Search(request *SearchRequest) ([]*DatabasePhotoRecord, error)
+	SearchPage(request *SearchRequest, page *PageRequest) (*PhotoPage, error)
+	GetPhotosUrl(md5sums []string) ([]*DatabasePhotoRecord, error)
+	GetPhotosFromTime(queryDate string, groupby string, dates *DateRange) ([]*DatabasePhotoRecord, error)
+	GetPhotosFromCoordinates(lat, lng string) ([]*DatabasePhotoRecord, error)
+	GetPhotosFromArea(area *GeoArea) ([]*DatabasePhotoRecord, error)
+	GetLocationClusters(zoom int, area *GeoArea) (*album.LocationClustersMessage, error)
+	GetPlaceStats(level string) (*album.PlaceStatsMessage, error)
+	GetOriginStats() (*album.OriginStatsMessage, error)
+	GetTimeStats(groupby string, dates *DateRange) (*album.TimeStatsMessage, error)
+	GetLocationStats() (*album.LocationStatsMessage, error)
+	GetAlbumList() []string
+	AlbumExists(albumName string) (bool, error)
+	GetAlbumData(albumName string) *DatabaseAlbumRecord
+	InsertNewAlbum(response *album.AlbumMessage) error
+	UpdateAlbum(response *album.AlbumMessage) error
+	DeleteAlbum(response *album.AlbumMessage) error
+	DeletePhotoAlbum(response *album.AlbumMessage) error
+	GetAlbumTree() ([]*album.AlbumTreeMessage, error)
+	MoveAlbum(albumName string, parent string) error
+	GetAlbumOwner(albumName string) (string, error)
+	ReorderAlbum(albumName string, md5sums []string) error
+	InsertAlbumPhotos(albumName string, md5sums []string, position int) error
+	SortAlbumByDate(albumName string, descending bool) error
+	SetAlbumCover(albumName string, md5sum string) error
 	CleanDatabase() error
+	ExportPhotos(fn func(photo *BackupPhotoRecord) error) error
+	ExportAlbums(fn func(a *album.AlbumMessage) error) error
+	RestorePhoto(photo *BackupPhotoRecord) error
+	RestoreAlbum(a *album.AlbumMessage) error
+	GetThumbnail(md5sum string) (*Thumbnail, error)
+	GetPhotoLocations(md5sum string) ([]*PhotoLocation, error)
+	AddKeywords(md5sums []string, keywords []string) error
+	RemoveKeywords(md5sums []string, keywords []string) error
+	GetPhotoKeywords(md5sum string) ([]string, error)
+	SuggestKeywords(prefix string, limit int) (*album.KeywordsMessage, error)
+	UpdateCuration(message *album.CurationMessage) error
+	UpdatePhotoMetadata(update *modele.MetadataUpdate, md5sum string) error
+	InsertShare(share *DatabaseShareRecord) error
+	GetShare(token string) (*DatabaseShareRecord, error)
+	GetShares(albumName string) ([]*DatabaseShareRecord, error)
+	DeleteShare(token string) error
+	RestoreShare(share *DatabaseShareRecord) error
+}
+
+// function returns the database implementation set in the application configuration
+// (database_type : tiedot by default or sqlite)
+func NewDatabase() (DatabaseInterface, error) {
+	conf := configurationapp.GetConfiguration()
+	if conf == nil {
+		return nil, errors.New("No configuration loaded")
+	}
+	switch conf.DatabaseType {
+	case DATABASE_SQLITE:
+		return NewSqliteDatabaseHandler()
+	case DATABASE_TIEDOT, "":
+		return NewDatabaseHandler()
+	default:
+		return nil, fmt.Errorf("Unknown database type %s", conf.DatabaseType)
+	}
 }
 
 // structure of a photo record
@@ -25,6 +98,22 @@ type DatabasePhotoRecord struct {
 	Image     string                 `json:"image"`
 	MachineId string                 `json:"machineid"`
 	Thumbnail string                 `json:"thumbnail"`
+	Size      int64                  `json:"size,omitempty"`
+	// modification time of the file in seconds since epoch
+	ModTime int64 `json:"modtime,omitempty"`
+	// place of the gazetteer nearest to the photo
+	City    string `json:"city,omitempty"`
+	Region  string `json:"region,omitempty"`
+	Country string `json:"country,omitempty"`
+	// curation of the user, 0 to 5 stars, favourite and colour label
+	Rating     int    `json:"rating,omitempty"`
+	Favourite  bool   `json:"favourite,omitempty"`
+	ColorLabel string `json:"color_label,omitempty"`
+	// uri of the thumbnail stored in the thumbnail store
+	ThumbnailUri  string `json:"thumbnail_uri,omitempty"`
+	ThumbnailSize int64  `json:"-"`
+	// every copy of the photo, the first one is the machineid and filepath of the record
+	Locations []*PhotoLocation `json:"locations,omitempty"`
 }
 
 // structure of an album record
@@ -33,6 +122,14 @@ type DatabaseAlbumRecord struct {
 	Description string                 `json:"description"`
 	Tags        []string               `json:"tags"`
 	Records     []*DatabasePhotoRecord `json:"records"`
+	// query of a smart album, nil for a static album
+	Query *SearchRequest `json:"query,omitempty"`
+	// name of the parent album, empty for a root album
+	Parent string `json:"parent,omitempty"`
+	// md5sum of the cover photo, the first photo if the user did not choose one
+	Cover string `json:"cover,omitempty"`
+	// name of the user who created the album
+	Owner string `json:"owner,omitempty"`
 }
 
 // functions returns a new pointer of databaseAlbumRecord
@@ -57,3 +154,13 @@ func NewDatabasePhotoResponse(md5sum string, filename string, filepath string, m
 		ExifTags:  exiftags,
 	}
 }
+
+// function returns the uri used by the UI to get the photo,
+// cloud photos are reached directly whereas local photos are served by the controller
+// which falls back on the other copies of the md5sum if the machine is offline
+func photoUri(md5sum string, machineid string, filepath string) string {
+	if machineid != modele.ORIGIN_FLICKR && machineid != modele.ORIGIN_GOOGLE {
+		return fmt.Sprintf("/photo?filepath=%s&machineid=%s&md5sum=%s", filepath, machineid, md5sum)
+	}
+	return filepath
+}
@@ -0,0 +1,31 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/jeromelesaux/photo/modele"
+)
+
+const (
+	// tag of the iptc keywords of the photos, the keywords are separated by a comma
+	IPTC_KEYWORDS_TAG = "iptc:Keywords"
+	IPTC_SEPARATOR    = ","
+)
+
+// function returns the iptc keywords of the tags trimmed and lower cased,
+// the keywords longer than KEYWORD_MAX_LENGTH are ignored
+func iptcKeywords(tags map[string]string) []string {
+	keywords := make([]string, 0)
+	for _, keyword := range strings.Split(tags[IPTC_KEYWORDS_TAG], IPTC_SEPARATOR) {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if keyword != "" && len(keyword) <= KEYWORD_MAX_LENGTH {
+			keywords = mergeKeywords(keywords, []string{keyword})
+		}
+	}
+	return keywords
+}
+
+// function returns the keywords of the metadata of the photo : its xmp and its iptc keywords
+func photoKeywords(item *modele.PhotoInformations) []string {
+	return mergeKeywords(xmpKeywords(item.Xmp), iptcKeywords(item.Tags))
+}
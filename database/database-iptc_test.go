@@ -0,0 +1,47 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jeromelesaux/photo/modele"
+)
+
+func TestIptcKeywords(t *testing.T) {
+	keywords := iptcKeywords(map[string]string{IPTC_KEYWORDS_TAG: "Scan, Family,, family "})
+	if !reflect.DeepEqual(keywords, []string{"family", "scan"}) {
+		t.Fatalf("expected [family scan] and received %v", keywords)
+	}
+	if keywords := iptcKeywords(nil); len(keywords) != 0 {
+		t.Fatalf("expected no keyword without iptc, received %v", keywords)
+	}
+}
+
+func TestIptc(t *testing.T) {
+	for name, d := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			testIptc(t, d)
+		})
+	}
+}
+
+func testIptc(t *testing.T, d DatabaseInterface) {
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "scan-001.jpg", Filepath: "/scans/scan-001.jpg", Tags: map[string]string{
+			IPTC_KEYWORDS_TAG:       "Family, Scan",
+			"iptc:Caption-Abstract": "Mamie à la plage",
+			"iptc:By-line":          "Studio Photo",
+		}, Xmp: &modele.XmpInformations{Keywords: []string{"Beach"}}},
+		{Md5Sum: "md5-2", Filename: "b.jpg", Filepath: "/b.jpg", Tags: map[string]string{"Model": "NIKON D80"}},
+	}))
+
+	if keywords, _ := d.GetPhotoKeywords("md5-1"); !reflect.DeepEqual(keywords, []string{"beach", "family", "scan"}) {
+		t.Fatalf("expected the iptc and xmp keywords and received %v", keywords)
+	}
+	if records, _ := d.Search(&SearchRequest{Field: SEARCH_KEYWORD, Value: "Scan"}); len(records) != 1 || records[0].Md5sum != "md5-1" {
+		t.Fatalf("expected the scanned photo with the keyword scan, received %v", records)
+	}
+	if records, _ := d.Search(&SearchRequest{Field: SEARCH_EXIF, Tag: "caption", Value: "plage"}); len(records) != 1 {
+		t.Fatalf("expected the scanned photo of the caption, received %d photos", len(records))
+	}
+}
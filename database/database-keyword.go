@@ -0,0 +1,141 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/pkg/errors"
+)
+
+// maximum length of a keyword of the photos
+const KEYWORD_MAX_LENGTH = 100
+
+var PictureNotFound = errors.New("Picture not found in database.")
+
+// function returns the keywords trimmed and lower cased without duplicates,
+// an error if no keyword is given or if a keyword is too long
+func NormalizeKeywords(keywords []string) ([]string, error) {
+	normalized := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if keyword == "" {
+			continue
+		}
+		if len(keyword) > KEYWORD_MAX_LENGTH {
+			return nil, fmt.Errorf("Keyword %s is longer than %d characters", keyword, KEYWORD_MAX_LENGTH)
+		}
+		normalized = mergeKeywords(normalized, []string{keyword})
+	}
+	if len(normalized) == 0 {
+		return nil, errors.New("No keyword given")
+	}
+	return normalized, nil
+}
+
+// function returns the sorted keywords of current and added without duplicates
+func mergeKeywords(current []string, added []string) []string {
+	merged := append([]string{}, current...)
+	for _, keyword := range added {
+		if !containsKeyword(merged, keyword) {
+			merged = append(merged, keyword)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// function returns the keywords of current which are not removed
+func removeKeywords(current []string, removed []string) []string {
+	remaining := make([]string, 0, len(current))
+	for _, keyword := range current {
+		if !containsKeyword(removed, keyword) {
+			remaining = append(remaining, keyword)
+		}
+	}
+	return remaining
+}
+
+func containsKeyword(keywords []string, keyword string) bool {
+	for _, k := range keywords {
+		if k == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// function returns true if the value is a keyword of the photo (case insensitive)
+func (doc *searchDocument) hasKeyword(value string) bool {
+	return containsKeyword(doc.keywords, strings.ToLower(strings.TrimSpace(value)))
+}
+
+// counters of the photos by keyword
+type keywordCounters map[string]int
+
+// function counts the photo of each keyword
+func (k keywordCounters) add(keywords []string) {
+	for _, keyword := range keywords {
+		k[keyword]++
+	}
+}
+
+// function returns the keywords starting with prefix sorted by number of photos, at most limit keywords
+// (all the keywords if limit is not positive)
+func (k keywordCounters) message(prefix string, limit int) *album.KeywordsMessage {
+	response := album.NewKeywordsMessage()
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	for keyword, count := range k {
+		if strings.HasPrefix(keyword, prefix) {
+			response.Keywords = append(response.Keywords, &album.KeywordMessage{Keyword: keyword, Count: count})
+		}
+	}
+	sort.Slice(response.Keywords, func(i, j int) bool {
+		a, b := response.Keywords[i], response.Keywords[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Keyword < b.Keyword
+	})
+	if limit > 0 && len(response.Keywords) > limit {
+		response.Keywords = response.Keywords[:limit]
+	}
+	return response
+}
+
+// function returns PictureNotFound if one of the md5sums is not stored in the database
+func picturesExist(d DatabaseInterface, md5sums []string) error {
+	if len(md5sums) == 0 {
+		return errors.New("No photo given")
+	}
+	for _, md5sum := range md5sums {
+		exists, err := d.PictureExists(md5sum)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return errors.Wrap(PictureNotFound, md5sum)
+		}
+	}
+	return nil
+}
+
+// function appends to the records the photos with the keyword tag which are not already in records
+func appendKeywordPhotos(d DatabaseInterface, records []*DatabasePhotoRecord, tag string) ([]*DatabasePhotoRecord, error) {
+	tagged, err := d.Search(&SearchRequest{Field: SEARCH_KEYWORD, Value: tag})
+	if err != nil {
+		return records, err
+	}
+	found := make(map[string]bool)
+	for _, r := range records {
+		found[r.Md5sum] = true
+	}
+	for _, r := range tagged {
+		if !found[r.Md5sum] {
+			records = append(records, r)
+			found[r.Md5sum] = true
+		}
+	}
+	return records, nil
+}
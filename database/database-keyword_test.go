@@ -0,0 +1,88 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jeromelesaux/photo/modele"
+	"github.com/pkg/errors"
+)
+
+func TestNormalizeKeywords(t *testing.T) {
+	keywords, err := NormalizeKeywords([]string{" Sunset", "beach ", "", "SUNSET"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keywords, []string{"beach", "sunset"}) {
+		t.Fatalf("expected [beach sunset] and received %v", keywords)
+	}
+	if _, err := NormalizeKeywords([]string{" "}); err == nil {
+		t.Fatal("expected an error without keyword")
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	for name, d := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			testKeywords(t, d)
+		})
+	}
+}
+
+func testKeywords(t *testing.T, d DatabaseInterface) {
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "a.jpg", Filepath: "/a.jpg"},
+		{Md5Sum: "md5-2", Filename: "b.jpg", Filepath: "/b.jpg"},
+		{Md5Sum: "md5-3", Filename: "c.jpg", Filepath: "/c.jpg"},
+	}))
+
+	if err := d.AddKeywords([]string{"md5-1", "md5-2"}, []string{" Beach", "sunset"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddKeywords([]string{"md5-2", "md5-3"}, []string{"beach", "Bella"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddKeywords([]string{"md5-1", "unknown"}, []string{"forest"}); errors.Cause(err) != PictureNotFound {
+		t.Fatalf("expected PictureNotFound and received %v", err)
+	}
+	if keywords, _ := d.GetPhotoKeywords("md5-2"); !reflect.DeepEqual(keywords, []string{"beach", "bella", "sunset"}) {
+		t.Fatalf("expected [beach bella sunset] and received %v", keywords)
+	}
+	if keywords, _ := d.GetPhotoKeywords("md5-1"); !reflect.DeepEqual(keywords, []string{"beach", "sunset"}) {
+		t.Fatalf("the keywords must not be added if a photo is unknown, received %v", keywords)
+	}
+
+	suggestions, _ := d.SuggestKeywords("B", 0)
+	if len(suggestions.Keywords) != 2 || suggestions.Keywords[0].Keyword != "beach" || suggestions.Keywords[0].Count != 3 {
+		t.Fatalf("expected beach (3) and bella (2), received %v", suggestions.Keywords)
+	}
+	if suggestions, _ := d.SuggestKeywords("", 1); len(suggestions.Keywords) != 1 {
+		t.Fatalf("expected one suggestion, received %d", len(suggestions.Keywords))
+	}
+
+	if records, _ := d.Search(&SearchRequest{Field: SEARCH_KEYWORD, Value: "SUNSET"}); len(records) != 2 {
+		t.Fatalf("expected 2 photos with the keyword sunset, received %d", len(records))
+	}
+	if records, _ := d.QueryByTag("bella"); len(records) != 2 {
+		t.Fatalf("expected 2 photos with the tag bella, received %d", len(records))
+	}
+
+	if err := d.RemoveKeywords([]string{"md5-1", "md5-2"}, []string{"sunset"}); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := d.Search(&SearchRequest{Field: SEARCH_KEYWORD, Value: "sunset"}); len(records) != 0 {
+		t.Fatalf("expected no photo with the keyword sunset, received %d", len(records))
+	}
+	if keywords, _ := d.GetPhotoKeywords("md5-1"); !reflect.DeepEqual(keywords, []string{"beach"}) {
+		t.Fatalf("expected [beach] and received %v", keywords)
+	}
+
+	exported := make(map[string][]string)
+	d.ExportPhotos(func(photo *BackupPhotoRecord) error {
+		exported[photo.Md5sum] = photo.Keywords
+		return nil
+	})
+	if !reflect.DeepEqual(exported["md5-3"], []string{"beach", "bella"}) {
+		t.Fatalf("expected the keywords in the backup, received %v", exported)
+	}
+}
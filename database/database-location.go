@@ -0,0 +1,159 @@
+package database
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/jeromelesaux/photo/modele"
+	"github.com/jeromelesaux/photo/slavehandler"
+)
+
+// location of a copy of the photo, the same photo (md5sum) can be stored on several machines
+type PhotoLocation struct {
+	MachineId string `json:"machineid"`
+	Filepath  string `json:"filepath"`
+	// unix time of the last scan which found the copy
+	LastSeen int64 `json:"last_seen"`
+}
+
+// function adds the location or refreshes its last seen time if it is already known
+func addLocation(locations []*PhotoLocation, machineid string, path string) []*PhotoLocation {
+	now := time.Now().Unix()
+	for _, location := range locations {
+		if location.MachineId == machineid && location.Filepath == path {
+			location.LastSeen = now
+			return locations
+		}
+	}
+	return append(locations, &PhotoLocation{MachineId: machineid, Filepath: path, LastSeen: now})
+}
+
+// function moves the copy of the machine from the previous filepath (any copy of the machine
+// if the previous filepath is empty) to the new filepath, a machine without copy is ignored.
+// it returns true if the first location (the one of the record) is moved
+func moveLocation(locations []*PhotoLocation, machineid string, move *modele.PhotoMove) ([]*PhotoLocation, bool) {
+	for i, location := range locations {
+		if location.MachineId == machineid && (move.PreviousFilepath == "" || location.Filepath == move.PreviousFilepath) {
+			location.Filepath = move.Filepath
+			location.LastSeen = time.Now().Unix()
+			return removeDuplicateLocations(locations), i == 0
+		}
+	}
+	return locations, false
+}
+
+// function removes the copy of the machine at the filepath
+func removeLocation(locations []*PhotoLocation, machineid string, path string) []*PhotoLocation {
+	kept := make([]*PhotoLocation, 0)
+	for _, location := range locations {
+		if location.MachineId != machineid || location.Filepath != path {
+			kept = append(kept, location)
+		}
+	}
+	return kept
+}
+
+// function removes the copies of the machines without id and of the inactive slaves
+func removeInactiveLocations(locations []*PhotoLocation) []*PhotoLocation {
+	slaves := slavehandler.GetSlaves()
+	kept := make([]*PhotoLocation, 0)
+	for _, location := range locations {
+		if location.MachineId == "" {
+			continue
+		}
+		if slave, ok := slaves.Slaves[location.MachineId]; ok && !slave.IsActive() {
+			continue
+		}
+		kept = append(kept, location)
+	}
+	return kept
+}
+
+// function merges the locations without duplicates
+func mergeLocations(locations []*PhotoLocation, others []*PhotoLocation) []*PhotoLocation {
+	return removeDuplicateLocations(append(locations, others...))
+}
+
+func removeDuplicateLocations(locations []*PhotoLocation) []*PhotoLocation {
+	kept := make([]*PhotoLocation, 0)
+	for _, location := range locations {
+		found := false
+		for _, k := range kept {
+			if k.MachineId == location.MachineId && k.Filepath == location.Filepath {
+				found = true
+				if location.LastSeen > k.LastSeen {
+					k.LastSeen = location.LastSeen
+				}
+				break
+			}
+		}
+		if !found {
+			kept = append(kept, location)
+		}
+	}
+	return kept
+}
+
+// function returns the filename of the location, cloud photos keep their filename
+// as their filepath is an url
+func locationFilename(location *PhotoLocation, filename string) string {
+	if location.MachineId == modele.ORIGIN_FLICKR || location.MachineId == modele.ORIGIN_GOOGLE {
+		return filename
+	}
+	return filepath.Base(location.Filepath)
+}
+
+// function returns true if the copy can be downloaded, cloud photos are always online
+func (l *PhotoLocation) IsOnline() bool {
+	if l.MachineId == modele.ORIGIN_FLICKR || l.MachineId == modele.ORIGIN_GOOGLE {
+		return true
+	}
+	slave, ok := slavehandler.GetSlaves().Slaves[l.MachineId]
+	return ok && slave.IsActive()
+}
+
+// function returns the locations to try to download the photo : the online copies first
+// starting by the copy of the machine requested
+func OrderLocations(locations []*PhotoLocation, machineid string) []*PhotoLocation {
+	ordered := make([]*PhotoLocation, 0)
+	offline := make([]*PhotoLocation, 0)
+	for _, location := range locations {
+		switch {
+		case !location.IsOnline():
+			offline = append(offline, location)
+		case location.MachineId == machineid:
+			ordered = append([]*PhotoLocation{location}, ordered...)
+		default:
+			ordered = append(ordered, location)
+		}
+	}
+	return append(ordered, offline...)
+}
+
+// function returns the locations or the location of the record if the locations are not stored
+// (photo recorded before the locations)
+func recordLocations(locations []*PhotoLocation, machineid string, path string, lastSeen int64) []*PhotoLocation {
+	if len(locations) > 0 {
+		return locations
+	}
+	return []*PhotoLocation{{MachineId: machineid, Filepath: path, LastSeen: lastSeen}}
+}
+
+// function returns the machines of the locations
+func locationMachines(locations []*PhotoLocation) []string {
+	machineids := make([]string, 0)
+	for _, location := range locations {
+		machineids = append(machineids, location.MachineId)
+	}
+	return machineids
+}
+
+// function moves the location of the record machineid and filepath at the first place
+func primaryFirst(locations []*PhotoLocation, machineid string, path string) []*PhotoLocation {
+	for i, location := range locations {
+		if location.MachineId == machineid && location.Filepath == path {
+			return append([]*PhotoLocation{location}, append(locations[:i:i], locations[i+1:]...)...)
+		}
+	}
+	return locations
+}
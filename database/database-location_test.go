@@ -0,0 +1,85 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jeromelesaux/photo/modele"
+	"github.com/jeromelesaux/photo/slavehandler"
+)
+
+func registerTestSlaves(t *testing.T) {
+	if err := slavehandler.LoadSlaves(filepath.Join(t.TempDir(), slavehandler.SLAVES_CONFIGURATION_FILE)); err != nil {
+		t.Fatal(err)
+	}
+	slavehandler.AddSlave(&slavehandler.Slave{Name: "laptop"})
+	slavehandler.AddSlave(&slavehandler.Slave{Name: "nas"})
+	t.Cleanup(func() {
+		slavehandler.RevokeSlave("laptop")
+		slavehandler.RevokeSlave("nas")
+	})
+}
+
+func TestOrderLocations(t *testing.T) {
+	registerTestSlaves(t)
+	slavehandler.GetSlaves().Slaves["nas"].LastConnection = time.Now().Add(-24 * time.Hour)
+	locations := OrderLocations([]*PhotoLocation{
+		{MachineId: "nas", Filepath: "/nas/a.jpg"},
+		{MachineId: "unknown", Filepath: "/a.jpg"},
+		{MachineId: modele.ORIGIN_GOOGLE, Filepath: "https://photos/a.jpg"},
+		{MachineId: "laptop", Filepath: "/laptop/a.jpg"},
+	}, "laptop")
+	if locations[0].MachineId != "laptop" || locations[1].MachineId != modele.ORIGIN_GOOGLE {
+		t.Fatalf("online copies must be first starting by the requested machine, received %v %v", locations[0], locations[1])
+	}
+	if len(locations) != 4 {
+		t.Fatalf("offline copies must be kept at the end, received %d copies", len(locations))
+	}
+}
+
+func TestPhotoLocations(t *testing.T) {
+	for name, d := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			testPhotoLocations(t, d)
+		})
+	}
+}
+
+func testPhotoLocations(t *testing.T, d DatabaseInterface) {
+	registerTestSlaves(t)
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "laptop", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "a.jpg", Filepath: "/laptop/a.jpg"}}))
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "nas", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "b.jpg", Filepath: "/nas/b.jpg"}}))
+
+	records, _ := d.QueryAll()
+	if len(records) != 1 || len(records[0].Locations) != 2 || records[0].MachineId != "laptop" {
+		t.Fatalf("expected one photo with 2 copies on laptop first and received %v", records)
+	}
+	if records, _ := d.Search(&SearchRequest{Field: SEARCH_MACHINEID, Value: "nas"}); len(records) != 1 {
+		t.Fatalf("the copy of nas must be searched, received %d records", len(records))
+	}
+
+	d.MovePhoto("nas", &modele.PhotoMove{Md5Sum: "md5-1", Filename: "c.jpg", Filepath: "/nas/c.jpg", PreviousFilepath: "/nas/b.jpg"})
+	locations, _ := d.GetPhotoLocations("md5-1")
+	if len(locations) != 2 || locations[0].Filepath != "/laptop/a.jpg" || locations[1].Filepath != "/nas/c.jpg" {
+		t.Fatalf("only the copy of nas must be moved, received %v %v", locations[0], locations[1])
+	}
+
+	if err := d.DeletePhoto("laptop", &modele.PhotoInformations{Md5Sum: "md5-1", Filepath: "/laptop/a.jpg"}); err != nil {
+		t.Fatal(err)
+	}
+	records, _ = d.QueryFilename("c.jpg")
+	if len(records) != 1 || records[0].MachineId != "nas" || len(records[0].Locations) != 1 {
+		t.Fatalf("the copy of nas must be kept, received %v", records)
+	}
+
+	slavehandler.GetSlaves().Slaves["nas"].LastConnection = time.Now().Add(-24 * time.Hour)
+	if _, ok := d.(*DatabaseMock); !ok {
+		d.CleanDatabase()
+		if exists, _ := d.PictureExists("md5-1"); exists {
+			t.Fatal("photo without copy on an active machine must be removed")
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/jeromelesaux/photo/modele"
+)
+
+const (
+	// exif tags of the offset and of the fraction of second of the original date
+	ORIGINALDATE_OFFSET_TAG = "Offset Time For DateTimeOriginal"
+	ORIGINALDATE_SUBSEC_TAG = "Sub-second Time (Original)"
+	// iptc tag of the caption, rewritten with the description of the jpeg
+	IPTC_CAPTION_TAG = "iptc:Caption-Abstract"
+)
+
+// exif tags of the original date replaced by a corrected date, the date is stored in DATEFLICKRTAG
+var originalDateTags = []string{DATEFLICKRTAG, ORIGINALDATE_SUBSEC_TAG, ORIGINALDATE_OFFSET_TAG}
+
+// function returns the exif date and offset tags of the xmp date, false if the date is invalid
+func xmpDateTags(value string) (map[string]string, bool) {
+	tm, offset, err := modele.ParseXmpDate(value)
+	if err != nil {
+		return nil, false
+	}
+	tags := map[string]string{DATEFLICKRTAG: tm.Format("2006:01:02 15:04:05")}
+	if offset {
+		tags[ORIGINALDATE_OFFSET_TAG] = tm.Format("-07:00")
+	}
+	return tags, true
+}
+
+// function returns the keywords of the update normalized, nil if the update does not replace the keywords
+func metadataKeywords(update *modele.MetadataUpdate) ([]string, error) {
+	if update.Keywords == nil {
+		return nil, nil
+	}
+	keywords := make([]string, 0)
+	for _, keyword := range update.Keywords {
+		if strings.TrimSpace(keyword) != "" {
+			keywords = append(keywords, keyword)
+		}
+	}
+	if len(keywords) == 0 {
+		return keywords, nil
+	}
+	return NormalizeKeywords(keywords)
+}
+
+// function returns the exif tags of the photo with the corrections of the update written in the photo,
+// the corrected coordinates replace the coordinates of the exif as the google ones
+func metadataTags(exif map[string]interface{}, update *modele.MetadataUpdate) map[string]interface{} {
+	tags := make(map[string]interface{}, len(exif)+4)
+	for tag, value := range exif {
+		tags[tag] = value
+	}
+	set := func(tag string, value string) {
+		if value == "" {
+			delete(tags, tag)
+		} else {
+			tags[tag] = value
+		}
+	}
+	if update.Date != nil {
+		if dateTags, ok := xmpDateTags(*update.Date); ok {
+			for _, tag := range originalDateTags {
+				delete(tags, tag)
+			}
+			for tag, value := range dateTags {
+				tags[tag] = value
+			}
+		}
+	}
+	if update.Latitude != nil && update.Longitude != nil {
+		tags[LATITUDEGOOGLETAG] = strconv.FormatFloat(*update.Latitude, 'f', -1, 64)
+		tags[LONGITUDEGOOGLETAG] = strconv.FormatFloat(*update.Longitude, 'f', -1, 64)
+	}
+	if update.Rating != nil {
+		tags[XMP_RATING_TAG] = strconv.Itoa(*update.Rating)
+	}
+	if update.Description != nil {
+		set(XMP_DESCRIPTION_TAG, strings.TrimSpace(*update.Description))
+		if _, ok := tags[IPTC_CAPTION_TAG]; ok {
+			set(IPTC_CAPTION_TAG, strings.TrimSpace(*update.Description))
+		}
+	}
+	if keywords, err := metadataKeywords(update); err == nil && keywords != nil {
+		delete(tags, XMP_HIERARCHICAL_SUBJECT_TAG)
+		set(XMP_SUBJECT_TAG, strings.Join(keywords, ", "))
+		if _, ok := tags[IPTC_KEYWORDS_TAG]; ok {
+			set(IPTC_KEYWORDS_TAG, strings.Join(keywords, ", "))
+		}
+	}
+	return tags
+}
+
+// function returns the md5sums with the md5sum previous replaced by md5sum
+func replaceMd5sum(md5sums []string, previous string, md5sum string) []string {
+	replaced := make([]string, 0, len(md5sums))
+	for _, m := range md5sums {
+		if m == previous {
+			m = md5sum
+		}
+		replaced = append(replaced, m)
+	}
+	return replaced
+}
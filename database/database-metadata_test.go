@@ -0,0 +1,116 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/modele"
+	"github.com/pkg/errors"
+)
+
+func TestMetadataTags(t *testing.T) {
+	date, latitude, longitude, description := "2015-08-01T18:30:00+01:00", -33.8568, 151.2153, " Opera "
+	tags := metadataTags(map[string]interface{}{
+		DATEFLICKRTAG:                "2020:01:01 10:00:00",
+		ORIGINALDATE_SUBSEC_TAG:      "5",
+		IPTC_CAPTION_TAG:             "Grandma",
+		XMP_HIERARCHICAL_SUBJECT_TAG: "Places|France",
+	}, &modele.MetadataUpdate{Date: &date, Latitude: &latitude, Longitude: &longitude, Description: &description, Keywords: []string{"Sydney", ""}})
+	expected := map[string]interface{}{
+		DATEFLICKRTAG:           "2015:08:01 18:30:00",
+		ORIGINALDATE_OFFSET_TAG: "+01:00",
+		LATITUDEGOOGLETAG:       "-33.8568",
+		LONGITUDEGOOGLETAG:      "151.2153",
+		XMP_DESCRIPTION_TAG:     "Opera",
+		IPTC_CAPTION_TAG:        "Opera",
+		XMP_SUBJECT_TAG:         "sydney",
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Fatalf("expected %v and received %v", expected, tags)
+	}
+	if keywords, err := metadataKeywords(&modele.MetadataUpdate{Keywords: []string{" "}}); err != nil || keywords == nil || len(keywords) != 0 {
+		t.Fatalf("expected the keywords removed, received %v %v", keywords, err)
+	}
+}
+
+func TestUpdatePhotoMetadata(t *testing.T) {
+	for name, d := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			testUpdatePhotoMetadata(t, d)
+		})
+	}
+}
+
+func metadataRecord(d DatabaseInterface, md5sum string) *DatabasePhotoRecord {
+	records, _ := d.QueryAll()
+	for _, record := range records {
+		if record.Md5sum == md5sum {
+			return record
+		}
+	}
+	return nil
+}
+
+func testUpdatePhotoMetadata(t *testing.T, d DatabaseInterface) {
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "a.jpg", Filepath: "/a.jpg",
+			Tags: map[string]string{DATEFLICKRTAG: "2020:01:01 10:00:00", ORIGINALDATE_SUBSEC_TAG: "5", LATITUDEGOOGLETAG: "38.9", LONGITUDEGOOGLETAG: "-0.37"},
+			Xmp:  &modele.XmpInformations{Keywords: []string{"Beach"}}},
+		{Md5Sum: "md5-2", Filename: "b.cr2", Filepath: "/b.cr2", Xmp: &modele.XmpInformations{Keywords: []string{"Grandma"}}},
+	}))
+	if err := d.InsertNewAlbum(album.NewAlbumMessage("holidays", []string{"md5-1", "md5-2"})); err != nil {
+		t.Fatal(err)
+	}
+
+	date, latitude, longitude, rating, description := "2015-08-01T18:30:00+01:00", -33.8568, 151.2153, 5, "Opera"
+	update := &modele.MetadataUpdate{Md5Sum: "md5-1", Date: &date, Latitude: &latitude, Longitude: &longitude,
+		Keywords: []string{"Sydney", "Opera"}, Rating: &rating, Description: &description}
+	if err := d.UpdatePhotoMetadata(update, "md5-new"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := d.PictureExists("md5-1"); exists {
+		t.Fatal("expected the previous md5sum replaced")
+	}
+	record := metadataRecord(d, "md5-new")
+	if record == nil {
+		t.Fatal("expected the photo with its new md5sum")
+	}
+	if record.ExifTags[DATEFLICKRTAG] != "2015:08:01 18:30:00" || record.ExifTags[ORIGINALDATE_SUBSEC_TAG] != nil || record.Rating != 5 {
+		t.Fatalf("expected the corrected date and rating, received %v %d", record.ExifTags, record.Rating)
+	}
+	if lat, lng := ExifCoordinates(record.ExifTags); lat != latitude || lng != longitude {
+		t.Fatalf("expected the coordinates of Sydney, received %f %f", lat, lng)
+	}
+	if locations, _ := d.GetPhotoLocations("md5-new"); len(locations) != 1 || locations[0].Filepath != "/a.jpg" {
+		t.Fatalf("expected the copy of the photo kept, received %v", locations)
+	}
+	if keywords, _ := d.GetPhotoKeywords("md5-new"); !reflect.DeepEqual(keywords, []string{"opera", "sydney"}) {
+		t.Fatalf("expected the keywords of the update, received %v", keywords)
+	}
+	if content := d.GetAlbumData("holidays"); content.Cover != "md5-new" || !reflect.DeepEqual(albumOrder(d, "holidays"), []string{"md5-new", "md5-2"}) {
+		t.Fatalf("expected the new md5sum in the album, received %s %v", content.Cover, albumOrder(d, "holidays"))
+	}
+	if records, _ := d.Search(&SearchRequest{Field: SEARCH_EXIF, Tag: "description", Value: "opera"}); len(records) != 1 {
+		t.Fatalf("expected the photo of the description, received %d photos", len(records))
+	}
+
+	// the sidecar of the raw written, the md5sum and the keywords are kept
+	rating = 2
+	if err := d.UpdatePhotoMetadata(&modele.MetadataUpdate{Md5Sum: "md5-2", Rating: &rating}, "md5-2"); err != nil {
+		t.Fatal(err)
+	}
+	if record := metadataRecord(d, "md5-2"); record == nil || record.Rating != 2 {
+		t.Fatalf("expected the rating of the raw updated, received %v", record)
+	}
+	if keywords, _ := d.GetPhotoKeywords("md5-2"); !reflect.DeepEqual(keywords, []string{"grandma"}) {
+		t.Fatalf("expected the keywords kept, received %v", keywords)
+	}
+
+	if err := d.UpdatePhotoMetadata(&modele.MetadataUpdate{Md5Sum: "md5-1", Rating: &rating}, "md5-1"); errors.Cause(err) != PictureNotFound {
+		t.Fatalf("expected PictureNotFound, received %v", err)
+	}
+	if err := d.UpdatePhotoMetadata(&modele.MetadataUpdate{Md5Sum: "md5-2", Rating: &rating}, "md5-new"); errors.Cause(err) != PictureAlreadyExists {
+		t.Fatalf("expected PictureAlreadyExists, received %v", err)
+	}
+}
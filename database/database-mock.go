@@ -1,38 +1,194 @@
 package database
 
 import (
-	"github.com/jeromelesaux/photo/modele"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"strconv"
 	"strings"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/modele"
 )
 
 type DatabaseMock struct {
-	data []*DatabasePhotoRecord
+	data     []*DatabasePhotoRecord
+	albums   map[string]*album.AlbumMessage
+	keywords map[string][]string
+	// queries of the smart albums
+	queries map[string]*SearchRequest
+	shares  map[string]*DatabaseShareRecord
 }
 
 // valide the interface contract !
 var _ DatabaseInterface = (*DatabaseMock)(nil)
 
 func NewDataBaseMock() (*DatabaseMock, error) {
-	return &DatabaseMock{data: make([]*DatabasePhotoRecord, 0)}, nil
+	return &DatabaseMock{data: make([]*DatabasePhotoRecord, 0), albums: make(map[string]*album.AlbumMessage, 0),
+		keywords: make(map[string][]string), queries: make(map[string]*SearchRequest),
+		shares: make(map[string]*DatabaseShareRecord)}, nil
 }
 
 func (d *DatabaseMock) InsertNewData(response *modele.PhotoResponse) error {
 	for _, item := range response.Photos {
+		if keywords := photoKeywords(item); len(keywords) > 0 {
+			d.keywords[item.Md5Sum] = mergeKeywords(d.keywords[item.Md5Sum], keywords)
+		}
+		if p := d.record(item.Md5Sum); p != nil {
+			p.Locations = addLocation(p.Locations, response.MachineId, item.Filepath)
+			if tags, changed := rescanTags(p.ExifTags, item); changed {
+				c := rescanCuration(photoCuration{rating: p.Rating, favourite: p.Favourite, colorLabel: p.ColorLabel}, p.ExifTags, tags)
+				p.ExifTags = tags
+				setRecordPlace(p)
+				c.setRecord(p)
+			}
+			continue
+		}
 		exifs := make(map[string]interface{}, 0)
-		for tag, value := range item.Tags {
+		for tag, value := range photoTags(item) {
 			exifs[tag] = value
 		}
 
 		toinsert := &DatabasePhotoRecord{
-			Filename: item.Filename,
-			Filepath: item.Filepath,
-			Md5sum:   item.Md5Sum,
-			ExifTags: exifs,
+			Filename:  item.Filename,
+			Filepath:  item.Filepath,
+			Md5sum:    item.Md5Sum,
+			MachineId: response.MachineId,
+			Type:      strings.ToLower(filepath.Ext(item.Filename)),
+			Size:      item.Size,
+			ModTime:   item.ModTime,
+			Thumbnail: item.Thumbnail,
+			ExifTags:  exifs,
+			Locations: addLocation(nil, response.MachineId, item.Filepath),
 		}
+		setRecordPlace(toinsert)
+		exifCuration(exifs).setRecord(toinsert)
 		d.data = append(d.data, toinsert)
 	}
 	return nil
 }
+func (d *DatabaseMock) record(md5sum string) *DatabasePhotoRecord {
+	for _, p := range d.data {
+		if p.Md5sum == md5sum {
+			return p
+		}
+	}
+	return nil
+}
+func (d *DatabaseMock) PictureExists(md5sum string) (bool, error) {
+	return d.record(md5sum) != nil, nil
+}
+func (d *DatabaseMock) MovePhoto(machineid string, move *modele.PhotoMove) error {
+	p := d.record(move.Md5Sum)
+	if p == nil {
+		return nil
+	}
+	var primary bool
+	p.Locations, primary = moveLocation(recordLocations(p.Locations, p.MachineId, p.Filepath, 0), machineid, move)
+	if primary {
+		p.MachineId = machineid
+		p.Filename = move.Filename
+		p.Filepath = move.Filepath
+		p.Type = strings.ToLower(filepath.Ext(move.Filename))
+	}
+	return nil
+}
+func (d *DatabaseMock) DeletePhoto(machineid string, photo *modele.PhotoInformations) error {
+	kept := make([]*DatabasePhotoRecord, 0)
+	for _, p := range d.data {
+		if p.Md5sum == photo.Md5Sum {
+			p.Locations = removeLocation(recordLocations(p.Locations, p.MachineId, p.Filepath, 0), machineid, photo.Filepath)
+			if len(p.Locations) == 0 {
+				continue
+			}
+			d.setPrimary(p)
+		}
+		kept = append(kept, p)
+	}
+	d.data = kept
+	return nil
+}
+func (d *DatabaseMock) setPrimary(p *DatabasePhotoRecord) {
+	primary := p.Locations[0]
+	if primary.MachineId != p.MachineId || primary.Filepath != p.Filepath {
+		p.Filename = locationFilename(primary, p.Filename)
+		p.MachineId = primary.MachineId
+		p.Filepath = primary.Filepath
+	}
+}
+func (d *DatabaseMock) GetPhotoLocations(md5sum string) ([]*PhotoLocation, error) {
+	if p := d.record(md5sum); p != nil {
+		return recordLocations(p.Locations, p.MachineId, p.Filepath, 0), nil
+	}
+	return make([]*PhotoLocation, 0), nil
+}
+func (d *DatabaseMock) ExportPhotos(fn func(photo *BackupPhotoRecord) error) error {
+	for i, p := range d.data {
+		err := fn(&BackupPhotoRecord{Md5sum: p.Md5sum, MachineId: p.MachineId, Filename: p.Filename, Filepath: p.Filepath,
+			Type: p.Type, Size: p.Size, ImportTime: int64(i), ModTime: p.ModTime, ExifTags: p.ExifTags, Locations: p.Locations, Keywords: d.keywords[p.Md5sum],
+			Rating: p.Rating, Favourite: p.Favourite, ColorLabel: p.ColorLabel, Thumbnail: p.Thumbnail})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (d *DatabaseMock) ExportAlbums(fn func(a *album.AlbumMessage) error) error {
+	for _, a := range d.albums {
+		message := album.NewAlbumMessage(a.AlbumName, a.Md5sums)
+		message.Description, message.Tags, message.Parent, message.Cover, message.Owner = a.Description, a.Tags, a.Parent, a.Cover, a.Owner
+		setAlbumMessageQuery(message, d.queries[a.AlbumName])
+		if err := fn(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (d *DatabaseMock) RestorePhoto(photo *BackupPhotoRecord) error {
+	if exists, _ := d.PictureExists(photo.Md5sum); exists {
+		return PictureAlreadyExists
+	}
+	record := &DatabasePhotoRecord{Md5sum: photo.Md5sum, MachineId: photo.MachineId, Filename: photo.Filename,
+		Filepath: photo.Filepath, Type: photo.Type, Size: photo.Size, ModTime: photo.ModTime, ExifTags: photo.ExifTags, Thumbnail: photo.Thumbnail,
+		Locations: recordLocations(photo.Locations, photo.MachineId, photo.Filepath, photo.ImportTime/1000000)}
+	setRecordPlace(record)
+	photo.curation().setRecord(record)
+	d.data = append(d.data, record)
+	if len(photo.Keywords) > 0 {
+		d.keywords[photo.Md5sum] = mergeKeywords(d.keywords[photo.Md5sum], photo.Keywords)
+	}
+	return nil
+}
+func setRecordPlace(record *DatabasePhotoRecord) {
+	place := photoPlace(record.ExifTags)
+	record.City, record.Region, record.Country = place.City, place.Region, place.Country
+}
+func (d *DatabaseMock) RestoreAlbum(a *album.AlbumMessage) error {
+	request, err := SmartAlbumQuery(a)
+	if err != nil {
+		return err
+	}
+	d.setAlbumQuery(a.AlbumName, request)
+	d.albums[a.AlbumName] = album.NewAlbumMessage(a.AlbumName, a.Md5sums)
+	d.albums[a.AlbumName].Description = a.Description
+	d.albums[a.AlbumName].Tags = a.Tags
+	d.albums[a.AlbumName].Parent = a.Parent
+	d.albums[a.AlbumName].Cover = a.Cover
+	d.albums[a.AlbumName].Owner = a.Owner
+	return nil
+}
+func (d *DatabaseMock) GetThumbnail(md5sum string) (*Thumbnail, error) {
+	for _, p := range d.data {
+		if p.Md5sum == md5sum && p.Thumbnail != "" {
+			content, err := base64.StdEncoding.DecodeString(p.Thumbnail)
+			if err != nil {
+				return nil, err
+			}
+			return &Thumbnail{Id: ThumbnailId(content), Content: content}, nil
+		}
+	}
+	return nil, ThumbnailNotFound
+}
 func (d *DatabaseMock) CleanDatabase() error {
 	d.data = d.data[:len(d.data)-1]
 	return nil
@@ -69,3 +225,451 @@ func (d *DatabaseMock) QueryExifTag(pattern string, exiftag string) ([]*Database
 	return results, nil
 
 }
+func (d *DatabaseMock) QueryByTag(tag string) ([]*DatabasePhotoRecord, error) {
+	results := make([]*DatabasePhotoRecord, 0)
+	for _, a := range d.albums {
+		for _, t := range a.Tags {
+			if strings.TrimSpace(strings.ToUpper(t)) == strings.TrimSpace(strings.ToUpper(tag)) {
+				results = append(results, d.GetAlbumData(a.AlbumName).Records...)
+				break
+			}
+		}
+	}
+	return appendKeywordPhotos(d, results, tag)
+}
+func (d *DatabaseMock) Search(request *SearchRequest) ([]*DatabasePhotoRecord, error) {
+	results := make([]*DatabasePhotoRecord, 0)
+	if err := request.Validate(); err != nil {
+		return results, err
+	}
+	albums, _ := searchAlbums(request, albumPhotos(d))
+	for i, p := range d.data {
+		if request.match(d.searchDocument(i), albums) {
+			results = append(results, p)
+		}
+	}
+	return results, nil
+}
+func (d *DatabaseMock) SearchPage(request *SearchRequest, page *PageRequest) (*PhotoPage, error) {
+	response := &PhotoPage{Records: make([]*DatabasePhotoRecord, 0)}
+	if request != nil {
+		if err := request.Validate(); err != nil {
+			return response, err
+		}
+	}
+	albums, _ := searchAlbums(request, albumPhotos(d))
+	entries := make([]pageEntry, 0)
+	for i := range d.data {
+		doc := d.searchDocument(i)
+		if request.match(doc, albums) {
+			entries = append(entries, pageEntry{key: page.key(doc), id: i})
+		}
+	}
+	selected, total, next, err := page.selectPage(entries)
+	if err != nil {
+		return response, err
+	}
+	for _, entry := range selected {
+		response.Records = append(response.Records, d.data[entry.id])
+	}
+	response.Total = &total
+	response.NextCursor = next
+	return response, nil
+}
+func (d *DatabaseMock) albumItems(albumName string) ([]string, error) {
+	if a, ok := d.albums[albumName]; ok {
+		return a.Md5sums, nil
+	}
+	return []string{}, nil
+}
+func (d *DatabaseMock) albumQuery(albumName string) (*SearchRequest, error) {
+	return d.queries[albumName], nil
+}
+func (d *DatabaseMock) albumParents() (map[string]string, error) {
+	parents := make(map[string]string)
+	for name, a := range d.albums {
+		parents[name] = a.Parent
+	}
+	return parents, nil
+}
+func (d *DatabaseMock) setAlbumQuery(albumName string, request *SearchRequest) {
+	if request == nil {
+		delete(d.queries, albumName)
+		return
+	}
+	d.queries[albumName] = request
+}
+func (d *DatabaseMock) searchDocument(i int) *searchDocument {
+	p := d.data[i]
+	return &searchDocument{md5sum: p.Md5sum, filename: p.Filename, filepath: p.Filepath, filetype: p.Type,
+		machineid: p.MachineId, machineids: locationMachines(p.Locations), exif: p.ExifTags, size: p.Size, imported: int64(i), modtime: p.ModTime,
+		city: p.City, region: p.Region, country: p.Country, keywords: d.keywords[p.Md5sum],
+		curation: photoCuration{rating: p.Rating, favourite: p.Favourite, colorLabel: p.ColorLabel}}
+}
+func (d *DatabaseMock) GetPhotosUrl(md5sums []string) ([]*DatabasePhotoRecord, error) {
+	results := make([]*DatabasePhotoRecord, 0)
+	for _, m := range md5sums {
+		for _, p := range d.data {
+			if p.Md5sum == m {
+				results = append(results, p)
+			}
+		}
+	}
+	return Reduce(results, ""), nil
+}
+func (d *DatabaseMock) GetPhotosFromTime(queryDate string, groupby string, dates *DateRange) ([]*DatabasePhotoRecord, error) {
+	results := make([]*DatabasePhotoRecord, 0)
+	for _, p := range d.data {
+		if photoInPeriod(p.ExifTags, p.ModTime, queryDate, groupby, dates) {
+			results = append(results, p)
+		}
+	}
+	return results, nil
+}
+func (d *DatabaseMock) GetPhotosFromCoordinates(lat, lng string) ([]*DatabasePhotoRecord, error) {
+	qlatitude, _ := strconv.ParseFloat(lat, 64)
+	qlongitude, _ := strconv.ParseFloat(lng, 64)
+	results := make([]*DatabasePhotoRecord, 0)
+	for _, p := range d.data {
+		latitude, longitude := CoordinatesFromExif(p.ExifTags)
+		if latitude == qlatitude && longitude == qlongitude {
+			results = append(results, p)
+		}
+	}
+	return results, nil
+}
+func (d *DatabaseMock) GetPhotosFromArea(area *GeoArea) ([]*DatabasePhotoRecord, error) {
+	results := make([]*DatabasePhotoRecord, 0)
+	for _, p := range d.data {
+		if photoGeohash(p.ExifTags) == "" {
+			continue
+		}
+		if latitude, longitude := ExifCoordinates(p.ExifTags); area.Contains(latitude, longitude) {
+			results = append(results, p)
+		}
+	}
+	return results, nil
+}
+func (d *DatabaseMock) GetLocationClusters(zoom int, area *GeoArea) (*album.LocationClustersMessage, error) {
+	clusters := newGeoClusters(zoom)
+	for _, p := range d.data {
+		if photoGeohash(p.ExifTags) == "" {
+			continue
+		}
+		if latitude, longitude := ExifCoordinates(p.ExifTags); area.Contains(latitude, longitude) {
+			clusters.add(latitude, longitude)
+		}
+	}
+	return clusters.message(zoom), nil
+}
+func (d *DatabaseMock) GetOriginStats() (*album.OriginStatsMessage, error) {
+	o := album.NewOriginStatsMessage()
+	for _, p := range d.data {
+		o.Stats[p.MachineId]++
+	}
+	return o, nil
+}
+func (d *DatabaseMock) GetPlaceStats(level string) (*album.PlaceStatsMessage, error) {
+	counters := newPlaceCounters(level)
+	for _, p := range d.data {
+		counters.add(p.City, p.Region, p.Country)
+	}
+	return counters.message(), nil
+}
+func (d *DatabaseMock) AddKeywords(md5sums []string, keywords []string) error {
+	keywords, err := NormalizeKeywords(keywords)
+	if err != nil {
+		return err
+	}
+	if err := picturesExist(d, md5sums); err != nil {
+		return err
+	}
+	for _, md5sum := range md5sums {
+		d.keywords[md5sum] = mergeKeywords(d.keywords[md5sum], keywords)
+	}
+	return nil
+}
+func (d *DatabaseMock) RemoveKeywords(md5sums []string, keywords []string) error {
+	keywords, err := NormalizeKeywords(keywords)
+	if err != nil {
+		return err
+	}
+	for _, md5sum := range md5sums {
+		if remaining := removeKeywords(d.keywords[md5sum], keywords); len(remaining) > 0 {
+			d.keywords[md5sum] = remaining
+		} else {
+			delete(d.keywords, md5sum)
+		}
+	}
+	return nil
+}
+func (d *DatabaseMock) GetPhotoKeywords(md5sum string) ([]string, error) {
+	return append([]string{}, d.keywords[md5sum]...), nil
+}
+func (d *DatabaseMock) SuggestKeywords(prefix string, limit int) (*album.KeywordsMessage, error) {
+	counters := make(keywordCounters)
+	for _, keywords := range d.keywords {
+		counters.add(keywords)
+	}
+	return counters.message(prefix, limit), nil
+}
+func (d *DatabaseMock) UpdateCuration(message *album.CurationMessage) error {
+	if err := ValidateCuration(message); err != nil {
+		return err
+	}
+	if err := picturesExist(d, message.Md5sums); err != nil {
+		return err
+	}
+	for _, md5sum := range message.Md5sums {
+		p := d.record(md5sum)
+		photoCuration{rating: p.Rating, favourite: p.Favourite, colorLabel: p.ColorLabel}.update(message).setRecord(p)
+	}
+	return nil
+}
+func (d *DatabaseMock) UpdatePhotoMetadata(update *modele.MetadataUpdate, md5sum string) error {
+	keywords, err := metadataKeywords(update)
+	if err != nil {
+		return err
+	}
+	p := d.record(update.Md5Sum)
+	if p == nil {
+		return PictureNotFound
+	}
+	if md5sum != update.Md5Sum && d.record(md5sum) != nil {
+		return PictureAlreadyExists
+	}
+	p.Md5sum = md5sum
+	p.ExifTags = metadataTags(p.ExifTags, update)
+	setRecordPlace(p)
+	if update.Rating != nil {
+		p.Rating = *update.Rating
+	}
+	if keywords == nil {
+		keywords = d.keywords[update.Md5Sum]
+	}
+	delete(d.keywords, update.Md5Sum)
+	if len(keywords) > 0 {
+		d.keywords[md5sum] = keywords
+	}
+	for _, a := range d.albums {
+		a.Md5sums = replaceMd5sum(a.Md5sums, update.Md5Sum, md5sum)
+		if a.Cover == update.Md5Sum {
+			a.Cover = md5sum
+		}
+	}
+	return nil
+}
+func (d *DatabaseMock) stats() *statsCounters {
+	counters := newStatsCounters()
+	for _, p := range d.data {
+		counters.add(p.ExifTags, p.ModTime, 1)
+	}
+	return counters
+}
+func (d *DatabaseMock) GetTimeStats(groupby string, dates *DateRange) (*album.TimeStatsMessage, error) {
+	if dates.bounded() {
+		return rangeTimeStats(d.stats().timeStats(STATS_DAY), groupby, dates), nil
+	}
+	return d.stats().timeStats(groupby), nil
+}
+func (d *DatabaseMock) GetLocationStats() (*album.LocationStatsMessage, error) {
+	return d.stats().locationStats(), nil
+}
+func (d *DatabaseMock) GetAlbumList() []string {
+	names := make([]string, 0)
+	for name := range d.albums {
+		names = append(names, name)
+	}
+	return names
+}
+func (d *DatabaseMock) AlbumExists(albumName string) (bool, error) {
+	_, ok := d.albums[albumName]
+	return ok, nil
+}
+func (d *DatabaseMock) GetAlbumData(albumName string) *DatabaseAlbumRecord {
+	collection := NewDatabaseAlbumRecord()
+	collection.AlbumName = albumName
+	if a, ok := d.albums[albumName]; ok {
+		collection.Description = a.Description
+		collection.Parent = a.Parent
+		collection.Cover = a.Cover
+		collection.Owner = a.Owner
+		collection.Tags = append(collection.Tags, a.Tags...)
+		if collection.Query = d.queries[albumName]; collection.Query != nil {
+			collection.Records, _ = d.Search(collection.Query)
+		}
+		for _, m := range a.Md5sums {
+			for _, p := range d.data {
+				if p.Md5sum == m {
+					collection.Records = append(collection.Records, p)
+				}
+			}
+		}
+	}
+	return ReduceAlbumMessage(collection, "")
+}
+func (d *DatabaseMock) InsertNewAlbum(response *album.AlbumMessage) error {
+	if _, ok := d.albums[response.AlbumName]; ok {
+		return d.UpdateAlbum(response)
+	}
+	request, err := updatedAlbumQuery(nil, response)
+	if err != nil {
+		return err
+	}
+	parents, _ := d.albumParents()
+	if err := checkAlbumParent(parents, response.AlbumName, response.Parent); err != nil {
+		return err
+	}
+	d.setAlbumQuery(response.AlbumName, request)
+	d.albums[response.AlbumName] = album.NewAlbumMessage(response.AlbumName, response.Md5sums)
+	d.albums[response.AlbumName].Description = response.Description
+	d.albums[response.AlbumName].Tags = response.Tags
+	d.albums[response.AlbumName].Parent = response.Parent
+	d.albums[response.AlbumName].Cover = response.Cover
+	d.albums[response.AlbumName].Owner = response.Owner
+	return nil
+}
+func (d *DatabaseMock) UpdateAlbum(response *album.AlbumMessage) error {
+	a, ok := d.albums[response.AlbumName]
+	if !ok {
+		return errors.New("no records found")
+	}
+	request, err := updatedAlbumQuery(d.queries[response.AlbumName], response)
+	if err != nil {
+		return err
+	}
+	if d.setAlbumQuery(response.AlbumName, request); request != nil {
+		a.Md5sums = make([]string, 0)
+	}
+	for _, m := range response.Md5sums {
+		found := false
+		for _, stored := range a.Md5sums {
+			if stored == m {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a.Md5sums = append(a.Md5sums, m)
+		}
+	}
+	a.Description = response.Description
+	a.Tags = response.Tags
+	return nil
+}
+func (d *DatabaseMock) DeleteAlbum(response *album.AlbumMessage) error {
+	deleted, ok := d.albums[response.AlbumName]
+	if !ok {
+		return errors.New("no records found")
+	}
+	// the subalbums are moved to the parent of the deleted album
+	for _, a := range d.albums {
+		if a.Parent == response.AlbumName {
+			a.Parent = deleted.Parent
+		}
+	}
+	delete(d.albums, response.AlbumName)
+	delete(d.queries, response.AlbumName)
+	for token, share := range d.shares {
+		if share.AlbumName == response.AlbumName {
+			delete(d.shares, token)
+		}
+	}
+	return nil
+}
+func (d *DatabaseMock) GetAlbumTree() ([]*album.AlbumTreeMessage, error) {
+	return albumTree(d)
+}
+func (d *DatabaseMock) MoveAlbum(albumName string, parent string) error {
+	if err := checkAlbumMove(d, albumName, parent); err != nil {
+		return err
+	}
+	d.albums[albumName].Parent = parent
+	return nil
+}
+func (d *DatabaseMock) ReorderAlbum(albumName string, md5sums []string) error {
+	return reorderAlbum(d, albumName, md5sums)
+}
+func (d *DatabaseMock) InsertAlbumPhotos(albumName string, md5sums []string, position int) error {
+	return insertAlbumPhotos(d, albumName, md5sums, position)
+}
+func (d *DatabaseMock) SortAlbumByDate(albumName string, descending bool) error {
+	return sortAlbumByDate(d, albumName, descending)
+}
+func (d *DatabaseMock) SetAlbumCover(albumName string, md5sum string) error {
+	return updateAlbumCover(d, albumName, md5sum)
+}
+func (d *DatabaseMock) setAlbumItems(albumName string, md5sums []string) error {
+	d.albums[albumName].Md5sums = md5sums
+	return nil
+}
+func (d *DatabaseMock) setAlbumCover(albumName string, md5sum string) error {
+	d.albums[albumName].Cover = md5sum
+	return nil
+}
+func (d *DatabaseMock) DeletePhotoAlbum(response *album.AlbumMessage) error {
+	a, ok := d.albums[response.AlbumName]
+	if !ok {
+		return errors.New("no records found")
+	}
+	if d.queries[response.AlbumName] != nil {
+		return SmartAlbumPhotos
+	}
+	kept := make([]string, 0)
+	for _, stored := range a.Md5sums {
+		toDelete := false
+		for _, m := range response.Md5sums {
+			if stored == m {
+				toDelete = true
+				break
+			}
+		}
+		if !toDelete {
+			kept = append(kept, stored)
+		}
+	}
+	a.Md5sums = kept
+	a.Description = response.Description
+	a.Tags = response.Tags
+	return nil
+}
+func (d *DatabaseMock) InsertShare(share *DatabaseShareRecord) error {
+	if err := checkShareAlbum(d, share.AlbumName); err != nil {
+		return err
+	}
+	d.shares[share.Token] = share
+	return nil
+}
+func (d *DatabaseMock) RestoreShare(share *DatabaseShareRecord) error {
+	return d.InsertShare(share)
+}
+func (d *DatabaseMock) GetShare(token string) (*DatabaseShareRecord, error) {
+	share, ok := d.shares[token]
+	if !ok {
+		return nil, ShareNotFound
+	}
+	return share, nil
+}
+func (d *DatabaseMock) GetShares(albumName string) ([]*DatabaseShareRecord, error) {
+	shares := make([]*DatabaseShareRecord, 0)
+	for _, share := range d.shares {
+		if albumName == "" || share.AlbumName == albumName {
+			shares = append(shares, share)
+		}
+	}
+	return sortShares(shares), nil
+}
+func (d *DatabaseMock) DeleteShare(token string) error {
+	if _, ok := d.shares[token]; !ok {
+		return ShareNotFound
+	}
+	delete(d.shares, token)
+	return nil
+}
+func (d *DatabaseMock) GetAlbumOwner(albumName string) (string, error) {
+	a, ok := d.albums[albumName]
+	if !ok {
+		return "", AlbumNotFound
+	}
+	return a.Owner, nil
+}
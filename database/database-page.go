@@ -0,0 +1,176 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// sort keys of the paginated queries, prefixed by - for a descending order
+const (
+	SORT_DATE          = "date"
+	SORT_FILENAME      = "filename"
+	SORT_SIZE          = "size"
+	SORT_IMPORT        = "import"
+	DEFAULT_PAGE_LIMIT = 100
+	MAX_PAGE_LIMIT     = 1000
+)
+
+// structure of a page request, the cursor is the next_cursor of the previous page
+type PageRequest struct {
+	Limit      int
+	Cursor     string
+	Sort       string
+	descending bool
+}
+
+// structure of a page of photos, total is the number of photos matching the query,
+// it is missing on the next pages of a filtered query of the sqlite implementation
+type PhotoPage struct {
+	Records    []*DatabasePhotoRecord `json:"records"`
+	Total      *int                   `json:"total,omitempty"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+}
+
+// position of a photo in the sort order, the md5sum keeps the order stable for equal values
+type pageKey struct {
+	Sort       string `json:"s"`
+	Descending bool   `json:"d,omitempty"`
+	Number     int64  `json:"n,omitempty"`
+	Text       string `json:"t,omitempty"`
+	Md5sum     string `json:"m"`
+}
+
+// photo matching a paginated query, id is the identifier of the document in the implementation
+type pageEntry struct {
+	key pageKey
+	id  int
+}
+
+// function returns the page request from the limit, cursor and sort parameters,
+// the limit is set to DEFAULT_PAGE_LIMIT if empty and the sort to import
+func NewPageRequest(limit string, cursor string, sortBy string) (*PageRequest, error) {
+	p := &PageRequest{Limit: DEFAULT_PAGE_LIMIT, Cursor: cursor, Sort: SORT_IMPORT}
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l <= 0 {
+			return p, fmt.Errorf("Invalid limit %s", limit)
+		}
+		p.Limit = l
+	}
+	if p.Limit > MAX_PAGE_LIMIT {
+		p.Limit = MAX_PAGE_LIMIT
+	}
+	if sortBy != "" {
+		p.descending = strings.HasPrefix(sortBy, "-")
+		p.Sort = strings.TrimPrefix(sortBy, "-")
+	}
+	switch p.Sort {
+	case SORT_DATE, SORT_FILENAME, SORT_SIZE, SORT_IMPORT:
+	default:
+		return p, fmt.Errorf("Unknown sort %s", sortBy)
+	}
+	return p, nil
+}
+
+// function returns the date taken of the photo in seconds since epoch, 0 if unknown
+func dateTaken(exif map[string]interface{}, modtime int64) int64 {
+	if date, ok := PhotoDate(exif, modtime); ok {
+		return date.Unix()
+	}
+	return 0
+}
+
+// function returns the position of the photo in the sort order of the page request
+func (p *PageRequest) key(doc *searchDocument) pageKey {
+	k := pageKey{Sort: p.Sort, Descending: p.descending, Md5sum: doc.md5sum}
+	switch p.Sort {
+	case SORT_DATE:
+		k.Number = dateTaken(doc.exif, doc.modtime)
+	case SORT_FILENAME:
+		k.Text = strings.ToLower(doc.filename)
+	case SORT_SIZE:
+		k.Number = doc.size
+	case SORT_IMPORT:
+		k.Number = doc.imported
+	}
+	return k
+}
+
+func (k pageKey) less(o pageKey) bool {
+	if k.Number != o.Number {
+		return k.Number < o.Number
+	}
+	if k.Text != o.Text {
+		return k.Text < o.Text
+	}
+	return k.Md5sum < o.Md5sum
+}
+
+func (k pageKey) cursor() string {
+	b, _ := json.Marshal(k)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func parseCursor(cursor string) (pageKey, error) {
+	var k pageKey
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return k, errors.New("Invalid cursor")
+	}
+	if err = json.Unmarshal(b, &k); err != nil {
+		return k, errors.New("Invalid cursor")
+	}
+	return k, nil
+}
+
+// function returns the key of the last photo of the previous page, nil for the first page.
+// a cursor of another sort or direction is refused
+func (p *PageRequest) lastKey() (*pageKey, error) {
+	if p.Cursor == "" {
+		return nil, nil
+	}
+	last, err := parseCursor(p.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	if last.Sort != p.Sort || last.Descending != p.descending {
+		direction := ""
+		if p.descending {
+			direction = "-"
+		}
+		return nil, errors.New("Cursor does not match the sort " + direction + p.Sort)
+	}
+	return &last, nil
+}
+
+// function sorts the photos matching the query and returns the ones of the requested page,
+// the total of photos matching and the cursor of the next page (empty on the last page)
+func (p *PageRequest) selectPage(entries []pageEntry) ([]pageEntry, int, string, error) {
+	before := func(a, b pageKey) bool {
+		if p.descending {
+			return b.less(a)
+		}
+		return a.less(b)
+	}
+	sort.Slice(entries, func(i, j int) bool { return before(entries[i].key, entries[j].key) })
+
+	start := 0
+	last, err := p.lastKey()
+	if err != nil {
+		return nil, len(entries), "", err
+	}
+	if last != nil {
+		start = sort.Search(len(entries), func(i int) bool { return before(*last, entries[i].key) })
+	}
+	end := start + p.Limit
+	if end >= len(entries) {
+		return entries[start:], len(entries), "", nil
+	}
+	return entries[start:end], len(entries), entries[end-1].key.cursor(), nil
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/jeromelesaux/photo/modele"
+)
+
+func TestNewPageRequest(t *testing.T) {
+	if _, err := NewPageRequest("0", "", ""); err == nil {
+		t.Fatal("limit 0 must be refused")
+	}
+	if _, err := NewPageRequest("", "", "-weight"); err == nil {
+		t.Fatal("unknown sort must be refused")
+	}
+	page, err := NewPageRequest("5000", "", "-date")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Limit != MAX_PAGE_LIMIT || page.Sort != SORT_DATE || !page.descending {
+		t.Fatalf("unexpected page request %v", page)
+	}
+}
+
+// function reads all the pages of the query and returns the md5sums in the order received,
+// the next pages of a filtered query of sqlite have no total
+func readAllPages(t *testing.T, db DatabaseInterface, request *SearchRequest, sortBy string) []string {
+	_, sqlite := db.(*SqliteDatabaseHandler)
+	md5sums := make([]string, 0)
+	cursor := ""
+	for {
+		page, err := NewPageRequest("2", cursor, sortBy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := db.SearchPage(request, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sqlite && request != nil && cursor != "" {
+			if response.Total != nil {
+				t.Fatalf("expected no total on the next pages and received %d", *response.Total)
+			}
+		} else if response.Total == nil || *response.Total != 5 {
+			t.Fatalf("expected total 5 and received %v", response.Total)
+		}
+		for _, record := range response.Records {
+			md5sums = append(md5sums, record.Md5sum)
+		}
+		if response.NextCursor == "" {
+			return md5sums
+		}
+		cursor = response.NextCursor
+	}
+}
+
+func insertPagePhotos(db DatabaseInterface) {
+	photos := make([]*modele.PhotoInformations, 0)
+	for i, filename := range []string{"c.jpg", "a.jpg", "e.jpg", "b.jpg", "d.jpg"} {
+		photos = append(photos, &modele.PhotoInformations{Md5Sum: "md5-" + strconv.Itoa(i), Filename: filename, Size: int64(10 - i)})
+	}
+	db.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", photos))
+}
+
+func TestMockPages(t *testing.T) {
+	db, _ := NewDataBaseMock()
+	insertPagePhotos(db)
+	md5sums := readAllPages(t, db, nil, "-filename")
+	expected := []string{"md5-2", "md5-4", "md5-0", "md5-3", "md5-1"}
+	if len(md5sums) != len(expected) {
+		t.Fatalf("expected %v and received %v", expected, md5sums)
+	}
+	for i := range expected {
+		if md5sums[i] != expected[i] {
+			t.Fatalf("expected %v and received %v", expected, md5sums)
+		}
+	}
+}
+
+func TestSqlitePages(t *testing.T) {
+	db, err := newSqliteDatabaseHandler(t.TempDir() + "/photo.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	insertPagePhotos(db)
+	md5sums := readAllPages(t, db, &SearchRequest{Field: SEARCH_EXTENSION, Value: "jpg"}, "size")
+	expected := []string{"md5-4", "md5-3", "md5-2", "md5-1", "md5-0"}
+	for i := range expected {
+		if i >= len(md5sums) || md5sums[i] != expected[i] {
+			t.Fatalf("expected %v and received %v", expected, md5sums)
+		}
+	}
+	page, _ := NewPageRequest("2", "", "filename")
+	first, _ := db.SearchPage(nil, page)
+	page, _ = NewPageRequest("2", first.NextCursor, "size")
+	if _, err := db.SearchPage(nil, page); err == nil {
+		t.Fatal("cursor of another sort must be refused")
+	}
+	page, _ = NewPageRequest("2", first.NextCursor, "-filename")
+	if _, err := db.SearchPage(nil, page); err == nil {
+		t.Fatal("cursor of another direction must be refused")
+	}
+
+	// a total written in the cursor by the client is not returned
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"s":"filename","t":"a.jpg","m":"md5-1","c":999999}`))
+	for _, request := range []*SearchRequest{nil, {Field: SEARCH_EXTENSION, Value: "jpg"}} {
+		page, _ = NewPageRequest("2", forged, "filename")
+		response, err := db.SearchPage(request, page)
+		if err != nil || len(response.Records) != 2 || (response.Total != nil && *response.Total != 5) {
+			t.Fatalf("expected the page after a.jpg without the total of the cursor, received %v %v", response, err)
+		}
+	}
+
+	// sort evaluated by sqlite without filter
+	md5sums = readAllPages(t, db, nil, "-filename")
+	expected = []string{"md5-2", "md5-4", "md5-0", "md5-3", "md5-1"}
+	if !reflect.DeepEqual(md5sums, expected) {
+		t.Fatalf("expected %v and received %v", expected, md5sums)
+	}
+}
+
+func TestSqliteDatePages(t *testing.T) {
+	db, err := newSqliteDatabaseHandler(t.TempDir() + "/photo.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	photos := make([]*modele.PhotoInformations, 0)
+	for i, date := range []string{"2019:01:01 10:00:00", "2021:01:01 10:00:00", "2018:01:01 10:00:00", "2020:01:01 10:00:00", "2017:01:01 10:00:00"} {
+		photos = append(photos, &modele.PhotoInformations{Md5Sum: "md5-" + strconv.Itoa(i), Filename: "a.jpg", Tags: map[string]string{"DateTimeOriginal": date}})
+	}
+	db.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", photos))
+	expected := []string{"md5-1", "md5-3", "md5-0", "md5-2", "md5-4"}
+	if md5sums := readAllPages(t, db, nil, "-date"); !reflect.DeepEqual(md5sums, expected) {
+		t.Fatalf("expected %v and received %v", expected, md5sums)
+	}
+	if md5sums := readAllPages(t, db, &SearchRequest{Field: SEARCH_EXTENSION, Value: "jpg"}, "-date"); !reflect.DeepEqual(md5sums, expected) {
+		t.Fatalf("expected %v and received %v", expected, md5sums)
+	}
+
+	// the date taken of the photos stored before the column is computed at opening
+	if _, err := db.DBConnection.Exec("UPDATE photos SET date_taken = NULL"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.migrateDateTaken(); err != nil {
+		t.Fatal(err)
+	}
+	if md5sums := readAllPages(t, db, nil, "date"); md5sums[0] != "md5-4" || md5sums[4] != "md5-1" {
+		t.Fatalf("expected the photos sorted by date taken, received %v", md5sums)
+	}
+}
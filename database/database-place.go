@@ -0,0 +1,91 @@
+package database
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/geocoder"
+)
+
+// levels of the places stats
+const (
+	PLACE_COUNTRY = "country"
+	PLACE_REGION  = "region"
+	PLACE_CITY    = "city"
+)
+
+// function returns true if the level of the places stats is known (country, region or city)
+func ValidPlaceLevel(level string) bool {
+	return level == PLACE_COUNTRY || level == PLACE_REGION || level == PLACE_CITY
+}
+
+// function returns the place of the gazetteer nearest to the photo, an empty place if the photo
+// is not located or far from every city of the gazetteer
+func photoPlace(exif map[string]interface{}) *geocoder.Place {
+	latitude, longitude := ExifCoordinates(exif)
+	if latitude == 0. && longitude == 0. {
+		return &geocoder.Place{}
+	}
+	if place, ok := geocoder.GetGazetteer().Lookup(latitude, longitude); ok {
+		return place
+	}
+	return &geocoder.Place{}
+}
+
+// function returns true if the value is the city, the region or the country of the photo (case insensitive)
+func (doc *searchDocument) inPlace(value string) bool {
+	for _, name := range []string{doc.city, doc.region, doc.country} {
+		if name != "" && strings.EqualFold(name, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// counters of the photos by place of the level
+type placeCounters struct {
+	level  string
+	counts map[album.PlaceStatMessage]int
+}
+
+func newPlaceCounters(level string) *placeCounters {
+	return &placeCounters{level: level, counts: make(map[album.PlaceStatMessage]int)}
+}
+
+// function counts the photo of the place, the photos without place are not counted
+func (p *placeCounters) add(city string, region string, country string) {
+	if city == "" {
+		return
+	}
+	key := album.PlaceStatMessage{Country: country}
+	if p.level != PLACE_COUNTRY {
+		key.Region = region
+	}
+	if p.level == PLACE_CITY {
+		key.City = city
+	}
+	p.counts[key]++
+}
+
+// function returns the places stats sorted by number of photos
+func (p *placeCounters) message() *album.PlaceStatsMessage {
+	response := album.NewPlaceStatsMessage(p.level)
+	for key, count := range p.counts {
+		stat := key
+		stat.Count = count
+		response.Stats = append(response.Stats, &stat)
+	}
+	sortPlaceStats(response)
+	return response
+}
+
+func sortPlaceStats(stats *album.PlaceStatsMessage) {
+	sort.Slice(stats.Stats, func(i, j int) bool {
+		a, b := stats.Stats[i], stats.Stats[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Country+"|"+a.Region+"|"+a.City < b.Country+"|"+b.Region+"|"+b.City
+	})
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/jeromelesaux/photo/geocoder"
+	"github.com/jeromelesaux/photo/modele"
+)
+
+func TestPlaces(t *testing.T) {
+	gazetteer, err := geocoder.Load("../resources/geonames/cities.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	geocoder.SetGazetteer(gazetteer)
+	databases := testDatabases(t)
+
+	for name, d := range databases {
+		t.Run(name, func(t *testing.T) {
+			testPlaces(t, d)
+		})
+	}
+
+	// the places are resolved again by the clean of the database
+	for name, d := range map[string]DatabaseInterface{"sqlite": databases["sqlite"], "tiedot": databases["tiedot"]} {
+		geocoder.SetGazetteer(geocoder.NewGazetteer())
+		if err := d.CleanDatabase(); err != nil {
+			t.Fatal(err)
+		}
+		if stats, _ := d.GetPlaceStats(PLACE_COUNTRY); len(stats.Stats) != 0 {
+			t.Fatalf("%s : expected no place without gazetteer, received %v", name, stats.Stats)
+		}
+	}
+	geocoder.SetGazetteer(gazetteer)
+}
+
+func testPlaces(t *testing.T, d DatabaseInterface) {
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "sagrada.jpg", Filepath: "/sagrada.jpg", Tags: located("41.4036", "2.1744")},
+		{Md5Sum: "md5-2", Filename: "ramblas.jpg", Filepath: "/ramblas.jpg", Tags: located("41.3809", "2.1734")},
+		{Md5Sum: "md5-3", Filename: "girona.jpg", Filepath: "/girona.jpg", Tags: located("41.9870", "2.8240")},
+		{Md5Sum: "md5-4", Filename: "eiffel.jpg", Filepath: "/eiffel.jpg", Tags: located("48.8584", "2.2945")},
+		{Md5Sum: "md5-5", Filename: "atlantic.jpg", Filepath: "/atlantic.jpg", Tags: located("0", "-30")},
+		{Md5Sum: "md5-6", Filename: "nowhere.jpg", Filepath: "/nowhere.jpg"},
+	}))
+
+	records, _ := d.Search(&SearchRequest{Field: SEARCH_PLACE, Value: "barcelona"})
+	if len(records) != 2 || records[0].City != "Barcelona" || records[0].Country != "Spain" {
+		t.Fatalf("expected 2 photos in Barcelona, received %v", records)
+	}
+	if records, _ := d.Search(&SearchRequest{Field: SEARCH_PLACE, Value: "Catalonia"}); len(records) != 3 {
+		t.Fatalf("expected 3 photos in Catalonia, received %d", len(records))
+	}
+
+	countries, _ := d.GetPlaceStats(PLACE_COUNTRY)
+	if len(countries.Stats) != 2 || countries.Stats[0].Country != "Spain" || countries.Stats[0].Count != 3 {
+		t.Fatalf("expected 3 photos in Spain and 1 in France, received %v", countries.Stats)
+	}
+	regions, _ := d.GetPlaceStats(PLACE_REGION)
+	if len(regions.Stats) != 2 || regions.Stats[1].Region != "Ile-de-France" || regions.Stats[1].City != "" {
+		t.Fatalf("expected the regions Catalonia and Ile-de-France, received %v", regions.Stats)
+	}
+	cities, _ := d.GetPlaceStats(PLACE_CITY)
+	if len(cities.Stats) != 3 || cities.Stats[0].City != "Barcelona" || cities.Stats[0].Count != 2 {
+		t.Fatalf("expected the cities Barcelona, Girona and Paris, received %v", cities.Stats)
+	}
+}
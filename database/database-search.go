@@ -0,0 +1,268 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// fields of the search predicates
+const (
+	SEARCH_FILENAME  = "filename"
+	SEARCH_EXTENSION = "extension"
+	SEARCH_EXIF      = "exif"
+	SEARCH_DATE      = "date"
+	SEARCH_LOCATION  = "location"
+	SEARCH_MACHINEID = "machineid"
+	SEARCH_ALBUM     = "album"
+	SEARCH_PLACE     = "place"
+	SEARCH_KEYWORD   = "keyword"
+	// minimum number of stars
+	SEARCH_RATING      = "rating"
+	SEARCH_FAVOURITE   = "favourite"
+	SEARCH_COLOR_LABEL = "label"
+	// photos taken between from and to
+	SEARCH_DATE_RANGE = "daterange"
+)
+
+// structure of the /search request body, a node is either a boolean operator
+// (and, or, not) on sub requests or a predicate on one field of the photos.
+type SearchRequest struct {
+	And []*SearchRequest `json:"and,omitempty"`
+	Or  []*SearchRequest `json:"or,omitempty"`
+	Not *SearchRequest   `json:"not,omitempty"`
+	// predicate field (filename, extension, exif, date, daterange, location, machineid, album, place, keyword, rating, favourite or label)
+	Field string `json:"field,omitempty"`
+	// value searched, contained in the filename or the exif value, equals for the other fields
+	Value string `json:"value,omitempty"`
+	// exif tag name for the exif predicate, contained in the tag name as /queryexif
+	Tag string `json:"tag,omitempty"`
+	// day, week, month or year for the date predicate, the value is a date returned by /timesstats
+	Groupby string `json:"groupby,omitempty"`
+	// days (yyyy-mm-dd, included, each bound optional) of the daterange predicate
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	// coordinates for the location predicate, rounded as /locationsstats
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+}
+
+// photo fields evaluated by the search predicates (raw filepath, not the controller uri)
+type searchDocument struct {
+	md5sum    string
+	filename  string
+	filepath  string
+	filetype  string
+	machineid string
+	// machines of the other copies of the photo
+	machineids []string
+	exif       map[string]interface{}
+	size       int64
+	imported   int64
+	// modification time of the file, date of the photo without exif date
+	modtime int64
+	// place of the gazetteer nearest to the photo
+	city    string
+	region  string
+	country string
+	// keywords of the photo, read only if the request searches keywords
+	keywords []string
+	curation photoCuration
+}
+
+// function checks that each node of the request is either one operator or one complete predicate
+func (s *SearchRequest) Validate() error {
+	if s == nil {
+		return errors.New("Empty search request")
+	}
+	set := 0
+	if len(s.And) > 0 {
+		set++
+	}
+	if len(s.Or) > 0 {
+		set++
+	}
+	if s.Not != nil {
+		set++
+	}
+	if s.Field != "" {
+		set++
+	}
+	if set != 1 {
+		return errors.New("Search request node must contain exactly one of and, or, not, field")
+	}
+	for _, sub := range append(s.And, s.Or...) {
+		if err := sub.Validate(); err != nil {
+			return err
+		}
+	}
+	if s.Not != nil {
+		return s.Not.Validate()
+	}
+	switch s.Field {
+	case "", SEARCH_FILENAME, SEARCH_EXTENSION, SEARCH_EXIF, SEARCH_MACHINEID, SEARCH_ALBUM, SEARCH_LOCATION, SEARCH_PLACE, SEARCH_KEYWORD:
+	case SEARCH_DATE:
+		if !ValidGroupby(s.Groupby) {
+			return fmt.Errorf("Search on date needs groupby day, week, month or year, received %s", s.Groupby)
+		}
+	case SEARCH_DATE_RANGE:
+		dates, err := NewDateRange(s.From, s.To)
+		if err != nil {
+			return err
+		}
+		if !dates.bounded() {
+			return errors.New("Search on daterange needs from or to")
+		}
+	case SEARCH_RATING:
+		if rating, err := strconv.Atoi(s.Value); err != nil || rating < 0 || rating > RATING_MAX {
+			return fmt.Errorf("Search on rating needs a number of stars between 0 and %d, received %s", RATING_MAX, s.Value)
+		}
+	case SEARCH_FAVOURITE:
+		if _, err := strconv.ParseBool(s.Value); err != nil {
+			return fmt.Errorf("Search on favourite needs true or false, received %s", s.Value)
+		}
+	case SEARCH_COLOR_LABEL:
+		if !ValidColorLabel(strings.ToLower(s.Value)) {
+			return fmt.Errorf("Search on label needs one of %s, received %s", strings.Join(ColorLabels, ", "), s.Value)
+		}
+	default:
+		return fmt.Errorf("Unknown search field %s", s.Field)
+	}
+	return nil
+}
+
+// function returns the album names used by the album predicates of the request
+func (s *SearchRequest) albumNames() []string {
+	names := make([]string, 0)
+	if s == nil {
+		return names
+	}
+	if s.Field == SEARCH_ALBUM {
+		names = append(names, s.Value)
+	}
+	for _, sub := range append(s.And, s.Or...) {
+		names = append(names, sub.albumNames()...)
+	}
+	return append(names, s.Not.albumNames()...)
+}
+
+// function returns true if a predicate of the request is on the field
+func (s *SearchRequest) uses(field string) bool {
+	if s == nil {
+		return false
+	}
+	if s.Field == field {
+		return true
+	}
+	for _, sub := range append(s.And, s.Or...) {
+		if sub.uses(field) {
+			return true
+		}
+	}
+	return s.Not.uses(field)
+}
+
+// function evaluates the request on the photo, albums contains the md5sums of each album
+// returned by albumNames, a nil request matches all the photos
+func (s *SearchRequest) match(doc *searchDocument, albums map[string]map[string]struct{}) bool {
+	switch {
+	case s == nil:
+		return true
+	case len(s.And) > 0:
+		for _, sub := range s.And {
+			if !sub.match(doc, albums) {
+				return false
+			}
+		}
+		return true
+	case len(s.Or) > 0:
+		for _, sub := range s.Or {
+			if sub.match(doc, albums) {
+				return true
+			}
+		}
+		return false
+	case s.Not != nil:
+		return !s.Not.match(doc, albums)
+	}
+
+	switch s.Field {
+	case SEARCH_FILENAME:
+		pattern := strings.ToLower(s.Value)
+		return strings.Contains(strings.ToLower(doc.filename), pattern) ||
+			strings.Contains(strings.ToLower(doc.filepath), pattern)
+	case SEARCH_EXTENSION:
+		extension := strings.ToLower(s.Value)
+		if !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+		return doc.filetype == extension
+	case SEARCH_EXIF:
+		for key, val := range doc.exif {
+			value, ok := val.(string)
+			if ok && strings.Contains(strings.ToLower(key), strings.ToLower(s.Tag)) &&
+				strings.Contains(strings.ToLower(value), strings.ToLower(s.Value)) {
+				return true
+			}
+		}
+		return false
+	case SEARCH_DATE:
+		return photoGroupDate(doc.exif, doc.modtime, s.Groupby) == s.Value
+	case SEARCH_DATE_RANGE:
+		return photoInPeriod(doc.exif, doc.modtime, "", "", &DateRange{From: s.From, To: s.To})
+	case SEARCH_LOCATION:
+		if doc.exif == nil {
+			return false
+		}
+		latitude, longitude := CoordinatesFromExif(doc.exif)
+		return Round(latitude, .5, 2) == Round(s.Latitude, .5, 2) && Round(longitude, .5, 2) == Round(s.Longitude, .5, 2)
+	case SEARCH_MACHINEID:
+		if doc.machineid == s.Value {
+			return true
+		}
+		for _, machineid := range doc.machineids {
+			if machineid == s.Value {
+				return true
+			}
+		}
+		return false
+	case SEARCH_ALBUM:
+		_, ok := albums[s.Value][doc.md5sum]
+		return ok
+	case SEARCH_PLACE:
+		return doc.inPlace(s.Value)
+	case SEARCH_KEYWORD:
+		return doc.hasKeyword(s.Value)
+	case SEARCH_RATING:
+		rating, _ := strconv.Atoi(s.Value)
+		return doc.curation.rating >= rating
+	case SEARCH_FAVOURITE:
+		favourite, _ := strconv.ParseBool(s.Value)
+		return doc.curation.favourite == favourite
+	case SEARCH_COLOR_LABEL:
+		return doc.curation.colorLabel == strings.ToLower(s.Value)
+	}
+	return false
+}
+
+// function returns the md5sums of the albums used by the request, items returns the md5sums
+// of one album in the database implementation
+func searchAlbums(s *SearchRequest, items func(albumName string) ([]string, error)) (map[string]map[string]struct{}, error) {
+	albums := make(map[string]map[string]struct{})
+	for _, name := range s.albumNames() {
+		if _, ok := albums[name]; ok {
+			continue
+		}
+		md5sums, err := items(name)
+		if err != nil {
+			return albums, err
+		}
+		albums[name] = make(map[string]struct{})
+		for _, m := range md5sums {
+			albums[name][m] = struct{}{}
+		}
+	}
+	return albums, nil
+}
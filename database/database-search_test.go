@@ -0,0 +1,95 @@
+package database
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/jeromelesaux/photo/album"
+)
+
+func TestSearchValidate(t *testing.T) {
+	invalids := []string{
+		`{}`,
+		`{"field":"size","value":"10"}`,
+		`{"field":"exif","value":"nikon","groupby":"year","and":[{"field":"album"}]}`,
+		`{"field":"date","value":"2016-01-01"}`,
+		`{"and":[{"field":"filename","value":"a"}],"field":"filename"}`,
+		`{"or":[{"not":{}}]}`,
+	}
+	for _, body := range invalids {
+		request := &SearchRequest{}
+		json.Unmarshal([]byte(body), request)
+		if request.Validate() == nil {
+			t.Fatal("expected validation error for " + body)
+		}
+	}
+}
+
+func TestSqliteSearch(t *testing.T) {
+	db := newTestSqliteDatabase(t)
+	db.InsertNewAlbum(&album.AlbumMessage{AlbumName: `Noël "chez" mamie`, Md5sums: []string{"md5-2"}})
+	year := ToUnixTime(map[string]interface{}{DATEFLICKRTAG: "2016:07:14 10:00:00"}, "year")
+	searches := map[string][]string{
+		`{"and":[{"field":"extension","value":"JPG"},{"field":"exif","tag":"model","value":"nikon"},{"field":"date","groupby":"year","value":"` + year + `"}]}`: {"md5-1"},
+		`{"or":[{"field":"filename","value":"l'été"},{"field":"filename","value":"IMG"}]}`:                                                                      {"md5-1", "md5-2"},
+		`{"not":{"field":"album","value":"Noël \"chez\" mamie"}}`:                                                                                               {"md5-1"},
+		`{"and":[{"field":"machineid","value":"mymachineid"},{"not":{"field":"extension","value":".nef"}}]}`:                                                    {"md5-1"},
+		`{"field":"machineid","value":"othermachine"}`:                                                                                                          {},
+	}
+	for body, expected := range searches {
+		request := &SearchRequest{}
+		if err := json.Unmarshal([]byte(body), request); err != nil {
+			t.Fatal(err)
+		}
+		response, err := db.Search(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(response) != len(expected) {
+			t.Fatal("expected size response " + strconv.Itoa(len(expected)) + " and received " + strconv.Itoa(len(response)) + " for " + body)
+		}
+		for _, md5sum := range expected {
+			found := false
+			for _, record := range response {
+				if record.Md5sum == md5sum {
+					found = true
+				}
+			}
+			if !found {
+				t.Fatal("expected " + md5sum + " in the response of " + body)
+			}
+		}
+	}
+}
+
+func TestMockSearch(t *testing.T) {
+	db, _ := NewDataBaseMock()
+	db.InsertNewData(newTestPhotoResponse())
+	db.InsertNewAlbum(&album.AlbumMessage{AlbumName: "vacances", Md5sums: []string{"md5-1"}})
+	response, _ := db.Search(&SearchRequest{And: []*SearchRequest{
+		{Field: SEARCH_ALBUM, Value: "vacances"},
+		{Field: SEARCH_FILENAME, Value: "img"}}})
+	if len(response) != 1 {
+		t.Fatal("expected size response 1 and received " + strconv.Itoa(len(response)))
+	}
+}
+
+func TestTiedotSearch(t *testing.T) {
+	d := testTiedot(t, t.TempDir())
+	d.InsertNewData(newTestPhotoResponse())
+	d.InsertNewAlbum(&album.AlbumMessage{AlbumName: `Noël "chez" mamie`, Md5sums: []string{"md5-2"}})
+	response, err := d.Search(&SearchRequest{Or: []*SearchRequest{
+		{Field: SEARCH_ALBUM, Value: `Noël "chez" mamie`},
+		{Field: SEARCH_EXIF, Tag: "model", Value: "nikon"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response) != 2 {
+		t.Fatal("expected size response 2 and received " + strconv.Itoa(len(response)))
+	}
+	response, _ = d.Search(&SearchRequest{Not: &SearchRequest{Field: SEARCH_EXTENSION, Value: "nef"}})
+	if len(response) != 1 || response[0].Md5sum != "md5-1" {
+		t.Fatalf("expected md5-1 for not nef and received %v", response)
+	}
+}
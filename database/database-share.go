@@ -0,0 +1,183 @@
+package database
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/credential"
+	"github.com/pkg/errors"
+)
+
+var (
+	ShareNotFound = errors.New("Share link not found in database.")
+	ShareExpired  = errors.New("Share link expired.")
+)
+
+var (
+	shareProofSecret []byte
+	shareProofLock   sync.Mutex
+)
+
+const (
+	// number of random bytes of the token of a share link
+	SHARE_TOKEN_BYTES = 24
+	// path of the gallery of the share links
+	SHARE_GALLERY_PATH = "/gallery/"
+)
+
+// structure of a share link record, the password is stored as a bcrypt hash (empty without password)
+type DatabaseShareRecord struct {
+	Token     string    `json:"token"`
+	AlbumName string    `json:"album_name"`
+	Expires   time.Time `json:"expires"`
+	Password  string    `json:"password,omitempty"`
+	Download  bool      `json:"download,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+// function returns a new share link of the album of the message, the expiry date must be after now
+func NewDatabaseShareRecord(message *album.ShareMessage, now time.Time) (*DatabaseShareRecord, error) {
+	if message.AlbumName == "" {
+		return nil, errors.New("The album of the share link is missing")
+	}
+	if !message.Expires.After(now) {
+		return nil, errors.New("The expiry date of the share link must be in the future")
+	}
+	token := make([]byte, SHARE_TOKEN_BYTES)
+	if _, err := rand.Read(token); err != nil {
+		return nil, errors.Wrap(err, "Cannot generate the token of the share link")
+	}
+	share := &DatabaseShareRecord{
+		Token:     base64.RawURLEncoding.EncodeToString(token),
+		AlbumName: message.AlbumName,
+		Expires:   message.Expires.UTC().Truncate(time.Second),
+		Download:  message.Download,
+		Created:   now.UTC().Truncate(time.Second),
+	}
+	if message.Password != "" {
+		password, err := credential.HashPassword(message.Password)
+		if err != nil {
+			return nil, err
+		}
+		share.Password = password
+	}
+	return share, nil
+}
+
+// function returns true if the share link needs a password
+func (s *DatabaseShareRecord) Protected() bool {
+	return s.Password != ""
+}
+
+// function returns true if the share link expired at now
+func (s *DatabaseShareRecord) Expired(now time.Time) bool {
+	return !now.Before(s.Expires)
+}
+
+// function returns true if the password is the password of the share link (always for a link without password),
+// the hashes are compared in constant time
+func (s *DatabaseShareRecord) CheckPassword(password string) bool {
+	return !s.Protected() || credential.CheckPassword(s.Password, password)
+}
+
+// function returns the key of the proofs of the gallery passwords, it is kept in memory like the sessions
+// of the users so the proofs cannot be computed from the database or a backup
+func shareProofKey() ([]byte, error) {
+	shareProofLock.Lock()
+	defer shareProofLock.Unlock()
+	if shareProofSecret == nil {
+		key, err := credential.NewRandomToken()
+		if err != nil {
+			return nil, err
+		}
+		shareProofSecret = []byte(key)
+	}
+	return shareProofSecret, nil
+}
+
+// function returns the proof of the password given to the visitor of the gallery (cookie value), it is signed
+// with the key of the server and changes with the token, the expiry date and the password of the link
+func (s *DatabaseShareRecord) Proof() (string, error) {
+	key, err := shareProofKey()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s.Token + "\n" + strconv.FormatInt(s.Expires.Unix(), 10) + "\n" + s.Password))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// function returns true if proof is the proof of the password of the share link
+func (s *DatabaseShareRecord) CheckProof(proof string) bool {
+	expected, err := s.Proof()
+	return err == nil && s.Protected() && hmac.Equal([]byte(proof), []byte(expected))
+}
+
+// function returns the message of the share link, without password
+func (s *DatabaseShareRecord) Message() *album.ShareMessage {
+	return &album.ShareMessage{
+		Token:     s.Token,
+		AlbumName: s.AlbumName,
+		Expires:   s.Expires,
+		Download:  s.Download,
+		Protected: s.Protected(),
+		Created:   s.Created,
+		Url:       SHARE_GALLERY_PATH + s.Token,
+	}
+}
+
+// function checks that the album of a new share link exists
+func checkShareAlbum(d DatabaseInterface, albumName string) error {
+	exists, err := d.AlbumExists(albumName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.Wrap(AlbumNotFound, albumName)
+	}
+	return nil
+}
+
+// function sorts the share links by creation date
+func sortShares(shares []*DatabaseShareRecord) []*DatabaseShareRecord {
+	sort.SliceStable(shares, func(i, j int) bool { return shares[i].Created.Before(shares[j].Created) })
+	return shares
+}
+
+// function returns the share link of the token if it is valid at now, ShareNotFound if the token
+// or its album do not exist and ShareExpired after the expiry date
+func ValidShare(d DatabaseInterface, token string, now time.Time) (*DatabaseShareRecord, error) {
+	share, err := d.GetShare(token)
+	if err != nil {
+		return nil, err
+	}
+	if share.Expired(now) {
+		return nil, ShareExpired
+	}
+	exists, err := d.AlbumExists(share.AlbumName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ShareNotFound
+	}
+	return share, nil
+}
+
+// function returns the photo of the album of the share link, PictureNotFound if the photo is not in the album
+func SharedPhoto(d DatabaseInterface, share *DatabaseShareRecord, md5sum string) (*DatabasePhotoRecord, error) {
+	for _, record := range d.GetAlbumData(share.AlbumName).Records {
+		if record.Md5sum == md5sum {
+			return record, nil
+		}
+	}
+	return nil, errors.Wrap(PictureNotFound, md5sum)
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/modele"
+	"github.com/pkg/errors"
+)
+
+func TestNewDatabaseShareRecord(t *testing.T) {
+	now := time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+	if _, err := NewDatabaseShareRecord(&album.ShareMessage{AlbumName: "wedding", Expires: now}, now); err == nil {
+		t.Fatal("expected an error for an expiry date in the past")
+	}
+	share, err := NewDatabaseShareRecord(&album.ShareMessage{AlbumName: "wedding", Expires: now.Add(time.Hour), Password: "secret"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := NewDatabaseShareRecord(&album.ShareMessage{AlbumName: "wedding", Expires: now.Add(time.Hour)}, now)
+	if share.Token == "" || share.Token == other.Token {
+		t.Fatalf("expected distinct tokens, received %s and %s", share.Token, other.Token)
+	}
+	if !share.Protected() || share.CheckPassword("wrong") || !share.CheckPassword("secret") {
+		t.Fatal("expected the share link protected by the password secret")
+	}
+	otherProof, _ := other.Proof()
+	if !other.CheckPassword("") || other.CheckProof(otherProof) {
+		t.Fatal("expected the share link without password")
+	}
+	proof, err := share.Proof()
+	if err != nil || !share.CheckProof(proof) || share.CheckProof(otherProof) {
+		t.Fatalf("expected the proof of the password of the share link, received %v", err)
+	}
+	// the proof is not computed from the database only
+	mac := hmac.New(sha256.New, []byte(share.Password))
+	mac.Write([]byte(share.Token))
+	if share.CheckProof(hex.EncodeToString(mac.Sum(nil))) {
+		t.Fatal("expected the proof keyed by the password hash refused")
+	}
+	extended := *share
+	extended.Expires = share.Expires.Add(time.Hour)
+	if extended.CheckProof(proof) {
+		t.Fatal("expected the proof bound to the expiry date")
+	}
+	if share.Expired(now) || !share.Expired(now.Add(time.Hour)) {
+		t.Fatal("expected the share link expired after one hour")
+	}
+	if message := share.Message(); message.Password != "" || !message.Protected || message.Url != SHARE_GALLERY_PATH+share.Token {
+		t.Fatalf("expected the message without password, received %v", message)
+	}
+}
+
+func TestShares(t *testing.T) {
+	for name, d := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			testShares(t, d)
+		})
+	}
+}
+
+func testShares(t *testing.T, d DatabaseInterface) {
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "a.jpg", Filepath: "/a.jpg"},
+		{Md5Sum: "md5-2", Filename: "b.jpg", Filepath: "/b.jpg"},
+	}))
+	if err := d.InsertNewAlbum(album.NewAlbumMessage("wedding", []string{"md5-1"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.InsertNewAlbum(album.NewAlbumMessage("holidays", []string{"md5-2"})); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	wedding, _ := NewDatabaseShareRecord(&album.ShareMessage{AlbumName: "wedding", Expires: now.Add(time.Hour), Password: "secret", Download: true}, now.Add(-time.Minute))
+	expired, _ := NewDatabaseShareRecord(&album.ShareMessage{AlbumName: "wedding", Expires: now.Add(time.Second)}, now)
+	expired.Expires = now.Add(-time.Second).Truncate(time.Second)
+	holidays, _ := NewDatabaseShareRecord(&album.ShareMessage{AlbumName: "holidays", Expires: now.Add(time.Hour)}, now)
+	for _, share := range []*DatabaseShareRecord{wedding, expired, holidays} {
+		if err := d.InsertShare(share); err != nil {
+			t.Fatal(err)
+		}
+	}
+	missing, _ := NewDatabaseShareRecord(&album.ShareMessage{AlbumName: "asia", Expires: now.Add(time.Hour)}, now)
+	if err := d.InsertShare(missing); errors.Cause(err) != AlbumNotFound {
+		t.Fatalf("expected AlbumNotFound and received %v", err)
+	}
+
+	share, err := ValidShare(d, wedding.Token, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if share.AlbumName != "wedding" || !share.Download || !share.CheckPassword("secret") || !share.Expires.Equal(wedding.Expires) {
+		t.Fatalf("expected the share link of the wedding, received %v", share)
+	}
+	if _, err := ValidShare(d, expired.Token, now); err != ShareExpired {
+		t.Fatalf("expected ShareExpired and received %v", err)
+	}
+	if _, err := ValidShare(d, "unknown", now); err != ShareNotFound {
+		t.Fatalf("expected ShareNotFound and received %v", err)
+	}
+	if record, err := SharedPhoto(d, share, "md5-1"); err != nil || record.Md5sum != "md5-1" {
+		t.Fatalf("expected md5-1 in the shared album, received %v %v", record, err)
+	}
+	if _, err := SharedPhoto(d, share, "md5-2"); errors.Cause(err) != PictureNotFound {
+		t.Fatalf("expected PictureNotFound for a photo of another album and received %v", err)
+	}
+
+	shares, err := d.GetShares("wedding")
+	if err != nil || len(shares) != 2 || shares[0].Token != wedding.Token {
+		t.Fatalf("expected the 2 share links of the wedding, received %v %v", shares, err)
+	}
+	if shares, _ := d.GetShares(""); len(shares) != 3 {
+		t.Fatalf("expected 3 share links, received %d", len(shares))
+	}
+	// a restored share link replaces the share link with the same token
+	restored := *holidays
+	restored.Download = true
+	if err := d.RestoreShare(&restored); err != nil {
+		t.Fatal(err)
+	}
+	if shares, _ := d.GetShares(""); len(shares) != 3 {
+		t.Fatalf("expected the share link replaced, received %d share links", len(shares))
+	}
+	if share, err := d.GetShare(holidays.Token); err != nil || !share.Download {
+		t.Fatalf("expected the restored share link, received %v %v", share, err)
+	}
+	if err := d.RestoreShare(missing); errors.Cause(err) != AlbumNotFound {
+		t.Fatalf("expected AlbumNotFound and received %v", err)
+	}
+	if err := d.DeleteShare(expired.Token); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeleteShare(expired.Token); err != ShareNotFound {
+		t.Fatalf("expected ShareNotFound and received %v", err)
+	}
+	// the share links of a deleted album are removed
+	if err := d.DeleteAlbum(&album.AlbumMessage{AlbumName: "wedding"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.GetShare(wedding.Token); err != ShareNotFound {
+		t.Fatalf("expected ShareNotFound and received %v", err)
+	}
+	if shares, _ := d.GetShares(""); len(shares) != 1 || shares[0].Token != holidays.Token {
+		t.Fatalf("expected the share link of the holidays, received %v", shares)
+	}
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"encoding/json"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+var SmartAlbumPhotos = errors.New("The photos of a smart album are selected by its query.")
+
+// function returns the query of the smart album, nil for a static album.
+// the query is a search request without album predicate and the smart album has no md5sum
+func SmartAlbumQuery(message *album.AlbumMessage) (*SearchRequest, error) {
+	if len(message.Query) == 0 || string(message.Query) == "null" {
+		return nil, nil
+	}
+	request := &SearchRequest{}
+	if err := json.Unmarshal(message.Query, request); err != nil {
+		return nil, errors.Wrap(err, "Cannot decode the query of the smart album")
+	}
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+	if request.uses(SEARCH_ALBUM) {
+		return nil, errors.New("The query of a smart album cannot search the albums")
+	}
+	if len(message.Md5sums) > 0 {
+		return nil, SmartAlbumPhotos
+	}
+	return request, nil
+}
+
+// function returns the query of the album after the update, stored is the query of the album (nil for a static album).
+// the query of the message replaces the stored query, the photos cannot be added to a smart album
+func updatedAlbumQuery(stored *SearchRequest, message *album.AlbumMessage) (*SearchRequest, error) {
+	request, err := SmartAlbumQuery(message)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil {
+		request = stored
+	}
+	if request == nil && message.Type == album.ALBUM_SMART {
+		return nil, errors.New("A smart album needs a query")
+	}
+	if request != nil && len(message.Md5sums) > 0 {
+		return nil, SmartAlbumPhotos
+	}
+	return request, nil
+}
+
+// function returns the query stored in the database, empty for a static album
+func encodeAlbumQuery(request *SearchRequest) string {
+	if request == nil {
+		return ""
+	}
+	value, err := json.Marshal(request)
+	if err != nil {
+		logger.Errorf("Cannot encode the smart album query with error : %v", err)
+		return ""
+	}
+	return string(value)
+}
+
+// function returns the query stored in the database, nil for a static album
+func decodeAlbumQuery(albumName string, value string) *SearchRequest {
+	if value == "" {
+		return nil
+	}
+	request := &SearchRequest{}
+	if err := json.Unmarshal([]byte(value), request); err != nil {
+		logger.Errorf("Cannot decode the query of the smart album %s with error : %v", albumName, err)
+		return nil
+	}
+	return request
+}
+
+// function sets the type and the query of the smart album message exported
+func setAlbumMessageQuery(message *album.AlbumMessage, request *SearchRequest) {
+	if request == nil {
+		return
+	}
+	message.Type = album.ALBUM_SMART
+	message.Query = json.RawMessage(encodeAlbumQuery(request))
+	message.Md5sums = make([]string, 0)
+}
+
+// albums of the database implementations
+type albumStore interface {
+	Search(request *SearchRequest) ([]*DatabasePhotoRecord, error)
+	// md5sums stored in the album
+	albumItems(albumName string) ([]string, error)
+	// query of the smart album, nil for a static album
+	albumQuery(albumName string) (*SearchRequest, error)
+}
+
+// function returns the md5sums of the album for the album predicates of the search,
+// the photos matching the query of a smart album or the photos stored in a static album
+func albumPhotos(d albumStore) func(albumName string) ([]string, error) {
+	return func(albumName string) ([]string, error) {
+		request, err := d.albumQuery(albumName)
+		if err != nil || request == nil {
+			return d.albumItems(albumName)
+		}
+		records, err := d.Search(request)
+		md5sums := make([]string, 0, len(records))
+		for _, record := range records {
+			md5sums = append(md5sums, record.Md5sum)
+		}
+		return md5sums, err
+	}
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/modele"
+)
+
+func TestSmartAlbumQuery(t *testing.T) {
+	message := album.NewAlbumMessage("smart", []string{})
+	if request, err := SmartAlbumQuery(message); request != nil || err != nil {
+		t.Fatalf("expected a static album, received %v %v", request, err)
+	}
+	message.Query = json.RawMessage(`{"field":"daterange","from":"2019-12-31","to":"2019-01-01"}`)
+	if _, err := SmartAlbumQuery(message); err == nil {
+		t.Fatal("expected an error for an inverted date range")
+	}
+	message.Query = json.RawMessage(`{"not":{"field":"album","value":"vacances"}}`)
+	if _, err := SmartAlbumQuery(message); err == nil {
+		t.Fatal("expected an error for an album predicate")
+	}
+	message.Query = json.RawMessage(`{"field":"rating","value":"5"}`)
+	message.Md5sums = []string{"md5-1"}
+	if _, err := SmartAlbumQuery(message); err != SmartAlbumPhotos {
+		t.Fatalf("expected SmartAlbumPhotos and received %v", err)
+	}
+	if _, err := updatedAlbumQuery(nil, &album.AlbumMessage{AlbumName: "smart", Type: album.ALBUM_SMART}); err == nil {
+		t.Fatal("expected an error for a smart album without query")
+	}
+}
+
+func TestSmartAlbum(t *testing.T) {
+	for name, d := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			testSmartAlbum(t, d)
+		})
+	}
+}
+
+func testSmartAlbum(t *testing.T, d DatabaseInterface) {
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "a.jpg", Filepath: "/a.jpg", Tags: map[string]string{"Rating": "5", "DateTimeOriginal": "2019:07:14 10:00:00"}},
+		{Md5Sum: "md5-2", Filename: "b.jpg", Filepath: "/b.jpg", Tags: map[string]string{"Rating": "5", "DateTimeOriginal": "2020:01:01 10:00:00"}},
+		{Md5Sum: "md5-3", Filename: "c.jpg", Filepath: "/c.jpg", Tags: map[string]string{"Rating": "2", "DateTimeOriginal": "2019:03:01 10:00:00"}},
+	}))
+	smart := album.NewAlbumMessage("best of 2019", []string{})
+	smart.Description = "5 stars"
+	smart.Query = json.RawMessage(`{"and":[{"field":"rating","value":"5"},{"field":"daterange","from":"2019-01-01","to":"2019-12-31"}]}`)
+	if err := d.InsertNewAlbum(smart); err != nil {
+		t.Fatal(err)
+	}
+	content := d.GetAlbumData("best of 2019")
+	if len(content.Records) != 1 || content.Records[0].Md5sum != "md5-1" || content.Query == nil || content.Description != "5 stars" {
+		t.Fatalf("expected md5-1 in the smart album, received %v", content)
+	}
+
+	// the photos added later are in the smart album
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", []*modele.PhotoInformations{
+		{Md5Sum: "md5-4", Filename: "d.jpg", Filepath: "/d.jpg", Tags: map[string]string{"Rating": "5", "DateTimeOriginal": "2019:12:31 23:00:00"}},
+	}))
+	if content := d.GetAlbumData("best of 2019"); len(content.Records) != 2 {
+		t.Fatalf("expected 2 photos in the smart album, received %d", len(content.Records))
+	}
+	if records, _ := d.Search(&SearchRequest{Field: SEARCH_ALBUM, Value: "best of 2019"}); len(records) != 2 {
+		t.Fatalf("expected 2 photos for the album predicate, received %d", len(records))
+	}
+
+	if err := d.UpdateAlbum(album.NewAlbumMessage("best of 2019", []string{"md5-3"})); err != SmartAlbumPhotos {
+		t.Fatalf("expected SmartAlbumPhotos and received %v", err)
+	}
+	if err := d.DeletePhotoAlbum(album.NewAlbumMessage("best of 2019", []string{"md5-1"})); err != SmartAlbumPhotos {
+		t.Fatalf("expected SmartAlbumPhotos and received %v", err)
+	}
+	// an update without query keeps the query
+	update := album.NewAlbumMessage("best of 2019", []string{})
+	update.Description = "the best"
+	if err := d.UpdateAlbum(update); err != nil {
+		t.Fatal(err)
+	}
+	if content := d.GetAlbumData("best of 2019"); len(content.Records) != 2 || content.Description != "the best" {
+		t.Fatalf("expected the smart album kept, received %v", content)
+	}
+
+	var exported *album.AlbumMessage
+	d.ExportAlbums(func(a *album.AlbumMessage) error {
+		if a.AlbumName == "best of 2019" {
+			exported = a
+		}
+		return nil
+	})
+	if exported == nil || exported.Type != album.ALBUM_SMART || len(exported.Query) == 0 || len(exported.Md5sums) != 0 {
+		t.Fatalf("expected the query of the smart album exported, received %v", exported)
+	}
+	d.DeleteAlbum(exported)
+	if err := d.RestoreAlbum(exported); err != nil {
+		t.Fatal(err)
+	}
+	if content := d.GetAlbumData("best of 2019"); len(content.Records) != 2 || content.Query == nil {
+		t.Fatalf("expected the smart album restored, received %v", content)
+	}
+}
@@ -0,0 +1,2279 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/configurationapp"
+	"github.com/jeromelesaux/photo/modele"
+	"github.com/jeromelesaux/photo/slavehandler"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+)
+
+var _ DatabaseInterface = (*SqliteDatabaseHandler)(nil)
+var globalSqliteConnection *sql.DB
+var sqliteConnectionLock sync.Mutex
+
+// sqlite implementation of the database, all the library is stored in one file
+// which can be inspected and saved with the sqlite3 standard tools.
+type SqliteDatabaseHandler struct {
+	DBConnection *sql.DB
+	Thumbnails   *ThumbnailStore
+}
+
+// schema migrations, the index in the slice is the schema version stored
+// in the sqlite user_version pragma, new migrations must be appended.
+var sqliteMigrations = []string{
+	`CREATE TABLE photos (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		md5sum TEXT NOT NULL UNIQUE,
+		machine_id TEXT NOT NULL DEFAULT '',
+		filename TEXT NOT NULL DEFAULT '',
+		filepath TEXT NOT NULL DEFAULT '',
+		type TEXT NOT NULL DEFAULT '',
+		thumbnail TEXT NOT NULL DEFAULT '',
+		exif_tags TEXT NOT NULL DEFAULT '{}'
+	);
+	CREATE INDEX photos_machine_id ON photos(machine_id);
+	CREATE INDEX photos_type ON photos(type);
+	CREATE INDEX photos_filename ON photos(filename);
+	CREATE TABLE albums (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		description TEXT NOT NULL DEFAULT ''
+	);
+	CREATE TABLE album_items (
+		album_id INTEGER NOT NULL REFERENCES albums(id) ON DELETE CASCADE,
+		md5sum TEXT NOT NULL,
+		PRIMARY KEY (album_id, md5sum)
+	);
+	CREATE TABLE album_tags (
+		album_id INTEGER NOT NULL REFERENCES albums(id) ON DELETE CASCADE,
+		tag TEXT NOT NULL,
+		PRIMARY KEY (album_id, tag)
+	);`,
+	`ALTER TABLE photos ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE photos ADD COLUMN imported_at INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE photos ADD COLUMN thumbnail_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE photos ADD COLUMN thumbnail_size INTEGER NOT NULL DEFAULT 0;`,
+	`CREATE TABLE photo_locations (
+		photo_id INTEGER NOT NULL REFERENCES photos(id) ON DELETE CASCADE,
+		machine_id TEXT NOT NULL,
+		filepath TEXT NOT NULL,
+		last_seen INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (photo_id, machine_id, filepath)
+	);
+	CREATE INDEX photo_locations_machine_id ON photo_locations(machine_id);
+	INSERT INTO photo_locations (photo_id, machine_id, filepath, last_seen) SELECT id, machine_id, filepath, imported_at / 1000000 FROM photos;`,
+	`CREATE TABLE time_stats (
+		groupby TEXT NOT NULL,
+		date TEXT NOT NULL,
+		count INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (groupby, date)
+	);
+	CREATE TABLE location_stats (
+		latitude REAL NOT NULL,
+		longitude REAL NOT NULL,
+		count INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (latitude, longitude)
+	);`,
+	`ALTER TABLE photos ADD COLUMN modified_at INTEGER NOT NULL DEFAULT 0;
+	DELETE FROM time_stats;`,
+	`ALTER TABLE photos ADD COLUMN latitude REAL;
+	ALTER TABLE photos ADD COLUMN longitude REAL;
+	ALTER TABLE photos ADD COLUMN geohash TEXT;
+	CREATE INDEX photos_latitude ON photos(latitude);
+	CREATE INDEX photos_geohash ON photos(geohash);`,
+	`ALTER TABLE photos ADD COLUMN city TEXT;
+	ALTER TABLE photos ADD COLUMN region TEXT;
+	ALTER TABLE photos ADD COLUMN country TEXT;
+	CREATE INDEX photos_place ON photos(country, region, city);`,
+	`CREATE TABLE photo_keywords (
+		md5sum TEXT NOT NULL,
+		keyword TEXT NOT NULL,
+		PRIMARY KEY (md5sum, keyword)
+	);
+	CREATE INDEX photo_keywords_keyword ON photo_keywords(keyword);`,
+	`ALTER TABLE photos ADD COLUMN rating INTEGER;
+	ALTER TABLE photos ADD COLUMN favourite INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE photos ADD COLUMN color_label TEXT NOT NULL DEFAULT '';
+	CREATE INDEX photos_rating ON photos(rating);`,
+	`ALTER TABLE albums ADD COLUMN query TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE albums ADD COLUMN parent TEXT NOT NULL DEFAULT '';
+	CREATE INDEX albums_parent ON albums(parent);`,
+	`ALTER TABLE album_items ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+	UPDATE album_items SET position = rowid;
+	ALTER TABLE albums ADD COLUMN cover TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE shares (
+		token TEXT PRIMARY KEY,
+		album_name TEXT NOT NULL,
+		expires_at INTEGER NOT NULL,
+		password TEXT NOT NULL DEFAULT '',
+		download INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL
+	);
+	CREATE INDEX shares_album_name ON shares(album_name);`,
+	`ALTER TABLE albums ADD COLUMN owner TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE photos ADD COLUMN date_taken INTEGER;
+	CREATE INDEX photos_date_taken ON photos(date_taken, md5sum);
+	CREATE INDEX photos_sort_filename ON photos(lower(filename), md5sum);
+	CREATE INDEX photos_sort_size ON photos(size, md5sum);
+	CREATE INDEX photos_sort_imported_at ON photos(imported_at, md5sum);`,
+}
+
+// json array of the keywords of the photo, used in the queries on the photos table
+const sqliteKeywordsColumn = "(SELECT json_group_array(k.keyword) FROM photo_keywords k WHERE k.md5sum = photos.md5sum)"
+
+// columns of the photos table read in a searchDocument by scanSearchDocument
+const sqliteSearchColumns = "id, md5sum, filename, filepath, machine_id, type, exif_tags, size, imported_at, modified_at, " +
+	"ifnull(city, ''), ifnull(region, ''), ifnull(country, ''), ifnull(rating, 0), favourite, color_label, " +
+	"(SELECT json_group_array(l.machine_id) FROM photo_locations l WHERE l.photo_id = photos.id), " + sqliteKeywordsColumn
+
+// json array of the copies of the photo, used in the queries on the photos table
+const sqliteLocationsColumn = "(SELECT json_group_array(json_object('machineid', l.machine_id, 'filepath', l.filepath, 'last_seen', l.last_seen)) " +
+	"FROM photo_locations l WHERE l.photo_id = photos.id)"
+
+// columns read to build a DatabasePhotoRecord with scanPhotoRecord
+const sqlitePhotoColumns = "md5sum, filename, filepath, machine_id, thumbnail, exif_tags, type, size, modified_at, thumbnail_id, thumbnail_size, " +
+	"ifnull(city, ''), ifnull(region, ''), ifnull(country, ''), ifnull(rating, 0), favourite, color_label, " + sqliteLocationsColumn
+
+// function returns the sqlite database handler stored at the database_path of the configuration
+func NewSqliteDatabaseHandler() (*SqliteDatabaseHandler, error) {
+	sqliteConnectionLock.Lock()
+	defer sqliteConnectionLock.Unlock()
+	if globalSqliteConnection == nil {
+		databasePath := configurationapp.GetConfiguration().DatabasePath
+		if databasePath == "" {
+			return &SqliteDatabaseHandler{}, errors.New("No database path defined")
+		}
+		d, err := newSqliteDatabaseHandler(databasePath)
+		if err != nil {
+			return d, err
+		}
+		globalSqliteConnection = d.DBConnection
+	}
+	return &SqliteDatabaseHandler{DBConnection: globalSqliteConnection, Thumbnails: NewThumbnailStore(configurationapp.GetConfiguration().DatabasePath)}, nil
+}
+
+// function opens the sqlite file and upgrades its schema
+func newSqliteDatabaseHandler(databasePath string) (*SqliteDatabaseHandler, error) {
+	d := &SqliteDatabaseHandler{Thumbnails: NewThumbnailStore(databasePath)}
+	conn, err := sql.Open("sqlite", "file:"+databasePath+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		logger.Error("Error while opening sqlite database with error : " + err.Error())
+		return d, err
+	}
+	d.DBConnection = conn
+	if err = d.migrate(); err != nil {
+		conn.Close()
+		return d, err
+	}
+	if err = d.migrateThumbnails(); err != nil {
+		conn.Close()
+		return d, err
+	}
+	if err = d.migrateStats(); err != nil {
+		conn.Close()
+		return d, err
+	}
+	if err = d.migrateGeohash(); err != nil {
+		conn.Close()
+		return d, err
+	}
+	if err = d.migrateDateTaken(); err != nil {
+		conn.Close()
+		return d, err
+	}
+	if err = d.updatePlaces(false); err != nil {
+		conn.Close()
+		return d, err
+	}
+	if err = d.migrateCuration(); err != nil {
+		conn.Close()
+		return d, err
+	}
+	return d, nil
+}
+
+func (d *SqliteDatabaseHandler) Close() error {
+	return d.DBConnection.Close()
+}
+
+func (d *SqliteDatabaseHandler) migrate() error {
+	var version int
+	if err := d.DBConnection.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		logger.Error("Error while reading sqlite schema version with error : " + err.Error())
+		return err
+	}
+	for version < len(sqliteMigrations) {
+		tx, err := d.DBConnection.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(sqliteMigrations[version]); err != nil {
+			tx.Rollback()
+			logger.Errorf("Error while migrating sqlite schema to version %d with error : %v", version+1, err)
+			return err
+		}
+		if _, err = tx.Exec("PRAGMA user_version = " + strconv.Itoa(version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+		version++
+		logger.Infof("Sqlite schema migrated to version %d", version)
+	}
+	return nil
+}
+
+// function escapes the pattern to be used as a contains in a LIKE clause
+func likePattern(pattern string) string {
+	r := strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+	return "%" + r.Replace(pattern) + "%"
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// function reads the sqlitePhotoColumns of the current row and returns the record
+// like the tiedot implementation (local filepath as controller uri, thumbnail not migrated in the image field)
+func scanPhotoRecord(row rowScanner) (*DatabasePhotoRecord, error) {
+	var md5sum, filename, path, machineid, thumbnail, exifTags, filetype, thumbnailId, city, region, country, locations string
+	var size, modtime, thumbnailSize int64
+	var c photoCuration
+	if err := row.Scan(&md5sum, &filename, &path, &machineid, &thumbnail, &exifTags, &filetype, &size, &modtime, &thumbnailId, &thumbnailSize,
+		&city, &region, &country, &c.rating, &c.favourite, &c.colorLabel, &locations); err != nil {
+		return nil, err
+	}
+	var exif map[string]interface{}
+	if err := json.Unmarshal([]byte(exifTags), &exif); err != nil {
+		logger.Errorf("Error while unmarshalling exif tags of %s with error : %v", md5sum, err)
+	}
+	record := NewDatabasePhotoResponse(md5sum, filename, photoUri(md5sum, machineid, path), machineid, thumbnail, exif)
+	record.Type = filetype
+	record.Size = size
+	record.ModTime = modtime
+	record.City, record.Region, record.Country = city, region, country
+	c.setRecord(record)
+	record.ThumbnailUri = thumbnailUri(md5sum, thumbnailId)
+	record.ThumbnailSize = thumbnailSize
+	record.Locations = scanLocations(locations, machineid, path)
+	return record, nil
+}
+
+// function reads the json array of the sqliteLocationsColumn, the copy of the record is the first location
+func scanLocations(content string, machineid string, path string) []*PhotoLocation {
+	locations := make([]*PhotoLocation, 0)
+	if err := json.Unmarshal([]byte(content), &locations); err != nil {
+		logger.Errorf("Error while unmarshalling locations with error : %v", err)
+	}
+	return primaryFirst(locations, machineid, path)
+}
+
+// function returns the id and the copies of the photo md5sum, the id is 0 if the photo is not stored
+func (d *SqliteDatabaseHandler) photoLocations(tx *sql.Tx, md5sum string) (int64, []*PhotoLocation, error) {
+	var id int64
+	var machineid, path, locations string
+	err := tx.QueryRow("SELECT id, machine_id, filepath, "+sqliteLocationsColumn+" FROM photos WHERE md5sum = ?", md5sum).
+		Scan(&id, &machineid, &path, &locations)
+	if err == sql.ErrNoRows {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return id, scanLocations(locations, machineid, path), nil
+}
+
+// function replaces the copies of the photo id, the first copy becomes the machine_id and filepath of the photo
+func (d *SqliteDatabaseHandler) savePhotoLocations(tx *sql.Tx, id int64, locations []*PhotoLocation) error {
+	if _, err := tx.Exec("DELETE FROM photo_locations WHERE photo_id = ?", id); err != nil {
+		return err
+	}
+	for _, location := range locations {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO photo_locations (photo_id, machine_id, filepath, last_seen) VALUES (?, ?, ?, ?)",
+			id, location.MachineId, location.Filepath, location.LastSeen); err != nil {
+			return err
+		}
+	}
+	primary := locations[0]
+	// an empty filename keeps the filename of the cloud photos
+	filename := locationFilename(primary, "")
+	_, err := tx.Exec("UPDATE photos SET machine_id = ?, filepath = ?, filename = CASE WHEN ? = '' THEN filename ELSE ? END "+
+		"WHERE id = ? AND (machine_id != ? OR filepath != ?)",
+		primary.MachineId, primary.Filepath, filename, filename, id, primary.MachineId, primary.Filepath)
+	return err
+}
+
+func (d *SqliteDatabaseHandler) queryPhotos(query string, args ...interface{}) ([]*DatabasePhotoRecord, error) {
+	response := make([]*DatabasePhotoRecord, 0)
+	rows, err := d.DBConnection.Query(query, args...)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return response, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		record, err := scanPhotoRecord(rows)
+		if err != nil {
+			logger.Error("Error while reading photo with error :" + err.Error())
+			continue
+		}
+		response = append(response, record)
+	}
+	return response, rows.Err()
+}
+
+// function calls fn for each photo exif tags, used by the functions which parse
+// the date or the coordinates from the exif values
+func (d *SqliteDatabaseHandler) forEachExif(fn func(exif map[string]interface{}) error) error {
+	rows, err := d.DBConnection.Query("SELECT exif_tags FROM photos")
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var exifTags string
+		if err := rows.Scan(&exifTags); err != nil {
+			return err
+		}
+		var exif map[string]interface{}
+		if err := json.Unmarshal([]byte(exifTags), &exif); err != nil || exif == nil {
+			continue
+		}
+		if err := fn(exif); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (d *SqliteDatabaseHandler) InsertNewData(response *modele.PhotoResponse) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	tx, err := d.DBConnection.Begin()
+	if err != nil {
+		logger.Error("Cannot begin transaction with error : " + err.Error())
+		return err
+	}
+	stmt, err := tx.Prepare("INSERT OR IGNORE INTO photos (md5sum, machine_id, filename, filepath, type, thumbnail_id, thumbnail_size, exif_tags, size, imported_at, modified_at, " +
+		"latitude, longitude, geohash, city, region, country, rating, favourite, color_label, date_taken) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	locationStmt, err := tx.Prepare("INSERT INTO photo_locations (photo_id, machine_id, filepath, last_seen) SELECT id, ?, ?, ? FROM photos WHERE md5sum = ? " +
+		"ON CONFLICT (photo_id, machine_id, filepath) DO UPDATE SET last_seen = excluded.last_seen")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer locationStmt.Close()
+	keywordStmt, err := tx.Prepare("INSERT OR IGNORE INTO photo_keywords (md5sum, keyword) VALUES (?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer keywordStmt.Close()
+	for _, item := range response.Photos {
+		itemTags := photoTags(item)
+		tags, err := json.Marshal(itemTags)
+		if err != nil || itemTags == nil {
+			tags = []byte("{}")
+		}
+		thumbnailId, thumbnailSize, err := d.Thumbnails.PutBase64(item.Thumbnail)
+		if err != nil {
+			logger.Errorf("Cannot store thumbnail of %s with error : %v", item.Md5Sum, err)
+		}
+		latitude, longitude, geohash := sqliteGeoColumns(exifTags(itemTags))
+		place := photoPlace(exifTags(itemTags))
+		curation := exifCuration(exifTags(itemTags))
+		result, err := stmt.Exec(item.Md5Sum,
+			response.MachineId,
+			item.Filename,
+			item.Filepath,
+			strings.ToLower(filepath.Ext(item.Filename)),
+			thumbnailId,
+			thumbnailSize,
+			string(tags),
+			item.Size,
+			time.Now().UnixMicro(),
+			item.ModTime,
+			latitude,
+			longitude,
+			geohash,
+			place.City,
+			place.Region,
+			place.Country,
+			curation.rating,
+			curation.favourite,
+			curation.colorLabel,
+			dateTaken(exifTags(itemTags), item.ModTime))
+		if err != nil {
+			logger.Error("Cannot insert data in database with error : " + err.Error())
+			continue
+		}
+		if _, err = locationStmt.Exec(response.MachineId, item.Filepath, time.Now().Unix(), item.Md5Sum); err != nil {
+			logger.Errorf("Cannot insert location %s of %s in database with error : %v", item.Filepath, item.Md5Sum, err)
+		}
+		for _, keyword := range photoKeywords(item) {
+			if _, err = keywordStmt.Exec(item.Md5Sum, keyword); err != nil {
+				logger.Errorf("Cannot insert keyword %s of %s in database with error : %v", keyword, item.Md5Sum, err)
+			}
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			if err := d.rescanPhoto(tx, item); err != nil {
+				logger.Errorf("Cannot update the xmp of %s with error : %v", item.Md5Sum, err)
+			}
+			logger.Infof("This picture %s already exists in database, location %s of %s recorded.", item.Md5Sum, item.Filepath, response.MachineId)
+		} else {
+			if err := d.addStats(tx, exifTags(itemTags), item.ModTime, 1); err != nil {
+				logger.Errorf("Cannot update stats of %s with error : %v", item.Md5Sum, err)
+			}
+			id, _ := result.LastInsertId()
+			logger.Infof("DB return id %d for filepath:%s\n", id, item.Filepath)
+		}
+	}
+	return tx.Commit()
+}
+
+// function applies the xmp of the copy scanned again to the photo already stored (see rescanTags)
+func (d *SqliteDatabaseHandler) rescanPhoto(tx *sql.Tx, item *modele.PhotoInformations) error {
+	var id, modtime int64
+	var content string
+	var exif map[string]interface{}
+	c := photoCuration{}
+	if err := tx.QueryRow("SELECT id, exif_tags, modified_at, ifnull(rating, 0), favourite, color_label FROM photos WHERE md5sum = ?", item.Md5Sum).
+		Scan(&id, &content, &modtime, &c.rating, &c.favourite, &c.colorLabel); err != nil {
+		return err
+	}
+	json.Unmarshal([]byte(content), &exif)
+	tags, changed := rescanTags(exif, item)
+	if !changed {
+		return nil
+	}
+	encoded, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+	latitude, longitude, geohash := sqliteGeoColumns(tags)
+	place := photoPlace(tags)
+	c = rescanCuration(c, exif, tags)
+	if _, err := tx.Exec("UPDATE photos SET exif_tags = ?, latitude = ?, longitude = ?, geohash = ?, city = ?, region = ?, country = ?, "+
+		"rating = ?, color_label = ?, date_taken = ? WHERE id = ?",
+		string(encoded), latitude, longitude, geohash, place.City, place.Region, place.Country, c.rating, c.colorLabel, dateTaken(tags, modtime), id); err != nil {
+		return err
+	}
+	if err := d.addStats(tx, exif, modtime, -1); err != nil {
+		return err
+	}
+	return d.addStats(tx, tags, modtime, 1)
+}
+
+// function updates the path of the copy of the photo md5sum stored on the machine
+func (d *SqliteDatabaseHandler) MovePhoto(machineid string, move *modele.PhotoMove) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	tx, err := d.DBConnection.Begin()
+	if err != nil {
+		logger.Error("Cannot begin transaction with error : " + err.Error())
+		return err
+	}
+	id, locations, err := d.photoLocations(tx, move.Md5Sum)
+	if err == nil && id != 0 {
+		var primary bool
+		locations, primary = moveLocation(locations, machineid, move)
+		err = d.savePhotoLocations(tx, id, locations)
+		if err == nil && primary {
+			_, err = tx.Exec("UPDATE photos SET machine_id = ?, filename = ?, filepath = ?, type = ? WHERE id = ?",
+				machineid, move.Filename, move.Filepath, strings.ToLower(filepath.Ext(move.Filename)), id)
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		logger.Errorf("Error while moving %s to %s with error : %v", move.Md5Sum, move.Filepath, err)
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	logger.Infof("Photo %s moved from %s to %s", move.Md5Sum, move.PreviousFilepath, move.Filepath)
+	return nil
+}
+
+// function removes the copy of the photo md5sum of the machine if it is still recorded at the photo filepath,
+// the photo is removed with its last copy
+func (d *SqliteDatabaseHandler) DeletePhoto(machineid string, photo *modele.PhotoInformations) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	tx, err := d.DBConnection.Begin()
+	if err != nil {
+		logger.Error("Cannot begin transaction with error : " + err.Error())
+		return err
+	}
+	id, locations, err := d.photoLocations(tx, photo.Md5Sum)
+	kept := removeLocation(locations, machineid, photo.Filepath)
+	if err == nil && len(kept) != len(locations) {
+		if len(kept) == 0 {
+			var tags string
+			var modtime int64
+			var exif map[string]interface{}
+			if err = tx.QueryRow("SELECT exif_tags, modified_at FROM photos WHERE id = ?", id).Scan(&tags, &modtime); err == nil {
+				json.Unmarshal([]byte(tags), &exif)
+				err = d.addStats(tx, exif, modtime, -1)
+			}
+			if err == nil {
+				_, err = tx.Exec("DELETE FROM photos WHERE id = ?", id)
+			}
+		} else {
+			err = d.savePhotoLocations(tx, id, kept)
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		logger.Errorf("Error while deleting %s with error : %v", photo.Md5Sum, err)
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	logger.Infof("Photo %s deleted from %s, %d copies left", photo.Md5Sum, photo.Filepath, len(kept))
+	return nil
+}
+
+// function returns the copies of the photo md5sum
+func (d *SqliteDatabaseHandler) GetPhotoLocations(md5sum string) ([]*PhotoLocation, error) {
+	tx, err := d.DBConnection.Begin()
+	if err != nil {
+		return make([]*PhotoLocation, 0), err
+	}
+	defer tx.Rollback()
+	_, locations, err := d.photoLocations(tx, md5sum)
+	if err != nil {
+		logger.Errorf("Error while retrieving locations of %s with error : %v", md5sum, err)
+		return make([]*PhotoLocation, 0), ErrorWhileRetreivingPicture
+	}
+	if locations == nil {
+		locations = make([]*PhotoLocation, 0)
+	}
+	return locations, nil
+}
+
+// function adds the keywords to the photos, PictureNotFound is returned if a photo is not stored
+func (d *SqliteDatabaseHandler) AddKeywords(md5sums []string, keywords []string) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	keywords, err := NormalizeKeywords(keywords)
+	if err != nil {
+		return err
+	}
+	if err := picturesExist(d, md5sums); err != nil {
+		return err
+	}
+	return d.updateKeywords("INSERT OR IGNORE INTO photo_keywords (md5sum, keyword) VALUES (?, ?)", md5sums, keywords)
+}
+
+// function removes the keywords from the photos
+func (d *SqliteDatabaseHandler) RemoveKeywords(md5sums []string, keywords []string) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	keywords, err := NormalizeKeywords(keywords)
+	if err != nil {
+		return err
+	}
+	return d.updateKeywords("DELETE FROM photo_keywords WHERE md5sum = ? AND keyword = ?", md5sums, keywords)
+}
+
+// function executes the statement with each md5sum and keyword in one transaction
+func (d *SqliteDatabaseHandler) updateKeywords(statement string, md5sums []string, keywords []string) error {
+	tx, err := d.DBConnection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(statement)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, md5sum := range md5sums {
+		for _, keyword := range keywords {
+			if _, err := stmt.Exec(md5sum, keyword); err != nil {
+				logger.Errorf("Cannot store the keyword %s of %s with error : %v", keyword, md5sum, err)
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// function returns the sorted keywords of the photo
+func (d *SqliteDatabaseHandler) GetPhotoKeywords(md5sum string) ([]string, error) {
+	keywords := make([]string, 0)
+	rows, err := d.DBConnection.Query("SELECT keyword FROM photo_keywords WHERE md5sum = ? ORDER BY keyword", md5sum)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return keywords, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var keyword string
+		if err := rows.Scan(&keyword); err != nil {
+			return keywords, err
+		}
+		keywords = append(keywords, keyword)
+	}
+	return keywords, rows.Err()
+}
+
+// function returns the keywords starting with prefix and their number of photos, the most used first
+func (d *SqliteDatabaseHandler) SuggestKeywords(prefix string, limit int) (*album.KeywordsMessage, error) {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	counters := make(keywordCounters)
+	rows, err := d.DBConnection.Query("SELECT keyword, count(*) FROM photo_keywords WHERE substr(keyword, 1, length(?)) = ? GROUP BY keyword", prefix, prefix)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return counters.message(prefix, limit), err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var keyword string
+		var count int
+		if err := rows.Scan(&keyword, &count); err != nil {
+			return counters.message(prefix, limit), err
+		}
+		counters[keyword] = count
+	}
+	return counters.message(prefix, limit), rows.Err()
+}
+
+// function updates the rating, the favourite flag and the colour label of the photos,
+// PictureNotFound is returned if a photo is not stored
+func (d *SqliteDatabaseHandler) UpdateCuration(message *album.CurationMessage) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	if err := ValidateCuration(message); err != nil {
+		return err
+	}
+	if err := picturesExist(d, message.Md5sums); err != nil {
+		return err
+	}
+	tx, err := d.DBConnection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, md5sum := range message.Md5sums {
+		var c photoCuration
+		if err := tx.QueryRow("SELECT ifnull(rating, 0), favourite, color_label FROM photos WHERE md5sum = ?", md5sum).
+			Scan(&c.rating, &c.favourite, &c.colorLabel); err != nil {
+			return err
+		}
+		c = c.update(message)
+		if _, err := tx.Exec("UPDATE photos SET rating = ?, favourite = ?, color_label = ? WHERE md5sum = ?", c.rating, c.favourite, c.colorLabel, md5sum); err != nil {
+			logger.Errorf("Cannot update the curation of %s with error : %v", md5sum, err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// function applies the corrections written back into the photo update.Md5Sum, md5sum is the md5sum of the photo
+// after the write : the photo, its keywords and the albums are updated. PictureNotFound is returned if the photo is not stored
+func (d *SqliteDatabaseHandler) UpdatePhotoMetadata(update *modele.MetadataUpdate, md5sum string) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	keywords, err := metadataKeywords(update)
+	if err != nil {
+		return err
+	}
+	if err := picturesExist(d, []string{update.Md5Sum}); err != nil {
+		return err
+	}
+	if md5sum != update.Md5Sum {
+		if exists, err := d.PictureExists(md5sum); err != nil || exists {
+			return errors.Wrap(PictureAlreadyExists, md5sum)
+		}
+	}
+	tx, err := d.DBConnection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var id, modtime int64
+	var content string
+	var exif map[string]interface{}
+	if err := tx.QueryRow("SELECT id, exif_tags, modified_at FROM photos WHERE md5sum = ?", update.Md5Sum).Scan(&id, &content, &modtime); err != nil {
+		return err
+	}
+	json.Unmarshal([]byte(content), &exif)
+	tags := metadataTags(exif, update)
+	encoded, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+	latitude, longitude, geohash := sqliteGeoColumns(tags)
+	place := photoPlace(tags)
+	if _, err := tx.Exec("UPDATE photos SET md5sum = ?, exif_tags = ?, latitude = ?, longitude = ?, geohash = ?, city = ?, region = ?, country = ?, date_taken = ? WHERE id = ?",
+		md5sum, string(encoded), latitude, longitude, geohash, place.City, place.Region, place.Country, dateTaken(tags, modtime), id); err != nil {
+		logger.Errorf("Cannot update the metadata of %s with error : %v", update.Md5Sum, err)
+		return err
+	}
+	if update.Rating != nil {
+		if _, err := tx.Exec("UPDATE photos SET rating = ? WHERE id = ?", *update.Rating, id); err != nil {
+			return err
+		}
+	}
+	if err := d.addStats(tx, exif, modtime, -1); err != nil {
+		return err
+	}
+	if err := d.addStats(tx, tags, modtime, 1); err != nil {
+		return err
+	}
+	statements := []string{
+		"UPDATE OR REPLACE photo_keywords SET md5sum = ? WHERE md5sum = ?",
+		"UPDATE OR REPLACE album_items SET md5sum = ? WHERE md5sum = ?",
+		"UPDATE albums SET cover = ? WHERE cover = ?",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, md5sum, update.Md5Sum); err != nil {
+			return err
+		}
+	}
+	if keywords != nil {
+		if _, err := tx.Exec("DELETE FROM photo_keywords WHERE md5sum = ?", md5sum); err != nil {
+			return err
+		}
+		for _, keyword := range keywords {
+			if _, err := tx.Exec("INSERT INTO photo_keywords (md5sum, keyword) VALUES (?, ?)", md5sum, keyword); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func (d *SqliteDatabaseHandler) PictureExists(md5sum string) (bool, error) {
+	var count int
+	if err := d.DBConnection.QueryRow("SELECT count(*) FROM photos WHERE md5sum = ?", md5sum).Scan(&count); err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return true, ErrorWhileRetreivingPicture
+	}
+	return count > 0, nil
+}
+
+func (d *SqliteDatabaseHandler) QueryAll() ([]*DatabasePhotoRecord, error) {
+	return d.queryPhotos("SELECT " + sqlitePhotoColumns + " FROM photos")
+}
+
+func (d *SqliteDatabaseHandler) QueryExtension(pattern string) ([]*DatabasePhotoRecord, error) {
+	response, err := d.queryPhotos("SELECT "+sqlitePhotoColumns+" FROM photos WHERE type = ?", pattern)
+	logger.Infof("request returns %d results for extension %s\n", len(response), pattern)
+	return response, err
+}
+
+func (d *SqliteDatabaseHandler) QueryFilename(pattern string) ([]*DatabasePhotoRecord, error) {
+	like := likePattern(pattern)
+	response, err := d.queryPhotos("SELECT "+sqlitePhotoColumns+" FROM photos WHERE filename LIKE ? ESCAPE '\\' OR filepath LIKE ? ESCAPE '\\'", like, like)
+	logger.Infof("request returns %d results for filename %s\n", len(response), pattern)
+	return response, err
+}
+
+func (d *SqliteDatabaseHandler) QueryExifTag(pattern string, exiftag string) ([]*DatabasePhotoRecord, error) {
+	response, err := d.queryPhotos("SELECT "+sqlitePhotoColumns+" FROM photos WHERE EXISTS "+
+		"(SELECT 1 FROM json_each(photos.exif_tags) e WHERE e.key LIKE ? ESCAPE '\\' AND e.value LIKE ? ESCAPE '\\')",
+		likePattern(exiftag), likePattern(pattern))
+	logger.Infof("request returns %d results for pattern %s and exif tag %s\n", len(response), pattern, exiftag)
+	return response, err
+}
+
+func (d *SqliteDatabaseHandler) albumItems(albumName string) ([]string, error) {
+	md5sums := make([]string, 0)
+	rows, err := d.DBConnection.Query("SELECT i.md5sum FROM album_items i JOIN albums a ON a.id = i.album_id WHERE a.name = ? ORDER BY i.position", albumName)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return md5sums, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var md5sum string
+		if err := rows.Scan(&md5sum); err == nil {
+			md5sums = append(md5sums, md5sum)
+		}
+	}
+	return md5sums, rows.Err()
+}
+
+func (d *SqliteDatabaseHandler) albumQuery(albumName string) (*SearchRequest, error) {
+	var value string
+	err := d.DBConnection.QueryRow("SELECT query FROM albums WHERE name = ?", albumName).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return nil, err
+	}
+	return decodeAlbumQuery(albumName, value), nil
+}
+
+func (d *SqliteDatabaseHandler) Search(request *SearchRequest) ([]*DatabasePhotoRecord, error) {
+	response := make([]*DatabasePhotoRecord, 0)
+	if err := request.Validate(); err != nil {
+		return response, err
+	}
+	albums, err := searchAlbums(request, albumPhotos(d))
+	if err != nil {
+		return response, err
+	}
+	ids := make([]int, 0)
+	err = d.forEachSearchDocument(func(id int, doc *searchDocument) {
+		if request.match(doc, albums) {
+			ids = append(ids, id)
+		}
+	})
+	if err != nil {
+		return response, err
+	}
+	response, err = d.photosById(ids)
+	logger.Infof("request returns %d results for search %v\n", len(response), request)
+	return response, err
+}
+
+// function returns the page of the photos matching the request, the sort and the cursor are evaluated by sqlite
+// on the indexes of the sort columns : the photos are read from the cursor in the sort order until the page is full.
+// the total of a filtered request is counted on its first page only, the next pages are returned without total
+func (d *SqliteDatabaseHandler) SearchPage(request *SearchRequest, page *PageRequest) (*PhotoPage, error) {
+	response := &PhotoPage{Records: make([]*DatabasePhotoRecord, 0)}
+	if request != nil {
+		if err := request.Validate(); err != nil {
+			return response, err
+		}
+	}
+	last, err := page.lastKey()
+	if err != nil {
+		return response, err
+	}
+	albums, err := searchAlbums(request, albumPhotos(d))
+	if err != nil {
+		return response, err
+	}
+	column, order, from, after := page.sqliteColumn(), "ASC", ">=", ">"
+	if page.descending {
+		order, from, after = "DESC", "<=", "<"
+	}
+	query := "SELECT " + column + ", " + sqliteSearchColumns + " FROM photos"
+	if request == nil {
+		query = "SELECT " + column + ", id, md5sum FROM photos"
+	}
+	args := make([]interface{}, 0)
+	if last != nil {
+		// the bound on the sort column alone lets sqlite seek the index of an expression
+		query += " WHERE " + column + " " + from + " ? AND (" + column + ", md5sum) " + after + " (?, ?)"
+		args = append(args, page.keyValue(last), page.keyValue(last), last.Md5sum)
+	}
+	query += " ORDER BY " + column + " " + order + ", md5sum " + order
+	if request == nil {
+		query += " LIMIT ?"
+		args = append(args, page.Limit+1)
+		total := 0
+		if err := d.DBConnection.QueryRow("SELECT count(*) FROM photos").Scan(&total); err != nil {
+			logger.Error("Error while querying with error :" + err.Error())
+			return response, err
+		}
+		response.Total = &total
+	}
+
+	rows, err := d.DBConnection.Query(query, args...)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return response, err
+	}
+	ids := make([]int, 0)
+	keys := make([]pageKey, 0)
+	matched := 0
+	for rows.Next() {
+		var value interface{}
+		var id int
+		doc := &searchDocument{}
+		if request == nil {
+			err = rows.Scan(&value, &id, &doc.md5sum)
+		} else {
+			id, err = scanSearchDocument(rows, doc, &value)
+		}
+		if err != nil {
+			logger.Error("Error while reading photo with error :" + err.Error())
+			continue
+		}
+		if !request.match(doc, albums) {
+			continue
+		}
+		matched++
+		if len(ids) <= page.Limit {
+			// the photo after the page tells if a next page exists
+			ids = append(ids, id)
+			keys = append(keys, page.sqliteKey(value, doc.md5sum))
+		} else if last != nil {
+			break
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return response, err
+	}
+	if request != nil && last == nil {
+		response.Total = &matched
+	}
+	if len(ids) > page.Limit {
+		response.NextCursor = keys[page.Limit-1].cursor()
+		ids = ids[:page.Limit]
+	}
+	response.Records, err = d.photosById(ids)
+	return response, err
+}
+
+// function returns the sql expression of the sort of the page request, indexed with the md5sum
+func (p *PageRequest) sqliteColumn() string {
+	switch p.Sort {
+	case SORT_DATE:
+		return "date_taken"
+	case SORT_FILENAME:
+		return "lower(filename)"
+	case SORT_SIZE:
+		return "size"
+	default:
+		return "imported_at"
+	}
+}
+
+// function returns the value of the sort column of the key
+func (p *PageRequest) keyValue(k *pageKey) interface{} {
+	if p.Sort == SORT_FILENAME {
+		return k.Text
+	}
+	return k.Number
+}
+
+// function returns the key of the photo from the value of the sort column read by sqlite
+func (p *PageRequest) sqliteKey(value interface{}, md5sum string) pageKey {
+	k := pageKey{Sort: p.Sort, Descending: p.descending, Md5sum: md5sum}
+	switch v := value.(type) {
+	case int64:
+		k.Number = v
+	case string:
+		k.Text = v
+	case []byte:
+		k.Text = string(v)
+	}
+	return k
+}
+
+// function calls fn with the id and the searched fields of each photo (without the thumbnail)
+func (d *SqliteDatabaseHandler) forEachSearchDocument(fn func(id int, doc *searchDocument)) error {
+	rows, err := d.DBConnection.Query("SELECT " + sqliteSearchColumns + " FROM photos")
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		doc := &searchDocument{}
+		id, err := scanSearchDocument(rows, doc)
+		if err != nil {
+			logger.Error("Error while reading photo with error :" + err.Error())
+			continue
+		}
+		fn(id, doc)
+	}
+	return rows.Err()
+}
+
+// function reads the row of the sqliteSearchColumns in the document and returns the id of the photo,
+// the columns selected before sqliteSearchColumns are read in dest
+func scanSearchDocument(rows *sql.Rows, doc *searchDocument, dest ...interface{}) (int, error) {
+	var id int
+	var exifTags, machineids, keywords string
+	dest = append(dest, &id, &doc.md5sum, &doc.filename, &doc.filepath, &doc.machineid, &doc.filetype, &exifTags, &doc.size, &doc.imported, &doc.modtime,
+		&doc.city, &doc.region, &doc.country, &doc.curation.rating, &doc.curation.favourite, &doc.curation.colorLabel, &machineids, &keywords)
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal([]byte(exifTags), &doc.exif); err != nil {
+		logger.Errorf("Error while unmarshalling exif tags of %s with error : %v", doc.md5sum, err)
+	}
+	if err := json.Unmarshal([]byte(machineids), &doc.machineids); err != nil {
+		logger.Errorf("Error while unmarshalling locations of %s with error : %v", doc.md5sum, err)
+	}
+	if err := json.Unmarshal([]byte(keywords), &doc.keywords); err != nil {
+		logger.Errorf("Error while unmarshalling keywords of %s with error : %v", doc.md5sum, err)
+	}
+	return id, nil
+}
+
+// function returns the records of the photos ids in the same order
+func (d *SqliteDatabaseHandler) photosById(ids []int) ([]*DatabasePhotoRecord, error) {
+	response := make([]*DatabasePhotoRecord, 0)
+	stmt, err := d.DBConnection.Prepare("SELECT " + sqlitePhotoColumns + " FROM photos WHERE id = ?")
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return response, err
+	}
+	defer stmt.Close()
+	for _, id := range ids {
+		record, err := scanPhotoRecord(stmt.QueryRow(id))
+		if err != nil {
+			logger.Errorf("Error while retrieving id %d with error : %v", id, err)
+			continue
+		}
+		response = append(response, record)
+	}
+	return response, nil
+}
+
+func (d *SqliteDatabaseHandler) QueryByTag(tag string) ([]*DatabasePhotoRecord, error) {
+	response := make([]*DatabasePhotoRecord, 0)
+	rows, err := d.DBConnection.Query("SELECT DISTINCT a.name FROM albums a JOIN album_tags t ON t.album_id = a.id WHERE upper(trim(t.tag)) = ?",
+		strings.TrimSpace(strings.ToUpper(tag)))
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return response, err
+	}
+	albumsNames := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err == nil {
+			albumsNames = append(albumsNames, name)
+		}
+	}
+	rows.Close()
+	for _, albumName := range albumsNames {
+		response = append(response, d.GetAlbumData(albumName).Records...)
+	}
+	return appendKeywordPhotos(d, response, tag)
+}
+
+func (d *SqliteDatabaseHandler) GetPhotosUrl(md5sums []string) ([]*DatabasePhotoRecord, error) {
+	response := make([]*DatabasePhotoRecord, 0)
+	for _, m := range md5sums {
+		var md5sum, filename, path, machineid, locations string
+		err := d.DBConnection.QueryRow("SELECT md5sum, filename, filepath, machine_id, "+sqliteLocationsColumn+" FROM photos WHERE md5sum = ?", m).
+			Scan(&md5sum, &filename, &path, &machineid, &locations)
+		if err != nil {
+			if err != sql.ErrNoRows {
+				logger.Errorf("Error while retrieving md5sum %s with error : %v", m, err)
+			}
+			continue
+		}
+		record := NewDatabasePhotoResponse(md5sum, filename, photoUri(md5sum, machineid, path), machineid, "", nil)
+		record.Locations = scanLocations(locations, machineid, path)
+		response = append(response, record)
+	}
+	return Reduce(response, ""), nil
+}
+
+// function returns the photos of the period queryDate of the groupby (all the periods if queryDate is empty)
+// taken in the range of dates
+func (d *SqliteDatabaseHandler) GetPhotosFromTime(queryDate string, groupby string, dates *DateRange) ([]*DatabasePhotoRecord, error) {
+	ids := make([]int, 0)
+	err := d.forEachSearchDocument(func(id int, doc *searchDocument) {
+		if photoInPeriod(doc.exif, doc.modtime, queryDate, groupby, dates) {
+			ids = append(ids, id)
+		}
+	})
+	if err != nil {
+		return make([]*DatabasePhotoRecord, 0), err
+	}
+	return d.photosById(ids)
+}
+
+// function returns the number of photos by date of the groupby (day, week, month or year) from the time_stats table,
+// only the photos taken in the range of dates are counted
+func (d *SqliteDatabaseHandler) GetTimeStats(groupby string, dates *DateRange) (*album.TimeStatsMessage, error) {
+	if dates.bounded() {
+		days, err := d.GetTimeStats(STATS_DAY, nil)
+		if err != nil {
+			return days, err
+		}
+		return rangeTimeStats(days, groupby, dates), nil
+	}
+	response := album.NewTimeStatsMessage()
+	rows, err := d.DBConnection.Query("SELECT date, count FROM time_stats WHERE groupby = ? AND count > 0 ORDER BY date", groupby)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return response, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		stat := &album.TimeStatMessage{}
+		if err := rows.Scan(&stat.Date, &stat.Count); err != nil {
+			return response, err
+		}
+		response.Stats = append(response.Stats, stat)
+	}
+	return response, rows.Err()
+}
+
+func (d *SqliteDatabaseHandler) GetPhotosFromCoordinates(lat, lng string) ([]*DatabasePhotoRecord, error) {
+	qlatitude, _ := strconv.ParseFloat(lat, 64)
+	qlongitude, _ := strconv.ParseFloat(lng, 64)
+	response := make([]*DatabasePhotoRecord, 0)
+	records, err := d.QueryAll()
+	if err != nil {
+		return response, err
+	}
+	for _, record := range records {
+		if record.ExifTags == nil {
+			continue
+		}
+		latitude, longitude := CoordinatesFromExif(record.ExifTags)
+		if Round(longitude, .5, 2) == qlongitude && Round(latitude, .5, 2) == qlatitude {
+			response = append(response, record)
+		}
+	}
+	return response, nil
+}
+
+// function returns the latitude, longitude and geohash columns of the photo exif,
+// the coordinates are null and the geohash empty if the photo is not located
+func sqliteGeoColumns(exif map[string]interface{}) (interface{}, interface{}, string) {
+	hash := photoGeohash(exif)
+	if hash == "" {
+		return nil, nil, ""
+	}
+	latitude, longitude := ExifCoordinates(exif)
+	return latitude, longitude, hash
+}
+
+// function calls fn with the id and the coordinates of the photos located in the bounding box of the area
+func (d *SqliteDatabaseHandler) forEachLocatedPhoto(area *GeoArea, fn func(id int, latitude float64, longitude float64)) error {
+	query := "SELECT id, latitude, longitude FROM photos WHERE geohash != ''"
+	args := make([]interface{}, 0)
+	if area != nil {
+		query += " AND latitude BETWEEN ? AND ? AND ("
+		args = append(args, area.South, area.North)
+		for i, lng := range area.longitudes() {
+			if i > 0 {
+				query += " OR "
+			}
+			query += "longitude BETWEEN ? AND ?"
+			args = append(args, lng[0], lng[1])
+		}
+		query += ")"
+	}
+	rows, err := d.DBConnection.Query(query, args...)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var latitude, longitude float64
+		if err := rows.Scan(&id, &latitude, &longitude); err != nil {
+			return err
+		}
+		if area.Contains(latitude, longitude) {
+			fn(id, latitude, longitude)
+		}
+	}
+	return rows.Err()
+}
+
+// function returns the photos located in the area, the photos are selected by the latitude index
+func (d *SqliteDatabaseHandler) GetPhotosFromArea(area *GeoArea) ([]*DatabasePhotoRecord, error) {
+	ids := make([]int, 0)
+	if err := d.forEachLocatedPhoto(area, func(id int, latitude float64, longitude float64) {
+		ids = append(ids, id)
+	}); err != nil {
+		return make([]*DatabasePhotoRecord, 0), err
+	}
+	return d.photosById(ids)
+}
+
+// function returns the clusters of the photos located in the area (all the photos if area is nil) for the zoom level of the map
+func (d *SqliteDatabaseHandler) GetLocationClusters(zoom int, area *GeoArea) (*album.LocationClustersMessage, error) {
+	clusters := newGeoClusters(zoom)
+	err := d.forEachLocatedPhoto(area, func(id int, latitude float64, longitude float64) {
+		clusters.add(latitude, longitude)
+	})
+	return clusters.message(zoom), err
+}
+
+// function returns the number of photos by place of the level (country, region or city)
+func (d *SqliteDatabaseHandler) GetPlaceStats(level string) (*album.PlaceStatsMessage, error) {
+	response := album.NewPlaceStatsMessage(level)
+	columns := "country, '', ''"
+	switch level {
+	case PLACE_REGION:
+		columns = "country, region, ''"
+	case PLACE_CITY:
+		columns = "country, region, city"
+	}
+	rows, err := d.DBConnection.Query("SELECT " + columns + ", count(*) FROM photos WHERE city != '' GROUP BY " + columns)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return response, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		stat := &album.PlaceStatMessage{}
+		if err := rows.Scan(&stat.Country, &stat.Region, &stat.City, &stat.Count); err != nil {
+			return response, err
+		}
+		response.Stats = append(response.Stats, stat)
+	}
+	sortPlaceStats(response)
+	return response, rows.Err()
+}
+
+func (d *SqliteDatabaseHandler) GetOriginStats() (*album.OriginStatsMessage, error) {
+	o := album.NewOriginStatsMessage()
+	rows, err := d.DBConnection.Query("SELECT machine_id, count(*) FROM photos GROUP BY machine_id")
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return o, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var machineOrigin string
+		var count int
+		if err := rows.Scan(&machineOrigin, &count); err != nil {
+			return o, err
+		}
+		o.Stats[machineOrigin] = count
+	}
+	return o, rows.Err()
+}
+
+// function returns the number of photos by location grid cell from the location_stats table
+func (d *SqliteDatabaseHandler) GetLocationStats() (*album.LocationStatsMessage, error) {
+	l := album.NewLocationStatsMessage()
+	rows, err := d.DBConnection.Query("SELECT latitude, longitude, count FROM location_stats WHERE count > 0 ORDER BY latitude, longitude")
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return l, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		gps := &album.LocationMessage{}
+		if err := rows.Scan(&gps.Latitude, &gps.Longitude, &gps.Count); err != nil {
+			return l, err
+		}
+		l.Stats = append(l.Stats, gps)
+	}
+	return l, rows.Err()
+}
+
+func (d *SqliteDatabaseHandler) GetAlbumList() []string {
+	albumsNames := make([]string, 0)
+	rows, err := d.DBConnection.Query("SELECT name FROM albums")
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return albumsNames
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err == nil {
+			albumsNames = append(albumsNames, name)
+		}
+	}
+	return albumsNames
+}
+
+func (d *SqliteDatabaseHandler) albumId(albumName string) (int64, error) {
+	var id int64
+	err := d.DBConnection.QueryRow("SELECT id FROM albums WHERE name = ?", albumName).Scan(&id)
+	return id, err
+}
+
+func (d *SqliteDatabaseHandler) AlbumExists(albumName string) (bool, error) {
+	_, err := d.albumId(albumName)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return false, err
+	}
+	return true, nil
+}
+
+func (d *SqliteDatabaseHandler) GetAlbumData(albumName string) *DatabaseAlbumRecord {
+	collection := NewDatabaseAlbumRecord()
+	collection.AlbumName = albumName
+
+	var id int64
+	var query string
+	err := d.DBConnection.QueryRow("SELECT id, description, query, parent, cover, owner FROM albums WHERE name = ?", albumName).
+		Scan(&id, &collection.Description, &query, &collection.Parent, &collection.Cover, &collection.Owner)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error("Error while querying with error :" + err.Error())
+		}
+		return collection
+	}
+	rows, err := d.DBConnection.Query("SELECT tag FROM album_tags WHERE album_id = ?", id)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return collection
+	}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err == nil {
+			collection.Tags = append(collection.Tags, tag)
+		}
+	}
+	rows.Close()
+
+	var records []*DatabasePhotoRecord
+	if collection.Query = decodeAlbumQuery(albumName, query); collection.Query != nil {
+		records, err = d.Search(collection.Query)
+	} else {
+		records, err = d.queryPhotos("SELECT "+sqlitePhotoColumns+" FROM photos WHERE md5sum IN (SELECT md5sum FROM album_items WHERE album_id = ?) "+
+			"ORDER BY (SELECT i.position FROM album_items i WHERE i.album_id = ? AND i.md5sum = photos.md5sum)", id, id)
+	}
+	if err != nil {
+		logger.Errorf("Error while reading the photos of the album %s with error : %v", albumName, err)
+		return collection
+	}
+	for _, record := range records {
+		// album records send the thumbnail in the thumbnail field
+		record.Thumbnail = record.Image
+		record.Image = ""
+		collection.Records = append(collection.Records, record)
+	}
+	return ReduceAlbumMessage(collection, "")
+}
+
+// function replaces the ordered items of the album id
+func (d *SqliteDatabaseHandler) saveAlbumItems(tx *sql.Tx, id int64, md5sums []string) error {
+	if _, err := tx.Exec("DELETE FROM album_items WHERE album_id = ?", id); err != nil {
+		return err
+	}
+	for position, md5sum := range md5sums {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO album_items (album_id, md5sum, position) VALUES (?, ?, ?)", id, md5sum, position); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// function replaces the items and the tags of the album id
+func (d *SqliteDatabaseHandler) saveAlbumContent(tx *sql.Tx, id int64, md5sums []string, tags []string) error {
+	if err := d.saveAlbumItems(tx, id, md5sums); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM album_tags WHERE album_id = ?", id); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO album_tags (album_id, tag) VALUES (?, ?)", id, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *SqliteDatabaseHandler) InsertNewAlbum(response *album.AlbumMessage) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	exists, err := d.AlbumExists(response.AlbumName)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return d.updateAlbum(response)
+	}
+	parents, err := d.albumParents()
+	if err != nil {
+		return err
+	}
+	if err = checkAlbumParent(parents, response.AlbumName, response.Parent); err != nil {
+		return err
+	}
+	return d.insertAlbum(response)
+}
+
+// function inserts the album which does not exist yet
+func (d *SqliteDatabaseHandler) insertAlbum(response *album.AlbumMessage) error {
+	request, err := updatedAlbumQuery(nil, response)
+	if err != nil {
+		return err
+	}
+	tx, err := d.DBConnection.Begin()
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec("INSERT INTO albums (name, description, query, parent, cover, owner) VALUES (?, ?, ?, ?, ?, ?)",
+		response.AlbumName, response.Description, encodeAlbumQuery(request), response.Parent, response.Cover, response.Owner)
+	if err != nil {
+		tx.Rollback()
+		logger.Errorf("Cannot insert album %s in database with error : %v", response.AlbumName, err)
+		return err
+	}
+	id, _ := result.LastInsertId()
+	if err = d.saveAlbumContent(tx, id, response.Md5sums, response.Tags); err != nil {
+		tx.Rollback()
+		logger.Errorf("Cannot insert album %s in database with error : %v", response.AlbumName, err)
+		return err
+	}
+	logger.Infof("DB return id %d for album:%s\n", id, response.AlbumName)
+	return tx.Commit()
+}
+
+// function replaces the album description and tags, sets the album query with the result of update applied
+// on the stored query and the album items with the result of merge applied on the stored items (no item for a smart album)
+func (d *SqliteDatabaseHandler) updateAlbumItems(response *album.AlbumMessage, update func(stored *SearchRequest) (*SearchRequest, error), merge func(stored []string) []string) error {
+	id, err := d.albumId(response.AlbumName)
+	if err == sql.ErrNoRows {
+		return errors.New("no records found")
+	}
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return err
+	}
+	storedQuery, err := d.albumQuery(response.AlbumName)
+	if err != nil {
+		return err
+	}
+	request, err := update(storedQuery)
+	if err != nil {
+		return err
+	}
+	if request != nil {
+		merge = func(stored []string) []string { return []string{} }
+	}
+	tx, err := d.DBConnection.Begin()
+	if err != nil {
+		return err
+	}
+	rows, err := tx.Query("SELECT md5sum FROM album_items WHERE album_id = ? ORDER BY position", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	stored := make([]string, 0)
+	for rows.Next() {
+		var md5sum string
+		if err := rows.Scan(&md5sum); err == nil {
+			stored = append(stored, md5sum)
+		}
+	}
+	rows.Close()
+	if _, err = tx.Exec("UPDATE albums SET description = ?, query = ? WHERE id = ?", response.Description, encodeAlbumQuery(request), id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = d.saveAlbumContent(tx, id, merge(stored), response.Tags); err != nil {
+		tx.Rollback()
+		logger.Error("Cannot insert data in database with error : " + err.Error())
+		return err
+	}
+	logger.Infof("DB return id %d for album:%s\n", id, response.AlbumName)
+	return tx.Commit()
+}
+
+func (d *SqliteDatabaseHandler) UpdateAlbum(response *album.AlbumMessage) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	return d.updateAlbum(response)
+}
+
+func (d *SqliteDatabaseHandler) updateAlbum(response *album.AlbumMessage) error {
+	update := func(stored *SearchRequest) (*SearchRequest, error) {
+		return updatedAlbumQuery(stored, response)
+	}
+	return d.updateAlbumItems(response, update, func(stored []string) []string {
+		return appendItems(stored, response.Md5sums)
+	})
+}
+
+func (d *SqliteDatabaseHandler) DeletePhotoAlbum(response *album.AlbumMessage) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	update := func(stored *SearchRequest) (*SearchRequest, error) {
+		if stored != nil {
+			return nil, SmartAlbumPhotos
+		}
+		return nil, nil
+	}
+	return d.updateAlbumItems(response, update, func(stored []string) []string {
+		photosToKeep := make([]string, 0)
+		for _, item := range stored {
+			mustBeDeleted := false
+			for _, md5sum := range response.Md5sums {
+				if md5sum == item {
+					mustBeDeleted = true
+					break
+				}
+			}
+			if !mustBeDeleted {
+				photosToKeep = append(photosToKeep, item)
+			}
+		}
+		return photosToKeep
+	})
+}
+
+func (d *SqliteDatabaseHandler) DeleteAlbum(response *album.AlbumMessage) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	var parent string
+	err := d.DBConnection.QueryRow("SELECT parent FROM albums WHERE name = ?", response.AlbumName).Scan(&parent)
+	if err == sql.ErrNoRows {
+		return errors.New("no records found")
+	}
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return err
+	}
+	if _, err = d.DBConnection.Exec("DELETE FROM albums WHERE name = ?", response.AlbumName); err != nil {
+		logger.Error("Cannot delete data in database with error : " + err.Error())
+		return err
+	}
+	// the subalbums are moved to the parent of the deleted album
+	if _, err = d.DBConnection.Exec("UPDATE albums SET parent = ? WHERE parent = ?", parent, response.AlbumName); err != nil {
+		logger.Error("Cannot update data in database with error : " + err.Error())
+		return err
+	}
+	// and its share links are removed
+	if _, err = d.DBConnection.Exec("DELETE FROM shares WHERE album_name = ?", response.AlbumName); err != nil {
+		logger.Error("Cannot delete data in database with error : " + err.Error())
+		return err
+	}
+	logger.Infof("album:%s is delete\n", response.AlbumName)
+	return nil
+}
+
+func (d *SqliteDatabaseHandler) albumParents() (map[string]string, error) {
+	parents := make(map[string]string)
+	rows, err := d.DBConnection.Query("SELECT name, parent FROM albums")
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return parents, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, parent string
+		if err := rows.Scan(&name, &parent); err == nil {
+			parents[name] = parent
+		}
+	}
+	return parents, rows.Err()
+}
+
+func (d *SqliteDatabaseHandler) GetAlbumTree() ([]*album.AlbumTreeMessage, error) {
+	return albumTree(d)
+}
+
+// function moves the album under the parent album, an empty parent moves the album to the root
+func (d *SqliteDatabaseHandler) MoveAlbum(albumName string, parent string) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	if err := checkAlbumMove(d, albumName, parent); err != nil {
+		return err
+	}
+	return d.setAlbumParent(albumName, parent)
+}
+
+func (d *SqliteDatabaseHandler) setAlbumParent(albumName string, parent string) error {
+	if _, err := d.DBConnection.Exec("UPDATE albums SET parent = ? WHERE name = ?", parent, albumName); err != nil {
+		logger.Errorf("Cannot update the parent of the album %s with error : %v", albumName, err)
+		return err
+	}
+	return nil
+}
+
+func (d *SqliteDatabaseHandler) setAlbumCover(albumName string, md5sum string) error {
+	if _, err := d.DBConnection.Exec("UPDATE albums SET cover = ? WHERE name = ?", md5sum, albumName); err != nil {
+		logger.Errorf("Cannot update the cover of the album %s with error : %v", albumName, err)
+		return err
+	}
+	return nil
+}
+
+func (d *SqliteDatabaseHandler) setAlbumItems(albumName string, md5sums []string) error {
+	id, err := d.albumId(albumName)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return err
+	}
+	tx, err := d.DBConnection.Begin()
+	if err != nil {
+		return err
+	}
+	if err = d.saveAlbumItems(tx, id, md5sums); err != nil {
+		tx.Rollback()
+		logger.Errorf("Cannot update the photos of the album %s with error : %v", albumName, err)
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *SqliteDatabaseHandler) ReorderAlbum(albumName string, md5sums []string) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	return reorderAlbum(d, albumName, md5sums)
+}
+
+func (d *SqliteDatabaseHandler) InsertAlbumPhotos(albumName string, md5sums []string, position int) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	return insertAlbumPhotos(d, albumName, md5sums, position)
+}
+
+func (d *SqliteDatabaseHandler) SortAlbumByDate(albumName string, descending bool) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	return sortAlbumByDate(d, albumName, descending)
+}
+
+func (d *SqliteDatabaseHandler) SetAlbumCover(albumName string, md5sum string) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	return updateAlbumCover(d, albumName, md5sum)
+}
+
+// function calls fn for each photo of the database, the writes must be blocked by the caller (see BlockWrites)
+func (d *SqliteDatabaseHandler) ExportPhotos(fn func(photo *BackupPhotoRecord) error) error {
+	rows, err := d.DBConnection.Query("SELECT md5sum, machine_id, filename, filepath, type, size, imported_at, modified_at, exif_tags, thumbnail, thumbnail_id, " +
+		"ifnull(rating, 0), favourite, color_label, " + sqliteLocationsColumn + ", " + sqliteKeywordsColumn + " FROM photos ORDER BY id")
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		photo := &BackupPhotoRecord{}
+		var tags, thumbnailId, locations, keywords string
+		if err := rows.Scan(&photo.Md5sum, &photo.MachineId, &photo.Filename, &photo.Filepath, &photo.Type,
+			&photo.Size, &photo.ImportTime, &photo.ModTime, &tags, &photo.Thumbnail, &thumbnailId,
+			&photo.Rating, &photo.Favourite, &photo.ColorLabel, &locations, &keywords); err != nil {
+			return err
+		}
+		json.Unmarshal([]byte(keywords), &photo.Keywords)
+		photo.Locations = scanLocations(locations, photo.MachineId, photo.Filepath)
+		if photo.Thumbnail == "" {
+			photo.Thumbnail = d.Thumbnails.Base64(thumbnailId)
+		}
+		if err := json.Unmarshal([]byte(tags), &photo.ExifTags); err != nil {
+			logger.Errorf("Error while reading exif tags of %s with error : %v", photo.Md5sum, err)
+		}
+		if err := fn(photo); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// function calls fn for each album of the database, the writes must be blocked by the caller (see BlockWrites)
+func (d *SqliteDatabaseHandler) ExportAlbums(fn func(a *album.AlbumMessage) error) error {
+	for _, name := range d.GetAlbumList() {
+		message := album.NewAlbumMessage(name, make([]string, 0))
+		var query string
+		err := d.DBConnection.QueryRow("SELECT description, query, parent, cover, owner FROM albums WHERE name = ?", name).
+			Scan(&message.Description, &query, &message.Parent, &message.Cover, &message.Owner)
+		if err != nil {
+			return err
+		}
+		if message.Md5sums, err = d.albumItems(name); err != nil {
+			return err
+		}
+		rows, err := d.DBConnection.Query("SELECT tag FROM album_tags WHERE album_id = (SELECT id FROM albums WHERE name = ?)", name)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var tag string
+			if err := rows.Scan(&tag); err == nil {
+				message.Tags = append(message.Tags, tag)
+			}
+		}
+		rows.Close()
+		setAlbumMessageQuery(message, decodeAlbumQuery(name, query))
+		if err := fn(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// function inserts the photo of a backup, PictureAlreadyExists is returned if the md5sum is already stored.
+// the writes must be blocked by the caller (see BlockWrites)
+func (d *SqliteDatabaseHandler) RestorePhoto(photo *BackupPhotoRecord) error {
+	tags, err := json.Marshal(photo.ExifTags)
+	if err != nil || photo.ExifTags == nil {
+		tags = []byte("{}")
+	}
+	thumbnailId, thumbnailSize, err := d.Thumbnails.PutBase64(photo.Thumbnail)
+	if err != nil {
+		logger.Errorf("Cannot store thumbnail of %s with error : %v", photo.Md5sum, err)
+	}
+	latitude, longitude, geohash := sqliteGeoColumns(photo.ExifTags)
+	place := photoPlace(photo.ExifTags)
+	curation := photo.curation()
+	result, err := d.DBConnection.Exec("INSERT OR IGNORE INTO photos (md5sum, machine_id, filename, filepath, type, thumbnail_id, thumbnail_size, exif_tags, size, imported_at, modified_at, "+
+		"latitude, longitude, geohash, city, region, country, rating, favourite, color_label, date_taken) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		photo.Md5sum, photo.MachineId, photo.Filename, photo.Filepath, photo.Type, thumbnailId, thumbnailSize, string(tags), photo.Size, photo.ImportTime, photo.ModTime,
+		latitude, longitude, geohash, place.City, place.Region, place.Country, curation.rating, curation.favourite, curation.colorLabel, dateTaken(photo.ExifTags, photo.ModTime))
+	if err != nil {
+		logger.Errorf("Cannot restore photo %s in database with error : %v", photo.Md5sum, err)
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return PictureAlreadyExists
+	}
+	id, _ := result.LastInsertId()
+	for _, location := range recordLocations(photo.Locations, photo.MachineId, photo.Filepath, photo.ImportTime/1000000) {
+		if _, err = d.DBConnection.Exec("INSERT OR IGNORE INTO photo_locations (photo_id, machine_id, filepath, last_seen) VALUES (?, ?, ?, ?)",
+			id, location.MachineId, location.Filepath, location.LastSeen); err != nil {
+			logger.Errorf("Cannot restore location %s of %s in database with error : %v", location.Filepath, photo.Md5sum, err)
+			return err
+		}
+	}
+	for _, keyword := range photo.Keywords {
+		if _, err = d.DBConnection.Exec("INSERT OR IGNORE INTO photo_keywords (md5sum, keyword) VALUES (?, ?)", photo.Md5sum, keyword); err != nil {
+			logger.Errorf("Cannot restore keyword %s of %s in database with error : %v", keyword, photo.Md5sum, err)
+			return err
+		}
+	}
+	var exif map[string]interface{}
+	json.Unmarshal(tags, &exif)
+	return d.addStats(d.DBConnection, exif, photo.ModTime, 1)
+}
+
+// function creates the album of a backup or replaces the stored album with the same name.
+// the writes must be blocked by the caller (see BlockWrites)
+func (d *SqliteDatabaseHandler) RestoreAlbum(a *album.AlbumMessage) error {
+	exists, err := d.AlbumExists(a.AlbumName)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return d.insertAlbum(a)
+	}
+	update := func(stored *SearchRequest) (*SearchRequest, error) {
+		return SmartAlbumQuery(a)
+	}
+	err = d.updateAlbumItems(a, update, func(stored []string) []string {
+		return a.Md5sums
+	})
+	if err != nil {
+		return err
+	}
+	if err = d.setAlbumParent(a.AlbumName, a.Parent); err != nil {
+		return err
+	}
+	if _, err = d.DBConnection.Exec("UPDATE albums SET owner = ? WHERE name = ?", a.Owner, a.AlbumName); err != nil {
+		logger.Errorf("Cannot update the owner of the album %s with error : %v", a.AlbumName, err)
+		return err
+	}
+	return d.setAlbumCover(a.AlbumName, a.Cover)
+}
+
+// function returns the thumbnail of the photo md5sum
+func (d *SqliteDatabaseHandler) GetThumbnail(md5sum string) (*Thumbnail, error) {
+	var thumbnail, thumbnailId string
+	err := d.DBConnection.QueryRow("SELECT thumbnail, thumbnail_id FROM photos WHERE md5sum = ?", md5sum).Scan(&thumbnail, &thumbnailId)
+	if err == sql.ErrNoRows {
+		return nil, ThumbnailNotFound
+	}
+	if err != nil {
+		logger.Errorf("Error while retrieving md5sum %s with error : %v", md5sum, err)
+		return nil, err
+	}
+	if thumbnailId != "" {
+		return d.Thumbnails.Get(thumbnailId)
+	}
+	if thumbnail != "" {
+		content, err := base64.StdEncoding.DecodeString(thumbnail)
+		if err != nil {
+			return nil, err
+		}
+		return &Thumbnail{Id: ThumbnailId(content), Content: content}, nil
+	}
+	return nil, ThumbnailNotFound
+}
+
+// function removes the thumbnails of the store which no photo references
+func (d *SqliteDatabaseHandler) sweepThumbnails() error {
+	rows, err := d.DBConnection.Query("SELECT DISTINCT thumbnail_id FROM photos WHERE thumbnail_id != ''")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	referenced := make(map[string]bool)
+	for rows.Next() {
+		var thumbnailId string
+		if err := rows.Scan(&thumbnailId); err != nil {
+			return err
+		}
+		referenced[thumbnailId] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = d.Thumbnails.Sweep(referenced, time.Now())
+	return err
+}
+
+// function moves the base64 thumbnails stored in the photos table to the thumbnail store
+func (d *SqliteDatabaseHandler) migrateThumbnails() error {
+	var count int
+	if err := d.DBConnection.QueryRow("SELECT count(*) FROM photos WHERE thumbnail != ''").Scan(&count); err != nil || count == 0 {
+		return err
+	}
+	logger.Infof("Moving %d thumbnails to the thumbnail store %s", count, d.Thumbnails.Path)
+	// the thumbnails are read by batches to not load the whole table in memory
+	var lastId int64
+	for {
+		rows, err := d.DBConnection.Query("SELECT id, thumbnail FROM photos WHERE thumbnail != '' AND id > ? ORDER BY id LIMIT 500", lastId)
+		if err != nil {
+			return err
+		}
+		thumbnails := make(map[int64]string)
+		for rows.Next() {
+			var thumbnail string
+			if err := rows.Scan(&lastId, &thumbnail); err != nil {
+				rows.Close()
+				return err
+			}
+			thumbnails[lastId] = thumbnail
+		}
+		rows.Close()
+		if len(thumbnails) == 0 {
+			break
+		}
+		for id, thumbnail := range thumbnails {
+			thumbnailId, thumbnailSize, err := d.Thumbnails.PutBase64(thumbnail)
+			if err != nil {
+				logger.Errorf("Cannot store thumbnail of photo %d with error : %v", id, err)
+				continue
+			}
+			if _, err := d.DBConnection.Exec("UPDATE photos SET thumbnail = '', thumbnail_id = ?, thumbnail_size = ? WHERE id = ?", thumbnailId, thumbnailSize, id); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := d.DBConnection.Exec("VACUUM")
+	return err
+}
+
+// function computes the coordinates and the geohash of the photos stored before the geohash column
+func (d *SqliteDatabaseHandler) migrateGeohash() error {
+	var lastId int64
+	for {
+		rows, err := d.DBConnection.Query("SELECT id, exif_tags FROM photos WHERE geohash IS NULL AND id > ? ORDER BY id LIMIT 500", lastId)
+		if err != nil {
+			return err
+		}
+		exifs := make(map[int64]map[string]interface{})
+		for rows.Next() {
+			var tags string
+			var exif map[string]interface{}
+			if err := rows.Scan(&lastId, &tags); err != nil {
+				rows.Close()
+				return err
+			}
+			json.Unmarshal([]byte(tags), &exif)
+			exifs[lastId] = exif
+		}
+		rows.Close()
+		if len(exifs) == 0 {
+			return nil
+		}
+		for id, exif := range exifs {
+			latitude, longitude, geohash := sqliteGeoColumns(exif)
+			if _, err := d.DBConnection.Exec("UPDATE photos SET latitude = ?, longitude = ?, geohash = ? WHERE id = ?", latitude, longitude, geohash, id); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// function computes the date taken of the photos stored before the date_taken column
+func (d *SqliteDatabaseHandler) migrateDateTaken() error {
+	var lastId int64
+	for {
+		rows, err := d.DBConnection.Query("SELECT id, exif_tags, modified_at FROM photos WHERE date_taken IS NULL AND id > ? ORDER BY id LIMIT 500", lastId)
+		if err != nil {
+			return err
+		}
+		dates := make(map[int64]int64)
+		for rows.Next() {
+			var tags string
+			var modtime int64
+			var exif map[string]interface{}
+			if err := rows.Scan(&lastId, &tags, &modtime); err != nil {
+				rows.Close()
+				return err
+			}
+			json.Unmarshal([]byte(tags), &exif)
+			dates[lastId] = dateTaken(exif, modtime)
+		}
+		rows.Close()
+		if len(dates) == 0 {
+			return nil
+		}
+		for id, date := range dates {
+			if _, err := d.DBConnection.Exec("UPDATE photos SET date_taken = ? WHERE id = ?", date, id); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// function resolves the places of the photos stored before the places (all the photos if all is set)
+func (d *SqliteDatabaseHandler) updatePlaces(all bool) error {
+	if all {
+		if _, err := d.DBConnection.Exec("UPDATE photos SET city = NULL, region = NULL, country = NULL"); err != nil {
+			return err
+		}
+	}
+	var lastId int64
+	for {
+		rows, err := d.DBConnection.Query("SELECT id, exif_tags FROM photos WHERE city IS NULL AND id > ? ORDER BY id LIMIT 500", lastId)
+		if err != nil {
+			return err
+		}
+		exifs := make(map[int64]map[string]interface{})
+		for rows.Next() {
+			var tags string
+			var exif map[string]interface{}
+			if err := rows.Scan(&lastId, &tags); err != nil {
+				rows.Close()
+				return err
+			}
+			json.Unmarshal([]byte(tags), &exif)
+			exifs[lastId] = exif
+		}
+		rows.Close()
+		if len(exifs) == 0 {
+			return nil
+		}
+		for id, exif := range exifs {
+			place := photoPlace(exif)
+			if _, err := d.DBConnection.Exec("UPDATE photos SET city = ?, region = ?, country = ? WHERE id = ?", place.City, place.Region, place.Country, id); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// function seeds the curation of the photos stored before the curation from their exif rating and label
+func (d *SqliteDatabaseHandler) migrateCuration() error {
+	var lastId int64
+	for {
+		rows, err := d.DBConnection.Query("SELECT id, exif_tags FROM photos WHERE rating IS NULL AND id > ? ORDER BY id LIMIT 500", lastId)
+		if err != nil {
+			return err
+		}
+		exifs := make(map[int64]map[string]interface{})
+		for rows.Next() {
+			var tags string
+			var exif map[string]interface{}
+			if err := rows.Scan(&lastId, &tags); err != nil {
+				rows.Close()
+				return err
+			}
+			json.Unmarshal([]byte(tags), &exif)
+			exifs[lastId] = exif
+		}
+		rows.Close()
+		if len(exifs) == 0 {
+			return nil
+		}
+		for id, exif := range exifs {
+			c := exifCuration(exif)
+			if _, err := d.DBConnection.Exec("UPDATE photos SET rating = ?, color_label = ? WHERE id = ?", c.rating, c.colorLabel, id); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// function sets the machine_id and filepath of the photos with another copy if their copy has been removed
+func (d *SqliteDatabaseHandler) promoteLocations() error {
+	tx, err := d.DBConnection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	rows, err := tx.Query("SELECT md5sum FROM photos WHERE NOT EXISTS " +
+		"(SELECT 1 FROM photo_locations l WHERE l.photo_id = photos.id AND l.machine_id = photos.machine_id AND l.filepath = photos.filepath)")
+	if err != nil {
+		return err
+	}
+	md5sums := make([]string, 0)
+	for rows.Next() {
+		var md5sum string
+		if err := rows.Scan(&md5sum); err == nil {
+			md5sums = append(md5sums, md5sum)
+		}
+	}
+	rows.Close()
+	for _, md5sum := range md5sums {
+		id, locations, err := d.photoLocations(tx, md5sum)
+		if err != nil {
+			return err
+		}
+		if err := d.savePhotoLocations(tx, id, locations); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// function adds delta to the stats counters of the photo exif
+func (d *SqliteDatabaseHandler) addStats(db sqlExecer, exif map[string]interface{}, modtime int64, delta int) error {
+	for groupby, date := range statsDates(exif, modtime) {
+		if _, err := db.Exec("INSERT INTO time_stats (groupby, date, count) VALUES (?, ?, ?) "+
+			"ON CONFLICT (groupby, date) DO UPDATE SET count = count + excluded.count", groupby, date, delta); err != nil {
+			return err
+		}
+	}
+	if cell, ok := statsLocation(exif); ok {
+		if _, err := db.Exec("INSERT INTO location_stats (latitude, longitude, count) VALUES (?, ?, ?) "+
+			"ON CONFLICT (latitude, longitude) DO UPDATE SET count = count + excluded.count", cell[0], cell[1], delta); err != nil {
+			return err
+		}
+	}
+	if delta < 0 {
+		if _, err := db.Exec("DELETE FROM time_stats WHERE count <= 0"); err != nil {
+			return err
+		}
+		if _, err := db.Exec("DELETE FROM location_stats WHERE count <= 0"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// function computes again the stats counters from all the photos
+func (d *SqliteDatabaseHandler) rebuildStats() error {
+	tx, err := d.DBConnection.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// the tables are emptied first to lock the database while the photos are read
+	if _, err := tx.Exec("DELETE FROM time_stats"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM location_stats"); err != nil {
+		return err
+	}
+	counters := newStatsCounters()
+	rows, err := tx.Query("SELECT exif_tags, modified_at FROM photos")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var tags string
+		var modtime int64
+		var exif map[string]interface{}
+		if err := rows.Scan(&tags, &modtime); err != nil {
+			rows.Close()
+			return err
+		}
+		if err := json.Unmarshal([]byte(tags), &exif); err != nil {
+			continue
+		}
+		counters.add(exif, modtime, 1)
+	}
+	rows.Close()
+	for groupby, dates := range counters.times {
+		for date, count := range dates {
+			if _, err := tx.Exec("INSERT INTO time_stats (groupby, date, count) VALUES (?, ?, ?)", groupby, date, count); err != nil {
+				return err
+			}
+		}
+	}
+	for cell, count := range counters.locations {
+		if _, err := tx.Exec("INSERT INTO location_stats (latitude, longitude, count) VALUES (?, ?, ?)", cell[0], cell[1], count); err != nil {
+			return err
+		}
+	}
+	logger.Infof("Stats computed for %d dates and %d locations", len(counters.times[STATS_DAY]), len(counters.locations))
+	return tx.Commit()
+}
+
+// function computes the stats counters of the photos stored before the counters
+func (d *SqliteDatabaseHandler) migrateStats() error {
+	var stats, photos int
+	if err := d.DBConnection.QueryRow("SELECT (SELECT count(*) FROM time_stats), (SELECT count(*) FROM photos)").Scan(&stats, &photos); err != nil {
+		return err
+	}
+	if stats > 0 || photos == 0 {
+		return nil
+	}
+	return d.rebuildStats()
+}
+
+func (d *SqliteDatabaseHandler) CleanDatabase() error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	if _, err := d.DBConnection.Exec("DELETE FROM photo_locations WHERE machine_id = ''"); err != nil {
+		logger.Error("Cannot delete data in database with error : " + err.Error())
+		return err
+	}
+	for _, slave := range slavehandler.GetSlaves().Slaves {
+		if !slave.IsActive() {
+			logger.Infof("Removing photos of machine %s", slave.Name)
+			if _, err := d.DBConnection.Exec("DELETE FROM photo_locations WHERE machine_id = ?", slave.Name); err != nil {
+				logger.Error("Cannot delete data in database with error : " + err.Error())
+				return err
+			}
+		}
+	}
+	// the photos are removed only if none of their copies is on an active machine
+	if _, err := d.DBConnection.Exec("DELETE FROM photos WHERE id NOT IN (SELECT photo_id FROM photo_locations)"); err != nil {
+		logger.Error("Cannot delete data in database with error : " + err.Error())
+		return err
+	}
+	if err := d.promoteLocations(); err != nil {
+		logger.Errorf("Error while updating the copies of the photos with error %v", err)
+		return err
+	}
+	if _, err := d.DBConnection.Exec("DELETE FROM photo_keywords WHERE md5sum NOT IN (SELECT md5sum FROM photos)"); err != nil {
+		logger.Error("Cannot delete keywords in database with error : " + err.Error())
+		return err
+	}
+	if err := d.sweepThumbnails(); err != nil {
+		logger.Errorf("Error while removing the thumbnails of the removed photos with error %v", err)
+		return err
+	}
+	if err := d.rebuildStats(); err != nil {
+		logger.Errorf("Error while computing the stats with error %v", err)
+		return err
+	}
+	if err := d.updatePlaces(true); err != nil {
+		logger.Errorf("Error while computing the places with error %v", err)
+		return err
+	}
+	if _, err := d.DBConnection.Exec("VACUUM"); err != nil {
+		logger.Errorf("Error while vacuuming database with error %v", err)
+		return err
+	}
+	return nil
+}
+
+// function stores the share link of an album
+func (d *SqliteDatabaseHandler) InsertShare(share *DatabaseShareRecord) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	if err := checkShareAlbum(d, share.AlbumName); err != nil {
+		return err
+	}
+	_, err := d.DBConnection.Exec("INSERT INTO shares (token, album_name, expires_at, password, download, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		share.Token, share.AlbumName, share.Expires.Unix(), share.Password, share.Download, share.Created.Unix())
+	if err != nil {
+		logger.Errorf("Cannot store the share link of the album %s with error : %v", share.AlbumName, err)
+	}
+	return err
+}
+
+// function creates the share link of a backup or replaces the stored share link with the same token.
+// the writes must be blocked by the caller (see BlockWrites)
+func (d *SqliteDatabaseHandler) RestoreShare(share *DatabaseShareRecord) error {
+	if err := checkShareAlbum(d, share.AlbumName); err != nil {
+		return err
+	}
+	_, err := d.DBConnection.Exec("INSERT OR REPLACE INTO shares (token, album_name, expires_at, password, download, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		share.Token, share.AlbumName, share.Expires.Unix(), share.Password, share.Download, share.Created.Unix())
+	if err != nil {
+		logger.Errorf("Cannot restore the share link of the album %s with error : %v", share.AlbumName, err)
+	}
+	return err
+}
+
+// function returns the share links of the rows (token, album_name, expires_at, password, download, created_at)
+func scanShares(rows *sql.Rows) ([]*DatabaseShareRecord, error) {
+	shares := make([]*DatabaseShareRecord, 0)
+	defer rows.Close()
+	for rows.Next() {
+		var expires, created int64
+		share := &DatabaseShareRecord{}
+		if err := rows.Scan(&share.Token, &share.AlbumName, &expires, &share.Password, &share.Download, &created); err != nil {
+			return shares, err
+		}
+		share.Expires = time.Unix(expires, 0).UTC()
+		share.Created = time.Unix(created, 0).UTC()
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+// function returns the share link of the token, ShareNotFound if the token does not exist
+func (d *SqliteDatabaseHandler) GetShare(token string) (*DatabaseShareRecord, error) {
+	rows, err := d.DBConnection.Query("SELECT token, album_name, expires_at, password, download, created_at FROM shares WHERE token = ?", token)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return nil, err
+	}
+	shares, err := scanShares(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(shares) == 0 {
+		return nil, ShareNotFound
+	}
+	return shares[0], nil
+}
+
+// function returns the share links of the album sorted by creation date, all the share links without album
+func (d *SqliteDatabaseHandler) GetShares(albumName string) ([]*DatabaseShareRecord, error) {
+	rows, err := d.DBConnection.Query("SELECT token, album_name, expires_at, password, download, created_at FROM shares WHERE ? = '' OR album_name = ? ORDER BY created_at, rowid", albumName, albumName)
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+		return make([]*DatabaseShareRecord, 0), err
+	}
+	return scanShares(rows)
+}
+
+// function removes the share link of the token, ShareNotFound if the token does not exist
+func (d *SqliteDatabaseHandler) DeleteShare(token string) error {
+	writesLock.RLock()
+	defer writesLock.RUnlock()
+	result, err := d.DBConnection.Exec("DELETE FROM shares WHERE token = ?", token)
+	if err != nil {
+		logger.Error("Cannot delete data in database with error : " + err.Error())
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		return ShareNotFound
+	}
+	return err
+}
+
+// function returns the owner of the album, AlbumNotFound if the album does not exist
+func (d *SqliteDatabaseHandler) GetAlbumOwner(albumName string) (string, error) {
+	var owner string
+	err := d.DBConnection.QueryRow("SELECT owner FROM albums WHERE name = ?", albumName).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return "", AlbumNotFound
+	}
+	if err != nil {
+		logger.Error("Error while querying with error :" + err.Error())
+	}
+	return owner, err
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/modele"
+)
+
+func newTestSqliteDatabase(t *testing.T) *SqliteDatabaseHandler {
+	db, err := newSqliteDatabaseHandler(filepath.Join(t.TempDir(), "photo.db"))
+	if err != nil {
+		t.Fatal("database must not be on error with error " + err.Error())
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.InsertNewData(newTestPhotoResponse()); err != nil {
+		t.Fatal("insert must not be on error with error " + err.Error())
+	}
+	return db
+}
+
+func newTestPhotoResponse() *modele.PhotoResponse {
+	photos := []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "IMG_0001.JPG", Filepath: "/photos/2016/IMG_0001.JPG",
+			Tags: map[string]string{"Model": "NIKON D80", DATEFLICKRTAG: "2016:07:14 10:00:00"}},
+		{Md5Sum: "md5-2", Filename: "DSC_0002.NEF", Filepath: "/photos/l'été/DSC_0002.NEF",
+			Tags: map[string]string{"Model": "Canon EOS 400D"}},
+	}
+	return modele.NewPhotoResponse("", modele.VERSION, "mymachineid", photos)
+}
+
+func TestSqliteInsertAndQueryAll(t *testing.T) {
+	db := newTestSqliteDatabase(t)
+	// same md5sum must be skipped
+	db.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "othermachine", []*modele.PhotoInformations{{Md5Sum: "md5-1", Filename: "copy.jpg"}}))
+	response, err := db.QueryAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response) != 2 {
+		t.Fatal("expected size response 2 and received " + strconv.Itoa(len(response)))
+	}
+	exists, _ := db.PictureExists("md5-2")
+	if !exists {
+		t.Fatal("expected md5-2 to exist")
+	}
+}
+
+func TestSqliteQueries(t *testing.T) {
+	db := newTestSqliteDatabase(t)
+	if response, _ := db.QueryExtension(".nef"); len(response) != 1 || response[0].Md5sum != "md5-2" {
+		t.Fatalf("expected md5-2 for extension .nef and received %v", response)
+	}
+	if response, _ := db.QueryFilename("l'été"); len(response) != 1 {
+		t.Fatal("expected size response 1 and received " + strconv.Itoa(len(response)))
+	}
+	if response, _ := db.QueryFilename("100%"); len(response) != 0 {
+		t.Fatal("expected size response 0 and received " + strconv.Itoa(len(response)))
+	}
+	response, _ := db.QueryExifTag("nikon", "model")
+	if len(response) != 1 || response[0].Md5sum != "md5-1" {
+		t.Fatalf("expected md5-1 for exif model nikon and received %v", response)
+	}
+	if response[0].Filepath != "/photo?filepath=/photos/2016/IMG_0001.JPG&machineid=mymachineid&md5sum=md5-1" {
+		t.Fatal("unexpected filepath " + response[0].Filepath)
+	}
+	month := ToUnixTime(map[string]interface{}{DATEFLICKRTAG: "2016:07:14 10:00:00"}, "month")
+	if response, _ := db.GetPhotosFromTime(month, "month", nil); len(response) != 1 {
+		t.Fatal("expected size response 1 and received " + strconv.Itoa(len(response)))
+	}
+	stats, _ := db.GetOriginStats()
+	if stats.Stats["mymachineid"] != 2 {
+		t.Fatalf("expected 2 photos for mymachineid and received %d", stats.Stats["mymachineid"])
+	}
+}
+
+func TestSqliteAlbums(t *testing.T) {
+	db := newTestSqliteDatabase(t)
+	name := `Noël "chez" mamie`
+	if err := db.InsertNewAlbum(&album.AlbumMessage{AlbumName: name, Md5sums: []string{"md5-1"}, Tags: []string{"family"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.InsertNewAlbum(&album.AlbumMessage{AlbumName: name, Md5sums: []string{"md5-2"}, Tags: []string{"family"}}); err != nil {
+		t.Fatal(err)
+	}
+	content := db.GetAlbumData(name)
+	if len(content.Records) != 2 || len(content.Tags) != 1 {
+		t.Fatalf("expected 2 records and 1 tag and received %d records and %d tags", len(content.Records), len(content.Tags))
+	}
+	if response, _ := db.QueryByTag(" FAMILY "); len(response) != 2 {
+		t.Fatal("expected size response 2 and received " + strconv.Itoa(len(response)))
+	}
+	if err := db.DeletePhotoAlbum(&album.AlbumMessage{AlbumName: name, Md5sums: []string{"md5-1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if content := db.GetAlbumData(name); len(content.Records) != 1 {
+		t.Fatal("expected size response 1 and received " + strconv.Itoa(len(content.Records)))
+	}
+	if err := db.DeleteAlbum(&album.AlbumMessage{AlbumName: name}); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := db.AlbumExists(name); exists {
+		t.Fatal("album must be deleted")
+	}
+	if err := db.UpdateAlbum(&album.AlbumMessage{AlbumName: name}); err == nil {
+		t.Fatal("update of an unknown album must fail")
+	}
+}
+
+func TestSqliteMoveAndDeletePhoto(t *testing.T) {
+	db := newTestSqliteDatabase(t)
+	// move from another machine must be ignored
+	db.MovePhoto("othermachine", &modele.PhotoMove{Md5Sum: "md5-1", Filename: "other.jpg", Filepath: "/other/other.jpg"})
+	if err := db.MovePhoto("mymachineid", &modele.PhotoMove{Md5Sum: "md5-1", Filename: "IMG_0001.jpeg", Filepath: "/photos/moved/IMG_0001.jpeg", PreviousFilepath: "/photos/2016/IMG_0001.JPG"}); err != nil {
+		t.Fatal(err)
+	}
+	records, _ := db.QueryFilename("IMG_0001.jpeg")
+	if len(records) != 1 || records[0].Md5sum != "md5-1" || records[0].Type != ".jpeg" {
+		t.Fatalf("photo must be moved, received %v", records)
+	}
+	// deletion with another filepath must be ignored
+	db.DeletePhoto("mymachineid", &modele.PhotoInformations{Md5Sum: "md5-2", Filepath: "/photos/DSC_0002.NEF"})
+	if exists, _ := db.PictureExists("md5-2"); !exists {
+		t.Fatal("photo with another filepath must not be deleted")
+	}
+	if err := db.DeletePhoto("mymachineid", &modele.PhotoInformations{Md5Sum: "md5-2", Filepath: "/photos/l'été/DSC_0002.NEF"}); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := db.PictureExists("md5-2"); exists {
+		t.Fatal("photo must be deleted")
+	}
+}
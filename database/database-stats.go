@@ -0,0 +1,143 @@
+package database
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jeromelesaux/photo/album"
+)
+
+// groupby of the time stats kept up to date in the database
+const (
+	STATS_DAY   = "day"
+	STATS_WEEK  = "week"
+	STATS_MONTH = "month"
+	STATS_YEAR  = "year"
+)
+
+var statsGroupbys = []string{STATS_DAY, STATS_WEEK, STATS_MONTH, STATS_YEAR}
+
+// lock of the stats counters of the tiedot collection : a counter is read then written (read-modify-write),
+// the concurrent writes of the photos (which only share the read side of writesLock) must not lose an update.
+// the rebuild of the counters holds it too
+var statsLock sync.Mutex
+
+// grid cell of the location stats (coordinates rounded to 2 decimals)
+type statsCell [2]float64
+
+// counters of the photos by date (for each groupby) and by location grid cell,
+// the database stores them to serve the stats without reading all the photos
+type statsCounters struct {
+	times     map[string]map[string]int
+	locations map[statsCell]int
+}
+
+func newStatsCounters() *statsCounters {
+	s := &statsCounters{times: make(map[string]map[string]int), locations: make(map[statsCell]int)}
+	for _, groupby := range statsGroupbys {
+		s.times[groupby] = make(map[string]int)
+	}
+	return s
+}
+
+// function returns the date of the photo for each groupby of the stats, empty if the photo has no date
+func statsDates(exif map[string]interface{}, modtime int64) map[string]string {
+	dates := make(map[string]string)
+	date, ok := PhotoDate(exif, modtime)
+	if !ok {
+		return dates
+	}
+	for _, groupby := range statsGroupbys {
+		dates[groupby] = GroupDate(date, groupby)
+	}
+	return dates
+}
+
+// function returns the grid cell of the photo, false if the photo is not located
+func statsLocation(exif map[string]interface{}) (statsCell, bool) {
+	latitude, longitude := CoordinatesFromExif(exif)
+	if longitude == 0. || latitude == 0. {
+		return statsCell{}, false
+	}
+	return statsCell{Round(latitude, .5, 2), Round(longitude, .5, 2)}, true
+}
+
+// function adds delta (1 for an inserted photo, -1 for a deleted photo) to the counters of the photo exif,
+// the photos without date or without location are not counted in these stats
+func (s *statsCounters) add(exif map[string]interface{}, modtime int64, delta int) {
+	for groupby, date := range statsDates(exif, modtime) {
+		s.times[groupby][date] += delta
+	}
+	if cell, ok := statsLocation(exif); ok {
+		s.locations[cell] += delta
+	}
+}
+
+// function returns the time stats of the groupby sorted by date
+func (s *statsCounters) timeStats(groupby string) *album.TimeStatsMessage {
+	response := album.NewTimeStatsMessage()
+	for date, count := range s.times[groupby] {
+		if count > 0 {
+			response.Stats = append(response.Stats, &album.TimeStatMessage{Date: date, Count: count})
+		}
+	}
+	sortTimeStats(response)
+	return response
+}
+
+// function returns the location stats sorted by coordinates
+func (s *statsCounters) locationStats() *album.LocationStatsMessage {
+	response := album.NewLocationStatsMessage()
+	for cell, count := range s.locations {
+		if count > 0 {
+			response.Stats = append(response.Stats, &album.LocationMessage{Latitude: cell[0], Longitude: cell[1], Count: count})
+		}
+	}
+	sortLocationStats(response)
+	return response
+}
+
+// function returns the time stats of the groupby counting only the days (stats by day) in the range
+func rangeTimeStats(days *album.TimeStatsMessage, groupby string, dates *DateRange) *album.TimeStatsMessage {
+	counts := make(map[string]int)
+	for _, day := range days.Stats {
+		if !dates.Contains(day.Date) {
+			continue
+		}
+		if date, err := time.Parse(DATE_FORMAT, day.Date); err == nil {
+			counts[GroupDate(date, groupby)] += day.Count
+		}
+	}
+	response := album.NewTimeStatsMessage()
+	for date, count := range counts {
+		response.Stats = append(response.Stats, &album.TimeStatMessage{Date: date, Count: count})
+	}
+	sortTimeStats(response)
+	return response
+}
+
+func sortTimeStats(stats *album.TimeStatsMessage) {
+	sort.Slice(stats.Stats, func(i, j int) bool { return stats.Stats[i].Date < stats.Stats[j].Date })
+}
+
+func sortLocationStats(stats *album.LocationStatsMessage) {
+	sort.Slice(stats.Stats, func(i, j int) bool {
+		if stats.Stats[i].Latitude != stats.Stats[j].Latitude {
+			return stats.Stats[i].Latitude < stats.Stats[j].Latitude
+		}
+		return stats.Stats[i].Longitude < stats.Stats[j].Longitude
+	})
+}
+
+// function returns the exif tags of a scanned photo as they are read from the database
+func exifTags(tags map[string]string) map[string]interface{} {
+	if tags == nil {
+		return nil
+	}
+	exif := make(map[string]interface{}, len(tags))
+	for tag, value := range tags {
+		exif[tag] = value
+	}
+	return exif
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/jeromelesaux/photo/modele"
+)
+
+func TestStats(t *testing.T) {
+	databases := testDatabases(t)
+
+	for name, d := range databases {
+		t.Run(name, func(t *testing.T) {
+			testStats(t, d)
+		})
+	}
+
+	// the counters of a library stored before the stats are computed once
+	sqlite := databases["sqlite"].(*SqliteDatabaseHandler)
+	sqlite.DBConnection.Exec("DELETE FROM time_stats")
+	if err := sqlite.migrateStats(); err != nil {
+		t.Fatal(err)
+	}
+	if stats, _ := sqlite.GetTimeStats(STATS_YEAR, nil); len(stats.Stats) != 1 || stats.Stats[0].Count != 2 {
+		t.Fatalf("stats must be computed again, received %v", stats.Stats)
+	}
+}
+
+func testStats(t *testing.T, d DatabaseInterface) {
+	paris := map[string]string{DATEFLICKRTAG: "2016:07:14 10:00:00",
+		LATITUDEFLICKRTAG: "48 deg 51' 24.00", LATITUDEREFFLICKTAG: "North",
+		LONGITUDEFLICKRTAG: "2 deg 21' 07.00", LONGITUDEREFFLICKTAG: "East"}
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "a.jpg", Filepath: "/a.jpg", Tags: paris},
+		{Md5Sum: "md5-2", Filename: "b.jpg", Filepath: "/b.jpg", Tags: paris},
+		{Md5Sum: "md5-3", Filename: "c.jpg", Filepath: "/c.jpg", Tags: map[string]string{DATEFLICKRTAG: "2016:07:15 10:00:00"}},
+	}))
+	// a copy on another machine is not counted twice
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "othermachine", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "a.jpg", Filepath: "/other/a.jpg", Tags: paris}}))
+
+	days, _ := d.GetTimeStats(STATS_DAY, nil)
+	if len(days.Stats) != 2 || days.Stats[0].Date != "2016-07-14" || days.Stats[0].Count != 2 || days.Stats[1].Count != 1 {
+		t.Fatalf("expected 2 photos the 2016-07-14 and 1 the next day, received %v %v", days.Stats[0], days.Stats)
+	}
+	years, _ := d.GetTimeStats(STATS_YEAR, nil)
+	if len(years.Stats) != 1 || years.Stats[0].Count != 3 {
+		t.Fatalf("expected 3 photos for the year, received %v", years.Stats)
+	}
+	locations, _ := d.GetLocationStats()
+	if len(locations.Stats) != 1 || locations.Stats[0].Count != 2 || locations.Stats[0].Latitude != 48.86 {
+		t.Fatalf("expected 2 photos in the cell of Paris, received %v", locations.Stats)
+	}
+
+	d.DeletePhoto("mymachineid", &modele.PhotoInformations{Md5Sum: "md5-3", Filepath: "/c.jpg"})
+	if days, _ := d.GetTimeStats(STATS_DAY, nil); len(days.Stats) != 1 {
+		t.Fatalf("the day of the deleted photo must be removed, received %v", days.Stats)
+	}
+	d.DeletePhoto("mymachineid", &modele.PhotoInformations{Md5Sum: "md5-1", Filepath: "/a.jpg"})
+	if locations, _ := d.GetLocationStats(); locations.Stats[0].Count != 2 {
+		t.Fatalf("a photo with another copy must still be counted, received %v", locations.Stats)
+	}
+}
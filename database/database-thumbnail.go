@@ -0,0 +1,199 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jeromelesaux/photo/configurationapp"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+var (
+	ThumbnailNotFound     = errors.New("Thumbnail not found.")
+	NoThumbnailStore      = errors.New("No thumbnail store defined.")
+	InvalidThumbnailId    = errors.New("Invalid thumbnail identifier.")
+	thumbnailStoreDirName = "thumbnails"
+)
+
+// delay before an unreferenced thumbnail is removed, the thumbnail of an import not recorded yet is kept
+const THUMBNAIL_SWEEP_DELAY = time.Hour
+
+// thumbnails are stored once on the disk, the file name is the sha256 of the content
+// and the photo records only store this identifier
+type ThumbnailStore struct {
+	Path string
+}
+
+// thumbnail content and its identifier in the store
+type Thumbnail struct {
+	Id      string
+	Content []byte
+}
+
+// function returns the thumbnail store of the database path, the thumbnails_path of the
+// configuration or the thumbnails directory next to the database
+func NewThumbnailStore(databasePath string) *ThumbnailStore {
+	if conf := configurationapp.GetConfiguration(); conf != nil && conf.ThumbnailsPath != "" {
+		return &ThumbnailStore{Path: conf.ThumbnailsPath}
+	}
+	return &ThumbnailStore{Path: filepath.Join(filepath.Dir(filepath.Clean(databasePath)), thumbnailStoreDirName)}
+}
+
+// function returns the identifier of the content
+func ThumbnailId(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// function returns the uri of the thumbnail of the photo md5sum or an empty string without thumbnail
+func thumbnailUri(md5sum string, thumbnailId string) string {
+	if thumbnailId == "" {
+		return ""
+	}
+	return "/thumbnail/" + md5sum
+}
+
+// function returns the length of the base64 thumbnail of the record, used to filter the records by size
+func thumbnailLength(record *DatabasePhotoRecord) int {
+	if record.Image != "" {
+		return len(record.Image)
+	}
+	return base64.StdEncoding.EncodedLen(int(record.ThumbnailSize))
+}
+
+func (s *ThumbnailStore) path(id string) (string, error) {
+	if len(id) != sha256.Size*2 {
+		return "", InvalidThumbnailId
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", InvalidThumbnailId
+	}
+	return filepath.Join(s.Path, id[:2], id+".png"), nil
+}
+
+// function stores the content if it is not already stored and returns its identifier
+func (s *ThumbnailStore) Put(content []byte) (string, error) {
+	if s == nil {
+		return "", NoThumbnailStore
+	}
+	id := ThumbnailId(content)
+	path, _ := s.path(id)
+	if _, err := os.Stat(path); err == nil {
+		// the thumbnail used again is not removed by a sweep before its photo is recorded
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return id, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		logger.Errorf("Cannot create thumbnail directory %s with error %v", filepath.Dir(path), err)
+		return "", err
+	}
+	// the content is renamed once written to never expose a partial thumbnail
+	tmp, err := os.CreateTemp(filepath.Dir(path), id+".*.tmp")
+	if err != nil {
+		logger.Errorf("Cannot create thumbnail %s with error %v", id, err)
+		return "", err
+	}
+	if _, err = tmp.Write(content); err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		logger.Errorf("Cannot write thumbnail %s with error %v", id, err)
+		return "", err
+	}
+	return id, nil
+}
+
+// function stores the base64 thumbnail and returns its identifier and its size in bytes,
+// an empty thumbnail returns an empty identifier
+func (s *ThumbnailStore) PutBase64(thumbnail string) (string, int64, error) {
+	if thumbnail == "" {
+		return "", 0, nil
+	}
+	content, err := base64.StdEncoding.DecodeString(thumbnail)
+	if err != nil {
+		return "", 0, fmt.Errorf("Thumbnail is not a base64 content : %v", err)
+	}
+	id, err := s.Put(content)
+	if err != nil {
+		return "", 0, err
+	}
+	return id, int64(len(content)), nil
+}
+
+// function returns the content of the thumbnail identifier
+func (s *ThumbnailStore) Get(id string) (*Thumbnail, error) {
+	if s == nil {
+		return nil, NoThumbnailStore
+	}
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ThumbnailNotFound
+	}
+	if err != nil {
+		logger.Errorf("Cannot read thumbnail %s with error %v", id, err)
+		return nil, err
+	}
+	return &Thumbnail{Id: id, Content: content}, nil
+}
+
+// function returns the base64 content of the thumbnail identifier, an empty string if the thumbnail is not found
+func (s *ThumbnailStore) Base64(id string) string {
+	if id == "" {
+		return ""
+	}
+	thumbnail, err := s.Get(id)
+	if err != nil {
+		logger.Errorf("Cannot read thumbnail %s with error %v", id, err)
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(thumbnail.Content)
+}
+
+// function removes the thumbnails which are not referenced and the temporary files of an interrupted Put,
+// the files modified less than THUMBNAIL_SWEEP_DELAY before now are kept. it returns the number of removed files
+func (s *ThumbnailStore) Sweep(referenced map[string]bool, now time.Time) (int, error) {
+	if s == nil {
+		return 0, NoThumbnailStore
+	}
+	files, err := filepath.Glob(filepath.Join(s.Path, "*", "*"))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, file := range files {
+		name := filepath.Base(file)
+		orphan := strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, ".png") && !referenced[strings.TrimSuffix(name, ".png")]
+		if !orphan {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil || info.IsDir() || info.ModTime().After(now.Add(-THUMBNAIL_SWEEP_DELAY)) {
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			logger.Errorf("Cannot remove thumbnail %s with error %v", file, err)
+			return removed, err
+		}
+		removed++
+	}
+	logger.Infof("Removed %d thumbnails of %s no photo references", removed, s.Path)
+	return removed, nil
+}
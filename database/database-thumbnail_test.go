@@ -0,0 +1,181 @@
+package database
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jeromelesaux/photo/modele"
+)
+
+func TestThumbnailStore(t *testing.T) {
+	store := &ThumbnailStore{Path: t.TempDir()}
+	id, err := store.Put([]byte("png content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same, _ := store.Put([]byte("png content")); same != id {
+		t.Fatal("same content must return the same identifier")
+	}
+	thumbnail, err := store.Get(id)
+	if err != nil || string(thumbnail.Content) != "png content" {
+		t.Fatalf("expected the stored content and received %v", err)
+	}
+	if _, err := store.Get("../../etc/passwd"); err != InvalidThumbnailId {
+		t.Fatal("invalid identifier must be refused")
+	}
+	if _, err := store.Get(ThumbnailId([]byte("other"))); err != ThumbnailNotFound {
+		t.Fatal("unknown identifier must not be found")
+	}
+}
+
+func TestThumbnailSweep(t *testing.T) {
+	store := &ThumbnailStore{Path: t.TempDir()}
+	kept, _ := store.Put([]byte("kept png"))
+	orphan, _ := store.Put([]byte("orphan png"))
+	recent, _ := store.Put([]byte("recent png"))
+	tmp := filepath.Join(store.Path, orphan[:2], orphan+".123.tmp")
+	os.WriteFile(tmp, []byte("partial png"), 0644)
+	now := time.Now()
+	old := now.Add(-2 * THUMBNAIL_SWEEP_DELAY)
+	for _, id := range []string{kept, orphan} {
+		path, _ := store.path(id)
+		os.Chtimes(path, old, old)
+	}
+	os.Chtimes(tmp, old, old)
+
+	removed, err := store.Sweep(map[string]bool{kept: true}, now)
+	if err != nil || removed != 2 {
+		t.Fatalf("expected the orphan thumbnail and the temporary file removed, received %d %v", removed, err)
+	}
+	if _, err := store.Get(orphan); err != ThumbnailNotFound {
+		t.Fatalf("expected the orphan thumbnail removed, received %v", err)
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Fatal("expected the temporary file removed")
+	}
+	for _, id := range []string{kept, recent} {
+		if _, err := store.Get(id); err != nil {
+			t.Fatalf("expected the thumbnail %s kept, received %v", id, err)
+		}
+	}
+	// a thumbnail stored again is not removed before its photo is recorded
+	path, _ := store.path(kept)
+	os.Chtimes(path, old, old)
+	store.Put([]byte("kept png"))
+	if removed, _ := store.Sweep(map[string]bool{}, now.Add(time.Minute)); removed != 0 {
+		t.Fatalf("expected the thumbnail stored again kept, received %d removed", removed)
+	}
+}
+
+func TestCleanThumbnails(t *testing.T) {
+	for name, d := range testDatabases(t) {
+		var store *ThumbnailStore
+		switch backend := d.(type) {
+		case *DatabaseHandler:
+			store = backend.Thumbnails
+		case *SqliteDatabaseHandler:
+			store = backend.Thumbnails
+		default:
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			testCleanThumbnails(t, d, store)
+		})
+	}
+}
+
+func testCleanThumbnails(t *testing.T, d DatabaseInterface, store *ThumbnailStore) {
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "a.jpg", Filepath: "/a.jpg", Thumbnail: base64.StdEncoding.EncodeToString([]byte("png a"))},
+		{Md5Sum: "md5-2", Filename: "b.jpg", Filepath: "/b.jpg", Thumbnail: base64.StdEncoding.EncodeToString([]byte("png b"))}}))
+	if err := d.DeletePhoto("mymachineid", &modele.PhotoInformations{Md5Sum: "md5-2", Filepath: "/b.jpg"}); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * THUMBNAIL_SWEEP_DELAY)
+	files, _ := filepath.Glob(filepath.Join(store.Path, "*", "*.png"))
+	if len(files) != 2 {
+		t.Fatalf("expected the 2 thumbnails stored, found %v", files)
+	}
+	for _, file := range files {
+		os.Chtimes(file, old, old)
+	}
+
+	if err := d.CleanDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ThumbnailId([]byte("png b"))); err != ThumbnailNotFound {
+		t.Fatalf("expected the thumbnail of the deleted photo removed, received %v", err)
+	}
+	if thumbnail, err := d.GetThumbnail("md5-1"); err != nil || string(thumbnail.Content) != "png a" {
+		t.Fatalf("expected the thumbnail of the photo kept, received %v", err)
+	}
+}
+
+func TestSqliteThumbnails(t *testing.T) {
+	dir := t.TempDir()
+	d, err := newSqliteDatabaseHandler(filepath.Join(dir, "photo.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	thumbnail := base64.StdEncoding.EncodeToString([]byte("png content"))
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "a.jpg", Thumbnail: thumbnail},
+		{Md5Sum: "md5-2", Filename: "b.jpg", Thumbnail: thumbnail}}))
+	// legacy row with the thumbnail inside the table
+	d.DBConnection.Exec("INSERT INTO photos (md5sum, filename, thumbnail) VALUES ('md5-3', 'c.jpg', ?)",
+		base64.StdEncoding.EncodeToString([]byte("old png")))
+
+	records, _ := d.QueryAll()
+	for _, record := range records {
+		if record.Md5sum == "md5-1" && (record.Image != "" || record.ThumbnailUri != "/thumbnail/md5-1") {
+			t.Fatalf("record must only reference its thumbnail, received %v", record)
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "thumbnails", "*", "*.png"))
+	if len(files) != 1 {
+		t.Fatalf("same thumbnail must be stored once, found %v", files)
+	}
+
+	if err := d.migrateThumbnails(); err != nil {
+		t.Fatal(err)
+	}
+	var legacy string
+	d.DBConnection.QueryRow("SELECT thumbnail FROM photos WHERE md5sum = 'md5-3'").Scan(&legacy)
+	if legacy != "" {
+		t.Fatal("thumbnail must be moved out of the table")
+	}
+	migrated, err := d.GetThumbnail("md5-3")
+	if err != nil || string(migrated.Content) != "old png" {
+		t.Fatalf("migrated thumbnail not found with error %v", err)
+	}
+}
+
+func TestTiedotThumbnailsMigration(t *testing.T) {
+	dir := t.TempDir()
+	d := testTiedot(t, filepath.Join(dir, "db"))
+	d.DBConnection.Use(DBPHOTO_COLLECTION).Insert(map[string]interface{}{
+		MD5SUM_INDEX:    "md5-1",
+		MACHINEID_INDEX: "mymachineid",
+		FILENAME_INDEX:  "a.jpg",
+		FILEPATH_INDEX:  "/a.jpg",
+		THUMBNAIL_INDEX: base64.StdEncoding.EncodeToString([]byte("old png"))})
+
+	if err := d.migrateThumbnails(); err != nil {
+		t.Fatal(err)
+	}
+	records, _ := d.QueryAll()
+	if len(records) != 1 || records[0].Image != "" || records[0].ThumbnailUri != "/thumbnail/md5-1" {
+		t.Fatalf("record must only reference its thumbnail, received %v", records)
+	}
+	thumbnail, err := d.GetThumbnail("md5-1")
+	if err != nil || string(thumbnail.Content) != "old png" {
+		t.Fatalf("migrated thumbnail not found with error %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "thumbnails")); err != nil {
+		t.Fatal("thumbnails must be stored next to the database")
+	}
+}
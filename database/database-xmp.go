@@ -0,0 +1,149 @@
+package database
+
+import (
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/jeromelesaux/photo/modele"
+)
+
+const (
+	// tags of the xmp stored with the exif tags of the photos, prefixed by their namespace
+	XMP_RATING_TAG               = "xmp:Rating"
+	XMP_LABEL_TAG                = "xmp:Label"
+	XMP_SUBJECT_TAG              = "dc:subject"
+	XMP_HIERARCHICAL_SUBJECT_TAG = "lr:hierarchicalSubject"
+	XMP_DESCRIPTION_TAG          = "dc:description"
+	XMP_TITLE_TAG                = "dc:title"
+	// path of the sidecar the xmp tags were read from
+	XMP_SIDECAR_TAG = "xmp:Sidecar"
+	// separator of the levels of the lightroom keywords
+	XMP_HIERARCHY_SEPARATOR = "|"
+)
+
+// tags of the xmp cleared with the sidecar they were read from
+var xmpTags = []string{XMP_RATING_TAG, XMP_LABEL_TAG, XMP_SUBJECT_TAG, XMP_HIERARCHICAL_SUBJECT_TAG, XMP_DESCRIPTION_TAG, XMP_TITLE_TAG, XMP_SIDECAR_TAG}
+
+// function returns the tags of the photo completed by its xmp, the rating and the label seed the curation,
+// the coordinates and the date of the xmp locate and date the photo if its exif has none
+func photoTags(item *modele.PhotoInformations) map[string]string {
+	if item.Xmp == nil {
+		return item.Tags
+	}
+	tags := make(map[string]string, len(item.Tags)+6)
+	for tag, value := range item.Tags {
+		tags[tag] = value
+	}
+	xmp := item.Xmp
+	if xmp.Rating != 0 {
+		tags[XMP_RATING_TAG] = strconv.Itoa(xmp.Rating)
+	}
+	values := map[string]string{
+		XMP_LABEL_TAG:                xmp.Label,
+		XMP_SUBJECT_TAG:              strings.Join(xmp.Keywords, ", "),
+		XMP_HIERARCHICAL_SUBJECT_TAG: strings.Join(xmp.HierarchicalKeywords, ", "),
+		XMP_DESCRIPTION_TAG:          xmp.Description,
+		XMP_TITLE_TAG:                xmp.Title,
+		XMP_SIDECAR_TAG:              xmp.Sidecar,
+	}
+	for tag, value := range values {
+		if value != "" {
+			tags[tag] = value
+		}
+	}
+	// the coordinates and the date of a sidecar are corrections of the photo (see /writemetadata)
+	if xmp.Latitude != 0 || xmp.Longitude != 0 {
+		if latitude, longitude := ExifCoordinates(exifTags(item.Tags)); xmp.Sidecar != "" || latitude == 0 && longitude == 0 {
+			tags[LATITUDEGOOGLETAG] = strconv.FormatFloat(xmp.Latitude, 'f', -1, 64)
+			tags[LONGITUDEGOOGLETAG] = strconv.FormatFloat(xmp.Longitude, 'f', -1, 64)
+		}
+	}
+	if dateTags, ok := xmpDateTags(xmp.Date); ok && (xmp.Sidecar != "" || exifValue(exifTags(item.Tags), exifDates[0].date) == "") {
+		for _, tag := range originalDateTags {
+			delete(tags, tag)
+		}
+		for tag, value := range dateTags {
+			tags[tag] = value
+		}
+	}
+	return tags
+}
+
+// function returns true if the sidecar is a sidecar of the photo (photo.xmp or photo.ext.xmp)
+func sidecarOf(sidecar string, photo string) bool {
+	name := strings.TrimSuffix(sidecar, filepath.Ext(sidecar))
+	return name == photo || name == strings.TrimSuffix(photo, filepath.Ext(photo))
+}
+
+// function returns the stored tags of the photo completed by the xmp of a copy scanned again (new copy, full scan
+// or sidecar modified) like its keywords, the values of the xmp replace the stored ones. the tags of the previous
+// sidecar are cleared when the copy has a sidecar or when the copy lost the sidecar they were read from.
+// false is returned if the copy has no xmp and no removed sidecar or if the tags are unchanged
+func rescanTags(stored map[string]interface{}, item *modele.PhotoInformations) (map[string]interface{}, bool) {
+	previous, _ := stored[XMP_SIDECAR_TAG].(string)
+	removed := previous != "" && sidecarOf(previous, item.Filepath) && (item.Xmp == nil || item.Xmp.Sidecar == "")
+	if item.Xmp == nil && !removed {
+		return stored, false
+	}
+	scanned := photoTags(item)
+	tags := make(map[string]interface{}, len(stored)+len(scanned))
+	for tag, value := range stored {
+		tags[tag] = value
+	}
+	if removed || item.Xmp.Sidecar != "" {
+		for _, tag := range xmpTags {
+			delete(tags, tag)
+		}
+		// the coordinates and the date of the previous sidecar, the scanned exif sets them again
+		if previous != "" {
+			for _, tag := range append([]string{LATITUDEGOOGLETAG, LONGITUDEGOOGLETAG}, originalDateTags...) {
+				delete(tags, tag)
+			}
+		}
+	}
+	// the exif tags replaced by the xmp (the date of a sidecar)
+	for tag := range item.Tags {
+		if _, ok := scanned[tag]; !ok {
+			delete(tags, tag)
+		}
+	}
+	for tag, value := range scanned {
+		tags[tag] = value
+	}
+	return tags, !reflect.DeepEqual(tags, stored)
+}
+
+// function returns the curation of the photo with the rating and the label of its tags if they changed
+// since the previous scan, the curation made in photo is kept otherwise
+func rescanCuration(c photoCuration, stored map[string]interface{}, tags map[string]interface{}) photoCuration {
+	previous, scanned := exifCuration(stored), exifCuration(tags)
+	if scanned.rating != previous.rating {
+		c.rating = scanned.rating
+	}
+	if scanned.colorLabel != previous.colorLabel {
+		c.colorLabel = scanned.colorLabel
+	}
+	return c
+}
+
+// function returns the keywords of the xmp : its subjects and each level of its hierarchical subjects,
+// trimmed and lower cased, the keywords longer than KEYWORD_MAX_LENGTH are ignored
+func xmpKeywords(xmp *modele.XmpInformations) []string {
+	keywords := make([]string, 0)
+	if xmp == nil {
+		return keywords
+	}
+	values := append([]string{}, xmp.Keywords...)
+	for _, hierarchy := range xmp.HierarchicalKeywords {
+		values = append(values, strings.Split(hierarchy, XMP_HIERARCHY_SEPARATOR)...)
+	}
+	for _, keyword := range values {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if keyword != "" && len(keyword) <= KEYWORD_MAX_LENGTH {
+			keywords = mergeKeywords(keywords, []string{keyword})
+		}
+	}
+	return keywords
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/modele"
+)
+
+func TestXmpKeywords(t *testing.T) {
+	keywords := xmpKeywords(&modele.XmpInformations{
+		Keywords:             []string{"Paris", " Beach ", ""},
+		HierarchicalKeywords: []string{"Places|France|Paris"},
+	})
+	if !reflect.DeepEqual(keywords, []string{"beach", "france", "paris", "places"}) {
+		t.Fatalf("expected [beach france paris places] and received %v", keywords)
+	}
+	if keywords := xmpKeywords(nil); len(keywords) != 0 {
+		t.Fatalf("expected no keyword without xmp, received %v", keywords)
+	}
+}
+
+func TestXmp(t *testing.T) {
+	for name, d := range testDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			testXmp(t, d)
+		})
+	}
+}
+
+func testXmp(t *testing.T, d DatabaseInterface) {
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "a.cr2", Filepath: "/a.cr2", Xmp: &modele.XmpInformations{
+			Rating:               4,
+			Label:                "Red",
+			Keywords:             []string{"Beach", "Grandma"},
+			HierarchicalKeywords: []string{"Places|France"},
+			Description:          "Grandma at the beach",
+			Latitude:             48.8566,
+			Longitude:            2.3522,
+		}},
+		{Md5Sum: "md5-2", Filename: "b.jpg", Filepath: "/b.jpg",
+			Tags: map[string]string{LATITUDEGOOGLETAG: "38.9", LONGITUDEGOOGLETAG: "-0.37"},
+			Xmp:  &modele.XmpInformations{Latitude: 48.8566, Longitude: 2.3522}},
+	}))
+
+	if keywords, _ := d.GetPhotoKeywords("md5-1"); !reflect.DeepEqual(keywords, []string{"beach", "france", "grandma", "places"}) {
+		t.Fatalf("expected the keywords of the xmp and received %v", keywords)
+	}
+	if records, _ := d.Search(&SearchRequest{Field: SEARCH_RATING, Value: "4"}); len(records) != 1 || records[0].ColorLabel != "red" {
+		t.Fatalf("expected the photo rated 4 stars with the red label, received %v", records)
+	}
+	if records, _ := d.Search(&SearchRequest{Field: SEARCH_EXIF, Tag: "description", Value: "grandma"}); len(records) != 1 {
+		t.Fatalf("expected the photo of the description, received %d photos", len(records))
+	}
+	records, _ := d.QueryAll()
+	for _, record := range records {
+		latitude, _ := ExifCoordinates(record.ExifTags)
+		switch {
+		case record.Md5sum == "md5-1" && latitude != 48.8566:
+			t.Fatalf("expected the photo located by its xmp, received %f", latitude)
+		case record.Md5sum == "md5-2" && latitude != 38.9:
+			t.Fatalf("expected the coordinates of the exif kept, received %f", latitude)
+		}
+	}
+
+	// keywords added in the sidecar of another copy
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "othermachine", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "a.cr2", Filepath: "/copy/a.cr2", Xmp: &modele.XmpInformations{Keywords: []string{"Holidays"}}},
+	}))
+	if keywords, _ := d.GetPhotoKeywords("md5-1"); !reflect.DeepEqual(keywords, []string{"beach", "france", "grandma", "holidays", "places"}) {
+		t.Fatalf("expected the keywords of the copy merged and received %v", keywords)
+	}
+	if records, _ := d.Search(&SearchRequest{Field: SEARCH_RATING, Value: "4"}); len(records) != 1 {
+		t.Fatalf("expected the rating kept by a copy without rating, received %v", records)
+	}
+
+	// sidecar modified since the previous scan, the favourite set in photo is kept
+	favourite := true
+	if err := d.UpdateCuration(&album.CurationMessage{Md5sums: []string{"md5-1"}, Favourite: &favourite}); err != nil {
+		t.Fatal(err)
+	}
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "a.cr2", Filepath: "/a.cr2", Xmp: &modele.XmpInformations{
+			Rating: 2, Label: "Red", Description: "Grandma in Nice", Latitude: 43.7102, Longitude: 7.262, Sidecar: "/a.cr2.xmp"}},
+	}))
+	records, _ = d.Search(&SearchRequest{Field: SEARCH_RATING, Value: "2"})
+	if len(records) != 1 || records[0].Rating != 2 || !records[0].Favourite || records[0].ColorLabel != "red" {
+		t.Fatalf("expected the rating of the sidecar and the favourite kept, received %v", records)
+	}
+	if records, _ := d.Search(&SearchRequest{Field: SEARCH_EXIF, Tag: "description", Value: "nice"}); len(records) != 1 {
+		t.Fatalf("expected the description of the sidecar, received %d photos", len(records))
+	}
+	records, _ = d.QueryAll()
+	for _, record := range records {
+		if latitude, _ := ExifCoordinates(record.ExifTags); record.Md5sum == "md5-1" && latitude != 43.7102 {
+			t.Fatalf("expected the coordinates of the sidecar, received %f", latitude)
+		}
+	}
+	// a copy without sidecar keeps the tags of the sidecar of another copy
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "othermachine", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "a.cr2", Filepath: "/copy/a.cr2"},
+	}))
+	if records, _ := d.Search(&SearchRequest{Field: SEARCH_RATING, Value: "2"}); len(records) != 1 {
+		t.Fatalf("expected the rating of the sidecar kept by another copy, received %v", records)
+	}
+
+	// sidecar removed since the previous scan, its tags are cleared
+	d.InsertNewData(modele.NewPhotoResponse("", modele.VERSION, "mymachineid", []*modele.PhotoInformations{
+		{Md5Sum: "md5-1", Filename: "a.cr2", Filepath: "/a.cr2"},
+	}))
+	if records, _ := d.Search(&SearchRequest{Field: SEARCH_RATING, Value: "2"}); len(records) != 0 {
+		t.Fatalf("expected the rating of the removed sidecar cleared, received %v", records)
+	}
+	if records, _ := d.Search(&SearchRequest{Field: SEARCH_EXIF, Tag: "description", Value: "nice"}); len(records) != 0 {
+		t.Fatalf("expected the description of the removed sidecar cleared, received %d photos", len(records))
+	}
+	records, _ = d.QueryAll()
+	for _, record := range records {
+		if record.Md5sum != "md5-1" {
+			continue
+		}
+		if latitude, _ := ExifCoordinates(record.ExifTags); latitude != 0 || record.Rating != 0 || !record.Favourite {
+			t.Fatalf("expected the coordinates and the rating of the removed sidecar cleared and the favourite kept, received %f %v", latitude, record)
+		}
+		for _, tag := range []string{XMP_LABEL_TAG, XMP_DESCRIPTION_TAG, XMP_SIDECAR_TAG} {
+			if _, ok := record.ExifTags[tag]; ok {
+				t.Fatalf("expected the tag %s of the removed sidecar cleared", tag)
+			}
+		}
+	}
+}
@@ -16,7 +16,6 @@ import (
 	"github.com/disintegration/imaging"
 	"github.com/jeromelesaux/photo/hash"
 	logger "github.com/sirupsen/logrus"
-	"github.com/xiam/exif"
 
 	"image/gif"
 	"image/jpeg"
@@ -30,49 +29,85 @@ import (
 // function returns all exifs values ot a local image
 // filepath is the file path of the image to treat.
 func GetPhotoInformations(filePath string) (*modele.PhotoInformations, error) {
-	abspath, err := filepath.Abs(filePath)
+	sum, err := hash.Md5Sum(filePath)
+	return photoInformations(filePath, sum, err)
+}
+
+// function returns all exifs values ot a local image whose md5sum is already computed
+func photoInformations(filePath string, sum string, err error) (*modele.PhotoInformations, error) {
+	abspath, _ := filepath.Abs(filePath)
 	filename := path.Base(filePath)
 	thumbnail, _ := GetBase64Thumbnail(filePath)
-	sum, err := hash.Md5Sum(filePath)
+	var size, modtime int64
+	if info, err := os.Stat(filePath); err == nil {
+		size = info.Size()
+		modtime = info.ModTime().Unix()
+	}
 	if err != nil {
 		return &modele.PhotoInformations{
 			Filename:  filename,
 			Filepath:  abspath,
 			Md5Sum:    sum,
 			Thumbnail: thumbnail,
+			Size:      size,
+			ModTime:   modtime,
 		}, err
 	}
 
-	data, err := exif.Read(filePath)
+	tags, err := photoTags(filePath)
+	return &modele.PhotoInformations{
+		Filename:  filename,
+		Filepath:  abspath,
+		Tags:      tags,
+		Md5Sum:    sum,
+		Thumbnail: thumbnail,
+		Size:      size,
+		ModTime:   modtime,
+		Xmp:       photoXmp(filePath),
+	}, err
+}
+
+// function returns the exif tags of the photo merged with its iptc tags (iptc: prefix),
+// an error is returned if the photo has neither
+func photoTags(filePath string) (map[string]string, error) {
+	var tags map[string]string
+	data, err := ReadExif(filePath)
 	if err != nil {
 		logger.Error(err.Error())
-		return &modele.PhotoInformations{
-			Filename:  filename,
-			Filepath:  abspath,
-			Md5Sum:    sum,
-			Thumbnail: thumbnail,
-		}, err
+	} else {
+		tags = data.Titles()
 	}
-
-	logger.Info("---------START----------")
-	if data != nil {
-		for key, val := range data.Tags {
-			logger.Info(key + " = " + val)
+	iptc, iptcErr := ReadIptc(filePath)
+	if iptcErr == nil {
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		for key, val := range iptc.Tags() {
+			tags[key] = val
 		}
+		err = nil
+	} else if iptcErr != IptcNotFound {
+		logger.Errorf("Error while reading iptc of %s with error %v", filePath, iptcErr)
+	}
+	if err != nil {
+		return nil, err
 	}
 
+	logger.Info("---------START----------")
+	for key, val := range tags {
+		logger.Info(key + " = " + val)
+	}
 	logger.Info("---------END----------")
-	if err != nil {
-		logger.Info(err.Error())
-		return &modele.PhotoInformations{}, err
+	return tags, nil
+}
+
+// function returns the xmp of the photo, nil if it has none
+func photoXmp(filePath string) *modele.XmpInformations {
+	xmp, err := GetXmpInformations(filePath)
+	if err != nil && err != XmpNotFound {
+		logger.Errorf("Error while reading xmp of %s with error %v", filePath, err)
 	}
-	return &modele.PhotoInformations{
-		Filename:  filename,
-		Filepath:  abspath,
-		Tags:      data.Tags,
-		Md5Sum:    sum,
-		Thumbnail: thumbnail,
-	}, err
+	return xmp
 }
 
 var Tags = make([]*modele.PhotoInformations, 0)
@@ -0,0 +1,623 @@
+package exifhandler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maximal number of entries of an ifd
+	MAX_IFD_ENTRIES = 1000
+	// maximal size of the value of a tag
+	MAX_TAG_SIZE = 4 << 20
+	// markers of the APP1 (exif, xmp) and APP13 (photoshop) segments of the jpeg
+	JPEG_APP1  = 0xe1
+	JPEG_APP13 = 0xed
+	// prefix of the exif APP1 segment of the jpeg
+	JPEG_EXIF_PREFIX = "Exif\x00\x00"
+)
+
+// types of the values of the tags
+const (
+	TYPE_BYTE      = 1
+	TYPE_ASCII     = 2
+	TYPE_SHORT     = 3
+	TYPE_LONG      = 4
+	TYPE_RATIONAL  = 5
+	TYPE_SBYTE     = 6
+	TYPE_UNDEFINED = 7
+	TYPE_SSHORT    = 8
+	TYPE_SLONG     = 9
+	TYPE_SRATIONAL = 10
+	TYPE_FLOAT     = 11
+	TYPE_DOUBLE    = 12
+	TYPE_IFD       = 13
+)
+
+// size in bytes of one value of each type
+var typeSizes = []int64{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8, 4}
+
+var (
+	ExifNotFound = errors.New("No exif data found.")
+	InvalidExif  = errors.New("Invalid exif data.")
+)
+
+// value of the rational and signed rational tags
+type Rational struct {
+	Numerator   int64
+	Denominator int64
+}
+
+// function returns the value of the rational, 0 if its denominator is 0
+func (r Rational) Float() float64 {
+	if r.Denominator == 0 {
+		return 0
+	}
+	return float64(r.Numerator) / float64(r.Denominator)
+}
+
+// tag of the exif data, Value is a string (ascii), []uint64 (byte, short, long), []int64 (signed byte, short, long),
+// []Rational, []float64 or []byte (undefined)
+type ExifTag struct {
+	Id    uint16
+	Ifd   string
+	Name  string
+	Title string
+	Type  uint16
+	Value interface{}
+}
+
+// exif data of a photo, the tags by name (DateTimeOriginal, GPSLatitude ...) and the camera model of the maker note
+type ExifData struct {
+	Tags       map[string]*ExifTag
+	MakerModel string
+}
+
+// entry of an ifd, offset is the position of the value of the entry
+type ifdEntry struct {
+	tag    uint16
+	typ    uint16
+	count  int64
+	offset int64
+}
+
+// reader of the tiff structure : the header and the ifds, the offsets are relative to the header
+type tiffReader struct {
+	r     io.ReaderAt
+	size  int64
+	order binary.ByteOrder
+}
+
+// function reads the exif data of the file : jpeg (APP1 segment), png (eXIf chunk) or tiff based raw files
+// (tiff, dng, cr2, nef, arw, orf, rw2)
+func ReadExif(filePath string) (*ExifData, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return DecodeExif(f, info.Size())
+}
+
+// function reads the exif data of the content of a photo of size bytes
+func DecodeExif(r io.ReaderAt, size int64) (*ExifData, error) {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, ExifNotFound
+	}
+	switch {
+	case header[0] == 0xff && header[1] == 0xd8:
+		content, err := jpegSegment(r, size, JPEG_APP1, JPEG_EXIF_PREFIX)
+		if err != nil {
+			return nil, err
+		}
+		return decodeTiff(bytes.NewReader(content), int64(len(content)))
+	case bytes.Equal(header, []byte("\x89PNG\r\n\x1a\n")):
+		content, err := pngChunk(r, size, "eXIf", "")
+		if err != nil {
+			return nil, err
+		}
+		return decodeTiff(bytes.NewReader(content), int64(len(content)))
+	case string(header[:2]) == "II" || string(header[:2]) == "MM":
+		return decodeTiff(r, size)
+	}
+	return nil, ExifNotFound
+}
+
+// function returns the content after the prefix of the first APPn segment of the jpeg starting with the prefix
+// (APP1 exif or xmp, APP13 photoshop)
+func jpegSegment(r io.ReaderAt, size int64, app byte, prefix string) ([]byte, error) {
+	offset := int64(2)
+	marker := make([]byte, 4)
+	for offset+4 <= size {
+		if _, err := r.ReadAt(marker, offset); err != nil {
+			return nil, ExifNotFound
+		}
+		if marker[0] != 0xff {
+			return nil, errors.Wrap(InvalidExif, "jpeg marker expected")
+		}
+		switch {
+		case marker[1] == 0xff:
+			// padding of the markers
+			offset++
+			continue
+		case marker[1] == 0xd8 || marker[1] == 0x01 || (marker[1] >= 0xd0 && marker[1] <= 0xd7):
+			offset += 2
+			continue
+		case marker[1] == 0xda || marker[1] == 0xd9:
+			// the exif segment is before the image data
+			return nil, ExifNotFound
+		}
+		length := int64(binary.BigEndian.Uint16(marker[2:]))
+		if length < 2 || offset+2+length > size {
+			return nil, errors.Wrap(InvalidExif, "jpeg segment out of the file")
+		}
+		if marker[1] == app && length > 8 {
+			content := make([]byte, length-2)
+			if _, err := r.ReadAt(content, offset+4); err != nil {
+				return nil, err
+			}
+			if bytes.HasPrefix(content, []byte(prefix)) {
+				return content[len(prefix):], nil
+			}
+		}
+		offset += 2 + length
+	}
+	return nil, ExifNotFound
+}
+
+// function returns the content after the prefix of the first chunk of the png with the name and the prefix
+// (eXIf chunk or iTXt chunk of the xmp)
+func pngChunk(r io.ReaderAt, size int64, name string, prefix string) ([]byte, error) {
+	offset := int64(8)
+	chunk := make([]byte, 8)
+	for offset+8 <= size {
+		if _, err := r.ReadAt(chunk, offset); err != nil {
+			return nil, ExifNotFound
+		}
+		length := int64(binary.BigEndian.Uint32(chunk[:4]))
+		if offset+12+length > size {
+			return nil, errors.Wrap(InvalidExif, "png chunk out of the file")
+		}
+		switch string(chunk[4:]) {
+		case name:
+			if length > MAX_TAG_SIZE {
+				return nil, errors.Wrap(InvalidExif, "png chunk too large")
+			}
+			content := make([]byte, length)
+			if _, err := r.ReadAt(content, offset+8); err != nil {
+				return nil, err
+			}
+			if bytes.HasPrefix(content, []byte(prefix)) {
+				return content[len(prefix):], nil
+			}
+		case "IEND":
+			return nil, ExifNotFound
+		}
+		offset += 12 + length
+	}
+	return nil, ExifNotFound
+}
+
+// function returns the reader of the tiff structure and the offset of its IFD0
+func newTiffReader(r io.ReaderAt, size int64) (*tiffReader, int64, error) {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, 0, ExifNotFound
+	}
+	t := &tiffReader{r: r, size: size}
+	switch string(header[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, 0, ExifNotFound
+	}
+	// 42 for tiff, dng, cr2, nef and arw, RO or SR for orf and 0x55 for rw2
+	switch t.order.Uint16(header[2:4]) {
+	case 42, 0x4f52, 0x5352, 0x55:
+	default:
+		return nil, 0, errors.Wrap(InvalidExif, "unknown tiff magic number")
+	}
+	return t, int64(t.order.Uint32(header[4:])), nil
+}
+
+// function reads the ifds of the tiff structure : IFD0, Exif, GPS, Interoperability and the canon maker note
+func decodeTiff(r io.ReaderAt, size int64) (*ExifData, error) {
+	t, ifd0, err := newTiffReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	data := &ExifData{Tags: make(map[string]*ExifTag)}
+	ifds := map[string]int64{IFD_0: ifd0}
+	var makerNote *ifdEntry
+	for _, ifd := range []string{IFD_0, IFD_EXIF, IFD_GPS, IFD_INTEROP} {
+		offset, ok := ifds[ifd]
+		if !ok {
+			continue
+		}
+		entries, err := t.entries(offset)
+		if err != nil {
+			if ifd == IFD_0 {
+				return nil, err
+			}
+			continue
+		}
+		for _, entry := range entries {
+			switch {
+			case ifd == IFD_0 && entry.tag == EXIF_IFD_POINTER:
+				ifds[IFD_EXIF] = t.pointer(entry)
+			case ifd == IFD_0 && entry.tag == GPS_IFD_POINTER:
+				ifds[IFD_GPS] = t.pointer(entry)
+			case ifd == IFD_EXIF && entry.tag == INTEROP_IFD_POINTER:
+				ifds[IFD_INTEROP] = t.pointer(entry)
+			default:
+				definition, ok := tagDefinitions[ifd][entry.tag]
+				if !ok {
+					continue
+				}
+				value, err := t.value(entry)
+				if err != nil {
+					continue
+				}
+				if ifd == IFD_EXIF && entry.tag == MAKER_NOTE_TAG {
+					e := entry
+					makerNote = &e
+				}
+				data.Tags[definition.name] = &ExifTag{Id: entry.tag, Ifd: ifd, Name: definition.name, Title: definition.title, Type: entry.typ, Value: value}
+			}
+		}
+	}
+	if makerNote != nil && strings.HasPrefix(strings.ToLower(data.String("Make")), "canon") {
+		data.MakerModel = t.canonModel(makerNote.offset)
+	}
+	return data, nil
+}
+
+// function returns the entries of the ifd at the offset
+func (t *tiffReader) entries(offset int64) ([]ifdEntry, error) {
+	if offset < 8 || offset+2 > t.size {
+		return nil, errors.Wrap(InvalidExif, "ifd out of the tiff structure")
+	}
+	b := make([]byte, 2)
+	if _, err := t.r.ReadAt(b, offset); err != nil {
+		return nil, err
+	}
+	count := int64(t.order.Uint16(b))
+	if count > MAX_IFD_ENTRIES || offset+2+count*12 > t.size {
+		return nil, errors.Wrap(InvalidExif, "ifd too large")
+	}
+	b = make([]byte, count*12)
+	if _, err := t.r.ReadAt(b, offset+2); err != nil {
+		return nil, err
+	}
+	entries := make([]ifdEntry, 0, count)
+	for i := int64(0); i < count; i++ {
+		e := b[i*12 : i*12+12]
+		entry := ifdEntry{tag: t.order.Uint16(e[0:2]), typ: t.order.Uint16(e[2:4]), count: int64(t.order.Uint32(e[4:8]))}
+		if entry.typ == 0 || int(entry.typ) >= len(typeSizes) {
+			continue
+		}
+		// the values of 4 bytes or less are in the entry
+		if entry.count*typeSizes[entry.typ] <= 4 {
+			entry.offset = offset + 2 + i*12 + 8
+		} else {
+			entry.offset = int64(t.order.Uint32(e[8:12]))
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// function returns the offset of the ifd of the pointer entry
+func (t *tiffReader) pointer(entry ifdEntry) int64 {
+	b := make([]byte, 4)
+	if _, err := t.r.ReadAt(b, entry.offset); err != nil {
+		return 0
+	}
+	return int64(t.order.Uint32(b))
+}
+
+// function returns the bytes of the value of the entry
+func (t *tiffReader) raw(entry ifdEntry) ([]byte, error) {
+	size := entry.count * typeSizes[entry.typ]
+	if size > MAX_TAG_SIZE || entry.offset+size > t.size {
+		return nil, errors.Wrap(InvalidExif, "tag value out of the tiff structure")
+	}
+	b := make([]byte, size)
+	if _, err := t.r.ReadAt(b, entry.offset); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// function returns the typed value of the entry
+func (t *tiffReader) value(entry ifdEntry) (interface{}, error) {
+	b, err := t.raw(entry)
+	if err != nil {
+		return nil, err
+	}
+	switch entry.typ {
+	case TYPE_ASCII:
+		return strings.TrimSpace(strings.TrimRight(string(b), "\x00")), nil
+	case TYPE_BYTE:
+		values := make([]uint64, len(b))
+		for i, v := range b {
+			values[i] = uint64(v)
+		}
+		return values, nil
+	case TYPE_SHORT:
+		values := make([]uint64, entry.count)
+		for i := range values {
+			values[i] = uint64(t.order.Uint16(b[i*2:]))
+		}
+		return values, nil
+	case TYPE_LONG, TYPE_IFD:
+		values := make([]uint64, entry.count)
+		for i := range values {
+			values[i] = uint64(t.order.Uint32(b[i*4:]))
+		}
+		return values, nil
+	case TYPE_SBYTE:
+		values := make([]int64, len(b))
+		for i, v := range b {
+			values[i] = int64(int8(v))
+		}
+		return values, nil
+	case TYPE_SSHORT:
+		values := make([]int64, entry.count)
+		for i := range values {
+			values[i] = int64(int16(t.order.Uint16(b[i*2:])))
+		}
+		return values, nil
+	case TYPE_SLONG:
+		values := make([]int64, entry.count)
+		for i := range values {
+			values[i] = int64(int32(t.order.Uint32(b[i*4:])))
+		}
+		return values, nil
+	case TYPE_RATIONAL:
+		values := make([]Rational, entry.count)
+		for i := range values {
+			values[i] = Rational{Numerator: int64(t.order.Uint32(b[i*8:])), Denominator: int64(t.order.Uint32(b[i*8+4:]))}
+		}
+		return values, nil
+	case TYPE_SRATIONAL:
+		values := make([]Rational, entry.count)
+		for i := range values {
+			values[i] = Rational{Numerator: int64(int32(t.order.Uint32(b[i*8:]))), Denominator: int64(int32(t.order.Uint32(b[i*8+4:])))}
+		}
+		return values, nil
+	case TYPE_FLOAT:
+		values := make([]float64, entry.count)
+		for i := range values {
+			values[i] = float64(math.Float32frombits(t.order.Uint32(b[i*4:])))
+		}
+		return values, nil
+	case TYPE_DOUBLE:
+		values := make([]float64, entry.count)
+		for i := range values {
+			values[i] = math.Float64frombits(t.order.Uint64(b[i*8:]))
+		}
+		return values, nil
+	}
+	return b, nil
+}
+
+// function returns the camera model of the canon maker note, an ifd at the offset of the maker note
+func (t *tiffReader) canonModel(offset int64) string {
+	entries, err := t.entries(offset)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		if entry.tag == CANON_IMAGE_TYPE_TAG && entry.typ == TYPE_ASCII {
+			if value, err := t.value(entry); err == nil {
+				return value.(string)
+			}
+		}
+	}
+	return ""
+}
+
+// function returns the tag of the name, nil if the photo has not this tag
+func (d *ExifData) Tag(name string) *ExifTag {
+	if d == nil {
+		return nil
+	}
+	return d.Tags[name]
+}
+
+// function returns the value of the tag of the name as text, empty if the photo has not this tag
+func (d *ExifData) String(name string) string {
+	if tag := d.Tag(name); tag != nil {
+		return tag.String()
+	}
+	return ""
+}
+
+// function returns the rationals of the tag of the name
+func (d *ExifData) Rationals(name string) []Rational {
+	if tag := d.Tag(name); tag != nil {
+		if values, ok := tag.Value.([]Rational); ok {
+			return values
+		}
+	}
+	return nil
+}
+
+// function returns the camera model, the model of the maker note if the photo has no Model tag
+func (d *ExifData) Model() string {
+	if model := d.String("Model"); model != "" {
+		return model
+	}
+	return d.MakerModel
+}
+
+// function returns the date the photo was taken (original, digitized or modification date) with its
+// sub-second and offset tags, a date without offset is in UTC
+func (d *ExifData) Time() (time.Time, bool) {
+	for _, names := range [][]string{
+		{"DateTimeOriginal", "SubSecTimeOriginal", "OffsetTimeOriginal"},
+		{"DateTimeDigitized", "SubSecTimeDigitized", "OffsetTimeDigitized"},
+		{"DateTime", "SubSecTime", "OffsetTime"},
+	} {
+		date, err := time.Parse("2006:01:02 15:04:05", d.String(names[0]))
+		if err != nil {
+			continue
+		}
+		if subsec := d.String(names[1]); subsec != "" {
+			if fraction, err := strconv.ParseFloat("0."+subsec, 64); err == nil {
+				date = date.Add(time.Duration(fraction * float64(time.Second)))
+			}
+		}
+		if offset, err := time.Parse("-07:00", d.String(names[2])); err == nil {
+			_, seconds := offset.Zone()
+			date = time.Date(date.Year(), date.Month(), date.Day(), date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), time.FixedZone(d.String(names[2]), seconds))
+		}
+		return date, true
+	}
+	return time.Time{}, false
+}
+
+// function returns the decimal degrees of the gps coordinates, south and west are negative
+func (d *ExifData) GPS() (latitude float64, longitude float64, ok bool) {
+	coordinate := func(name string, ref string, negative string) (float64, bool) {
+		values := d.Rationals(name)
+		if len(values) != 3 || values[0].Denominator == 0 {
+			return 0, false
+		}
+		value := values[0].Float() + values[1].Float()/60 + values[2].Float()/3600
+		if strings.EqualFold(d.String(ref), negative) {
+			value = -value
+		}
+		return value, true
+	}
+	latitude, okLatitude := coordinate("GPSLatitude", "GPSLatitudeRef", "S")
+	longitude, okLongitude := coordinate("GPSLongitude", "GPSLongitudeRef", "W")
+	return latitude, longitude, okLatitude && okLongitude
+}
+
+// function returns the values of the tags as text by libexif title, the keys of the exif tags of the photos
+func (d *ExifData) Titles() map[string]string {
+	titles := make(map[string]string)
+	if d == nil {
+		return titles
+	}
+	for _, tag := range d.Tags {
+		if value := tag.String(); value != "" {
+			titles[tag.Title] = value
+		}
+	}
+	if _, ok := titles["Model"]; !ok && d.MakerModel != "" {
+		titles["Model"] = d.MakerModel
+	}
+	return titles
+}
+
+// function returns the value of the tag as text, in the format of libexif for the tags read by the database
+// (dates, gps coordinates, orientation, exposure)
+func (t *ExifTag) String() string {
+	switch value := t.Value.(type) {
+	case string:
+		return value
+	case []uint64:
+		if t.Name == "Orientation" && len(value) == 1 && value[0] < uint64(len(orientations)) {
+			return orientations[value[0]]
+		}
+		values := make([]string, len(value))
+		for i, v := range value {
+			values[i] = strconv.FormatUint(v, 10)
+		}
+		return strings.Join(values, ", ")
+	case []int64:
+		values := make([]string, len(value))
+		for i, v := range value {
+			values[i] = strconv.FormatInt(v, 10)
+		}
+		return strings.Join(values, ", ")
+	case []float64:
+		values := make([]string, len(value))
+		for i, v := range value {
+			values[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return strings.Join(values, ", ")
+	case []Rational:
+		return formatRationals(t.Name, value)
+	case []byte:
+		switch t.Name {
+		case "ExifVersion", "FlashpixVersion", "InteroperabilityVersion":
+			return strings.TrimRight(string(value), "\x00")
+		case "UserComment":
+			// the comment starts with the 8 bytes of its character code
+			if len(value) > 8 {
+				return strings.TrimSpace(strings.TrimRight(string(value[8:]), "\x00"))
+			}
+			return ""
+		}
+		return fmt.Sprintf("%d bytes undefined data", len(value))
+	}
+	return ""
+}
+
+// function returns the text of the rationals of the tag
+func formatRationals(name string, values []Rational) string {
+	if len(values) == 0 {
+		return ""
+	}
+	switch name {
+	case "ExposureTime":
+		if v := values[0].Float(); v > 0 && v < 1 {
+			return fmt.Sprintf("1/%.0f sec.", 1/v)
+		}
+		return fmt.Sprintf("%.0f sec.", values[0].Float())
+	case "FNumber":
+		return fmt.Sprintf("f/%.1f", values[0].Float())
+	case "FocalLength":
+		return fmt.Sprintf("%.1f mm", values[0].Float())
+	case "GPSTimeStamp":
+		if len(values) == 3 {
+			return fmt.Sprintf("%02.0f:%02.0f:%05.2f", values[0].Float(), values[1].Float(), values[2].Float())
+		}
+	case "GPSLatitude", "GPSLongitude":
+		// degrees, minutes and seconds with the precision of their denominator, as libexif
+		parts := make([]string, len(values))
+		for i, v := range values {
+			if v.Denominator == 0 {
+				parts[i] = fmt.Sprintf("%d/%d", v.Numerator, v.Denominator)
+				continue
+			}
+			decimals := int(math.Log10(float64(v.Denominator)) - 0.08 + 1.0)
+			if decimals <= 0 {
+				parts[i] = fmt.Sprintf("%2d", v.Numerator/v.Denominator)
+				continue
+			}
+			fraction := (v.Numerator % v.Denominator) * int64(math.Pow10(decimals)) / v.Denominator
+			parts[i] = fmt.Sprintf("%2d.%0*d", v.Numerator/v.Denominator, decimals, fraction)
+		}
+		return strings.Join(parts, ", ")
+	}
+	parts := make([]string, len(values))
+	for i, v := range values {
+		if v.Denominator == 1 {
+			parts[i] = strconv.FormatInt(v.Numerator, 10)
+		} else {
+			parts[i] = strconv.FormatFloat(v.Float(), 'f', 2, 64)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,209 @@
+package exifhandler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// entry of the ifds of the test, the value is written after the ifd or at the offset at
+type testEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+	at    uint32
+}
+
+func ascii(tag uint16, value string) testEntry {
+	return testEntry{tag: tag, typ: TYPE_ASCII, count: uint32(len(value) + 1), data: append([]byte(value), 0)}
+}
+
+func short(order binary.ByteOrder, tag uint16, value uint16) testEntry {
+	b := make([]byte, 2)
+	order.PutUint16(b, value)
+	return testEntry{tag: tag, typ: TYPE_SHORT, count: 1, data: b}
+}
+
+func long(order binary.ByteOrder, tag uint16, value uint32) testEntry {
+	b := make([]byte, 4)
+	order.PutUint32(b, value)
+	return testEntry{tag: tag, typ: TYPE_LONG, count: 1, data: b}
+}
+
+func rationals(order binary.ByteOrder, tag uint16, values ...uint32) testEntry {
+	b := make([]byte, len(values)*4)
+	for i, v := range values {
+		order.PutUint32(b[i*4:], v)
+	}
+	return testEntry{tag: tag, typ: TYPE_RATIONAL, count: uint32(len(values) / 2), data: b}
+}
+
+func ifdSize(entries []testEntry) uint32 {
+	size := uint32(2 + len(entries)*12 + 4)
+	for _, e := range entries {
+		if len(e.data) > 4 && e.at == 0 {
+			size += uint32(len(e.data))
+		}
+	}
+	return size
+}
+
+// function returns the ifd written at the offset, the values larger than 4 bytes follow the ifd
+func encodeIfd(order binary.ByteOrder, offset uint32, entries []testEntry) []byte {
+	b := make([]byte, 2+len(entries)*12+4)
+	order.PutUint16(b, uint16(len(entries)))
+	data := offset + uint32(len(b))
+	for i, e := range entries {
+		entry := b[2+i*12:]
+		order.PutUint16(entry, e.tag)
+		order.PutUint16(entry[2:], e.typ)
+		order.PutUint32(entry[4:], e.count)
+		switch {
+		case e.at != 0:
+			order.PutUint32(entry[8:], e.at)
+		case len(e.data) <= 4:
+			copy(entry[8:12], e.data)
+		default:
+			order.PutUint32(entry[8:], data)
+			data += uint32(len(e.data))
+		}
+	}
+	for _, e := range entries {
+		if len(e.data) > 4 && e.at == 0 {
+			b = append(b, e.data...)
+		}
+	}
+	return b
+}
+
+// function returns the tiff structure of a canon photo taken at Valencia with the magic number
+func testTiff(order binary.ByteOrder, magic uint16) []byte {
+	makerNote := []testEntry{ascii(CANON_IMAGE_TYPE_TAG, "Canon EOS 400D DIGITAL"), short(order, 0x0010, 1)}
+	gps := []testEntry{
+		ascii(0x0001, "N"),
+		rationals(order, 0x0002, 38, 1, 54, 1, 3540, 100),
+		ascii(0x0003, "W"),
+		rationals(order, 0x0004, 0, 1, 22, 1, 30, 1),
+	}
+	exif := []testEntry{
+		rationals(order, 0x829a, 1, 200),
+		rationals(order, 0x829d, 56, 10),
+		ascii(0x9003, "2016:07:14 10:00:00"),
+		ascii(0x9011, "+02:00"),
+		ascii(0x9291, "5"),
+		{tag: MAKER_NOTE_TAG, typ: TYPE_UNDEFINED},
+	}
+	ifd0 := []testEntry{
+		ascii(0x010f, "Canon"),
+		short(order, 0x0112, 6),
+		long(order, EXIF_IFD_POINTER, 0),
+		long(order, GPS_IFD_POINTER, 0),
+	}
+	ifd0Offset := uint32(8)
+	exifOffset := ifd0Offset + ifdSize(ifd0)
+	gpsOffset := exifOffset + ifdSize(exif)
+	makerNoteOffset := gpsOffset + ifdSize(gps)
+	ifd0[2] = long(order, EXIF_IFD_POINTER, exifOffset)
+	ifd0[3] = long(order, GPS_IFD_POINTER, gpsOffset)
+	makerNoteContent := encodeIfd(order, makerNoteOffset, makerNote)
+	exif[5].count, exif[5].at = uint32(len(makerNoteContent)), makerNoteOffset
+
+	header := make([]byte, 8)
+	if order == binary.LittleEndian {
+		copy(header, "II")
+	} else {
+		copy(header, "MM")
+	}
+	order.PutUint16(header[2:], magic)
+	order.PutUint32(header[4:], ifd0Offset)
+	content := append(header, encodeIfd(order, ifd0Offset, ifd0)...)
+	content = append(content, encodeIfd(order, exifOffset, exif)...)
+	content = append(content, encodeIfd(order, gpsOffset, gps)...)
+	return append(content, makerNoteContent...)
+}
+
+func testJpeg(tiff []byte) []byte {
+	b := []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x04, 0x00, 0x00}
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	b = append(b, 0xff, 0xe1, byte((len(segment)+2)>>8), byte(len(segment)+2))
+	b = append(b, segment...)
+	return append(b, 0xff, 0xda, 0x00, 0x02, 0xff, 0xd9)
+}
+
+func testPngChunk(name string, data []byte) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(len(data)))
+	b = append(append(b, name...), data...)
+	return append(b, 0, 0, 0, 0)
+}
+
+func testPng(tiff []byte) []byte {
+	b := []byte("\x89PNG\r\n\x1a\n")
+	b = append(b, testPngChunk("IHDR", make([]byte, 13))...)
+	b = append(b, testPngChunk("eXIf", tiff)...)
+	return append(b, testPngChunk("IEND", nil)...)
+}
+
+func TestDecodeExif(t *testing.T) {
+	contents := map[string][]byte{
+		"cr2":  testTiff(binary.LittleEndian, 42),
+		"nef":  testTiff(binary.BigEndian, 42),
+		"orf":  testTiff(binary.LittleEndian, 0x4f52),
+		"jpeg": testJpeg(testTiff(binary.BigEndian, 42)),
+		"png":  testPng(testTiff(binary.LittleEndian, 42)),
+	}
+	for name, content := range contents {
+		t.Run(name, func(t *testing.T) {
+			data, err := DecodeExif(bytes.NewReader(content), int64(len(content)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data.MakerModel != "Canon EOS 400D DIGITAL" || data.Model() != data.MakerModel {
+				t.Fatalf("expected the model of the maker note, received %s", data.MakerModel)
+			}
+			date, ok := data.Time()
+			expected := time.Date(2016, 7, 14, 8, 0, 0, 500000000, time.UTC)
+			if !ok || !date.Equal(expected) {
+				t.Fatalf("expected the date %v, received %v", expected, date)
+			}
+			latitude, longitude, ok := data.GPS()
+			if !ok || latitude < 38.9098 || latitude > 38.9099 || longitude != -0.375 {
+				t.Fatalf("expected the gps coordinates of Valencia, received %f %f", latitude, longitude)
+			}
+			if r := data.Rationals("ExposureTime"); len(r) != 1 || r[0].Float() != 0.005 {
+				t.Fatalf("expected the exposure time 1/200, received %v", r)
+			}
+			titles := data.Titles()
+			for title, value := range map[string]string{
+				"Manufacturer":             "Canon",
+				"Model":                    "Canon EOS 400D DIGITAL",
+				"Orientation":              "Right-top",
+				"Date and Time (Original)": "2016:07:14 10:00:00",
+				"Exposure Time":            "1/200 sec.",
+				"F-Number":                 "f/5.6",
+				"Latitude":                 "38, 54, 35.40",
+				"Longitude":                " 0, 22, 30",
+				"East or West Longitude":   "W",
+			} {
+				if titles[title] != value {
+					t.Fatalf("expected %s = %q, received %q", title, value, titles[title])
+				}
+			}
+		})
+	}
+
+	for name, content := range map[string][]byte{
+		"empty":           {},
+		"text":            []byte("not a photo"),
+		"jpeg without":    {0xff, 0xd8, 0xff, 0xda, 0x00, 0x02},
+		"truncated tiff":  testTiff(binary.LittleEndian, 42)[:20],
+		"truncated jpeg":  testJpeg(testTiff(binary.BigEndian, 42))[:30],
+		"bad tiff offset": {'I', 'I', 42, 0, 0xff, 0xff, 0xff, 0x7f},
+	} {
+		if _, err := DecodeExif(bytes.NewReader(content), int64(len(content))); err == nil {
+			t.Fatalf("expected an error for the content %s", name)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package exifhandler
+
+// ifds of the exif data
+const (
+	IFD_0       = "IFD0"
+	IFD_EXIF    = "Exif"
+	IFD_GPS     = "GPS"
+	IFD_INTEROP = "Interoperability"
+)
+
+// tags pointing to the sub ifds and to the maker note
+const (
+	EXIF_IFD_POINTER    = 0x8769
+	GPS_IFD_POINTER     = 0x8825
+	INTEROP_IFD_POINTER = 0xa005
+	MAKER_NOTE_TAG      = 0x927c
+	// image type of the canon maker notes (camera model)
+	CANON_IMAGE_TYPE_TAG = 0x0006
+	// xmp packet of the IFD0 of the tiff based files
+	XMP_PACKET_TAG = 0x02bc
+)
+
+// name (exif specification) and title (libexif, the keys of the tags of the photos) of a tag
+type tagDefinition struct {
+	name  string
+	title string
+}
+
+// tags read in each ifd, the unknown tags are ignored
+var tagDefinitions = map[string]map[uint16]tagDefinition{
+	IFD_0: {
+		0x0100: {"ImageWidth", "Image Width"},
+		0x0101: {"ImageLength", "Image Length"},
+		0x0102: {"BitsPerSample", "Bits per Sample"},
+		0x0103: {"Compression", "Compression"},
+		0x0106: {"PhotometricInterpretation", "Photometric Interpretation"},
+		0x010e: {"ImageDescription", "Image Description"},
+		0x010f: {"Make", "Manufacturer"},
+		0x0110: {"Model", "Model"},
+		0x0112: {"Orientation", "Orientation"},
+		0x0115: {"SamplesPerPixel", "Samples per Pixel"},
+		0x011a: {"XResolution", "X-Resolution"},
+		0x011b: {"YResolution", "Y-Resolution"},
+		0x0128: {"ResolutionUnit", "Resolution Unit"},
+		0x0131: {"Software", "Software"},
+		0x0132: {"DateTime", "Date and Time"},
+		0x013b: {"Artist", "Artist"},
+		0x013e: {"WhitePoint", "White Point"},
+		0x013f: {"PrimaryChromaticities", "Primary Chromaticities"},
+		0x0213: {"YCbCrPositioning", "YCbCr Positioning"},
+		0x8298: {"Copyright", "Copyright"},
+	},
+	IFD_EXIF: {
+		0x829a: {"ExposureTime", "Exposure Time"},
+		0x829d: {"FNumber", "F-Number"},
+		0x8822: {"ExposureProgram", "Exposure Program"},
+		0x8827: {"ISOSpeedRatings", "ISO Speed Ratings"},
+		0x8830: {"SensitivityType", "Sensitivity Type"},
+		0x9000: {"ExifVersion", "Exif Version"},
+		0x9003: {"DateTimeOriginal", "Date and Time (Original)"},
+		0x9004: {"DateTimeDigitized", "Date and Time (Digitized)"},
+		0x9010: {"OffsetTime", "Offset Time For DateTime"},
+		0x9011: {"OffsetTimeOriginal", "Offset Time For DateTimeOriginal"},
+		0x9012: {"OffsetTimeDigitized", "Offset Time For DateTimeDigitized"},
+		0x9101: {"ComponentsConfiguration", "Components Configuration"},
+		0x9102: {"CompressedBitsPerPixel", "Compressed Bits per Pixel"},
+		0x9201: {"ShutterSpeedValue", "Shutter Speed"},
+		0x9202: {"ApertureValue", "Aperture"},
+		0x9203: {"BrightnessValue", "Brightness"},
+		0x9204: {"ExposureBiasValue", "Exposure Bias"},
+		0x9205: {"MaxApertureValue", "Maximum Aperture Value"},
+		0x9206: {"SubjectDistance", "Subject Distance"},
+		0x9207: {"MeteringMode", "Metering Mode"},
+		0x9208: {"LightSource", "Light Source"},
+		0x9209: {"Flash", "Flash"},
+		0x920a: {"FocalLength", "Focal Length"},
+		0x927c: {"MakerNote", "Maker Note"},
+		0x9286: {"UserComment", "User Comment"},
+		0x9290: {"SubSecTime", "Sub-second Time"},
+		0x9291: {"SubSecTimeOriginal", "Sub-second Time (Original)"},
+		0x9292: {"SubSecTimeDigitized", "Sub-second Time (Digitized)"},
+		0xa000: {"FlashpixVersion", "FlashPixVersion"},
+		0xa001: {"ColorSpace", "Color Space"},
+		0xa002: {"PixelXDimension", "Pixel X Dimension"},
+		0xa003: {"PixelYDimension", "Pixel Y Dimension"},
+		0xa20e: {"FocalPlaneXResolution", "Focal Plane X-Resolution"},
+		0xa20f: {"FocalPlaneYResolution", "Focal Plane Y-Resolution"},
+		0xa210: {"FocalPlaneResolutionUnit", "Focal Plane Resolution Unit"},
+		0xa217: {"SensingMethod", "Sensing Method"},
+		0xa300: {"FileSource", "File Source"},
+		0xa301: {"SceneType", "Scene Type"},
+		0xa401: {"CustomRendered", "Custom Rendered"},
+		0xa402: {"ExposureMode", "Exposure Mode"},
+		0xa403: {"WhiteBalance", "White Balance"},
+		0xa404: {"DigitalZoomRatio", "Digital Zoom Ratio"},
+		0xa405: {"FocalLengthIn35mmFilm", "Focal Length in 35mm Film"},
+		0xa406: {"SceneCaptureType", "Scene Capture Type"},
+		0xa407: {"GainControl", "Gain Control"},
+		0xa408: {"Contrast", "Contrast"},
+		0xa409: {"Saturation", "Saturation"},
+		0xa40a: {"Sharpness", "Sharpness"},
+		0xa40c: {"SubjectDistanceRange", "Subject Distance Range"},
+		0xa420: {"ImageUniqueID", "Image Unique ID"},
+		0xa430: {"CameraOwnerName", "Camera Owner Name"},
+		0xa431: {"BodySerialNumber", "Serial Number"},
+		0xa432: {"LensSpecification", "Lens Specification"},
+		0xa433: {"LensMake", "Lens Make"},
+		0xa434: {"LensModel", "Lens Model"},
+		0xa435: {"LensSerialNumber", "Lens Serial Number"},
+	},
+	IFD_GPS: {
+		0x0000: {"GPSVersionID", "GPS Tag Version"},
+		0x0001: {"GPSLatitudeRef", "North or South Latitude"},
+		0x0002: {"GPSLatitude", "Latitude"},
+		0x0003: {"GPSLongitudeRef", "East or West Longitude"},
+		0x0004: {"GPSLongitude", "Longitude"},
+		0x0005: {"GPSAltitudeRef", "Altitude Reference"},
+		0x0006: {"GPSAltitude", "Altitude"},
+		0x0007: {"GPSTimeStamp", "GPS Time (Atomic Clock)"},
+		0x0008: {"GPSSatellites", "GPS Satellites"},
+		0x0009: {"GPSStatus", "GPS Receiver Status"},
+		0x000a: {"GPSMeasureMode", "GPS Measurement Mode"},
+		0x000b: {"GPSDOP", "Measurement Precision"},
+		0x000c: {"GPSSpeedRef", "Speed Unit"},
+		0x000d: {"GPSSpeed", "Speed of GPS Receiver"},
+		0x0010: {"GPSImgDirectionRef", "Reference for Direction of Image"},
+		0x0011: {"GPSImgDirection", "Direction of Image"},
+		0x0012: {"GPSMapDatum", "Geodetic Survey Data Used"},
+		0x001d: {"GPSDateStamp", "GPS Date"},
+	},
+	IFD_INTEROP: {
+		0x0001: {"InteroperabilityIndex", "Interoperability Index"},
+		0x0002: {"InteroperabilityVersion", "Interoperability Version"},
+	},
+}
+
+// descriptions of the orientations, as libexif writes them
+var orientations = []string{"", "Top-left", "Top-right", "Bottom-right", "Bottom-left", "Left-top", "Right-top", "Right-bottom", "Left-bottom"}
@@ -0,0 +1,246 @@
+package exifhandler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// prefix of the photoshop APP13 segment of the jpeg
+	JPEG_PHOTOSHOP_PREFIX = "Photoshop 3.0\x00"
+	// signature and id of the photoshop image resource of the iptc
+	PHOTOSHOP_RESOURCE_SIGNATURE = "8BIM"
+	PHOTOSHOP_IPTC_RESOURCE      = 0x0404
+	// tags of the IFD0 of the tiff based files with the iptc or the photoshop image resources
+	IPTC_NAA_TAG  = 0x83bb
+	PHOTOSHOP_TAG = 0x8649
+	// marker of the iptc datasets
+	IPTC_MARKER = 0x1c
+	// prefix of the iptc tags of the photos
+	IPTC_NAMESPACE = "iptc:"
+	// separator of the values of the repeatable datasets in the tags
+	IPTC_SEPARATOR = ", "
+	// value of the coded character set dataset (1:90) of the utf-8 iptc
+	IPTC_UTF8 = "\x1b%G"
+)
+
+var IptcNotFound = errors.New("No iptc data found.")
+
+// names of the datasets of the application record (record 2), the unknown datasets are ignored
+var iptcDatasets = map[byte]string{
+	5:   "Object Name",
+	7:   "Edit Status",
+	10:  "Urgency",
+	15:  "Category",
+	20:  "Supplemental Categories",
+	25:  "Keywords",
+	40:  "Special Instructions",
+	55:  "Date Created",
+	60:  "Time Created",
+	80:  "By-line",
+	85:  "By-line Title",
+	90:  "City",
+	92:  "Sub-location",
+	95:  "Province-State",
+	100: "Country-Primary Location Code",
+	101: "Country-Primary Location Name",
+	103: "Original Transmission Reference",
+	105: "Headline",
+	110: "Credit",
+	115: "Source",
+	116: "Copyright Notice",
+	118: "Contact",
+	120: "Caption-Abstract",
+	122: "Writer-Editor",
+}
+
+// iptc datasets of a photo by name, the repeatable datasets (keywords...) have several values
+type IptcData struct {
+	Datasets map[string][]string
+}
+
+// function reads the iptc of the file : jpeg (APP13 photoshop segment) or tiff based raw files (IFD0 tags)
+func ReadIptc(filePath string) (*IptcData, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return DecodeIptc(f, info.Size())
+}
+
+// function reads the iptc of the content of a photo of size bytes
+func DecodeIptc(r io.ReaderAt, size int64) (*IptcData, error) {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, IptcNotFound
+	}
+	switch {
+	case header[0] == 0xff && header[1] == 0xd8:
+		resources, err := jpegSegment(r, size, JPEG_APP13, JPEG_PHOTOSHOP_PREFIX)
+		if err != nil {
+			return nil, IptcNotFound
+		}
+		iim, err := photoshopIptc(resources)
+		if err != nil {
+			return nil, err
+		}
+		return DecodeIim(iim)
+	case string(header[:2]) == "II" || string(header[:2]) == "MM":
+		t, ifd0, err := newTiffReader(r, size)
+		if err != nil {
+			return nil, IptcNotFound
+		}
+		entries, err := t.entries(ifd0)
+		if err != nil {
+			return nil, IptcNotFound
+		}
+		for _, entry := range entries {
+			switch entry.tag {
+			case IPTC_NAA_TAG:
+				iim, err := t.raw(entry)
+				if err != nil {
+					return nil, err
+				}
+				return DecodeIim(iim)
+			case PHOTOSHOP_TAG:
+				resources, err := t.raw(entry)
+				if err != nil {
+					return nil, err
+				}
+				if iim, err := photoshopIptc(resources); err == nil {
+					return DecodeIim(iim)
+				}
+			}
+		}
+	}
+	return nil, IptcNotFound
+}
+
+// function returns the iptc resource of the photoshop image resources
+func photoshopIptc(resources []byte) ([]byte, error) {
+	for offset := 0; offset+12 <= len(resources); {
+		if string(resources[offset:offset+4]) != PHOTOSHOP_RESOURCE_SIGNATURE {
+			return nil, errors.Wrap(InvalidExif, "photoshop resource expected")
+		}
+		id := binary.BigEndian.Uint16(resources[offset+4:])
+		// pascal name padded to an even size
+		nameSize := int(resources[offset+6]) + 1
+		nameSize += nameSize % 2
+		dataOffset := offset + 6 + nameSize + 4
+		if dataOffset > len(resources) {
+			break
+		}
+		size := int(binary.BigEndian.Uint32(resources[dataOffset-4:]))
+		if size < 0 || dataOffset+size > len(resources) {
+			return nil, errors.Wrap(InvalidExif, "photoshop resource out of the segment")
+		}
+		if id == PHOTOSHOP_IPTC_RESOURCE {
+			return resources[dataOffset : dataOffset+size], nil
+		}
+		offset = dataOffset + size + size%2
+	}
+	return nil, IptcNotFound
+}
+
+// function decodes the datasets of the application record of the iptc, the values are utf-8 if
+// the iptc declares it (1:90) or is valid utf-8, latin-1 otherwise
+func DecodeIim(iim []byte) (*IptcData, error) {
+	data := &IptcData{Datasets: make(map[string][]string)}
+	// the values are converted once the character set of the record 1 is known
+	values := make(map[byte][][]byte)
+	declaredUtf8 := false
+	err := iimDatasets(iim, func(record byte, dataset byte, value []byte) {
+		switch {
+		case record == 1 && dataset == 90:
+			declaredUtf8 = bytes.Equal(value, []byte(IPTC_UTF8))
+		case record == 2:
+			if _, ok := iptcDatasets[dataset]; ok {
+				values[dataset] = append(values[dataset], value)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for dataset, datasetValues := range values {
+		for _, value := range datasetValues {
+			text := strings.TrimSpace(strings.TrimRight(iptcString(value, declaredUtf8), "\x00"))
+			if text != "" {
+				data.Datasets[iptcDatasets[dataset]] = append(data.Datasets[iptcDatasets[dataset]], text)
+			}
+		}
+	}
+	if len(data.Datasets) == 0 {
+		return nil, IptcNotFound
+	}
+	return data, nil
+}
+
+// function calls fn with the record, the number and the value of each dataset of the iptc
+func iimDatasets(iim []byte, fn func(record byte, dataset byte, value []byte)) error {
+	for offset := 0; offset+5 <= len(iim); {
+		if iim[offset] != IPTC_MARKER {
+			// padding after the last dataset
+			break
+		}
+		record, dataset := iim[offset+1], iim[offset+2]
+		length := int(binary.BigEndian.Uint16(iim[offset+3:]))
+		offset += 5
+		if length&0x8000 != 0 {
+			// extended dataset, the length is written in the next bytes
+			lengthSize := length & 0x7fff
+			if lengthSize > 4 || offset+lengthSize > len(iim) {
+				return errors.Wrap(InvalidExif, "iptc dataset too large")
+			}
+			length = 0
+			for _, b := range iim[offset : offset+lengthSize] {
+				length = length<<8 | int(b)
+			}
+			offset += lengthSize
+		}
+		if length < 0 || offset+length > len(iim) {
+			return errors.Wrap(InvalidExif, "iptc dataset out of the record")
+		}
+		fn(record, dataset, iim[offset:offset+length])
+		offset += length
+	}
+	return nil
+}
+
+// function returns the text of the value, latin-1 values are converted to utf-8
+func iptcString(value []byte, declaredUtf8 bool) string {
+	if declaredUtf8 || utf8.Valid(value) {
+		return string(value)
+	}
+	runes := make([]rune, len(value))
+	for i, b := range value {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// function returns the values of the dataset, nil if the photo has not this dataset
+func (d *IptcData) Values(name string) []string {
+	return d.Datasets[name]
+}
+
+// function returns the datasets as tags of the photo prefixed by iptc:, the values of the
+// repeatable datasets are separated by a comma
+func (d *IptcData) Tags() map[string]string {
+	tags := make(map[string]string, len(d.Datasets))
+	for name, values := range d.Datasets {
+		tags[IPTC_NAMESPACE+name] = strings.Join(values, IPTC_SEPARATOR)
+	}
+	return tags
+}
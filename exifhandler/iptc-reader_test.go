@@ -0,0 +1,88 @@
+package exifhandler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func testIptcDataset(record byte, dataset byte, value []byte) []byte {
+	b := []byte{IPTC_MARKER, record, dataset, 0, 0}
+	binary.BigEndian.PutUint16(b[3:], uint16(len(value)))
+	return append(b, value...)
+}
+
+// function returns the photoshop image resource of the id with an odd sized name and content
+func testPhotoshopResource(id uint16, content []byte) []byte {
+	b := []byte(PHOTOSHOP_RESOURCE_SIGNATURE + "\x00\x00\x01a")
+	binary.BigEndian.PutUint16(b[4:], id)
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(content)))
+	b = append(append(b, size...), content...)
+	if len(content)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// function returns the iptc of a scanned print, the caption is latin-1
+func testIim() []byte {
+	iim := testIptcDataset(1, 0, []byte{0, 4})
+	iim = append(iim, testIptcDataset(2, 0, []byte{0, 4})...)
+	iim = append(iim, testIptcDataset(2, 120, []byte("Mamie \xe0 la plage"))...)
+	iim = append(iim, testIptcDataset(2, 25, []byte("Family"))...)
+	iim = append(iim, testIptcDataset(2, 25, []byte("Scan"))...)
+	iim = append(iim, testIptcDataset(2, 90, []byte("Valencia"))...)
+	// extended dataset, the length is written in 4 bytes
+	iim = append(iim, IPTC_MARKER, 2, 80, 0x80, 0x04, 0, 0, 0, 6)
+	return append(append(iim, "Jerome"...), 0, 0)
+}
+
+func TestDecodeIptc(t *testing.T) {
+	iim := testIim()
+	resources := append(testPhotoshopResource(0x040c, []byte{1, 2, 3}), testPhotoshopResource(PHOTOSHOP_IPTC_RESOURCE, iim)...)
+	segment := append([]byte(JPEG_PHOTOSHOP_PREFIX), resources...)
+	jpeg := testJpeg(testTiff(binary.BigEndian, 42))
+	jpegIptc := append(append([]byte{}, jpeg[:2]...), 0xff, 0xed, byte((len(segment)+2)>>8), byte(len(segment)+2))
+	jpegIptc = append(append(jpegIptc, segment...), jpeg[2:]...)
+	tiffIptc := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiffIptc = append(tiffIptc, encodeIfd(binary.BigEndian, 8, []testEntry{
+		{tag: IPTC_NAA_TAG, typ: TYPE_UNDEFINED, count: uint32(len(iim)), data: iim},
+	})...)
+
+	for name, content := range map[string][]byte{"jpeg": jpegIptc, "tiff": tiffIptc} {
+		data, err := DecodeIptc(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			t.Fatalf("expected the iptc of the %s, received %v", name, err)
+		}
+		if !reflect.DeepEqual(data.Values("Keywords"), []string{"Family", "Scan"}) {
+			t.Fatalf("expected the keywords Family and Scan, received %v", data.Values("Keywords"))
+		}
+		tags := data.Tags()
+		for tag, value := range map[string]string{
+			"iptc:Caption-Abstract": "Mamie à la plage",
+			"iptc:Keywords":         "Family, Scan",
+			"iptc:City":             "Valencia",
+			"iptc:By-line":          "Jerome",
+		} {
+			if tags[tag] != value {
+				t.Fatalf("expected %s = %q in the %s, received %q", tag, value, name, tags[tag])
+			}
+		}
+		if len(tags) != 4 {
+			t.Fatalf("expected only the datasets with a value, received %v", tags)
+		}
+	}
+
+	if _, err := DecodeIptc(bytes.NewReader(jpeg), int64(len(jpeg))); err != IptcNotFound {
+		t.Fatalf("expected IptcNotFound for a jpeg without iptc, received %v", err)
+	}
+	if _, err := DecodeIim(iim[:len(iim)-10]); err == nil {
+		t.Fatal("expected an error for a truncated dataset")
+	}
+	utf8Iim := append(testIptcDataset(1, 90, []byte("\x1b%G")), testIptcDataset(2, 120, []byte("Mamie à la plage"))...)
+	if data, err := DecodeIim(utf8Iim); err != nil || data.Values("Caption-Abstract")[0] != "Mamie à la plage" {
+		t.Fatalf("expected the utf-8 caption, received %v %v", data, err)
+	}
+}
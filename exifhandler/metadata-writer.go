@@ -0,0 +1,763 @@
+package exifhandler
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jeromelesaux/photo/configurationexif"
+	"github.com/jeromelesaux/photo/modele"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	// photoshop image resource of the md5 digest of the iptc, removed when the iptc is rewritten
+	PHOTOSHOP_IPTC_DIGEST_RESOURCE = 0x0425
+	// maximal size of the content of a jpeg segment
+	JPEG_SEGMENT_MAX_SIZE = 0xffff - 2
+	// exif tags rewritten in place in the jpeg
+	DATETIME_ORIGINAL_TAG    = 0x9003
+	OFFSET_TIME_ORIGINAL_TAG = 0x9011
+	SUBSEC_TIME_ORIGINAL_TAG = 0x9291
+	GPS_LATITUDE_REF_TAG     = 0x0001
+	GPS_LATITUDE_TAG         = 0x0002
+	GPS_LONGITUDE_REF_TAG    = 0x0003
+	GPS_LONGITUDE_TAG        = 0x0004
+)
+
+// packet completed by EditXmp for the photos without xmp
+const emptyXmpPacket = "<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n" +
+	"<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n" +
+	" <rdf:RDF xmlns:rdf=\"" + NAMESPACE_RDF + "\">\n" +
+	" </rdf:RDF>\n" +
+	"</x:xmpmeta>\n" +
+	"<?xpacket end=\"w\"?>"
+
+// prefixes of the namespaces of the xmp properties written
+var xmpPrefixes = map[string]string{
+	NAMESPACE_XMP:  "xmp",
+	NAMESPACE_DC:   "dc",
+	NAMESPACE_LR:   "lr",
+	NAMESPACE_EXIF: "exif",
+	NAMESPACE_PS:   "photoshop",
+}
+
+// xmp property written by EditXmp, xml is the element written, empty to remove the property
+type xmpProperty struct {
+	name xml.Name
+	xml  string
+	// value listed in the changes
+	value string
+}
+
+// function writes the corrections of the update into the photo update.Filepath : a jpeg gets them in its xmp,
+// its exif date and gps tags and its iptc, the other photos (or a jpeg if update.Sidecar is set) in their xmp sidecar.
+// the photo must still have the md5sum update.Md5Sum, the original bytes of the file written are copied
+// in conf.MetadataBackupDirectory and the new md5sum of the photo is recorded in the scan index. in dry run nothing is written.
+// only the files of the scan roots with an extension of conf are written
+func WriteMetadata(update *modele.MetadataUpdate, conf configurationexif.FileExtension) (*modele.MetadataResult, error) {
+	if err := update.Validate(); err != nil {
+		return nil, err
+	}
+	if !conf.InScanRoots(update.Filepath) {
+		return nil, errors.Errorf("The file %s is outside the scan roots", update.Filepath)
+	}
+	if !hasExtension(filepath.Base(update.Filepath), conf) {
+		return nil, errors.Errorf("The file %s is not a photo", update.Filepath)
+	}
+	if !filepath.IsAbs(conf.MetadataBackupDirectory) {
+		return nil, errors.Errorf("The backup directory %s is not an absolute path", conf.MetadataBackupDirectory)
+	}
+	if !update.DryRun {
+		// the scan index is updated with the photo written
+		scanIndexLock.Lock()
+		defer scanIndexLock.Unlock()
+	}
+	content, err := ioutil.ReadFile(update.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	md5sum := fmt.Sprintf("%x", md5.Sum(content))
+	if md5sum != update.Md5Sum {
+		return nil, errors.Errorf("The photo %s has changed since its scan, md5sum %s", update.Filepath, md5sum)
+	}
+	result := &modele.MetadataResult{Md5Sum: md5sum, NewMd5Sum: md5sum, Filepath: update.Filepath, DryRun: update.DryRun}
+	var original, written []byte
+	if len(content) > 2 && content[0] == 0xff && content[1] == 0xd8 && !update.Sidecar {
+		result.Written, original = update.Filepath, content
+		if written, result.Changes, err = RewriteJpeg(content, update); err != nil {
+			return nil, err
+		}
+		result.NewMd5Sum = fmt.Sprintf("%x", md5.Sum(written))
+	} else {
+		result.Sidecar = true
+		packet := []byte(emptyXmpPacket)
+		if result.Written = XmpSidecar(update.Filepath); result.Written != "" {
+			if original, err = readSidecar(result.Written); err != nil {
+				return nil, err
+			}
+			packet = original
+		} else {
+			// the sidecar of darktable and digikam, the name of a lightroom sidecar is shared by the raw and the jpeg
+			result.Written = update.Filepath + XMP_SIDECAR_EXTENSION
+		}
+		if written, result.Changes, err = EditXmp(packet, update); err != nil {
+			return nil, err
+		}
+	}
+	if update.DryRun {
+		return result, nil
+	}
+	if original != nil {
+		if result.Backup, err = backupFile(conf.MetadataBackupDirectory, result.Written, original); err != nil {
+			return nil, err
+		}
+	}
+	if err := replaceFile(result.Written, written); err != nil {
+		return nil, err
+	}
+	if !result.Sidecar {
+		if err := recordScanIndex(update.Filepath, result.NewMd5Sum); err != nil {
+			logger.Errorf("Cannot record %s in the scan index with error %v", update.Filepath, err)
+		}
+	}
+	logger.Infof("Metadata of %s written in %s (%s), md5sum %s", update.Filepath, result.Written, strings.Join(result.Changes, ", "), result.NewMd5Sum)
+	return result, nil
+}
+
+// function copies the original bytes of the file in the directory, named by their md5sum
+// and returns the path of the copy
+func backupFile(directory string, path string, original []byte) (string, error) {
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return "", err
+	}
+	backup := filepath.Join(directory, fmt.Sprintf("%x-%s", md5.Sum(original), filepath.Base(path)))
+	if _, err := os.Stat(backup); err == nil {
+		return backup, nil
+	}
+	if err := ioutil.WriteFile(backup, original, 0600); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
+
+// function replaces the content of the file, the new content is written in a temporary file renamed
+// so the file is never truncated
+func replaceFile(path string, content []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, mode); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// function returns the jpeg with the corrections of the update : the xmp segment is rewritten (added if the jpeg has none),
+// the original date and the gps coordinates of the exif and the keywords and the caption of the iptc are rewritten
+// if the jpeg has them
+func RewriteJpeg(content []byte, update *modele.MetadataUpdate) ([]byte, []string, error) {
+	changes := make([]string, 0)
+	out := bytes.NewBuffer(append([]byte{}, content[:2]...))
+	hasXmp := false
+	if _, err := jpegSegment(bytes.NewReader(content), int64(len(content)), JPEG_APP1, JPEG_XMP_PREFIX); err == nil {
+		hasXmp = true
+	}
+	xmpWritten := false
+	writeXmp := func(packet []byte) error {
+		xmp, xmpChanges, err := EditXmp(packet, update)
+		if err != nil {
+			return err
+		}
+		segment, err := jpegAppSegment(JPEG_APP1, append([]byte(JPEG_XMP_PREFIX), xmp...))
+		if err != nil {
+			return err
+		}
+		out.Write(segment)
+		changes = append(changes, xmpChanges...)
+		xmpWritten = true
+		return nil
+	}
+	offset := 2
+	for offset+4 <= len(content) {
+		marker := content[offset+1]
+		if content[offset] != 0xff {
+			return nil, nil, errors.Wrap(InvalidExif, "jpeg marker expected")
+		}
+		if marker == 0xff || marker == 0x01 || (marker >= 0xd0 && marker <= 0xd8) {
+			out.WriteByte(content[offset])
+			offset++
+			if marker != 0xff {
+				out.WriteByte(marker)
+				offset++
+			}
+			continue
+		}
+		if !hasXmp && !xmpWritten && marker != 0xe0 && marker != JPEG_APP1 {
+			// the xmp follows the jfif and exif segments
+			if err := writeXmp([]byte(emptyXmpPacket)); err != nil {
+				return nil, nil, err
+			}
+		}
+		if marker == 0xda || marker == 0xd9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(content[offset+2:]))
+		if length < 2 || offset+2+length > len(content) {
+			return nil, nil, errors.Wrap(InvalidExif, "jpeg segment out of the file")
+		}
+		segment := content[offset : offset+2+length]
+		payload := segment[4:]
+		switch {
+		case marker == JPEG_APP1 && bytes.HasPrefix(payload, []byte(JPEG_EXIF_PREFIX)):
+			rewritten := append([]byte{}, segment...)
+			changes = append(changes, rewriteExif(rewritten[4+len(JPEG_EXIF_PREFIX):], update)...)
+			out.Write(rewritten)
+		case marker == JPEG_APP1 && bytes.HasPrefix(payload, []byte(JPEG_XMP_PREFIX)) && !xmpWritten:
+			if err := writeXmp(payload[len(JPEG_XMP_PREFIX):]); err != nil {
+				return nil, nil, err
+			}
+		case marker == JPEG_APP13 && bytes.HasPrefix(payload, []byte(JPEG_PHOTOSHOP_PREFIX)):
+			resources, iptcChanges, err := rewritePhotoshop(payload[len(JPEG_PHOTOSHOP_PREFIX):], update)
+			if err != nil {
+				return nil, nil, err
+			}
+			rewritten, err := jpegAppSegment(JPEG_APP13, append([]byte(JPEG_PHOTOSHOP_PREFIX), resources...))
+			if err != nil {
+				return nil, nil, err
+			}
+			out.Write(rewritten)
+			changes = append(changes, iptcChanges...)
+		default:
+			out.Write(segment)
+		}
+		offset += 2 + length
+	}
+	if offset+4 > len(content) || !xmpWritten {
+		return nil, nil, errors.Wrap(InvalidExif, "jpeg without image data")
+	}
+	out.Write(content[offset:])
+	return out.Bytes(), changes, nil
+}
+
+// function returns the APPn segment of the content
+func jpegAppSegment(marker byte, content []byte) ([]byte, error) {
+	if len(content) > JPEG_SEGMENT_MAX_SIZE {
+		return nil, errors.Errorf("The segment of %d bytes is too large for the jpeg", len(content))
+	}
+	segment := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(content)+2))
+	return append(segment, content...), nil
+}
+
+// function rewrites in place the original date and the gps coordinates of the exif of the jpeg if the tags
+// exist with the size of the new values, the xmp keeps the values otherwise
+func rewriteExif(tiff []byte, update *modele.MetadataUpdate) []string {
+	changes := make([]string, 0)
+	t, ifd0, err := newTiffReader(bytes.NewReader(tiff), int64(len(tiff)))
+	if err != nil {
+		return changes
+	}
+	entries, err := t.entries(ifd0)
+	if err != nil {
+		return changes
+	}
+	ifds := make(map[string][]ifdEntry)
+	for _, entry := range entries {
+		switch entry.tag {
+		case EXIF_IFD_POINTER:
+			ifds[IFD_EXIF], _ = t.entries(t.pointer(entry))
+		case GPS_IFD_POINTER:
+			ifds[IFD_GPS], _ = t.entries(t.pointer(entry))
+		}
+	}
+	ascii := func(entry ifdEntry, value string) bool {
+		if entry.typ != TYPE_ASCII || entry.count != int64(len(value)+1) || entry.offset+entry.count > int64(len(tiff)) {
+			return false
+		}
+		copy(tiff[entry.offset:], value+"\x00")
+		return true
+	}
+	if update.Date != nil {
+		date, offset, _ := modele.ParseXmpDate(*update.Date)
+		for _, entry := range ifds[IFD_EXIF] {
+			switch entry.tag {
+			case DATETIME_ORIGINAL_TAG:
+				if value := date.Format("2006:01:02 15:04:05"); ascii(entry, value) {
+					changes = append(changes, "exif:DateTimeOriginal="+value)
+				}
+			case OFFSET_TIME_ORIGINAL_TAG:
+				// unknown offset written with spaces
+				value := "   :  "
+				if offset {
+					value = date.Format("-07:00")
+				}
+				if ascii(entry, value) {
+					changes = append(changes, "exif:OffsetTimeOriginal="+value)
+				}
+			case SUBSEC_TIME_ORIGINAL_TAG:
+				if entry.count > 1 && ascii(entry, strings.Repeat("0", int(entry.count-1))) {
+					changes = append(changes, "exif:SubSecTimeOriginal=0")
+				}
+			}
+		}
+	}
+	if update.Latitude != nil && update.Longitude != nil {
+		references := map[uint16]string{GPS_LATITUDE_REF_TAG: "N", GPS_LONGITUDE_REF_TAG: "E"}
+		if *update.Latitude < 0 {
+			references[GPS_LATITUDE_REF_TAG] = "S"
+		}
+		if *update.Longitude < 0 {
+			references[GPS_LONGITUDE_REF_TAG] = "W"
+		}
+		coordinates := map[uint16]float64{GPS_LATITUDE_TAG: *update.Latitude, GPS_LONGITUDE_TAG: *update.Longitude}
+		found := 0
+		for _, entry := range ifds[IFD_GPS] {
+			if _, ok := references[entry.tag]; ok && entry.typ == TYPE_ASCII && entry.count == 2 {
+				found++
+			}
+			if _, ok := coordinates[entry.tag]; ok && entry.typ == TYPE_RATIONAL && entry.count == 3 && entry.offset+24 <= int64(len(tiff)) {
+				found++
+			}
+		}
+		// the four tags are rewritten together
+		if found == 4 {
+			for _, entry := range ifds[IFD_GPS] {
+				if reference, ok := references[entry.tag]; ok {
+					ascii(entry, reference)
+				}
+				if coordinate, ok := coordinates[entry.tag]; ok {
+					for i, value := range degreesMinutesSeconds(coordinate) {
+						t.order.PutUint32(tiff[entry.offset+int64(i)*8:], value[0])
+						t.order.PutUint32(tiff[entry.offset+int64(i)*8+4:], value[1])
+					}
+				}
+			}
+			changes = append(changes, fmt.Sprintf("exif:GPSLatitude=%s", xmpCoordinate(*update.Latitude, "N", "S")),
+				fmt.Sprintf("exif:GPSLongitude=%s", xmpCoordinate(*update.Longitude, "E", "W")))
+		}
+	}
+	return changes
+}
+
+// function returns the rationals of the degrees, minutes and seconds of the coordinate
+func degreesMinutesSeconds(coordinate float64) [3][2]uint32 {
+	coordinate = math.Abs(coordinate)
+	degrees := math.Floor(coordinate)
+	minutes := math.Floor((coordinate - degrees) * 60)
+	seconds := ((coordinate-degrees)*60 - minutes) * 60
+	return [3][2]uint32{{uint32(degrees), 1}, {uint32(minutes), 1}, {uint32(math.Round(seconds * 10000)), 10000}}
+}
+
+// function returns the xmp coordinate "DDD,MM.mmmmmmk" of the decimal coordinate, k is positive or negative
+func xmpCoordinate(coordinate float64, positive string, negative string) string {
+	reference := positive
+	if coordinate < 0 {
+		reference = negative
+	}
+	coordinate = math.Abs(coordinate)
+	degrees := math.Floor(coordinate)
+	minutes := strconv.FormatFloat((coordinate-degrees)*60, 'f', 6, 64)
+	minutes = strings.TrimRight(strings.TrimRight(minutes, "0"), ".")
+	return fmt.Sprintf("%d,%s%s", int(degrees), minutes, reference)
+}
+
+// function returns the photoshop image resources with the keywords and the caption of the update written
+// in the iptc, the resources of a jpeg without iptc are not modified
+func rewritePhotoshop(resources []byte, update *modele.MetadataUpdate) ([]byte, []string, error) {
+	if update.Keywords == nil && update.Description == nil {
+		return resources, nil, nil
+	}
+	if _, err := photoshopIptc(resources); err != nil {
+		return resources, nil, nil
+	}
+	out := bytes.NewBuffer(nil)
+	changes := make([]string, 0)
+	offset := 0
+	for offset+12 <= len(resources) {
+		id := binary.BigEndian.Uint16(resources[offset+4:])
+		nameSize := int(resources[offset+6]) + 1
+		nameSize += nameSize % 2
+		dataOffset := offset + 6 + nameSize + 4
+		if dataOffset > len(resources) {
+			break
+		}
+		size := int(binary.BigEndian.Uint32(resources[dataOffset-4:]))
+		if size < 0 || size > len(resources)-dataOffset {
+			return nil, nil, errors.Wrap(InvalidExif, "photoshop resource out of the segment")
+		}
+		next := dataOffset + size + size%2
+		if next > len(resources) {
+			next = len(resources)
+		}
+		switch id {
+		case PHOTOSHOP_IPTC_RESOURCE:
+			iim, iimChanges, err := rewriteIim(resources[dataOffset:dataOffset+size], update)
+			if err != nil {
+				return nil, nil, err
+			}
+			out.Write(resources[offset : dataOffset-4])
+			binary.Write(out, binary.BigEndian, uint32(len(iim)))
+			out.Write(iim)
+			if len(iim)%2 == 1 {
+				out.WriteByte(0)
+			}
+			changes = append(changes, iimChanges...)
+		case PHOTOSHOP_IPTC_DIGEST_RESOURCE:
+			// the digest of the previous iptc
+		default:
+			out.Write(resources[offset:next])
+		}
+		offset = next
+	}
+	out.Write(resources[offset:])
+	return out.Bytes(), changes, nil
+}
+
+// function returns the iptc with the keywords and the caption of the update, the text datasets
+// are written in utf-8 declared by the dataset 1:90
+func rewriteIim(iim []byte, update *modele.MetadataUpdate) ([]byte, []string, error) {
+	type dataset struct {
+		record, number byte
+		value          []byte
+	}
+	datasets := make([]dataset, 0)
+	declaredUtf8 := false
+	err := iimDatasets(iim, func(record byte, number byte, value []byte) {
+		if record == 1 && number == 90 {
+			declaredUtf8 = bytes.Equal(value, []byte(IPTC_UTF8))
+			return
+		}
+		datasets = append(datasets, dataset{record, number, value})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	replaced := make(map[byte][]string)
+	changes := make([]string, 0)
+	if update.Keywords != nil {
+		replaced[25] = metadataKeywords(update.Keywords)
+		changes = append(changes, IPTC_NAMESPACE+iptcDatasets[25]+"="+strings.Join(replaced[25], IPTC_SEPARATOR))
+	}
+	if update.Description != nil {
+		replaced[120] = []string{}
+		if description := strings.TrimSpace(*update.Description); description != "" {
+			replaced[120] = []string{description}
+		}
+		changes = append(changes, IPTC_NAMESPACE+iptcDatasets[120]+"="+strings.TrimSpace(*update.Description))
+	}
+	out := bytes.NewBuffer(nil)
+	for _, d := range datasets {
+		if d.record == 1 {
+			writeIimDataset(out, d.record, d.number, d.value)
+		}
+	}
+	writeIimDataset(out, 1, 90, []byte(IPTC_UTF8))
+	written := make(map[byte]bool)
+	write := func(number byte) {
+		for _, value := range replaced[number] {
+			writeIimDataset(out, 2, number, []byte(value))
+		}
+		written[number] = true
+	}
+	for _, d := range datasets {
+		switch {
+		case d.record == 1:
+		case d.record == 2 && replaced[d.number] != nil:
+			if !written[d.number] {
+				write(d.number)
+			}
+		case d.record == 2 && iptcDatasets[d.number] != "":
+			writeIimDataset(out, d.record, d.number, []byte(iptcString(d.value, declaredUtf8)))
+		default:
+			writeIimDataset(out, d.record, d.number, d.value)
+		}
+	}
+	numbers := make([]int, 0)
+	for number := range replaced {
+		if !written[number] {
+			numbers = append(numbers, int(number))
+		}
+	}
+	sort.Ints(numbers)
+	for _, number := range numbers {
+		write(byte(number))
+	}
+	return out.Bytes(), changes, nil
+}
+
+// function writes the dataset, the values longer than 32767 bytes are extended datasets
+func writeIimDataset(w io.Writer, record byte, number byte, value []byte) {
+	if len(value) <= 0x7fff {
+		w.Write([]byte{IPTC_MARKER, record, number, byte(len(value) >> 8), byte(len(value))})
+	} else {
+		header := []byte{IPTC_MARKER, record, number, 0x80, 4, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(header[5:], uint32(len(value)))
+		w.Write(header)
+	}
+	w.Write(value)
+}
+
+// function returns the keywords trimmed without duplicates (case insensitive)
+func metadataKeywords(values []string) []string {
+	keywords := make([]string, 0, len(values))
+	seen := make(map[string]bool)
+	for _, keyword := range values {
+		keyword = strings.TrimSpace(keyword)
+		if keyword == "" || seen[strings.ToLower(keyword)] {
+			continue
+		}
+		seen[strings.ToLower(keyword)] = true
+		keywords = append(keywords, keyword)
+	}
+	return keywords
+}
+
+// function returns the xmp properties written for the update, with an empty xml for the properties removed
+func xmpProperties(update *modele.MetadataUpdate) []xmpProperty {
+	properties := make([]xmpProperty, 0)
+	element := func(prefix string, local string, content string) string {
+		return "<" + prefix + ":" + local + ">" + content + "</" + prefix + ":" + local + ">"
+	}
+	text := func(value string) string {
+		b := bytes.NewBuffer(nil)
+		xml.EscapeText(b, []byte(value))
+		return b.String()
+	}
+	if update.Rating != nil {
+		value := strconv.Itoa(*update.Rating)
+		properties = append(properties, xmpProperty{xml.Name{Space: NAMESPACE_XMP, Local: "Rating"}, element("xmp", "Rating", value), value})
+	}
+	if update.Date != nil {
+		date, offset, _ := modele.ParseXmpDate(*update.Date)
+		value := date.Format("2006-01-02T15:04:05")
+		if offset {
+			value = date.Format("2006-01-02T15:04:05-07:00")
+		}
+		properties = append(properties,
+			xmpProperty{xml.Name{Space: NAMESPACE_EXIF, Local: "DateTimeOriginal"}, element("exif", "DateTimeOriginal", value), value},
+			xmpProperty{xml.Name{Space: NAMESPACE_PS, Local: "DateCreated"}, element("photoshop", "DateCreated", value), value})
+	}
+	if update.Latitude != nil && update.Longitude != nil {
+		latitude := xmpCoordinate(*update.Latitude, "N", "S")
+		longitude := xmpCoordinate(*update.Longitude, "E", "W")
+		properties = append(properties,
+			xmpProperty{xml.Name{Space: NAMESPACE_EXIF, Local: "GPSLatitude"}, element("exif", "GPSLatitude", latitude), latitude},
+			xmpProperty{xml.Name{Space: NAMESPACE_EXIF, Local: "GPSLongitude"}, element("exif", "GPSLongitude", longitude), longitude})
+	}
+	if update.Description != nil {
+		property := xmpProperty{name: xml.Name{Space: NAMESPACE_DC, Local: "description"}, value: strings.TrimSpace(*update.Description)}
+		if property.value != "" {
+			property.xml = element("dc", "description", "<rdf:Alt><rdf:li xml:lang=\"x-default\">"+text(property.value)+"</rdf:li></rdf:Alt>")
+		}
+		properties = append(properties, property)
+	}
+	if update.Keywords != nil {
+		keywords := metadataKeywords(update.Keywords)
+		property := xmpProperty{name: xml.Name{Space: NAMESPACE_DC, Local: "subject"}, value: strings.Join(keywords, IPTC_SEPARATOR)}
+		if len(keywords) > 0 {
+			items := ""
+			for _, keyword := range keywords {
+				items += "<rdf:li>" + text(keyword) + "</rdf:li>"
+			}
+			property.xml = element("dc", "subject", "<rdf:Bag>"+items+"</rdf:Bag>")
+		}
+		// the hierarchy of the keywords replaced is removed
+		properties = append(properties, property, xmpProperty{name: xml.Name{Space: NAMESPACE_LR, Local: "hierarchicalSubject"}})
+	}
+	return properties
+}
+
+// span of the packet removed by EditXmp
+type xmpSpan struct {
+	start, end int
+}
+
+// function returns the xmp packet with the properties of the update : the properties of the update
+// (elements or attributes of the rdf:Description) are removed and written in a new rdf:Description,
+// the other properties of the packet are kept as written
+func EditXmp(packet []byte, update *modele.MetadataUpdate) ([]byte, []string, error) {
+	packet = bytes.TrimRight(packet, "\x00")
+	properties := xmpProperties(update)
+	managed := make(map[xml.Name]bool)
+	for _, property := range properties {
+		managed[property.name] = true
+	}
+	isDescription := func(name xml.Name) bool { return name.Space == NAMESPACE_RDF && name.Local == "Description" }
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+	decoder.Strict = false
+	spans := make([]xmpSpan, 0)
+	stack := make([]xml.Name, 0)
+	// depth of the property removed, its end is the end of the span
+	removed, removedStart := -1, 0
+	rdfEnd := -1
+	for {
+		start := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Invalid xmp packet")
+		}
+		end := int(decoder.InputOffset())
+		switch t := token.(type) {
+		case xml.StartElement:
+			if removed < 0 && len(stack) > 0 && isDescription(stack[len(stack)-1]) && managed[t.Name] {
+				removed, removedStart = len(stack), start
+			}
+			if isDescription(t.Name) {
+				attributes, err := xmpAttributes(packet[start:end], t.Attr, managed)
+				if err != nil {
+					return nil, nil, err
+				}
+				for _, span := range attributes {
+					spans = append(spans, xmpSpan{start + span.start, start + span.end})
+				}
+			}
+			stack = append(stack, t.Name)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				continue
+			}
+			stack = stack[:len(stack)-1]
+			if removed == len(stack) {
+				spans = append(spans, xmpSpan{lineStart(packet, removedStart), end})
+				removed = -1
+			}
+			if t.Name.Space == NAMESPACE_RDF && t.Name.Local == "RDF" && rdfEnd < 0 {
+				rdfEnd = start
+			}
+		}
+	}
+	if rdfEnd < 0 {
+		return nil, nil, errors.New("Invalid xmp packet, rdf:RDF expected")
+	}
+
+	changes := make([]string, 0)
+	elements := make([]string, 0)
+	namespaces := make(map[string]bool)
+	for _, property := range properties {
+		if property.xml == "" {
+			continue
+		}
+		elements = append(elements, property.xml)
+		namespaces[property.name.Space] = true
+		changes = append(changes, xmpPrefixes[property.name.Space]+":"+property.name.Local+"="+property.value)
+	}
+	for _, property := range properties {
+		if property.xml == "" && property.value == "" && property.name.Space != NAMESPACE_LR {
+			changes = append(changes, xmpPrefixes[property.name.Space]+":"+property.name.Local+"=")
+		}
+	}
+	out := bytes.NewBuffer(nil)
+	previous := 0
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	for _, span := range spans {
+		if span.start < previous || span.start > rdfEnd {
+			continue
+		}
+		out.Write(packet[previous:span.start])
+		previous = span.end
+	}
+	out.Write(packet[previous:rdfEnd])
+	if len(elements) > 0 {
+		uris := make([]string, 0, len(namespaces))
+		for uri := range namespaces {
+			uris = append(uris, uri)
+		}
+		sort.Strings(uris)
+		out.WriteString(" <rdf:Description rdf:about=\"\" xmlns:rdf=\"" + NAMESPACE_RDF + "\"")
+		for _, uri := range uris {
+			out.WriteString("\n    xmlns:" + xmpPrefixes[uri] + "=\"" + uri + "\"")
+		}
+		out.WriteString(">\n")
+		for _, e := range elements {
+			out.WriteString("   " + e + "\n")
+		}
+		out.WriteString("  </rdf:Description>\n ")
+	}
+	out.Write(packet[rdfEnd:])
+	return out.Bytes(), changes, nil
+}
+
+// function returns the position of the start of the line of the element at start if only spaces precede it
+func lineStart(packet []byte, start int) int {
+	i := start
+	for i > 0 && (packet[i-1] == ' ' || packet[i-1] == '\t') {
+		i--
+	}
+	if i > 0 && packet[i-1] == '\n' {
+		i--
+		if i > 0 && packet[i-1] == '\r' {
+			i--
+		}
+		return i
+	}
+	return start
+}
+
+// function returns the spans of the managed attributes of the start tag with their preceding spaces,
+// the attributes of the tag are read in the order of the decoded attributes
+func xmpAttributes(tag []byte, attributes []xml.Attr, managed map[xml.Name]bool) ([]xmpSpan, error) {
+	spans := make([]xmpSpan, 0)
+	isSpace := func(c byte) bool { return c == ' ' || c == '\t' || c == '\r' || c == '\n' }
+	// the name of the element
+	i := 1
+	for i < len(tag) && !isSpace(tag[i]) && tag[i] != '/' && tag[i] != '>' {
+		i++
+	}
+	for index := 0; ; index++ {
+		start := i
+		for i < len(tag) && isSpace(tag[i]) {
+			i++
+		}
+		if i >= len(tag) || tag[i] == '/' || tag[i] == '>' {
+			if index != len(attributes) {
+				return nil, errors.New("Invalid xmp packet, unexpected attributes")
+			}
+			return spans, nil
+		}
+		for i < len(tag) && !isSpace(tag[i]) && tag[i] != '=' && tag[i] != '/' && tag[i] != '>' {
+			i++
+		}
+		j := i
+		for j < len(tag) && isSpace(tag[j]) {
+			j++
+		}
+		if j < len(tag) && tag[j] == '=' {
+			j++
+			for j < len(tag) && isSpace(tag[j]) {
+				j++
+			}
+			if j >= len(tag) || (tag[j] != '"' && tag[j] != '\'') {
+				return nil, errors.New("Invalid xmp packet, quoted attribute expected")
+			}
+			closing := bytes.IndexByte(tag[j+1:], tag[j])
+			if closing < 0 {
+				return nil, errors.New("Invalid xmp packet, unterminated attribute")
+			}
+			i = j + 1 + closing + 1
+		}
+		if index >= len(attributes) {
+			return nil, errors.New("Invalid xmp packet, unexpected attributes")
+		}
+		if managed[attributes[index].Name] {
+			spans = append(spans, xmpSpan{start, i})
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package exifhandler
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jeromelesaux/photo/configurationexif"
+	"github.com/jeromelesaux/photo/modele"
+)
+
+// function returns an update of all the metadata of the photo
+func testMetadataUpdate(md5sum string) *modele.MetadataUpdate {
+	date, latitude, longitude, rating, description := "2015-08-01T18:30:00+01:00", -33.8568, 151.2153, 5, "Opera & harbour"
+	return &modele.MetadataUpdate{
+		Md5Sum:      md5sum,
+		Date:        &date,
+		Latitude:    &latitude,
+		Longitude:   &longitude,
+		Keywords:    []string{"Sydney", " Opera ", "sydney"},
+		Rating:      &rating,
+		Description: &description,
+	}
+}
+
+func TestEditXmp(t *testing.T) {
+	update := testMetadataUpdate("x")
+	packet, changes, err := EditXmp([]byte(testLightroomXmp), update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xmp, err := DecodeXmp(packet)
+	if err != nil {
+		t.Fatalf("expected a valid packet, received %v\n%s", err, packet)
+	}
+	if xmp.Rating != 5 || xmp.Label != "Red" || xmp.Description != "Opera & harbour" || xmp.Date != "2015-08-01T18:30:00+01:00" {
+		t.Fatalf("expected the rating, the description and the date of the update and the label kept, received %v", xmp)
+	}
+	if !reflect.DeepEqual(xmp.Keywords, []string{"Sydney", "Opera"}) || len(xmp.HierarchicalKeywords) != 0 {
+		t.Fatalf("expected the keywords of the update only, received %v %v", xmp.Keywords, xmp.HierarchicalKeywords)
+	}
+	if xmp.Latitude > -33.8567 || xmp.Latitude < -33.8569 || xmp.Longitude < 151.2152 || xmp.Longitude > 151.2154 {
+		t.Fatalf("expected the coordinates of Sydney, received %f %f", xmp.Latitude, xmp.Longitude)
+	}
+	if len(changes) != 7 {
+		t.Fatalf("expected the 7 properties written, received %v", changes)
+	}
+	if !strings.Contains(string(packet), "xmp:Label=\"Red\"") || strings.Contains(string(packet), "Grandma") {
+		t.Fatalf("expected the other properties kept as written, received\n%s", packet)
+	}
+
+	// the description and the keywords removed
+	empty := ""
+	packet, _, err = EditXmp(packet, &modele.MetadataUpdate{Md5Sum: "x", Description: &empty, Keywords: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xmp, err := DecodeXmp(packet); err != nil || xmp.Description != "" || len(xmp.Keywords) != 0 || xmp.Rating != 5 {
+		t.Fatalf("expected the description and the keywords removed, received %v %v", xmp, err)
+	}
+
+	// packet created for a photo without xmp
+	packet, _, err = EditXmp([]byte(emptyXmpPacket), update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xmp, err := DecodeXmp(packet); err != nil || xmp.Rating != 5 || len(xmp.Keywords) != 2 {
+		t.Fatalf("expected the properties of the update, received %v %v", xmp, err)
+	}
+	if _, _, err := EditXmp([]byte("<x:xmpmeta>"), update); err == nil {
+		t.Fatal("expected an error for a packet without rdf:RDF")
+	}
+}
+
+func TestRewriteJpeg(t *testing.T) {
+	iim := testIim()
+	resources := append(testPhotoshopResource(PHOTOSHOP_IPTC_DIGEST_RESOURCE, make([]byte, 16)), testPhotoshopResource(PHOTOSHOP_IPTC_RESOURCE, iim)...)
+	segment := append([]byte(JPEG_PHOTOSHOP_PREFIX), resources...)
+	jpeg := testJpeg(testTiff(binary.BigEndian, 42))
+	// the iptc follows the exif
+	exifEnd := len(jpeg) - 6
+	content := append(append([]byte{}, jpeg[:exifEnd]...), 0xff, 0xed, byte((len(segment)+2)>>8), byte(len(segment)+2))
+	content = append(append(content, segment...), jpeg[exifEnd:]...)
+
+	written, changes, err := RewriteJpeg(content, testMetadataUpdate("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := DecodeExif(bytes.NewReader(written), int64(len(written)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	date, ok := data.Time()
+	if expected := time.Date(2015, 8, 1, 17, 30, 0, 0, time.UTC); !ok || !date.Equal(expected) {
+		t.Fatalf("expected the date %v, received %v", expected, date)
+	}
+	latitude, longitude, ok := data.GPS()
+	if !ok || latitude > -33.8567 || latitude < -33.8569 || longitude < 151.2152 || longitude > 151.2154 {
+		t.Fatalf("expected the gps coordinates of Sydney, received %f %f", latitude, longitude)
+	}
+	iptc, err := DecodeIptc(bytes.NewReader(written), int64(len(written)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(iptc.Values("Keywords"), []string{"Sydney", "Opera"}) || iptc.Values("Caption-Abstract")[0] != "Opera & harbour" || iptc.Values("City")[0] != "Valencia" {
+		t.Fatalf("expected the keywords and the caption of the update and the city kept, received %v", iptc.Tags())
+	}
+	found, err := embeddedXmp(bytes.NewReader(written), int64(len(written)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xmp, err := DecodeXmp(found); err != nil || xmp.Rating != 5 {
+		t.Fatalf("expected the xmp added, received %v %v", xmp, err)
+	}
+	if bytes.Contains(written, make([]byte, 16)) {
+		t.Fatal("expected the digest of the previous iptc removed")
+	}
+	if !bytes.HasSuffix(written, jpeg[exifEnd:]) || len(changes) < 13 {
+		t.Fatalf("expected the image data kept and the changes of the exif, the iptc and the xmp, received %v", changes)
+	}
+	if _, _, err := RewriteJpeg(jpeg[:20], testMetadataUpdate("x")); err == nil {
+		t.Fatal("expected an error for a truncated jpeg")
+	}
+
+	// resource announcing more bytes than the segment has
+	truncated := testPhotoshopResource(PHOTOSHOP_IPTC_RESOURCE, make([]byte, 4))
+	binary.BigEndian.PutUint32(truncated[len(truncated)-8:], 1000)
+	if _, _, err := rewritePhotoshop(append(testPhotoshopResource(PHOTOSHOP_IPTC_RESOURCE, iim), truncated...), testMetadataUpdate("x")); err == nil {
+		t.Fatal("expected an error for a truncated photoshop resource")
+	}
+}
+
+func TestWriteMetadata(t *testing.T) {
+	dir := t.TempDir()
+	previousIndex := ScanIndexFile
+	ScanIndexFile = filepath.Join(dir, "scan_index.json")
+	defer func() { ScanIndexFile = previousIndex }()
+
+	conf := configurationexif.FileExtension{Extensions: []string{".jpg", ".cr2"}, ScanRoots: []string{dir}, MetadataBackupDirectory: filepath.Join(dir, "backup")}
+	jpeg := testJpeg(testTiff(binary.LittleEndian, 42))
+	jpegPath := filepath.Join(dir, "IMG_0001.jpg")
+	rawPath := filepath.Join(dir, "IMG_0001.cr2")
+	raw := testTiff(binary.LittleEndian, 42)
+	for path, content := range map[string][]byte{jpegPath: jpeg, rawPath: raw} {
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	jpegMd5 := fmt.Sprintf("%x", md5.Sum(jpeg))
+	index := &ScanIndex{Files: map[string]*ScanIndexEntry{jpegPath: {Md5Sum: jpegMd5, Size: int64(len(jpeg))}}}
+	if err := index.Save(ScanIndexFile); err != nil {
+		t.Fatal(err)
+	}
+
+	update := testMetadataUpdate(jpegMd5)
+	update.Filepath, update.DryRun = jpegPath, true
+	if _, err := WriteMetadata(update, configurationexif.FileExtension{Extensions: conf.Extensions, ScanRoots: []string{t.TempDir()}, MetadataBackupDirectory: conf.MetadataBackupDirectory}); err == nil {
+		t.Fatal("expected an error for a photo outside the scan roots")
+	}
+	if _, err := WriteMetadata(update, configurationexif.FileExtension{Extensions: conf.Extensions, ScanRoots: conf.ScanRoots, MetadataBackupDirectory: "backup"}); err == nil {
+		t.Fatal("expected an error for a relative backup directory")
+	}
+	result, err := WriteMetadata(update, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := ioutil.ReadFile(jpegPath); !bytes.Equal(content, jpeg) || result.NewMd5Sum == jpegMd5 || result.Backup != "" {
+		t.Fatalf("expected the new md5sum without writing the photo in dry run, received %v", result)
+	}
+
+	update.DryRun = false
+	written, err := WriteMetadata(update, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadFile(jpegPath)
+	if written.NewMd5Sum != result.NewMd5Sum || written.NewMd5Sum != fmt.Sprintf("%x", md5.Sum(content)) || written.Sidecar {
+		t.Fatalf("expected the photo written with the md5sum of the dry run, received %v", written)
+	}
+	if backup, err := ioutil.ReadFile(written.Backup); err != nil || !bytes.Equal(backup, jpeg) {
+		t.Fatalf("expected the original bytes in the backup, received %v", err)
+	}
+	if entry := LoadScanIndex(ScanIndexFile).Files[jpegPath]; entry == nil || entry.Md5Sum != written.NewMd5Sum {
+		t.Fatalf("expected the new md5sum in the scan index, received %v", entry)
+	}
+	if _, err := WriteMetadata(update, conf); err == nil {
+		t.Fatal("expected an error for a photo modified since its scan")
+	}
+
+	// the raw gets a sidecar, its md5sum is unchanged
+	rawMd5 := fmt.Sprintf("%x", md5.Sum(raw))
+	update = testMetadataUpdate(rawMd5)
+	update.Filepath = rawPath
+	result, err = WriteMetadata(update, conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Sidecar || result.NewMd5Sum != rawMd5 || result.Written != rawPath+XMP_SIDECAR_EXTENSION || result.Backup != "" {
+		t.Fatalf("expected a new sidecar of the raw, received %v", result)
+	}
+	xmp, err := GetXmpInformations(rawPath)
+	if err != nil || xmp.Rating != 5 || xmp.Sidecar == "" {
+		t.Fatalf("expected the rating of the sidecar, received %v %v", xmp, err)
+	}
+	rating := 1
+	result, err = WriteMetadata(&modele.MetadataUpdate{Md5Sum: rawMd5, Filepath: rawPath, Rating: &rating}, conf)
+	if err != nil || result.Backup == "" {
+		t.Fatalf("expected the backup of the previous sidecar, received %v %v", result, err)
+	}
+	if xmp, err := GetXmpInformations(rawPath); err != nil || xmp.Rating != 1 || len(xmp.Keywords) != 2 {
+		t.Fatalf("expected the rating replaced and the keywords kept, received %v %v", xmp, err)
+	}
+	if _, err := os.Stat(rawPath + XMP_SIDECAR_EXTENSION + ".tmp"); !os.IsNotExist(err) {
+		t.Fatal("expected the temporary file renamed")
+	}
+	if _, err := WriteMetadata(&modele.MetadataUpdate{Md5Sum: rawMd5, Filepath: ScanIndexFile, Rating: &rating}, conf); err == nil {
+		t.Fatal("expected an error for a file which is not a photo")
+	}
+}
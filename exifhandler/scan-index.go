@@ -0,0 +1,248 @@
+package exifhandler
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jeromelesaux/photo/configurationexif"
+	"github.com/jeromelesaux/photo/hash"
+	"github.com/jeromelesaux/photo/modele"
+	logger "github.com/sirupsen/logrus"
+)
+
+// file storing the files found by the previous scans of the slave
+var ScanIndexFile = "scan_index.json"
+
+var scanIndexLock sync.Mutex
+
+// state of a file found by a scan, a file with the same size and modification time and the same xmp sidecar
+// is not read again
+type ScanIndexEntry struct {
+	Md5Sum         string    `json:"md5sum"`
+	Size           int64     `json:"size"`
+	ModTime        time.Time `json:"modtime"`
+	SidecarSize    int64     `json:"sidecar_size,omitempty"`
+	SidecarModTime time.Time `json:"sidecar_modtime,omitempty"`
+}
+
+// function returns true if the file and its sidecar are unchanged since the entry
+func (e *ScanIndexEntry) unchanged(info os.FileInfo, sidecar *ScanIndexEntry) bool {
+	return e.Size == info.Size() && e.ModTime.Equal(info.ModTime()) &&
+		e.SidecarSize == sidecar.SidecarSize && e.SidecarModTime.Equal(sidecar.SidecarModTime)
+}
+
+// function returns the entry of the xmp sidecar of the photo (SidecarSize and SidecarModTime), empty without sidecar
+func sidecarEntry(path string) *ScanIndexEntry {
+	entry := &ScanIndexEntry{}
+	if sidecar := XmpSidecar(path); sidecar != "" {
+		if info, err := os.Stat(sidecar); err == nil {
+			entry.SidecarSize, entry.SidecarModTime = info.Size(), info.ModTime()
+		}
+	}
+	return entry
+}
+
+// files found by the previous scans indexed by their absolute path
+type ScanIndex struct {
+	Files map[string]*ScanIndexEntry `json:"files"`
+}
+
+// file found by the current scan which is new or modified since the previous scan
+type scannedFile struct {
+	path  string
+	entry *ScanIndexEntry
+	err   error
+}
+
+// function loads the scan index from the file path, an empty index is returned if the file does not exist
+func LoadScanIndex(indexFile string) *ScanIndex {
+	index := &ScanIndex{Files: make(map[string]*ScanIndexEntry)}
+	f, err := os.Open(indexFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("Error while opening scan index " + indexFile + " with error " + err.Error())
+		}
+		return index
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(index); err != nil {
+		logger.Error("Error while reading scan index " + indexFile + " with error " + err.Error())
+		return &ScanIndex{Files: make(map[string]*ScanIndexEntry)}
+	}
+	if index.Files == nil {
+		index.Files = make(map[string]*ScanIndexEntry)
+	}
+	return index
+}
+
+// function saves the scan index in the file path
+func (s *ScanIndex) Save(indexFile string) error {
+	f, err := os.Create(indexFile)
+	if err != nil {
+		logger.Error("Error while saving scan index with error " + err.Error())
+		return err
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(s); err != nil {
+		logger.Error("Error while saving scan index with error " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// function scans the local directory and returns only the photos added since the previous scan,
+// the photos found at a new path (same md5sum) and the photos deleted.
+// unchanged files (same size and modification time) are neither hashed nor read.
+// full forces to read all the files again.
+func ScanDirectory(directorypath string, conf configurationexif.FileExtension, full bool) (*modele.PhotoResponse, error) {
+	scanIndexLock.Lock()
+	defer scanIndexLock.Unlock()
+	index := LoadScanIndex(ScanIndexFile)
+	response, err := index.Scan(directorypath, conf, full)
+	if saveErr := index.Save(ScanIndexFile); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return response, err
+}
+
+// function scans the directory and updates the index (see ScanDirectory)
+func (s *ScanIndex) Scan(directorypath string, conf configurationexif.FileExtension, full bool) (*modele.PhotoResponse, error) {
+	response := &modele.PhotoResponse{
+		Version: modele.VERSION,
+		Photos:  make([]*modele.PhotoInformations, 0),
+		Moved:   make([]*modele.PhotoMove, 0),
+		Deleted: make([]*modele.PhotoInformations, 0),
+	}
+	root, err := filepath.Abs(directorypath)
+	if err != nil {
+		return response, err
+	}
+
+	seen := make(map[string]bool)
+	scanned := make([]*scannedFile, 0)
+	// md5sums not found anymore at their previous path
+	missing := make(map[string]string)
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			logger.Error(err.Error())
+			return nil
+		}
+		if info.IsDir() || !hasExtension(filepath.Base(path), conf) {
+			return nil
+		}
+		seen[path] = true
+		previous := s.Files[path]
+		sidecar := sidecarEntry(path)
+		if !full && previous != nil && previous.unchanged(info, sidecar) {
+			return nil
+		}
+		sum, err := hash.Md5Sum(path)
+		file := &scannedFile{path: path, entry: &ScanIndexEntry{Md5Sum: sum, Size: info.Size(), ModTime: info.ModTime(),
+			SidecarSize: sidecar.SidecarSize, SidecarModTime: sidecar.SidecarModTime}, err: err}
+		if err != nil {
+			scanned = append(scanned, file)
+			return nil
+		}
+		if !full && previous != nil && previous.Md5Sum == sum && previous.SidecarSize == sidecar.SidecarSize &&
+			previous.SidecarModTime.Equal(sidecar.SidecarModTime) {
+			// only the modification time has changed
+			s.Files[path] = file.entry
+			return nil
+		}
+		if previous != nil && previous.Md5Sum != sum {
+			// content replaced at the same path
+			missing[previous.Md5Sum] = path
+			delete(s.Files, path)
+		}
+		scanned = append(scanned, file)
+		return nil
+	})
+
+	// files of the scanned directory not found anymore
+	for path, entry := range s.Files {
+		if !seen[path] && (path == root || strings.HasPrefix(path, root+string(filepath.Separator))) {
+			missing[entry.Md5Sum] = path
+			delete(s.Files, path)
+		}
+	}
+
+	for _, file := range scanned {
+		if previousPath, ok := missing[file.entry.Md5Sum]; ok && file.err == nil {
+			delete(missing, file.entry.Md5Sum)
+			response.Moved = append(response.Moved, &modele.PhotoMove{
+				Md5Sum:           file.entry.Md5Sum,
+				Filename:         filepath.Base(file.path),
+				Filepath:         file.path,
+				PreviousFilepath: previousPath})
+			s.Files[file.path] = file.entry
+			continue
+		}
+		logger.Info("Found file " + file.path)
+		tags, _ := photoInformations(file.path, file.entry.Md5Sum, file.err)
+		if tags.Filename != "" {
+			response.Photos = append(response.Photos, tags)
+		}
+		if file.err == nil {
+			s.Files[file.path] = file.entry
+		}
+	}
+
+	paths := s.paths()
+	for md5sum, path := range missing {
+		if copyPath := paths[md5sum]; copyPath != "" {
+			// another copy of the photo is still on the slave
+			response.Moved = append(response.Moved, &modele.PhotoMove{
+				Md5Sum:           md5sum,
+				Filename:         filepath.Base(copyPath),
+				Filepath:         copyPath,
+				PreviousFilepath: path})
+			continue
+		}
+		response.Deleted = append(response.Deleted, &modele.PhotoInformations{Md5Sum: md5sum, Filename: filepath.Base(path), Filepath: path})
+	}
+	logger.Infof("Scan of %s found %d new photos, %d moved, %d deleted", root, len(response.Photos), len(response.Moved), len(response.Deleted))
+	return response, err
+}
+
+// function returns a path of each md5sum of the index
+func (s *ScanIndex) paths() map[string]string {
+	paths := make(map[string]string)
+	for path, entry := range s.Files {
+		paths[entry.Md5Sum] = path
+	}
+	return paths
+}
+
+func hasExtension(filename string, conf configurationexif.FileExtension) bool {
+	for _, d := range conf.Extensions {
+		if strings.HasSuffix(filename, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// function records the new md5sum of a file rewritten by the slave in the scan index,
+// the next scan does not report the rewritten file as a new photo. the caller holds scanIndexLock
+func recordScanIndex(path string, md5sum string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	index := LoadScanIndex(ScanIndexFile)
+	if _, ok := index.Files[path]; !ok {
+		return nil
+	}
+	entry := sidecarEntry(path)
+	entry.Md5Sum, entry.Size, entry.ModTime = md5sum, info.Size(), info.ModTime()
+	index.Files[path] = entry
+	return index.Save(ScanIndexFile)
+}
@@ -0,0 +1,81 @@
+package exifhandler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jeromelesaux/photo/configurationexif"
+)
+
+func writeScanFile(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanIndex(t *testing.T) {
+	dir := t.TempDir()
+	conf := configurationexif.FileExtension{Extensions: []string{".jpg"}}
+	writeScanFile(t, filepath.Join(dir, "a.jpg"), "photo a")
+	writeScanFile(t, filepath.Join(dir, "b.jpg"), "photo b")
+	writeScanFile(t, filepath.Join(dir, "notes.txt"), "not a photo")
+	index := LoadScanIndex(filepath.Join(dir, "missing.json"))
+
+	response, _ := index.Scan(dir, conf, false)
+	if len(response.Photos) != 2 || len(response.Moved) != 0 || len(response.Deleted) != 0 {
+		t.Fatalf("first scan must find 2 photos, received %d photos", len(response.Photos))
+	}
+
+	response, _ = index.Scan(dir, conf, false)
+	if len(response.Photos) != 0 || len(response.Moved) != 0 || len(response.Deleted) != 0 {
+		t.Fatal("second scan must not find anything")
+	}
+
+	response, _ = index.Scan(dir, conf, true)
+	if len(response.Photos) != 2 {
+		t.Fatal("full scan must read all the photos again")
+	}
+
+	// sidecar added then modified, the photo is read again with its xmp
+	sidecar := filepath.Join(dir, "a.xmp")
+	writeScanFile(t, sidecar, testLightroomXmp)
+	response, _ = index.Scan(dir, conf, false)
+	if len(response.Photos) != 1 || response.Photos[0].Filename != "a.jpg" || response.Photos[0].Xmp == nil {
+		t.Fatalf("expected a.jpg read again with its new sidecar, received %v", response.Photos)
+	}
+	if response, _ = index.Scan(dir, conf, false); len(response.Photos) != 0 {
+		t.Fatal("unchanged sidecar must not be read again")
+	}
+	writeScanFile(t, sidecar, testLightroomXmp+"\n")
+	if response, _ = index.Scan(dir, conf, false); len(response.Photos) != 1 || len(response.Moved) != 0 {
+		t.Fatalf("expected a.jpg read again with its modified sidecar, received %v", response.Photos)
+	}
+	os.Remove(sidecar)
+
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "a.jpg"), filepath.Join(dir, "sub", "a.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(dir, "b.jpg"))
+	response, _ = index.Scan(dir, conf, false)
+	if len(response.Photos) != 0 {
+		t.Fatal("moved photo must not be read again")
+	}
+	if len(response.Moved) != 1 || response.Moved[0].Filepath != filepath.Join(dir, "sub", "a.jpg") || response.Moved[0].PreviousFilepath != filepath.Join(dir, "a.jpg") {
+		t.Fatalf("expected a.jpg moved to sub, received %v", response.Moved)
+	}
+	if len(response.Deleted) != 1 || response.Deleted[0].Filepath != filepath.Join(dir, "b.jpg") {
+		t.Fatalf("expected b.jpg deleted, received %v", response.Deleted)
+	}
+
+	indexFile := filepath.Join(dir, "index.json")
+	if err := index.Save(indexFile); err != nil {
+		t.Fatal(err)
+	}
+	if loaded := LoadScanIndex(indexFile); len(loaded.Files) != 1 {
+		t.Fatalf("expected 1 file in the saved index, received %d", len(loaded.Files))
+	}
+}
@@ -0,0 +1,313 @@
+package exifhandler
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jeromelesaux/photo/modele"
+	"github.com/pkg/errors"
+)
+
+const (
+	// prefix of the xmp APP1 segment of the jpeg
+	JPEG_XMP_PREFIX = "http://ns.adobe.com/xap/1.0/\x00"
+	// keyword of the iTXt chunk of the xmp in the png
+	PNG_XMP_KEYWORD = "XML:com.adobe.xmp\x00"
+	// extensions of the sidecars
+	XMP_SIDECAR_EXTENSION = ".xmp"
+)
+
+// namespaces of the xmp properties read
+const (
+	NAMESPACE_RDF  = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	NAMESPACE_XMP  = "http://ns.adobe.com/xap/1.0/"
+	NAMESPACE_DC   = "http://purl.org/dc/elements/1.1/"
+	NAMESPACE_LR   = "http://ns.adobe.com/lightroom/1.0/"
+	NAMESPACE_EXIF = "http://ns.adobe.com/exif/1.0/"
+	NAMESPACE_PS   = "http://ns.adobe.com/photoshop/1.0/"
+)
+
+var XmpNotFound = errors.New("No xmp data found.")
+
+// function returns the xmp of the photo : the packet embedded in the photo completed by its sidecar
+// (photo.xmp or photo.XMP as lightroom, photo.ext.xmp as darktable), the sidecar values are kept
+// when both set a property. XmpNotFound is returned if the photo has neither.
+func GetXmpInformations(filePath string) (*modele.XmpInformations, error) {
+	var xmp *modele.XmpInformations
+	if packet, err := ReadEmbeddedXmp(filePath); err == nil {
+		if xmp, err = DecodeXmp(packet); err != nil {
+			return nil, err
+		}
+	}
+	if sidecar := XmpSidecar(filePath); sidecar != "" {
+		packet, err := readSidecar(sidecar)
+		if err != nil {
+			return xmp, err
+		}
+		sidecarXmp, err := DecodeXmp(packet)
+		if err != nil {
+			return xmp, err
+		}
+		sidecarXmp.Sidecar = sidecar
+		xmp = mergeXmp(xmp, sidecarXmp)
+	}
+	if xmp == nil {
+		return nil, XmpNotFound
+	}
+	return xmp, nil
+}
+
+// function returns the path of the sidecar of the photo, empty if the photo has none
+func XmpSidecar(filePath string) string {
+	base := strings.TrimSuffix(filePath, filepath.Ext(filePath))
+	for _, sidecar := range []string{
+		base + XMP_SIDECAR_EXTENSION,
+		base + strings.ToUpper(XMP_SIDECAR_EXTENSION),
+		filePath + XMP_SIDECAR_EXTENSION,
+		filePath + strings.ToUpper(XMP_SIDECAR_EXTENSION),
+	} {
+		if info, err := os.Stat(sidecar); err == nil && !info.IsDir() {
+			return sidecar
+		}
+	}
+	return ""
+}
+
+func readSidecar(sidecar string) ([]byte, error) {
+	f, err := os.Open(sidecar)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	packet, err := ioutil.ReadAll(io.LimitReader(f, MAX_TAG_SIZE+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(packet) > MAX_TAG_SIZE {
+		return nil, errors.Errorf("The sidecar %s is too large", sidecar)
+	}
+	return packet, nil
+}
+
+// function returns the xmp packet embedded in the photo : jpeg (APP1 segment), png (iTXt chunk)
+// or tiff based raw files (IFD0 tag)
+func ReadEmbeddedXmp(filePath string) ([]byte, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return embeddedXmp(f, info.Size())
+}
+
+func embeddedXmp(r io.ReaderAt, size int64) ([]byte, error) {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, XmpNotFound
+	}
+	switch {
+	case header[0] == 0xff && header[1] == 0xd8:
+		if packet, err := jpegSegment(r, size, JPEG_APP1, JPEG_XMP_PREFIX); err == nil {
+			return packet, nil
+		}
+	case bytes.Equal(header, []byte("\x89PNG\r\n\x1a\n")):
+		content, err := pngChunk(r, size, "iTXt", PNG_XMP_KEYWORD)
+		// compression flag and method, then the language tag and the translated keyword
+		if err == nil && len(content) > 2 && content[0] == 0 {
+			parts := bytes.SplitN(content[2:], []byte{0}, 3)
+			if len(parts) == 3 {
+				return parts[2], nil
+			}
+		}
+	case string(header[:2]) == "II" || string(header[:2]) == "MM":
+		t, ifd0, err := newTiffReader(r, size)
+		if err != nil {
+			return nil, XmpNotFound
+		}
+		entries, err := t.entries(ifd0)
+		if err != nil {
+			return nil, XmpNotFound
+		}
+		for _, entry := range entries {
+			if entry.tag == XMP_PACKET_TAG {
+				return t.raw(entry)
+			}
+		}
+	}
+	return nil, XmpNotFound
+}
+
+// xml element open while decoding the packet, the text and the rdf:li values of a property
+type xmpElement struct {
+	name   xml.Name
+	text   strings.Builder
+	values []string
+}
+
+// function decodes the properties of the xmp packet read by photo : rating, label, keywords,
+// description, title, gps coordinates and capture date
+func DecodeXmp(packet []byte) (*modele.XmpInformations, error) {
+	properties := make(map[xml.Name][]string)
+	set := func(name xml.Name, values []string) {
+		if _, ok := properties[name]; !ok && len(values) > 0 {
+			properties[name] = values
+		}
+	}
+	// the packets of the tiff tags are padded with null bytes
+	decoder := xml.NewDecoder(bytes.NewReader(bytes.TrimRight(packet, "\x00")))
+	decoder.Strict = false
+	stack := make([]*xmpElement, 0)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid xmp packet")
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space == NAMESPACE_RDF && t.Name.Local == "Description" {
+				// simple properties written as attributes
+				for _, attr := range t.Attr {
+					set(attr.Name, []string{strings.TrimSpace(attr.Value)})
+				}
+			}
+			stack = append(stack, &xmpElement{name: t.Name})
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		case xml.EndElement:
+			if len(stack) == 0 {
+				continue
+			}
+			e := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			text := strings.TrimSpace(e.text.String())
+			switch {
+			case e.name.Space == NAMESPACE_RDF && e.name.Local == "li":
+				// value of the bag, sequence or alternative of the nearest property
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i].name.Space != NAMESPACE_RDF {
+						if text != "" {
+							stack[i].values = append(stack[i].values, text)
+						}
+						break
+					}
+				}
+			case e.name.Space != NAMESPACE_RDF:
+				if len(e.values) == 0 && text != "" {
+					e.values = []string{text}
+				}
+				set(e.name, e.values)
+			}
+		}
+	}
+
+	xmp := &modele.XmpInformations{
+		Label:                first(properties[xml.Name{Space: NAMESPACE_XMP, Local: "Label"}]),
+		Keywords:             properties[xml.Name{Space: NAMESPACE_DC, Local: "subject"}],
+		HierarchicalKeywords: properties[xml.Name{Space: NAMESPACE_LR, Local: "hierarchicalSubject"}],
+		Description:          first(properties[xml.Name{Space: NAMESPACE_DC, Local: "description"}]),
+		Title:                first(properties[xml.Name{Space: NAMESPACE_DC, Local: "title"}]),
+		Date:                 first(properties[xml.Name{Space: NAMESPACE_EXIF, Local: "DateTimeOriginal"}]),
+	}
+	if xmp.Date == "" {
+		xmp.Date = first(properties[xml.Name{Space: NAMESPACE_PS, Local: "DateCreated"}])
+	}
+	if rating, err := strconv.ParseFloat(first(properties[xml.Name{Space: NAMESPACE_XMP, Local: "Rating"}]), 64); err == nil {
+		xmp.Rating = int(rating)
+	}
+	latitude, latitudeErr := XmpCoordinate(first(properties[xml.Name{Space: NAMESPACE_EXIF, Local: "GPSLatitude"}]))
+	longitude, longitudeErr := XmpCoordinate(first(properties[xml.Name{Space: NAMESPACE_EXIF, Local: "GPSLongitude"}]))
+	if latitudeErr == nil && longitudeErr == nil {
+		xmp.Latitude, xmp.Longitude = latitude, longitude
+	}
+	return xmp, nil
+}
+
+// function returns the first value of the property, the default language of an alternative is written first
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// function returns the decimal degrees of the xmp coordinate "DDD,MM,SSk" or "DDD,MM.mmk",
+// k is N, S, E or W
+func XmpCoordinate(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 {
+		return 0, errors.Errorf("Invalid xmp coordinate %s", value)
+	}
+	reference := strings.ToUpper(value[len(value)-1:])
+	parts := strings.Split(value[:len(value)-1], ",")
+	if len(parts) < 2 || len(parts) > 3 || !strings.Contains("NSEW", reference) {
+		return 0, errors.Errorf("Invalid xmp coordinate %s", value)
+	}
+	coordinate := 0.
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return 0, errors.Errorf("Invalid xmp coordinate %s", value)
+		}
+		switch i {
+		case 0:
+			coordinate += v
+		case 1:
+			coordinate += v / 60
+		case 2:
+			coordinate += v / 3600
+		}
+	}
+	if reference == "S" || reference == "W" {
+		coordinate = -coordinate
+	}
+	return coordinate, nil
+}
+
+// function returns the xmp of the photo, the properties of the sidecar replace the embedded ones
+func mergeXmp(embedded *modele.XmpInformations, sidecar *modele.XmpInformations) *modele.XmpInformations {
+	if embedded == nil {
+		return sidecar
+	}
+	merged := *embedded
+	merged.Sidecar = sidecar.Sidecar
+	if sidecar.Rating != 0 {
+		merged.Rating = sidecar.Rating
+	}
+	if sidecar.Label != "" {
+		merged.Label = sidecar.Label
+	}
+	if len(sidecar.Keywords) > 0 {
+		merged.Keywords = sidecar.Keywords
+	}
+	if len(sidecar.HierarchicalKeywords) > 0 {
+		merged.HierarchicalKeywords = sidecar.HierarchicalKeywords
+	}
+	if sidecar.Description != "" {
+		merged.Description = sidecar.Description
+	}
+	if sidecar.Title != "" {
+		merged.Title = sidecar.Title
+	}
+	if sidecar.Latitude != 0 || sidecar.Longitude != 0 {
+		merged.Latitude, merged.Longitude = sidecar.Latitude, sidecar.Longitude
+	}
+	if sidecar.Date != "" {
+		merged.Date = sidecar.Date
+	}
+	return &merged
+}
@@ -0,0 +1,132 @@
+package exifhandler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// xmp packet written by lightroom, simple properties as attributes
+const testLightroomXmp = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:exif="http://ns.adobe.com/exif/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:lr="http://ns.adobe.com/lightroom/1.0/"
+   xmp:Rating="4"
+   xmp:Label="Red"
+   exif:GPSLatitude="38,54.59N"
+   exif:GPSLongitude="0,22.5W">
+   <dc:description>
+    <rdf:Alt>
+     <rdf:li xml:lang="x-default">Grandma at the beach</rdf:li>
+    </rdf:Alt>
+   </dc:description>
+   <dc:subject>
+    <rdf:Bag>
+     <rdf:li>Beach</rdf:li>
+     <rdf:li>Grandma</rdf:li>
+    </rdf:Bag>
+   </dc:subject>
+   <lr:hierarchicalSubject>
+    <rdf:Bag>
+     <rdf:li>Places|Spain|Valencia</rdf:li>
+    </rdf:Bag>
+   </lr:hierarchicalSubject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+// xmp packet written by darktable, simple properties as elements
+const testDarktableXmp = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+   <xmp:Rating>2</xmp:Rating>
+   <dc:subject><rdf:Seq><rdf:li>darktable|format|cr2</rdf:li></rdf:Seq></dc:subject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+func TestDecodeXmp(t *testing.T) {
+	xmp, err := DecodeXmp([]byte(testLightroomXmp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xmp.Rating != 4 || xmp.Label != "Red" || xmp.Description != "Grandma at the beach" {
+		t.Fatalf("expected 4 stars, red and the description, received %v", xmp)
+	}
+	if !reflect.DeepEqual(xmp.Keywords, []string{"Beach", "Grandma"}) || !reflect.DeepEqual(xmp.HierarchicalKeywords, []string{"Places|Spain|Valencia"}) {
+		t.Fatalf("expected the keywords of the packet, received %v %v", xmp.Keywords, xmp.HierarchicalKeywords)
+	}
+	if xmp.Latitude < 38.9098 || xmp.Latitude > 38.9099 || xmp.Longitude != -0.375 {
+		t.Fatalf("expected the coordinates of Valencia, received %f %f", xmp.Latitude, xmp.Longitude)
+	}
+	if _, err := DecodeXmp([]byte("<x:xmpmeta><rdf:RDF>")); err == nil {
+		t.Fatal("expected an error for a truncated packet")
+	}
+	if coordinate, err := XmpCoordinate("25,21,32.6101S"); err != nil || coordinate > -25.3590 || coordinate < -25.3591 {
+		t.Fatalf("expected -25.359, received %f %v", coordinate, err)
+	}
+	if _, err := XmpCoordinate("25.3N"); err == nil {
+		t.Fatal("expected an error without minutes")
+	}
+}
+
+func TestXmpInformations(t *testing.T) {
+	packet := []byte(testLightroomXmp)
+	tiff := testTiff(binary.LittleEndian, 42)
+	// tiff with the xmp tag as only entry of its IFD0
+	tiffXmp := make([]byte, 8)
+	copy(tiffXmp, "II*\x00\x08\x00\x00\x00")
+	tiffXmp = append(tiffXmp, encodeIfd(binary.LittleEndian, 8, []testEntry{
+		{tag: XMP_PACKET_TAG, typ: TYPE_BYTE, count: uint32(len(packet) + 2), data: append(append([]byte{}, packet...), 0, 0)},
+	})...)
+	pngXmp := testPng(tiff)
+	pngXmp = append(pngXmp[:len(pngXmp)-12], testPngChunk("iTXt", append([]byte(PNG_XMP_KEYWORD+"\x00\x00en\x00\x00"), packet...))...)
+	pngXmp = append(pngXmp, testPngChunk("IEND", nil)...)
+	jpeg := testJpeg(tiff)
+	segment := append([]byte(JPEG_XMP_PREFIX), packet...)
+	jpegXmp := append(append([]byte{}, jpeg[:2]...), 0xff, 0xe1, byte((len(segment)+2)>>8), byte(len(segment)+2))
+	jpegXmp = append(append(jpegXmp, segment...), jpeg[2:]...)
+
+	for name, content := range map[string][]byte{"tiff": tiffXmp, "png": pngXmp, "jpeg": jpegXmp} {
+		found, err := embeddedXmp(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			t.Fatalf("expected the xmp of the %s, received %v", name, err)
+		}
+		if xmp, err := DecodeXmp(found); err != nil || xmp.Rating != 4 {
+			t.Fatalf("expected the packet of the %s, received %v", name, err)
+		}
+	}
+	if _, err := embeddedXmp(bytes.NewReader(jpeg), int64(len(jpeg))); err != XmpNotFound {
+		t.Fatalf("expected XmpNotFound for a jpeg without xmp, received %v", err)
+	}
+
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "a.jpg"), jpegXmp, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "a.XMP"), []byte(testDarktableXmp), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "b.cr2"), tiff, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "b.cr2.xmp"), []byte(testDarktableXmp), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "c.jpg"), jpeg, 0644)
+
+	// the properties of the sidecar replace the embedded ones
+	xmp, err := GetXmpInformations(filepath.Join(dir, "a.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xmp.Rating != 2 || xmp.Label != "Red" || !reflect.DeepEqual(xmp.Keywords, []string{"darktable|format|cr2"}) || xmp.Sidecar != filepath.Join(dir, "a.XMP") {
+		t.Fatalf("expected the xmp of the photo merged with its sidecar, received %v", xmp)
+	}
+	if xmp, err := GetXmpInformations(filepath.Join(dir, "b.cr2")); err != nil || xmp.Rating != 2 {
+		t.Fatalf("expected the darktable sidecar, received %v %v", xmp, err)
+	}
+	if _, err := GetXmpInformations(filepath.Join(dir, "c.jpg")); err != XmpNotFound {
+		t.Fatalf("expected XmpNotFound, received %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+// package resolves coordinates to the nearest city, region and country of a local
+// gazetteer in the GeoNames format (cities file, admin1CodesASCII.txt and countryInfo.txt)
+package geocoder
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jeromelesaux/photo/configurationapp"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	// gazetteer used if the configuration has no gazetteer_path
+	DEFAULT_GAZETTEER_PATH = "resources/geonames/cities.txt"
+	// file of the region names next to the cities file
+	ADMIN1_FILENAME = "admin1CodesASCII.txt"
+	// file of the country names next to the cities file
+	COUNTRIES_FILENAME = "countryInfo.txt"
+	// coordinates farther than this distance (meters) from every city are not resolved
+	MAX_DISTANCE = 50000.
+	EARTH_RADIUS = 6371000.
+)
+
+// structure of a place of the gazetteer
+type Place struct {
+	City        string  `json:"city"`
+	Region      string  `json:"region,omitempty"`
+	Country     string  `json:"country,omitempty"`
+	CountryCode string  `json:"country_code,omitempty"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+}
+
+type gridCell [2]int
+
+// structure of the cities of the gazetteer indexed by cells of one degree
+type Gazetteer struct {
+	places []*Place
+	grid   map[gridCell][]*Place
+}
+
+var (
+	gazetteerOnce sync.Once
+	gazetteerLock sync.RWMutex
+	gazetteer     *Gazetteer
+)
+
+// function returns the gazetteer of the gazetteer_path of the configuration (or DEFAULT_GAZETTEER_PATH)
+// loaded at the first call, the gazetteer is empty if the file cannot be read
+func GetGazetteer() *Gazetteer {
+	gazetteerOnce.Do(func() {
+		path := DEFAULT_GAZETTEER_PATH
+		if conf := configurationapp.GetConfiguration(); conf != nil && conf.GazetteerPath != "" {
+			path = conf.GazetteerPath
+		}
+		g, err := Load(path)
+		if err != nil {
+			logger.Errorf("Cannot load gazetteer %s, the photos will not be geocoded, error : %v", path, err)
+		}
+		setGazetteer(g)
+	})
+	gazetteerLock.RLock()
+	defer gazetteerLock.RUnlock()
+	return gazetteer
+}
+
+// function replaces the gazetteer used to resolve the coordinates
+func SetGazetteer(g *Gazetteer) {
+	gazetteerOnce.Do(func() {})
+	setGazetteer(g)
+}
+
+func setGazetteer(g *Gazetteer) {
+	gazetteerLock.Lock()
+	defer gazetteerLock.Unlock()
+	gazetteer = g
+}
+
+// function returns an empty gazetteer
+func NewGazetteer() *Gazetteer {
+	return &Gazetteer{places: make([]*Place, 0), grid: make(map[gridCell][]*Place)}
+}
+
+// function loads the cities file (tab separated GeoNames format : name in the 2nd column, latitude and
+// longitude in the 5th and 6th, country code in the 9th and admin1 code in the 11th). the region and
+// country names are read from admin1CodesASCII.txt and countryInfo.txt in the same directory if they exist.
+// an empty gazetteer is returned with the error
+func Load(path string) (*Gazetteer, error) {
+	g := NewGazetteer()
+	dir := filepath.Dir(path)
+	regions := make(map[string]string)
+	readColumns(filepath.Join(dir, ADMIN1_FILENAME), 2, func(columns []string) {
+		regions[columns[0]] = columns[1]
+	})
+	countries := make(map[string]string)
+	readColumns(filepath.Join(dir, COUNTRIES_FILENAME), 5, func(columns []string) {
+		countries[columns[0]] = columns[4]
+	})
+	err := readColumns(path, 11, func(columns []string) {
+		latitude, errLat := strconv.ParseFloat(columns[4], 64)
+		longitude, errLng := strconv.ParseFloat(columns[5], 64)
+		if errLat != nil || errLng != nil {
+			return
+		}
+		place := &Place{City: columns[1], CountryCode: columns[8], Latitude: latitude, Longitude: longitude,
+			Region: columns[10], Country: columns[8]}
+		if region, ok := regions[columns[8]+"."+columns[10]]; ok {
+			place.Region = region
+		}
+		if country, ok := countries[columns[8]]; ok {
+			place.Country = country
+		}
+		g.Add(place)
+	})
+	if err != nil {
+		return NewGazetteer(), err
+	}
+	logger.Infof("Gazetteer %s loaded with %d cities", path, len(g.places))
+	return g, nil
+}
+
+// function calls fn with the tab separated columns of each line of the file with at least min columns,
+// the lines starting with # are comments
+func readColumns(path string, min int, fn func(columns []string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if columns := strings.Split(line, "\t"); len(columns) >= min {
+			fn(columns)
+		}
+	}
+	return scanner.Err()
+}
+
+func cellOf(latitude float64, longitude float64) gridCell {
+	return gridCell{int(math.Floor(latitude)), int(math.Floor(longitude))}
+}
+
+// function adds the place to the gazetteer
+func (g *Gazetteer) Add(place *Place) {
+	g.places = append(g.places, place)
+	cell := cellOf(place.Latitude, place.Longitude)
+	g.grid[cell] = append(g.grid[cell], place)
+}
+
+// function returns the number of cities of the gazetteer
+func (g *Gazetteer) Len() int {
+	if g == nil {
+		return 0
+	}
+	return len(g.places)
+}
+
+// function returns the nearest city of the coordinates, false if no city is nearer than MAX_DISTANCE
+func (g *Gazetteer) Lookup(latitude float64, longitude float64) (*Place, bool) {
+	if g.Len() == 0 {
+		return nil, false
+	}
+	// cells around the coordinates containing the circle of MAX_DISTANCE
+	delta := MAX_DISTANCE / EARTH_RADIUS * 180 / math.Pi
+	lngDelta := 180.
+	if cos := math.Cos(latitude * math.Pi / 180); cos > delta/180 {
+		lngDelta = math.Min(180, delta/cos)
+	}
+	var nearest *Place
+	best := MAX_DISTANCE
+	center := cellOf(latitude, longitude)
+	south, north := int(math.Floor(latitude-delta)), int(math.Floor(latitude+delta))
+	lngCells := int(math.Ceil(lngDelta))
+	for lat := south; lat <= north; lat++ {
+		for i := -lngCells; i <= lngCells; i++ {
+			// the longitudes cells are wrapped around the antimeridian
+			lng := (center[1]+i+180+360)%360 - 180
+			for _, place := range g.grid[gridCell{lat, lng}] {
+				if d := Distance(latitude, longitude, place.Latitude, place.Longitude); d <= best {
+					nearest, best = place, d
+				}
+			}
+		}
+	}
+	return nearest, nearest != nil
+}
+
+// function returns the distance in meters between two coordinates
+func Distance(lat1 float64, lng1 float64, lat2 float64, lng2 float64) float64 {
+	phi1, phi2 := lat1*math.Pi/180, lat2*math.Pi/180
+	dphi, dlambda := (lat2-lat1)*math.Pi/180, (lng2-lng1)*math.Pi/180
+	h := math.Sin(dphi/2)*math.Sin(dphi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dlambda/2)*math.Sin(dlambda/2)
+	return 2 * EARTH_RADIUS * math.Asin(math.Min(1, math.Sqrt(h)))
+}
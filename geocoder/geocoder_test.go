@@ -0,0 +1,51 @@
+package geocoder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	g, err := Load("../resources/geonames/cities.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Len() == 0 {
+		t.Fatal("expected the cities of the bundled gazetteer")
+	}
+	place, ok := g.Lookup(41.4036, 2.1744)
+	if !ok || place.City != "Barcelona" || place.Region != "Catalonia" || place.Country != "Spain" || place.CountryCode != "ES" {
+		t.Fatalf("expected Barcelona, Catalonia, Spain and received %v", place)
+	}
+	if place, ok := g.Lookup(48.8049, 2.1204); !ok || place.City != "Versailles" {
+		t.Fatalf("expected the nearest city Versailles and received %v", place)
+	}
+	if place, ok := g.Lookup(0, -30); ok {
+		t.Fatalf("no city expected in the middle of the Atlantic and received %v", place)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "cities.txt")); err == nil {
+		t.Fatal("expected an error for a missing gazetteer")
+	}
+}
+
+func TestLookupAntimeridian(t *testing.T) {
+	dir := t.TempDir()
+	content := "#comment\n1\tTaveuni\tTaveuni\t\t-16.85\t179.97\tP\tPPL\tFJ\t\t03\n" +
+		"2\tTwo\tTwo\t\t-16.85\t-179.5\tP\tPPL\tFJ\t\t03\n"
+	if err := os.WriteFile(filepath.Join(dir, "cities.txt"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g, err := Load(filepath.Join(dir, "cities.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Len() != 2 {
+		t.Fatalf("expected 2 cities and received %d", g.Len())
+	}
+	// without the names files the codes are kept
+	place, ok := g.Lookup(-16.85, -179.98)
+	if !ok || place.City != "Taveuni" || place.Country != "FJ" || place.Region != "03" {
+		t.Fatalf("expected Taveuni across the antimeridian and received %v", place)
+	}
+}
@@ -1,6 +1,9 @@
 package modele
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"sync"
 	"time"
 )
@@ -52,6 +55,111 @@ type PhotoInformations struct {
 	Filename  string            `json:"filename"`
 	Filepath  string            `json:"filepath"`
 	Thumbnail string            `json:"thumbnail"`
+	Size      int64             `json:"size,omitempty"`
+	// modification time of the file in seconds since epoch, date of the photo without exif date
+	ModTime int64 `json:"modtime,omitempty"`
+	// xmp metadata embedded in the photo or of its sidecar, nil if the photo has none
+	Xmp *XmpInformations `json:"xmp,omitempty"`
+}
+
+// xmp metadata of a photo written by lightroom, darktable... (embedded packet or .xmp sidecar)
+type XmpInformations struct {
+	// xmp:Rating, -1 for a rejected photo
+	Rating int `json:"rating,omitempty"`
+	// xmp:Label, colour label
+	Label string `json:"label,omitempty"`
+	// dc:subject
+	Keywords []string `json:"keywords,omitempty"`
+	// lr:hierarchicalSubject, levels separated by |
+	HierarchicalKeywords []string `json:"hierarchical_keywords,omitempty"`
+	// dc:description and dc:title, default language
+	Description string `json:"description,omitempty"`
+	Title       string `json:"title,omitempty"`
+	// exif:GPSLatitude and exif:GPSLongitude in decimal degrees, 0, 0 if the photo is not located
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	// exif:DateTimeOriginal or photoshop:DateCreated as written in the packet (see ParseXmpDate)
+	Date string `json:"date,omitempty"`
+	// path of the sidecar read, empty for the embedded packet only
+	Sidecar string `json:"sidecar,omitempty"`
+}
+
+// layouts of the xmp dates, the offset and the seconds are optional
+var xmpDateLayouts = []string{"2006-01-02T15:04:05.999999999Z07:00", "2006-01-02T15:04Z07:00", "2006-01-02T15:04:05.999999999", "2006-01-02T15:04", "2006-01-02"}
+
+// function parses the xmp date, the returned boolean is false if the date has no offset
+// and keeps the time of the camera
+func ParseXmpDate(value string) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	for i, layout := range xmpDateLayouts {
+		if tm, err := time.Parse(layout, value); err == nil {
+			return tm, i < 2, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("Invalid date %s, 2006-01-02T15:04:05 with an optional offset expected", value)
+}
+
+// metadata corrections written back by the slave into the photo or into its xmp sidecar,
+// only the set fields are written. keywords replace the keywords of the photo (an empty list removes them)
+type MetadataUpdate struct {
+	Md5Sum string `json:"md5sum"`
+	// machine and path of the copy written, the controller chooses the first copy if they are empty
+	MachineId string `json:"machineid,omitempty"`
+	Filepath  string `json:"filepath,omitempty"`
+	// capture date 2006-01-02T15:04:05, with an optional offset (+02:00)
+	Date        *string  `json:"date,omitempty"`
+	Latitude    *float64 `json:"latitude,omitempty"`
+	Longitude   *float64 `json:"longitude,omitempty"`
+	Keywords    []string `json:"keywords"`
+	Rating      *int     `json:"rating,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	// writes the xmp sidecar even if the photo is a jpeg which could embed the metadata
+	Sidecar bool `json:"sidecar,omitempty"`
+	// returns the changes without writing them
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// function checks the corrections, at least one is needed and the coordinates are set together
+func (m *MetadataUpdate) Validate() error {
+	if m.Md5Sum == "" {
+		return errors.New("No photo given")
+	}
+	if m.Date == nil && m.Latitude == nil && m.Longitude == nil && m.Keywords == nil && m.Rating == nil && m.Description == nil {
+		return errors.New("The update needs date, latitude and longitude, keywords, rating or description")
+	}
+	if m.Date != nil {
+		if _, _, err := ParseXmpDate(*m.Date); err != nil {
+			return err
+		}
+	}
+	if (m.Latitude == nil) != (m.Longitude == nil) {
+		return errors.New("The latitude and the longitude are set together")
+	}
+	if m.Latitude != nil && (*m.Latitude < -90 || *m.Latitude > 90 || *m.Longitude < -180 || *m.Longitude > 180) {
+		return errors.New("The coordinates are out of range")
+	}
+	if m.Rating != nil && (*m.Rating < 0 || *m.Rating > 5) {
+		return errors.New("The rating must be between 0 and 5")
+	}
+	return nil
+}
+
+// result of the metadata written by the slave, md5sum is the md5sum of the photo before the write
+// and new_md5sum after it (the same for a sidecar), in dry run the photo is not written
+// and new_md5sum is the md5sum the photo would have
+type MetadataResult struct {
+	Md5Sum    string `json:"md5sum"`
+	NewMd5Sum string `json:"new_md5sum"`
+	Filepath  string `json:"filepath"`
+	// file written : the photo or its sidecar
+	Written string `json:"written"`
+	Sidecar bool   `json:"sidecar,omitempty"`
+	// copy of the original bytes of the file written, empty for a new sidecar
+	Backup string `json:"backup,omitempty"`
+	// tags written (xmp:Rating, exif:DateTimeOriginal, iptc:Keywords...)
+	Changes []string `json:"changes"`
+	DryRun  bool     `json:"dry_run,omitempty"`
+	Message string   `json:"error_message,omitempty"`
 }
 
 func NewPhotoInformations() *PhotoInformations {
@@ -60,12 +168,24 @@ func NewPhotoInformations() *PhotoInformations {
 	}
 }
 
+// structure of a photo found with the same md5sum at a new path during a scan
+type PhotoMove struct {
+	Md5Sum           string `json:"md5sum"`
+	Filename         string `json:"filename"`
+	Filepath         string `json:"filepath"`
+	PreviousFilepath string `json:"previous_filepath"`
+}
+
+// scan response of a slave, an incremental scan only sends the new photos
+// and reports the photos moved or deleted since the previous scan
 type PhotoResponse struct {
 	Message   string               `json:"error_message,omitempty"`
 	Origin    string               `json:"origin,omitempty"`
 	Version   string               `json:"version"`
 	MachineId string               `json:"machine"`
 	Photos    []*PhotoInformations `json:"photos"`
+	Moved     []*PhotoMove         `json:"moved,omitempty"`
+	Deleted   []*PhotoInformations `json:"deleted,omitempty"`
 }
 
 var (
@@ -91,6 +211,8 @@ func NewPhotoResponse(message string, version string, machineid string, photos [
 type FolderToScan struct {
 	MachineId string   `json:"machineid"`
 	Folders   []string `json:"folders_toscan"`
+	// full reads again all the files, otherwise the slave only reads the files changed since the previous scan
+	Full bool `json:"full,omitempty"`
 }
 
 type JSTreeAttribute struct {
@@ -6,17 +6,36 @@ import (
 	"log"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/jeromelesaux/photo/backup"
 	"github.com/jeromelesaux/photo/configurationapp"
+	"github.com/jeromelesaux/photo/database"
 	"github.com/jeromelesaux/photo/modele"
 	"github.com/jeromelesaux/photo/routes"
+	"github.com/jeromelesaux/photo/slavehandler"
+	"github.com/jeromelesaux/photo/tlshandler"
+	"github.com/jeromelesaux/photo/userhandler"
 	logger "github.com/sirupsen/logrus"
 )
 
 var httpport = flag.String("httpport", "", "listening at http://localhost:httpport")
 var configurationfile = flag.String("configurationfile", "", "photoexif client's configuration file")
+var backupfile = flag.String("backup", "", "writes the backup archive of the library in this file and exits")
+var restorefile = flag.String("restore", "", "restores the backup archive of this file in the library and exits")
+var adduser = flag.String("adduser", "", "registers the user with -password and -role and exits")
+var password = flag.String("password", "", "password of the user registered by -adduser")
+var role = flag.String("role", userhandler.ROLE_ADMIN, "role of the user registered by -adduser (admin or user)")
+var certfile = flag.String("certfile", "", "certificate of the https server (and of its client in mutual tls)")
+var keyfile = flag.String("keyfile", "", "key of the certificate -certfile")
+var cafile = flag.String("cafile", "", "local CA of the mutual tls, the controller talks to the slaves presenting a certificate of this CA only")
+var generateca = flag.String("generateca", "", "generates the local CA of the mutual tls in this directory and exits")
+var generatecert = flag.String("generatecert", "", "generates the certificate of this name signed by the local CA of -cadir and exits")
+var cadir = flag.String("cadir", "", "directory of the local CA used by -generatecert")
+var hosts = flag.String("hosts", "", "names and ip addresses of the machine of -generatecert separated by commas")
 var Version string
 var GitHash string
 var BuildStmp string
@@ -44,43 +63,121 @@ func main() {
 	//}
 	//pprof.WriteHeapProfile(f)
 	//defer f.Close()
-	if *httpport != "" && *configurationfile != "" {
-		logger.Info(wellcomeMessage)
+	if *generateca != "" {
+		if err := tlshandler.GenerateCA(*generateca); err != nil {
+			logger.Fatal(err)
+		}
+		fmt.Printf("Local CA written in %s\n", *generateca)
+	} else if *generatecert != "" && *cadir != "" {
+		if err := tlshandler.GenerateCertificate(*cadir, *generatecert, strings.Split(*hosts, ",")); err != nil {
+			logger.Fatal(err)
+		}
+		fmt.Printf("Certificate %s written in %s\n", *generatecert, *cadir)
+	} else if (*backupfile != "" || *restorefile != "") && *configurationfile != "" {
 		configurationapp.LoadPhotoExifConfiguration(*configurationfile)
+		if err := slavehandler.LoadSlaves(""); err != nil {
+			logger.Fatal(err)
+		}
+		if err := backupOrRestore(*backupfile, *restorefile); err != nil {
+			logger.Fatal(err)
+		}
+	} else if *adduser != "" && *configurationfile != "" {
+		conf := configurationapp.LoadPhotoExifConfiguration(*configurationfile)
+		if err := userhandler.LoadUsers(conf.UsersPath); err != nil {
+			logger.Fatal(err)
+		}
+		if err := userhandler.AddUser(*adduser, *password, *role); err != nil {
+			logger.Fatal(err)
+		}
+		fmt.Printf("User %s added with the role %s\n", *adduser, *role)
+	} else if *httpport != "" && *configurationfile != "" {
+		logger.Info(wellcomeMessage)
+		conf := configurationapp.LoadPhotoExifConfiguration(*configurationfile)
+		if err := userhandler.LoadUsers(conf.UsersPath); err != nil {
+			logger.Fatal(err)
+		}
+		if err := slavehandler.LoadSlaves(""); err != nil {
+			logger.Fatal(err)
+		}
+		if err := tlshandler.Configure(*certfile, *keyfile, *cafile); err != nil {
+			logger.Fatal(err)
+		}
+		if !userhandler.HasUsers() {
+			logger.Warn("No user registered, add an admin with -adduser name -password password")
+		}
 		modele.InitActionsHistory()
-		http.HandleFunc("/register", routes.RegisterSlave)
-		http.HandleFunc("/registeredslaves", routes.GetRegisteredSlaves)
-		http.HandleFunc("/browse", routes.Browse)
-		http.HandleFunc("/scan", routes.ScanFolders)
-		http.HandleFunc("/queryextension", routes.QueryExtension)
-		http.HandleFunc("/queryfilename", routes.QueryFilename)
-		http.HandleFunc("/queryexif", routes.QueryExif)
-		http.HandleFunc("/queryall", routes.QueryAll)
-		http.HandleFunc("/getfileextension", routes.ReadExtensionList)
-		http.HandleFunc("/cleandatabase", routes.CleanDatabase)
-		http.HandleFunc("/createalbum", routes.CreateNewPhotoAlbum)
-		http.HandleFunc("/albums", routes.ListPhotoAlbums)
-		http.HandleFunc("/getalbum", routes.GetAlbumData)
-		http.HandleFunc("/updatealbum", routes.UpdateAlbum)
-		http.HandleFunc("/deletealbum", routes.DeleteAlbum)
-		http.HandleFunc("/deletephotosalbum", routes.DeletePhotosAlbum)
-		http.HandleFunc("/pdfalbum", routes.GenerateAlbumPdf)
-		http.HandleFunc("/googlesave", routes.SaveGoogleConfiguration)
-		http.HandleFunc("/googleload", routes.LoadGoogleConfiguration)
-		http.HandleFunc("/flickrload", routes.LoadFlickrConfiguration)
-		http.HandleFunc("/flickrsave", routes.SaveFlickrConfiguration)
-		http.HandleFunc("/flickrloadalbums", routes.LoadFlickrAlbums)
-		http.HandleFunc("/history", routes.GetHistory)
-		http.HandleFunc("/originsstats", routes.GetOriginStats)
-		http.HandleFunc("/locationsstats", routes.GetLocationStats)
-		http.HandleFunc("/photosfromlocation", routes.GetPhotosFromLocation)
-		http.HandleFunc("/timesstats", routes.GetTimeStats)
-		http.HandleFunc("/photosfromtime", routes.GetPhotosFromTime)
-		http.HandleFunc("/download", routes.DownloadPhotos)
-		http.HandleFunc("/tag", routes.GetPhotosByTag)
-		http.HandleFunc("/photo", routes.GetLocalPhoto)
-		http.Handle("/", http.StripPrefix("/", http.FileServer(http.Dir("./resources"))))
-		log.Fatal(http.ListenAndServe(":"+*httpport, nil))
+		// the routes are public, allowed to the users or to the admins
+		mux := http.NewServeMux()
+		mux.HandleFunc("/login", routes.Login)
+		mux.HandleFunc("/logout", routes.Logout)
+		mux.HandleFunc("/me", routes.UserRoute(routes.CurrentUser))
+		mux.HandleFunc("/setpassword", routes.UserRoute(routes.SetPassword))
+		mux.HandleFunc("/newtoken", routes.UserRoute(routes.NewToken))
+		mux.HandleFunc("/tokens", routes.UserRoute(routes.ListTokens))
+		mux.HandleFunc("/deletetoken", routes.UserRoute(routes.DeleteToken))
+		mux.HandleFunc("/users", routes.AdminRoute(routes.ListUsers))
+		mux.HandleFunc("/adduser", routes.AdminRoute(routes.AddUser))
+		mux.HandleFunc("/deleteuser", routes.AdminRoute(routes.DeleteUser))
+		mux.HandleFunc("/debug/pprof/", routes.AdminRoute(http.DefaultServeMux.ServeHTTP))
+		mux.HandleFunc("/register", routes.RegisterSlave)
+		mux.HandleFunc("/registeredslaves", routes.AdminRoute(routes.GetRegisteredSlaves))
+		mux.HandleFunc("/enrolmenttoken", routes.AdminRoute(routes.NewEnrolmentToken))
+		mux.HandleFunc("/revokeslave", routes.AdminRoute(routes.RevokeSlave))
+		mux.HandleFunc("/browse", routes.AdminRoute(routes.Browse))
+		mux.HandleFunc("/scan", routes.AdminRoute(routes.ScanFolders))
+		mux.HandleFunc("/queryextension", routes.UserRoute(routes.QueryExtension))
+		mux.HandleFunc("/queryfilename", routes.UserRoute(routes.QueryFilename))
+		mux.HandleFunc("/queryexif", routes.UserRoute(routes.QueryExif))
+		mux.HandleFunc("/queryall", routes.UserRoute(routes.QueryAll))
+		mux.HandleFunc("/search", routes.UserRoute(routes.Search))
+		mux.HandleFunc("/getfileextension", routes.AdminRoute(routes.ReadExtensionList))
+		mux.HandleFunc("/cleandatabase", routes.AdminRoute(routes.CleanDatabase))
+		mux.HandleFunc("/backup", routes.AdminRoute(routes.Backup))
+		mux.HandleFunc("/restore", routes.AdminRoute(routes.Restore))
+		mux.HandleFunc("/updatemetadata", routes.AdminRoute(routes.UpdateMetadata))
+		mux.HandleFunc("/createalbum", routes.UserRoute(routes.CreateNewPhotoAlbum))
+		mux.HandleFunc("/albums", routes.UserRoute(routes.ListPhotoAlbums))
+		mux.HandleFunc("/albumstree", routes.UserRoute(routes.GetAlbumTree))
+		mux.HandleFunc("/movealbum", routes.UserRoute(routes.MoveAlbum))
+		mux.HandleFunc("/reorderalbum", routes.UserRoute(routes.ReorderAlbum))
+		mux.HandleFunc("/insertalbumphotos", routes.UserRoute(routes.InsertAlbumPhotos))
+		mux.HandleFunc("/sortalbum", routes.UserRoute(routes.SortAlbum))
+		mux.HandleFunc("/albumcover", routes.UserRoute(routes.SetAlbumCover))
+		mux.HandleFunc("/getalbum", routes.UserRoute(routes.GetAlbumData))
+		mux.HandleFunc("/updatealbum", routes.UserRoute(routes.UpdateAlbum))
+		mux.HandleFunc("/deletealbum", routes.UserRoute(routes.DeleteAlbum))
+		mux.HandleFunc("/deletephotosalbum", routes.UserRoute(routes.DeletePhotosAlbum))
+		mux.HandleFunc("/pdfalbum", routes.UserRoute(routes.GenerateAlbumPdf))
+		mux.HandleFunc("/googlesave", routes.AdminRoute(routes.SaveGoogleConfiguration))
+		mux.HandleFunc("/googleload", routes.AdminRoute(routes.LoadGoogleConfiguration))
+		mux.HandleFunc("/flickrload", routes.AdminRoute(routes.LoadFlickrConfiguration))
+		mux.HandleFunc("/flickrsave", routes.AdminRoute(routes.SaveFlickrConfiguration))
+		mux.HandleFunc("/flickrloadalbums", routes.AdminRoute(routes.LoadFlickrAlbums))
+		mux.HandleFunc("/history", routes.UserRoute(routes.GetHistory))
+		mux.HandleFunc("/originsstats", routes.UserRoute(routes.GetOriginStats))
+		mux.HandleFunc("/locationsstats", routes.UserRoute(routes.GetLocationStats))
+		mux.HandleFunc("/photosfromlocation", routes.UserRoute(routes.GetPhotosFromLocation))
+		mux.HandleFunc("/photosinarea", routes.UserRoute(routes.GetPhotosFromArea))
+		mux.HandleFunc("/locationsclusters", routes.UserRoute(routes.GetLocationClusters))
+		mux.HandleFunc("/placesstats", routes.UserRoute(routes.GetPlaceStats))
+		mux.HandleFunc("/timesstats", routes.UserRoute(routes.GetTimeStats))
+		mux.HandleFunc("/photosfromtime", routes.UserRoute(routes.GetPhotosFromTime))
+		mux.HandleFunc("/download", routes.UserRoute(routes.DownloadPhotos))
+		mux.HandleFunc("/tag", routes.UserRoute(routes.GetPhotosByTag))
+		mux.HandleFunc("/addkeywords", routes.UserRoute(routes.AddKeywords))
+		mux.HandleFunc("/removekeywords", routes.UserRoute(routes.RemoveKeywords))
+		mux.HandleFunc("/keywords", routes.UserRoute(routes.GetPhotoKeywords))
+		mux.HandleFunc("/suggestkeywords", routes.UserRoute(routes.SuggestKeywords))
+		mux.HandleFunc("/updatecuration", routes.UserRoute(routes.UpdateCuration))
+		mux.HandleFunc("/photo", routes.UserRoute(routes.GetLocalPhoto))
+		mux.HandleFunc("/thumbnail/", routes.UserRoute(routes.GetStoredThumbnail))
+		mux.HandleFunc("/share", routes.UserRoute(routes.CreateShare))
+		mux.HandleFunc("/shares", routes.UserRoute(routes.ListShares))
+		mux.HandleFunc("/deleteshare", routes.UserRoute(routes.DeleteShare))
+		mux.HandleFunc(database.SHARE_GALLERY_PATH, routes.Gallery)
+		mux.Handle(routes.LOGIN_PAGE, http.FileServer(http.Dir("./resources")))
+		mux.Handle("/", routes.UserPage(http.StripPrefix("/", http.FileServer(http.Dir("./resources")))))
+		log.Fatal(tlshandler.ListenAndServe(":"+*httpport, mux, false))
 	} else {
 		timeStmp, err := strconv.Atoi(BuildStmp)
 		if err != nil {
@@ -92,3 +189,39 @@ func main() {
 	}
 
 }
+
+// function writes the backup archive in backupfile or restores the archive of restorefile
+func backupOrRestore(backupfile, restorefile string) error {
+	db, err := database.NewDatabase()
+	if err != nil {
+		return err
+	}
+	if backupfile != "" {
+		f, err := os.Create(backupfile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		report, err := backup.Write(f, db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Backup %s written with %d photos, %d albums and %d thumbnails\n", backupfile, report.Photos, report.Albums, report.Thumbnails)
+		return nil
+	}
+	f, err := os.Open(restorefile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	report, err := backup.Restore(f, info.Size(), db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backup %s restored with %d photos (%d already stored) and %d albums\n", restorefile, report.Photos, report.PhotosSkipped, report.Albums)
+	return nil
+}
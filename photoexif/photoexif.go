@@ -17,6 +17,7 @@ import (
 	"github.com/jeromelesaux/photo/modele"
 	"github.com/jeromelesaux/photo/routes"
 	"github.com/jeromelesaux/photo/slavehandler"
+	"github.com/jeromelesaux/photo/tlshandler"
 	"github.com/sirupsen/logrus"
 )
 
@@ -24,6 +25,10 @@ var photopath = flag.String("photopath", "", "photo path to analyze")
 var directorypath = flag.String("directorypath", "", "directory path to scan.")
 var httpport = flag.String("httpport", "", "listening at http://localhost:httpport")
 var masteruri = flag.String("masteruri", "", "uri of the master to register ex: -masteruri http://localhost:3001/register")
+var enrolmenttoken = flag.String("enrolmenttoken", "", "enrolment token of the master (/enrolmenttoken) for the first registration")
+var certfile = flag.String("certfile", "", "certificate of the https server (and of its client in mutual tls)")
+var keyfile = flag.String("keyfile", "", "key of the certificate -certfile")
+var cafile = flag.String("cafile", "", "local CA of the mutual tls, the slave answers the controller presenting a certificate of this CA only")
 var logFormat = flag.String("logformat", "", "format of the log (text or logstash available).")
 var logLevel = flag.String("loglevel", "", "level of the log (DEBUG, INFO, WARN ...).")
 var Version string
@@ -70,23 +75,39 @@ func main() {
 			response.Photos = pinfos
 		} else {
 			if *httpport != "" {
+				// the slave answers the files of its scan roots only
+				if err := conf.CheckScanRoots(configurationexif.CONFIGURATION_FILE); err != nil {
+					logrus.Error(err.Error() + ", don't start")
+					return
+				}
 				if *masteruri != "" {
 					port, err := strconv.Atoi(*httpport)
 					if err != nil {
 						logrus.Error("Error : " + err.Error())
 						return
 					}
-					go slavehandler.RegisterToMaster(*masteruri, port, "/directory")
+					if err := tlshandler.Configure(*certfile, *keyfile, *cafile); err != nil {
+						logrus.Error("Error : " + err.Error())
+						return
+					}
+					if err := slavehandler.LoadSlaveSecret(""); err != nil {
+						logrus.Error("Error : " + err.Error())
+						return
+					}
+					go slavehandler.RegisterToMaster(*masteruri, port, "/directory", *enrolmenttoken)
 				} else {
 					logrus.Error("masteruri is mandatary, don't start")
 					return
 				}
-				http.HandleFunc("/file", routes.GetFileInformations)
-				http.HandleFunc("/directory", routes.GetDirectoryInformations)
-				http.HandleFunc("/getfileextension", routes.GetExtensionList)
-				http.HandleFunc("/thumbnail", routes.GetThumbnail)
-				http.HandleFunc("/photo", routes.GetPhoto)
-				log.Fatal(http.ListenAndServe(":"+*httpport, nil))
+				// the routes answer the requests signed by the master only
+				mux := http.NewServeMux()
+				mux.HandleFunc("/file", routes.SlaveRoute(routes.GetFileInformations))
+				mux.HandleFunc("/directory", routes.SlaveRoute(routes.GetDirectoryInformations))
+				mux.HandleFunc("/getfileextension", routes.SlaveRoute(routes.GetExtensionList))
+				mux.HandleFunc("/thumbnail", routes.SlaveRoute(routes.GetThumbnail))
+				mux.HandleFunc("/photo", routes.SlaveRoute(routes.GetPhoto))
+				mux.HandleFunc("/writemetadata", routes.SlaveRoute(routes.WriteMetadata))
+				log.Fatal(tlshandler.ListenAndServe(":"+*httpport, mux, true))
 			} else {
 				timeStmp, err := strconv.Atoi(BuildStmp)
 				if err != nil {
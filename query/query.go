@@ -0,0 +1,97 @@
+// package builds the tiedot queries with typed constructors instead of json strings,
+// the values are never interpreted so user inputs (album names, md5sums...) cannot change the query.
+package query
+
+import (
+	"encoding/json"
+
+	"github.com/HouzuoGuo/tiedot/db"
+)
+
+// structure of a tiedot query, it must be created with the constructors of the package
+type Query struct {
+	expr interface{}
+}
+
+// function returns the query matching all the documents of the collection
+func All() Query {
+	return Query{expr: "all"}
+}
+
+// function returns the query matching the documents where the indexed field equals value
+func Eq(field string, value string) Query {
+	return Query{expr: map[string]interface{}{
+		"eq": value,
+		"in": []interface{}{field},
+	}}
+}
+
+// function returns the query matching the documents where the indexed field equals one of the values
+func In(field string, values ...string) Query {
+	queries := make([]Query, 0)
+	for _, value := range values {
+		queries = append(queries, Eq(field, value))
+	}
+	return Union(queries...)
+}
+
+// function returns the query matching the documents where the indexed field is set
+func Has(field string) Query {
+	return Query{expr: map[string]interface{}{
+		"has": []interface{}{field},
+	}}
+}
+
+// function returns the query matching the documents where the indexed integer field
+// is between from and to (both included)
+func Range(field string, from, to int) Query {
+	return Query{expr: map[string]interface{}{
+		"int-from": from,
+		"int-to":   to,
+		"in":       []interface{}{field},
+	}}
+}
+
+// function returns the query matching the documents of at least one of the queries
+func Union(queries ...Query) Query {
+	exprs := make([]interface{}, 0)
+	for _, q := range queries {
+		exprs = append(exprs, q.expr)
+	}
+	return Query{expr: exprs}
+}
+
+// function returns the query matching the documents of all the queries
+func Intersect(queries ...Query) Query {
+	if len(queries) == 0 {
+		return Union()
+	}
+	exprs := make([]interface{}, 0)
+	for _, q := range queries {
+		exprs = append(exprs, q.expr)
+	}
+	return Query{expr: map[string]interface{}{
+		"n": exprs,
+	}}
+}
+
+// function returns the structure evaluated by the tiedot query processor
+func (q Query) Compile() interface{} {
+	return q.expr
+}
+
+// function returns the json representation of the query (used in logs)
+func (q Query) String() string {
+	b, err := json.Marshal(q.expr)
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
+
+// function evaluates the query on the collection and returns the documents ids found
+func Eval(q Query, collection *db.Col) (map[int]struct{}, error) {
+	result := make(map[int]struct{})
+	err := db.EvalQuery(q.Compile(), collection, &result)
+	return result, err
+}
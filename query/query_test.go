@@ -0,0 +1,55 @@
+package query
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/HouzuoGuo/tiedot/db"
+)
+
+func TestCompile(t *testing.T) {
+	q := Intersect(Eq("album_name", `Noël "chez" mamie`), Range("date", 1, 2))
+	expected := `{"n":[{"eq":"Noël \"chez\" mamie","in":["album_name"]},{"in":["date"],"int-from":1,"int-to":2}]}`
+	if q.String() != expected {
+		t.Fatal("expected " + expected + " and received " + q.String())
+	}
+	if In("md5sum").String() != `[]` {
+		t.Fatal("expected empty union and received " + In("md5sum").String())
+	}
+}
+
+func TestEvalWithQuotes(t *testing.T) {
+	database, err := db.OpenDB(t.TempDir())
+	if err != nil {
+		t.Fatal("database must not be on error with error " + err.Error())
+	}
+	defer database.Close()
+	if err := database.Create("albums"); err != nil {
+		t.Fatal(err)
+	}
+	albums := database.Use("albums")
+	if err := albums.Index([]string{"album_name"}); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{`Noël "chez" mamie`, `"]}, "all"`, "vacances"}
+	for _, name := range names {
+		if _, err := albums.Insert(map[string]interface{}{"album_name": name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result, err := Eval(Eq("album_name", names[1]), albums)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 {
+		t.Fatal("expected size response 1 and received " + strconv.Itoa(len(result)))
+	}
+	result, _ = Eval(In("album_name", names...), albums)
+	if len(result) != 3 {
+		t.Fatal("expected size response 3 and received " + strconv.Itoa(len(result)))
+	}
+	result, _ = Eval(Intersect(All(), Eq("album_name", "vacances")), albums)
+	if len(result) != 1 {
+		t.Fatal("expected size response 1 and received " + strconv.Itoa(len(result)))
+	}
+}
@@ -0,0 +1,292 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jeromelesaux/photo/database"
+	"github.com/jeromelesaux/photo/modele"
+	"github.com/jeromelesaux/photo/userhandler"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	// name of the cookie of the sessions opened by /login
+	SESSION_COOKIE = "photo_session"
+	// page of the login form, served without session
+	LOGIN_PAGE = "/login.html"
+	// duration of the answer of a failed login, slows the guesses of the passwords
+	LOGIN_FAILURE_DELAY = time.Second
+)
+
+type contextKey int
+
+// key of the authenticated user in the context of the requests
+const userContextKey contextKey = 0
+
+// function returns the user of the api token (header Authorization: Bearer token) or of the session cookie
+func authenticatedUser(r *http.Request) (*userhandler.User, error) {
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		if !strings.HasPrefix(authorization, "Bearer ") {
+			return nil, errors.New("Bearer token expected")
+		}
+		return userhandler.TokenUser(strings.TrimPrefix(authorization, "Bearer "))
+	}
+	cookie, err := r.Cookie(SESSION_COOKIE)
+	if err != nil {
+		return nil, userhandler.SessionNotFound
+	}
+	return userhandler.SessionUser(cookie.Value)
+}
+
+// function returns the authenticated user of the request, nil for a public route
+func requestUser(r *http.Request) *userhandler.User {
+	user, _ := r.Context().Value(userContextKey).(*userhandler.User)
+	return user
+}
+
+// function returns the handler allowed to the authenticated users with the role
+func withRole(h http.HandlerFunc, admin bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := authenticatedUser(r)
+		if err != nil {
+			http.Error(w, "authentication required", http.StatusUnauthorized)
+			return
+		}
+		if admin && !user.IsAdmin() {
+			logger.Warnf("User %s is not allowed to call %s", user.Name, r.URL.Path)
+			http.Error(w, "admin role required", http.StatusForbidden)
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+	}
+}
+
+// function returns the handler allowed to all the authenticated users
+func UserRoute(h http.HandlerFunc) http.HandlerFunc {
+	return withRole(h, false)
+}
+
+// function returns the handler allowed to the users with the admin role (slaves, cloud accounts, users and maintenance)
+func AdminRoute(h http.HandlerFunc) http.HandlerFunc {
+	return withRole(h, true)
+}
+
+// function returns the handler of the pages of the ui, the visitors without session are redirected to the login page
+func UserPage(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := authenticatedUser(r); err != nil {
+			http.Redirect(w, r, LOGIN_PAGE, http.StatusFound)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// function returns true if the user of the request can modify the album : an admin or the owner of the album.
+// a new album can be created by every user. it writes 403 if the user is not allowed
+func albumOwned(w http.ResponseWriter, r *http.Request, db database.DatabaseInterface, albumName string) bool {
+	user := requestUser(r)
+	if user == nil {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return false
+	}
+	if user.IsAdmin() {
+		return true
+	}
+	owner, err := db.GetAlbumOwner(albumName)
+	if err == database.AlbumNotFound {
+		return true
+	}
+	if err != nil {
+		JsonAsResponse(w, err)
+		return false
+	}
+	if owner != user.Name {
+		http.Error(w, "the album "+albumName+" belongs to another user", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// function decodes the body of the users routes (json or form)
+func userRequest(w http.ResponseWriter, r *http.Request) *userhandler.UserMessage {
+	message := &userhandler.UserMessage{}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		message.Name, message.Password, message.Role = r.PostFormValue("name"), r.PostFormValue("password"), r.PostFormValue("role")
+		return message
+	}
+	if r.Body == nil {
+		http.Error(w, "empty body", 400)
+		return nil
+	}
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(message); err != nil {
+		logger.Info("Cannot not decode body received for user with error " + err.Error())
+		http.Error(w, "Cannot not decode body received for user", 400)
+		return nil
+	}
+	return message
+}
+
+// function writes the status of the error of the users routes, 404 if the user or the token does not exist
+func userError(w http.ResponseWriter, err error) {
+	if cause := errors.Cause(err); cause == userhandler.UserNotFound || cause == userhandler.TokenNotFound {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	http.Error(w, err.Error(), 400)
+}
+
+// route opens a session for the name and the password of the body (json or login form) and sets the session cookie
+func Login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST expected", http.StatusMethodNotAllowed)
+		return
+	}
+	message := userRequest(w, r)
+	if message == nil {
+		return
+	}
+	user, err := userhandler.Authenticate(message.Name, message.Password)
+	if err != nil {
+		logger.Warnf("Failed login of user %s from %s", message.Name, r.RemoteAddr)
+		time.Sleep(LOGIN_FAILURE_DELAY)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	id, expires, err := userhandler.NewSession(user.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     SESSION_COOKIE,
+		Value:    id,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Secure:   r.TLS != nil,
+	})
+	modele.PostActionMessage("user " + user.Name + " logged in.")
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	JsonAsResponse(w, user.Message())
+}
+
+// route closes the session of the session cookie
+func Logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(SESSION_COOKIE); err == nil {
+		userhandler.DeleteSession(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: SESSION_COOKIE, Value: "", Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+	JsonAsResponse(w, "Logged out.")
+}
+
+// route returns the authenticated user
+func CurrentUser(w http.ResponseWriter, r *http.Request) {
+	JsonAsResponse(w, requestUser(r).Message())
+}
+
+// route returns the users
+func ListUsers(w http.ResponseWriter, r *http.Request) {
+	users := make([]*userhandler.UserMessage, 0)
+	for _, user := range userhandler.GetUsers() {
+		users = append(users, user.Message())
+	}
+	JsonAsResponse(w, users)
+}
+
+// route registers the user of the body (name, password and role user or admin)
+func AddUser(w http.ResponseWriter, r *http.Request) {
+	message := userRequest(w, r)
+	if message == nil {
+		return
+	}
+	if message.Role == "" {
+		message.Role = userhandler.ROLE_USER
+	}
+	if err := userhandler.AddUser(message.Name, message.Password, message.Role); err != nil {
+		userError(w, err)
+		return
+	}
+	JsonAsResponse(w, "User "+message.Name+" added.")
+}
+
+// route removes the user of the body
+func DeleteUser(w http.ResponseWriter, r *http.Request) {
+	message := userRequest(w, r)
+	if message == nil {
+		return
+	}
+	if err := userhandler.DeleteUser(message.Name); err != nil {
+		userError(w, err)
+		return
+	}
+	JsonAsResponse(w, "User "+message.Name+" deleted.")
+}
+
+// route changes the password of the authenticated user, an admin can change the password of every user (name of the body)
+func SetPassword(w http.ResponseWriter, r *http.Request) {
+	message := userRequest(w, r)
+	if message == nil {
+		return
+	}
+	user := requestUser(r)
+	if message.Name == "" {
+		message.Name = user.Name
+	}
+	if message.Name != user.Name && !user.IsAdmin() {
+		http.Error(w, "admin role required", http.StatusForbidden)
+		return
+	}
+	if err := userhandler.SetPassword(message.Name, message.Password); err != nil {
+		userError(w, err)
+		return
+	}
+	JsonAsResponse(w, "Password of "+message.Name+" changed.")
+}
+
+// route creates the api token of the authenticated user named by the body, the token is only returned by this route
+func NewToken(w http.ResponseWriter, r *http.Request) {
+	message := userRequest(w, r)
+	if message == nil {
+		return
+	}
+	token, err := userhandler.NewToken(requestUser(r).Name, message.Name)
+	if err != nil {
+		userError(w, err)
+		return
+	}
+	JsonAsResponse(w, token)
+}
+
+// route returns the api tokens of the authenticated user, without the tokens
+func ListTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := userhandler.GetTokens(requestUser(r).Name)
+	if err != nil {
+		userError(w, err)
+		return
+	}
+	JsonAsResponse(w, tokens)
+}
+
+// route removes the api token of the authenticated user named by the body
+func DeleteToken(w http.ResponseWriter, r *http.Request) {
+	message := userRequest(w, r)
+	if message == nil {
+		return
+	}
+	if err := userhandler.DeleteToken(requestUser(r).Name, message.Name); err != nil {
+		userError(w, err)
+		return
+	}
+	JsonAsResponse(w, "Api token "+message.Name+" deleted.")
+}
@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/configurationapp"
+	"github.com/jeromelesaux/photo/database"
+	"github.com/jeromelesaux/photo/modele"
+	"github.com/jeromelesaux/photo/userhandler"
+)
+
+func TestUserRoutes(t *testing.T) {
+	dir := t.TempDir()
+	confFile := filepath.Join(dir, "conf.json")
+	os.WriteFile(confFile, []byte(`{"database_path":"`+filepath.Join(dir, "photo.db")+`","database_type":"sqlite"}`), 0644)
+	configurationapp.LoadPhotoExifConfiguration(confFile)
+	modele.InitActionsHistory()
+	db, err := database.NewDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := userhandler.LoadUsers(filepath.Join(dir, "users.json")); err != nil {
+		t.Fatal(err)
+	}
+	userhandler.AddUser("alice", "alice-password", userhandler.ROLE_ADMIN)
+	userhandler.AddUser("bob", "bob-password", userhandler.ROLE_USER)
+	token, err := userhandler.NewToken("bob", "script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.InsertNewAlbum(&album.AlbumMessage{AlbumName: "paris", Owner: "alice"})
+
+	call := func(h http.HandlerFunc, body string, bearer string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		if bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w
+	}
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+
+	if w := call(UserRoute(ok), "", "", nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without account, received %d", w.Code)
+	}
+	if w := call(UserRoute(ok), "", "unknown", nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an unknown api token, received %d", w.Code)
+	}
+	if w := call(UserRoute(ok), "", token.Token, nil); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for the api token of bob, received %d", w.Code)
+	}
+	if w := call(AdminRoute(ok), "", token.Token, nil); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for bob on an admin route, received %d", w.Code)
+	}
+
+	if w := call(Login, `{"name":"alice","password":"wrong-password"}`, "", nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a wrong password, received %d", w.Code)
+	}
+	w := call(Login, `{"name":"alice","password":"alice-password"}`, "", nil)
+	if w.Code != http.StatusOK || len(w.Result().Cookies()) != 1 {
+		t.Fatalf("expected the session cookie, received %d", w.Code)
+	}
+	session := w.Result().Cookies()[0]
+	if w := call(AdminRoute(ok), "", "", session); w.Code != http.StatusOK {
+		t.Fatalf("expected 200 for alice on an admin route, received %d", w.Code)
+	}
+
+	// bob cannot modify the album of alice but creates its own albums
+	if w := call(UserRoute(DeleteAlbum), `{"album_name":"paris"}`, token.Token, nil); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for the album of alice, received %d", w.Code)
+	}
+	if w := call(UserRoute(CreateNewPhotoAlbum), `{"album_name":"rome"}`, token.Token, nil); w.Code != http.StatusOK {
+		t.Fatalf("expected the album rome created, received %d %s", w.Code, w.Body.String())
+	}
+	if owner, err := db.GetAlbumOwner("rome"); err != nil || owner != "bob" {
+		t.Fatalf("expected bob owner of rome, received %s %v", owner, err)
+	}
+	if w := call(UserRoute(DeleteAlbum), `{"album_name":"rome"}`, "", session); w.Code != http.StatusOK {
+		t.Fatalf("expected alice allowed to delete rome, received %d", w.Code)
+	}
+
+	call(Logout, "", "", session)
+	if w := call(UserRoute(ok), "", "", session); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 after logout, received %d", w.Code)
+	}
+}
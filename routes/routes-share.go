@@ -0,0 +1,357 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/database"
+	"github.com/jeromelesaux/photo/modele"
+	"github.com/jeromelesaux/photo/slavehandler"
+	"github.com/jeromelesaux/photo/webclient"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+// name of the cookie of the gallery storing the proof of the password of the share link
+const SHARE_COOKIE = "photo_share"
+
+// page of the gallery of a share link, the photos of the album with their thumbnails
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>{{.Album.AlbumName}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+.photos { display: flex; flex-wrap: wrap; }
+.photo { margin: 0.5em; text-align: center; font-size: small; }
+.photo img { display: block; width: 100px; height: 100px; object-fit: contain; }
+</style>
+</head>
+<body>
+<h1>{{.Album.AlbumName}}</h1>
+{{if .Album.Description}}<p>{{.Album.Description}}</p>{{end}}
+{{if .Password}}
+<form method="post">
+<label>Password <input type="password" name="password" autofocus></label>
+<input type="submit" value="Open">
+{{if .WrongPassword}}<p>Wrong password.</p>{{end}}
+</form>
+{{else}}
+<div class="photos">
+{{range .Album.Records}}
+<div class="photo">
+{{if $.Download}}<a href="{{$.Path}}/photo/{{.Md5sum}}">{{end}}<img src="{{$.Path}}/thumbnail/{{.Md5sum}}" alt="{{.Filename}}" loading="lazy">{{if $.Download}}</a>{{end}}
+{{.Filename}}
+</div>
+{{end}}
+</div>
+<p>Available until {{.Expires.Format "2006-01-02 15:04"}} UTC</p>
+{{end}}
+</body>
+</html>
+`))
+
+// structure of the page of the gallery, password is true to ask the password of the share link
+type galleryPage struct {
+	Album         *database.DatabaseAlbumRecord
+	Path          string
+	Download      bool
+	Expires       time.Time
+	Password      bool
+	WrongPassword bool
+}
+
+// route creates a share link of the album of the body (album_name, expires, password and download)
+func CreateShare(w http.ResponseWriter, r *http.Request) {
+	message := shareRequest(w, r)
+	if message == nil {
+		return
+	}
+	share, err := database.NewDatabaseShareRecord(message, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	db, err := database.NewDatabase()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	if !albumOwned(w, r, db, share.AlbumName) {
+		return
+	}
+	if err := db.InsertShare(share); err != nil {
+		photosUpdateError(w, err)
+		return
+	}
+	modele.PostActionMessage("album " + share.AlbumName + " shared until " + share.Expires.Format(time.RFC3339))
+	JsonAsResponse(w, share.Message())
+}
+
+// route returns the share links of the album albumName (all the share links without albumName) of the albums
+// of the user
+func ListShares(w http.ResponseWriter, r *http.Request) {
+	db, err := database.NewDatabase()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	shares, err := db.GetShares(r.URL.Query().Get("albumName"))
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	user := requestUser(r)
+	messages := make([]*album.ShareMessage, 0, len(shares))
+	for _, share := range shares {
+		// the users see the share links of their albums
+		if owner, _ := db.GetAlbumOwner(share.AlbumName); user.IsAdmin() || owner == user.Name {
+			messages = append(messages, share.Message())
+		}
+	}
+	JsonAsResponse(w, messages)
+}
+
+// route removes the share link of the token of the body
+func DeleteShare(w http.ResponseWriter, r *http.Request) {
+	message := shareRequest(w, r)
+	if message == nil {
+		return
+	}
+	db, err := database.NewDatabase()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	share, err := db.GetShare(message.Token)
+	if err != nil {
+		if err == database.ShareNotFound {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		JsonAsResponse(w, err)
+		return
+	}
+	if !albumOwned(w, r, db, share.AlbumName) {
+		return
+	}
+	if err := db.DeleteShare(message.Token); err != nil {
+		if err == database.ShareNotFound {
+			http.Error(w, err.Error(), 404)
+			return
+		}
+		JsonAsResponse(w, err)
+		return
+	}
+	JsonAsResponse(w, "Share link deleted.")
+}
+
+// function decodes the body of the share routes
+func shareRequest(w http.ResponseWriter, r *http.Request) *album.ShareMessage {
+	if r.Body == nil {
+		http.Error(w, "empty body", 400)
+		return nil
+	}
+	defer r.Body.Close()
+	message := &album.ShareMessage{}
+	if err := json.NewDecoder(r.Body).Decode(message); err != nil {
+		logger.Info("Cannot not decode body received for share with error " + err.Error())
+		http.Error(w, "Cannot not decode body received for share", 400)
+		return nil
+	}
+	return message
+}
+
+// route of the read-only gallery of the share links, it does not need any account :
+// /gallery/{token} returns the page of the album, /gallery/{token}/thumbnail/{md5sum} the thumbnails
+// and /gallery/{token}/photo/{md5sum} the originals if the share link allows the download
+func Gallery(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, database.SHARE_GALLERY_PATH), "/")
+	if len(parts) != 1 && len(parts) != 3 {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	db, err := database.NewDatabase()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	share, err := database.ValidShare(db, parts[0], time.Now())
+	switch {
+	case err == database.ShareNotFound:
+		http.NotFound(w, r)
+		return
+	case err == database.ShareExpired:
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	case err != nil:
+		logger.Errorf("Error while getting the share link with error %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(parts) == 1 {
+		galleryAlbum(w, r, db, share)
+		return
+	}
+	if !galleryAllowed(r, share) {
+		http.Error(w, "password expected", http.StatusUnauthorized)
+		return
+	}
+	record, err := database.SharedPhoto(db, share, parts[2])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	switch parts[1] {
+	case "thumbnail":
+		galleryThumbnail(w, r, db, record)
+	case "photo":
+		if !share.Download {
+			http.Error(w, "the download of the photos is not allowed", http.StatusForbidden)
+			return
+		}
+		galleryPhoto(w, r, db, record)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// function returns true if the visitor gave the password of the share link (cookie of the gallery)
+func galleryAllowed(r *http.Request, share *database.DatabaseShareRecord) bool {
+	if !share.Protected() {
+		return true
+	}
+	cookie, err := r.Cookie(SHARE_COOKIE)
+	return err == nil && share.CheckProof(cookie.Value)
+}
+
+// function writes the page of the album of the share link, the password form sets the cookie of the gallery
+func galleryAlbum(w http.ResponseWriter, r *http.Request, db database.DatabaseInterface, share *database.DatabaseShareRecord) {
+	path := database.SHARE_GALLERY_PATH + share.Token
+	page := &galleryPage{Album: &database.DatabaseAlbumRecord{AlbumName: share.AlbumName}, Path: path, Download: share.Download, Expires: share.Expires}
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		if share.CheckPassword(r.PostFormValue("password")) {
+			proof, err := share.Proof()
+			if err != nil {
+				logger.Errorf("Cannot sign the password of the share link of the album %s with error %v", share.AlbumName, err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     SHARE_COOKIE,
+				Value:    proof,
+				Path:     path,
+				Expires:  share.Expires,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+				Secure:   r.TLS != nil,
+			})
+			http.Redirect(w, r, path, http.StatusSeeOther)
+			return
+		}
+		logger.Warnf("Wrong password of the share link of the album %s from %s", share.AlbumName, r.RemoteAddr)
+		time.Sleep(LOGIN_FAILURE_DELAY)
+		page.WrongPassword = true
+	}
+	if galleryAllowed(r, share) {
+		page.Album = db.GetAlbumData(share.AlbumName)
+	} else {
+		page.Password = true
+		status = http.StatusUnauthorized
+	}
+	var buf bytes.Buffer
+	if err := galleryTemplate.Execute(&buf, page); err != nil {
+		logger.Errorf("Error while writing the gallery of the album %s with error %v", share.AlbumName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// function returns the copies of the photo, the online copies first
+func galleryLocations(db database.DatabaseInterface, record *database.DatabasePhotoRecord) []*database.PhotoLocation {
+	locations, err := db.GetPhotoLocations(record.Md5sum)
+	if err != nil {
+		logger.Errorf("Error while getting the copies of %s with error %v", record.Md5sum, err)
+	}
+	return database.OrderLocations(locations, record.MachineId)
+}
+
+// function writes the thumbnail of the photo read on the machines of its copies,
+// the thumbnail stored in the database is written if no machine answers
+func galleryThumbnail(w http.ResponseWriter, r *http.Request, db database.DatabaseInterface, record *database.DatabasePhotoRecord) {
+	client := webclient.NewPhotoExifClient()
+	content := []byte{}
+	for _, location := range galleryLocations(db, record) {
+		slave := slavehandler.GetSlaves().Slaves[location.MachineId]
+		if slave == nil {
+			continue
+		}
+		err, data := client.GetThumbnail(slave, location.Filepath)
+		if err != nil || data == "" {
+			logger.Errorf("Error while getting thumbnail %s from machine id %s with error %v", location.Filepath, location.MachineId, err)
+			continue
+		}
+		if content, err = base64.StdEncoding.DecodeString(data); err == nil {
+			break
+		}
+		logger.Errorf("Error while decoding thumbnail %s from machine id %s with error %v", location.Filepath, location.MachineId, err)
+	}
+	if len(content) == 0 {
+		thumbnail, err := db.GetThumbnail(record.Md5sum)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		content = thumbnail.Content
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeContent(w, r, record.Md5sum+".png", time.Time{}, bytes.NewReader(content))
+}
+
+// function writes the original of the photo read on the machines of its copies
+func galleryPhoto(w http.ResponseWriter, r *http.Request, db database.DatabaseInterface, record *database.DatabasePhotoRecord) {
+	client := webclient.NewPhotoExifClient()
+	for _, location := range galleryLocations(db, record) {
+		if location.MachineId == modele.ORIGIN_FLICKR || location.MachineId == modele.ORIGIN_GOOGLE {
+			http.Redirect(w, r, location.Filepath, http.StatusFound)
+			return
+		}
+		slave := slavehandler.GetSlaves().Slaves[location.MachineId]
+		if slave == nil {
+			continue
+		}
+		err, raw := client.GetOriginal(slave, location.Filepath)
+		if err == nil && raw.Base64Content == "" {
+			err = errors.New("empty photo")
+		}
+		if err != nil {
+			logger.Errorf("Error while getting file %s from machine id %s with error %v", location.Filepath, location.MachineId, err)
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(raw.Base64Content)
+		if err != nil {
+			logger.Errorf("Error while decoding file %s from machine id %s with error %v", location.Filepath, location.MachineId, err)
+			continue
+		}
+		BinaryAsResponse(w, b, filepath.Base(location.Filepath))
+		return
+	}
+	http.Error(w, "no machine of the photo answered", http.StatusBadGateway)
+}
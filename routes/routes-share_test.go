@@ -0,0 +1,86 @@
+package routes
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/configurationapp"
+	"github.com/jeromelesaux/photo/database"
+)
+
+func TestGallery(t *testing.T) {
+	dir := t.TempDir()
+	confFile := filepath.Join(dir, "conf.json")
+	os.WriteFile(confFile, []byte(`{"database_path":"`+filepath.Join(dir, "photo.db")+`","database_type":"sqlite"}`), 0644)
+	configurationapp.LoadPhotoExifConfiguration(confFile)
+	db, err := database.NewDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbnail := base64.StdEncoding.EncodeToString([]byte("png content"))
+	db.RestorePhoto(&database.BackupPhotoRecord{Md5sum: "md5-1", MachineId: "mymachineid", Filename: "a.jpg", Filepath: "/a.jpg", Type: ".jpg", Thumbnail: thumbnail})
+	db.RestorePhoto(&database.BackupPhotoRecord{Md5sum: "md5-2", MachineId: "mymachineid", Filename: "b.jpg", Filepath: "/b.jpg", Type: ".jpg", Thumbnail: thumbnail})
+	db.InsertNewAlbum(album.NewAlbumMessage("wedding", []string{"md5-1"}))
+	db.InsertNewAlbum(album.NewAlbumMessage("holidays", []string{"md5-2"}))
+
+	share, _ := database.NewDatabaseShareRecord(&album.ShareMessage{AlbumName: "wedding", Expires: time.Now().Add(time.Hour), Password: "secret"}, time.Now())
+	if err := db.InsertShare(share); err != nil {
+		t.Fatal(err)
+	}
+	path := database.SHARE_GALLERY_PATH + share.Token
+	gallery := func(method, target string, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if method == http.MethodPost {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		Gallery(w, r)
+		return w
+	}
+
+	if w := gallery(http.MethodGet, database.SHARE_GALLERY_PATH+"unknown", "", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown token, received %d", w.Code)
+	}
+	if w := gallery(http.MethodGet, path, "", nil); w.Code != http.StatusUnauthorized || strings.Contains(w.Body.String(), "md5-1") {
+		t.Fatalf("expected the password form, received %d %s", w.Code, w.Body.String())
+	}
+	if w := gallery(http.MethodGet, path+"/thumbnail/md5-1", "", nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without password, received %d", w.Code)
+	}
+	start := time.Now()
+	if w := gallery(http.MethodPost, path, url.Values{"password": {"wrong"}}.Encode(), nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a wrong password, received %d", w.Code)
+	}
+	if elapsed := time.Since(start); elapsed < LOGIN_FAILURE_DELAY {
+		t.Fatalf("expected the answer of a wrong password delayed, received after %v", elapsed)
+	}
+	w := gallery(http.MethodPost, path, url.Values{"password": {"secret"}}.Encode(), nil)
+	if w.Code != http.StatusSeeOther || len(w.Result().Cookies()) != 1 {
+		t.Fatalf("expected the cookie of the gallery, received %d", w.Code)
+	}
+	cookie := w.Result().Cookies()[0]
+
+	if w := gallery(http.MethodGet, path, "", cookie); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), path+"/thumbnail/md5-1") {
+		t.Fatalf("expected the photos of the wedding, received %d %s", w.Code, w.Body.String())
+	}
+	if w := gallery(http.MethodGet, path+"/thumbnail/md5-1", "", cookie); w.Code != http.StatusOK || w.Body.String() != "png content" {
+		t.Fatalf("expected the thumbnail of md5-1, received %d", w.Code)
+	}
+	if w := gallery(http.MethodGet, path+"/thumbnail/md5-2", "", cookie); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a photo of another album, received %d", w.Code)
+	}
+	if w := gallery(http.MethodGet, path+"/photo/md5-1", "", cookie); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without download, received %d", w.Code)
+	}
+}
@@ -5,15 +5,18 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/jeromelesaux/photo/album"
+	"github.com/jeromelesaux/photo/backup"
 	"github.com/jeromelesaux/photo/configurationapp"
 	"github.com/jeromelesaux/photo/configurationexif"
 	"github.com/jeromelesaux/photo/database"
@@ -24,16 +27,23 @@ import (
 	"github.com/jeromelesaux/photo/modele"
 	"github.com/jeromelesaux/photo/pdf"
 	"github.com/jeromelesaux/photo/slavehandler"
+	"github.com/jeromelesaux/photo/tlshandler"
 	"github.com/jeromelesaux/photo/webclient"
+	"github.com/pkg/errors"
 	logger "github.com/sirupsen/logrus"
 )
 
 func GetPhotosByTag(w http.ResponseWriter, r *http.Request) {
 	starttime := time.Now()
 	tag := r.URL.Query().Get("value")
+	filter, err := curationFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 
 	modele.PostActionMessage("calling query tag with value : " + tag)
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
 	if err != nil {
 		logger.Error("Error while getting dabatabse with error" + err.Error())
 		JsonAsResponse(w, err)
@@ -43,6 +53,7 @@ func GetPhotosByTag(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		JsonAsResponse(w, err)
 	}
+	response = filter.Records(response)
 	logger.Infof("QueryFilename returns %d records", len(response))
 	response = database.Reduce(response, modele.FILESIZE_LITTLE)
 	logger.Info("QueryFilename completed in " + strconv.FormatFloat(time.Now().Sub(starttime).Seconds(), 'g', 2, 64) + " seconds")
@@ -50,17 +61,37 @@ func GetPhotosByTag(w http.ResponseWriter, r *http.Request) {
 	JsonAsResponse(w, response)
 }
 
+// route returns the zip of the photos md5sums or of the photos of the album albumName
+// (and of its subalbums if recursive is true)
 func DownloadPhotos(w http.ResponseWriter, r *http.Request) {
 	p := r.URL.Query().Get("md5sums")
 	photosId := strings.Split(p, ",")
+	albumName := r.URL.Query().Get("albumName")
+	recursive, err := recursiveAlbum(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 	modele.PostActionMessage("Download files starts.")
 	defer modele.PostActionMessage("Download files ended.")
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
 	if err != nil {
 		modele.PostActionMessage(err.Error())
 		JsonAsResponse(w, err)
 		return
 	}
+	if albumName != "" {
+		content, err := albumContent(db, albumName, recursive)
+		if err != nil {
+			modele.PostActionMessage(err.Error())
+			JsonAsResponse(w, err)
+			return
+		}
+		photosId = make([]string, 0)
+		for _, record := range content.Records {
+			photosId = append(photosId, record.Md5sum)
+		}
+	}
 	response, err := db.GetPhotosUrl(photosId)
 	if err != nil {
 		modele.PostActionMessage(err.Error())
@@ -95,36 +126,64 @@ func DownloadPhotos(w http.ResponseWriter, r *http.Request) {
 	BinaryAsResponse(w, b.Bytes(), "content.zip")
 }
 
+// function returns the photos of the date of the groupby (day, week, month or year) taken between
+// the optional dates from and to (yyyy-mm-dd, included)
 func GetPhotosFromTime(w http.ResponseWriter, r *http.Request) {
 	groupby := r.URL.Query().Get("groupby")
 	queryDate := r.URL.Query().Get("date")
+	if queryDate != "" && !database.ValidGroupby(groupby) {
+		http.Error(w, "groupby must be day, week, month or year", 400)
+		return
+	}
+	dates, err := database.NewDateRange(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	filter, err := curationFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 	modele.PostActionMessage("Get Photos from time groupby " + groupby + " for date " + queryDate)
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
 	if err != nil {
 		modele.PostActionMessage(err.Error())
 		JsonAsResponse(w, err)
 		return
 	}
-	response, err := db.GetPhotosFromTime(queryDate, groupby)
+	response, err := db.GetPhotosFromTime(queryDate, groupby, dates)
 	if err != nil {
 		modele.PostActionMessage(err.Error())
 		JsonAsResponse(w, err)
 		return
 	}
+	response = filter.Records(response)
 	modele.PostActionMessage("Get photos from time ended and found " + strconv.Itoa(len(response)))
 	JsonAsResponse(w, response)
 }
 
+// function returns the number of photos by date of the groupby (day, week, month or year) taken between
+// the optional dates from and to (yyyy-mm-dd, included)
 func GetTimeStats(w http.ResponseWriter, r *http.Request) {
 	groupby := r.URL.Query().Get("groupby")
+	if !database.ValidGroupby(groupby) {
+		http.Error(w, "groupby must be day, week, month or year", 400)
+		return
+	}
+	dates, err := database.NewDateRange(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 	modele.PostActionMessage("Get stats Photos from time groupby " + groupby)
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
 	if err != nil {
 		modele.PostActionMessage(err.Error())
 		JsonAsResponse(w, err)
 		return
 	}
-	response, err := db.GetTimeStats(groupby)
+	response, err := db.GetTimeStats(groupby, dates)
 	if err != nil {
 		modele.PostActionMessage(err.Error())
 		JsonAsResponse(w, err)
@@ -137,8 +196,13 @@ func GetTimeStats(w http.ResponseWriter, r *http.Request) {
 func GetPhotosFromLocation(w http.ResponseWriter, r *http.Request) {
 	lat := r.URL.Query().Get("lat")
 	lng := r.URL.Query().Get("lng")
+	filter, err := curationFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 	modele.PostActionMessage("Get Photos from location with latitude : " + lat + " and longitude : " + lng)
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
 	if err != nil {
 		modele.PostActionMessage(err.Error())
 		JsonAsResponse(w, err)
@@ -150,13 +214,129 @@ func GetPhotosFromLocation(w http.ResponseWriter, r *http.Request) {
 		JsonAsResponse(w, err)
 		return
 	}
+	response = filter.Records(response)
 	modele.PostActionMessage("Get photos from location ended and found " + strconv.Itoa(len(response)))
 	JsonAsResponse(w, response)
 }
 
+// function returns the area of the request, the bounding box north, south, east and west or
+// the circle of radius meters around latitude and longitude. nil is returned without area parameters
+func requestArea(r *http.Request) (*database.GeoArea, error) {
+	values := r.URL.Query()
+	parse := func(names ...string) ([]float64, error) {
+		numbers := make([]float64, 0)
+		for _, name := range names {
+			number, err := strconv.ParseFloat(values.Get(name), 64)
+			if err != nil {
+				return numbers, errors.New("Invalid parameter " + name)
+			}
+			numbers = append(numbers, number)
+		}
+		return numbers, nil
+	}
+	switch {
+	case values.Get("radius") != "":
+		numbers, err := parse("latitude", "longitude", "radius")
+		if err != nil {
+			return nil, err
+		}
+		return database.NewRadiusArea(numbers[0], numbers[1], numbers[2])
+	case values.Get("north") != "" || values.Get("south") != "" || values.Get("east") != "" || values.Get("west") != "":
+		numbers, err := parse("north", "south", "east", "west")
+		if err != nil {
+			return nil, err
+		}
+		return database.NewBoundingBox(numbers[0], numbers[1], numbers[2], numbers[3])
+	}
+	return nil, nil
+}
+
+// function returns the photos of the bounding box (north, south, east, west) or
+// of the circle of radius meters around latitude and longitude
+func GetPhotosFromArea(w http.ResponseWriter, r *http.Request) {
+	area, err := requestArea(r)
+	if err == nil && area == nil {
+		err = errors.New("The area needs north, south, east and west or latitude, longitude and radius")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	filter, err := curationFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	modele.PostActionMessage("Get Photos from area " + r.URL.RawQuery)
+	db, err := database.NewDatabase()
+	if err != nil {
+		modele.PostActionMessage(err.Error())
+		JsonAsResponse(w, err)
+		return
+	}
+	response, err := db.GetPhotosFromArea(area)
+	if err != nil {
+		modele.PostActionMessage(err.Error())
+		JsonAsResponse(w, err)
+		return
+	}
+	response = filter.Records(response)
+	modele.PostActionMessage("Get photos from area ended and found " + strconv.Itoa(len(response)))
+	JsonAsResponse(w, response)
+}
+
+// function returns the clusters of photos for the zoom level of the map (0 to 21),
+// only the photos of the optional area are clustered
+func GetLocationClusters(w http.ResponseWriter, r *http.Request) {
+	zoom, err := strconv.Atoi(r.URL.Query().Get("zoom"))
+	if err != nil || zoom < 0 {
+		http.Error(w, "zoom must be a positive number", 400)
+		return
+	}
+	area, err := requestArea(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	db, err := database.NewDatabase()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	response, err := db.GetLocationClusters(zoom, area)
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	JsonAsResponse(w, response)
+}
+
+// function returns the number of photos by place, level is country (default), region or city
+func GetPlaceStats(w http.ResponseWriter, r *http.Request) {
+	level := r.URL.Query().Get("level")
+	if level == "" {
+		level = database.PLACE_COUNTRY
+	}
+	if !database.ValidPlaceLevel(level) {
+		http.Error(w, "level must be country, region or city", 400)
+		return
+	}
+	db, err := database.NewDatabase()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	response, err := db.GetPlaceStats(level)
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	JsonAsResponse(w, response)
+}
+
 func GetLocationStats(w http.ResponseWriter, r *http.Request) {
 	modele.PostActionMessage("calling get origin stats.")
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
 	if err != nil {
 		JsonAsResponse(w, err)
 		return
@@ -173,7 +353,7 @@ func GetLocationStats(w http.ResponseWriter, r *http.Request) {
 
 func GetOriginStats(w http.ResponseWriter, r *http.Request) {
 	modele.PostActionMessage("calling get origin stats.")
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
 	if err != nil {
 		JsonAsResponse(w, err)
 		return
@@ -255,7 +435,7 @@ func LoadFlickrAlbums(w http.ResponseWriter, r *http.Request) {
 		go func() {
 			flickrClient.GetData(flickrChan)
 		}()
-		db, err := database.NewDatabaseHandler()
+		db, err := database.NewDatabase()
 		if err != nil {
 			logger.Errorf("cannot connect to database with error %v", err)
 			return
@@ -331,7 +511,7 @@ func SaveGoogleConfiguration(w http.ResponseWriter, r *http.Request) {
 		go func() {
 			googleConf.GetData(googlePhotoChan)
 		}()
-		db, err := database.NewDatabaseHandler()
+		db, err := database.NewDatabase()
 		if err != nil {
 			logger.Errorf("cannot connect to database with error %v", err)
 			return
@@ -355,7 +535,7 @@ func SaveGoogleConfiguration(w http.ResponseWriter, r *http.Request) {
 	JsonAsResponse(w, "Configuration saved and imported data, please check log file to accept account usage")
 }
 
-// route create a new album by the name and the md5sums of the photos
+// route create a new album by the name and the md5sums of the photos (or the query of a smart album)
 func CreateNewPhotoAlbum(w http.ResponseWriter, r *http.Request) {
 	modele.PostActionMessage("calling create new album.")
 	if r.Body == nil {
@@ -374,14 +554,22 @@ func CreateNewPhotoAlbum(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Cannot not decode body received for registering", 400)
 		return
 	}
+	if _, err = database.SmartAlbumQuery(albumMessage); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 
 	logger.Info(albumMessage)
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
 	modele.PostActionMessage("calling create new album ended.")
 	if err != nil {
 		JsonAsResponse(w, err)
 		return
 	}
+	if !albumOwned(w, r, db, albumMessage.AlbumName) {
+		return
+	}
+	albumMessage.Owner = requestUser(r).Name
 	if err = db.InsertNewAlbum(albumMessage); err != nil {
 		JsonAsResponse(w, err)
 		return
@@ -410,11 +598,14 @@ func DeleteAlbum(w http.ResponseWriter, r *http.Request) {
 	}
 	logger.Info(albumMessage)
 
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
 	if err != nil {
 		JsonAsResponse(w, err)
 		return
 	}
+	if !albumOwned(w, r, db, albumMessage.AlbumName) {
+		return
+	}
 	if err = db.DeleteAlbum(albumMessage); err != nil {
 
 		JsonAsResponse(w, err)
@@ -445,11 +636,14 @@ func DeletePhotosAlbum(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	logger.Info(albumMessage)
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
 	if err != nil {
 		JsonAsResponse(w, err)
 		return
 	}
+	if !albumOwned(w, r, db, albumMessage.AlbumName) {
+		return
+	}
 	if err = db.DeletePhotoAlbum(albumMessage); err != nil {
 		JsonAsResponse(w, err)
 		return
@@ -462,6 +656,11 @@ func GenerateAlbumPdf(w http.ResponseWriter, r *http.Request) {
 	var photosid []string
 	albumName := r.URL.Query().Get("albumName")
 	numberPhotosPerPage := r.URL.Query().Get("numberPhotosPerPage")
+	recursive, err := recursiveAlbum(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 	c, err := url.ParseQuery(r.URL.RawQuery)
 	if err != nil {
 		JsonAsResponse(w, "An error occured while generating pdf for album :"+albumName+" "+err.Error())
@@ -476,12 +675,16 @@ func GenerateAlbumPdf(w http.ResponseWriter, r *http.Request) {
 	modele.PostActionMessage("calling generate pdf album for album : " + albumName)
 
 	logger.Info("Generate album : " + albumName)
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	content, err := albumContent(db, albumName, recursive)
 	if err != nil {
 		JsonAsResponse(w, err)
 		return
 	}
-	content := db.GetAlbumData(albumName)
 	if content.AlbumName == albumName && len(content.Records) > 0 {
 		logger.Infof("album %s contents %d photos.", content.AlbumName, len(content.Records))
 		if (len(content.Records) > 150 && len(photosid) == 0) || len(photosid) > 150 {
@@ -492,9 +695,10 @@ func GenerateAlbumPdf(w http.ResponseWriter, r *http.Request) {
 		selected := database.NewDatabaseAlbumRecord()
 		logger.Infof("photosid:%v", photosid)
 		if len(photosid) > 0 {
+			// the selected photos are in the order of the album
 			selected.AlbumName = content.AlbumName
-			for _, id := range photosid {
-				for _, photo := range content.Records {
+			for _, photo := range content.Records {
+				for _, id := range photosid {
 					if photo.Md5sum == id {
 						selected.Records = append(selected.Records, photo)
 						break
@@ -546,13 +750,20 @@ func UpdateAlbum(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Cannot not decode body received for registering", 400)
 		return
 	}
+	if _, err = database.SmartAlbumQuery(albumMessage); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 	logger.Info(albumMessage)
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
 	modele.PostActionMessage("calling update album content ended.")
 	if err != nil {
 		JsonAsResponse(w, err)
 		return
 	}
+	if !albumOwned(w, r, db, albumMessage.AlbumName) {
+		return
+	}
 	if err = db.UpdateAlbum(albumMessage); err != nil {
 		JsonAsResponse(w, err)
 		return
@@ -566,7 +777,7 @@ func UpdateAlbum(w http.ResponseWriter, r *http.Request) {
 func ListPhotoAlbums(w http.ResponseWriter, r *http.Request) {
 	modele.PostActionMessage("calling get albums list.")
 
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
 	if err != nil {
 		JsonAsResponse(w, err)
 		return
@@ -576,17 +787,75 @@ func ListPhotoAlbums(w http.ResponseWriter, r *http.Request) {
 	JsonAsResponse(w, albums)
 }
 
+// route returns the root albums with their subalbums and their numbers of photos
+func GetAlbumTree(w http.ResponseWriter, r *http.Request) {
+	db, err := database.NewDatabase()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	tree, err := db.GetAlbumTree()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	JsonAsResponse(w, tree)
+}
+
+// route moves the album of the body under its parent album
+func MoveAlbum(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		http.Error(w, "empty body", 400)
+		return
+	}
+	defer r.Body.Close()
+	message := &album.MoveAlbumMessage{}
+	if err := json.NewDecoder(r.Body).Decode(message); err != nil {
+		logger.Info("Cannot not decode body received for album move with error " + err.Error())
+		http.Error(w, "Cannot not decode body received for album move", 400)
+		return
+	}
+	db, err := database.NewDatabase()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	if !albumOwned(w, r, db, message.AlbumName) {
+		return
+	}
+	if err := db.MoveAlbum(message.AlbumName, message.Parent); err != nil {
+		photosUpdateError(w, err)
+		return
+	}
+	JsonAsResponse(w, "Album "+message.AlbumName+" moved.")
+}
+
 func GetAlbumData(w http.ResponseWriter, r *http.Request) {
 
 	albumName := r.URL.Query().Get("albumName")
+	page, err := pageRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	filter, err := curationFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 
 	modele.PostActionMessage("calling get album content for album : " + albumName)
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
 	if err != nil {
 		JsonAsResponse(w, err)
 		return
 	}
+	if page != nil {
+		PageAsResponse(w, db, filter.Search(&database.SearchRequest{Field: database.SEARCH_ALBUM, Value: albumName}), page)
+		return
+	}
 	content := db.GetAlbumData(albumName)
+	content.Records = filter.Records(content.Records)
 	modele.PostActionMessage("calling get album content for album : " + albumName + " ended.")
 	JsonAsResponse(w, content)
 }
@@ -624,7 +893,7 @@ func ReadExtensionList(w http.ResponseWriter, r *http.Request) {
 
 // route : purpose clean the database redundance
 func CleanDatabase(w http.ResponseWriter, r *http.Request) {
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
 	modele.PostActionMessage("calling clean database.")
 	if err != nil {
 		JsonAsResponse(w, err)
@@ -644,6 +913,9 @@ func CleanDatabase(w http.ResponseWriter, r *http.Request) {
 // route thumbnail  of the filpath (encoded in url)
 func GetPhoto(w http.ResponseWriter, r *http.Request) {
 	filePath := r.URL.Query().Get("filepath")
+	if !scanRootAllowed(w, r, filePath) {
+		return
+	}
 	content, orientation, err := exifhandler.GetBase64Photo(filePath)
 	if err != nil {
 		JsonAsResponse(w, err)
@@ -652,24 +924,62 @@ func GetPhoto(w http.ResponseWriter, r *http.Request) {
 	JsonAsResponse(w, &modele.ExportRawPhoto{Filename: filePath, Base64Content: content, Orientation: orientation})
 }
 
+// route: returns the original photo of the machine, the other copies of the md5sum are tried if the machine is offline,
+// only the copies recorded for the md5sum are served
 func GetLocalPhoto(w http.ResponseWriter, r *http.Request) {
 	filePath := r.URL.Query().Get("filepath")
 	machineid := r.URL.Query().Get("machineid")
-	if slave := slavehandler.GetSlaves().Slaves[machineid]; slave != nil {
-		client := webclient.NewPhotoExifClient()
-		err, raw := client.GetOriginal(slave, filePath)
-		if err != nil {
-			logger.Errorf("Error while getting file %s from machine id %s with error %v", filePath, machineid, err)
-			JsonAsResponse(w, err)
+	md5sum := r.URL.Query().Get("md5sum")
+	if md5sum == "" {
+		http.Error(w, "md5sum expected", http.StatusBadRequest)
+		return
+	}
+	db, err := database.NewDatabase()
+	if err != nil {
+		logger.Errorf("Error while getting the database with error %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	copies, err := db.GetPhotoLocations(md5sum)
+	if err != nil {
+		logger.Errorf("Error while getting the copies of %s with error %v", md5sum, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	locations, err := photoLocations(copies, md5sum, machineid, filePath)
+	if err != nil {
+		logger.Warnf("Refused the file %s of machine id %s for %s from %s", filePath, machineid, md5sum, r.RemoteAddr)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	var lastErr error
+	client := webclient.NewPhotoExifClient()
+	for _, location := range locations {
+		if location.MachineId == modele.ORIGIN_FLICKR || location.MachineId == modele.ORIGIN_GOOGLE {
+			http.Redirect(w, r, location.Filepath, http.StatusFound)
 			return
 		}
+		slave := slavehandler.GetSlaves().Slaves[location.MachineId]
+		if slave == nil {
+			continue
+		}
+		err, raw := client.GetOriginal(slave, location.Filepath)
+		if err != nil {
+			logger.Errorf("Error while getting file %s from machine id %s with error %v", location.Filepath, location.MachineId, err)
+			lastErr = err
+			continue
+		}
 		b, err := base64.StdEncoding.DecodeString(raw.Base64Content)
 		if err != nil {
-			logger.Errorf("Error while decoding file %s from machine id %s with error %v", filePath, machineid, err)
-			JsonAsResponse(w, err)
-			return
+			logger.Errorf("Error while decoding file %s from machine id %s with error %v", location.Filepath, location.MachineId, err)
+			lastErr = err
+			continue
 		}
-		BinaryAsResponse(w, b, filepath.Base(filePath))
+		BinaryAsResponse(w, b, filepath.Base(location.Filepath))
+		return
+	}
+	if lastErr != nil {
+		JsonAsResponse(w, lastErr)
 		return
 	}
 
@@ -677,9 +987,39 @@ func GetLocalPhoto(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// function returns the copies of the photo to try, the requested copy first, an error if the copy is not recorded
+func photoLocations(copies []*database.PhotoLocation, md5sum string, machineid string, path string) ([]*database.PhotoLocation, error) {
+	var requested *database.PhotoLocation
+	others := make([]*database.PhotoLocation, 0)
+	for _, location := range copies {
+		if requested == nil && location.MachineId == machineid && location.Filepath == path {
+			requested = location
+			continue
+		}
+		others = append(others, location)
+	}
+	if requested == nil {
+		return nil, errors.Wrapf(database.PictureNotFound, "%s on %s %s", md5sum, machineid, path)
+	}
+	return append([]*database.PhotoLocation{requested}, database.OrderLocations(others, machineid)...), nil
+}
+
+// function returns true if the file or the directory is inside the scan roots of the slave, a 403 is answered otherwise
+func scanRootAllowed(w http.ResponseWriter, r *http.Request, path string) bool {
+	if configurationexif.LoadConfigurationAtOnce().InScanRoots(path) {
+		return true
+	}
+	logger.Warnf("Refused the file %s outside the scan roots from %s", path, r.RemoteAddr)
+	http.Error(w, "the file is outside the scan roots", http.StatusForbidden)
+	return false
+}
+
 // route thumbnail  of the filpath (encoded in url)
 func GetThumbnail(w http.ResponseWriter, r *http.Request) {
 	filePath := r.URL.Query().Get("filepath")
+	if !scanRootAllowed(w, r, filePath) {
+		return
+	}
 	response, err := exifhandler.GetBase64Thumbnail(filePath)
 	if err != nil {
 		JsonAsResponse(w, err)
@@ -701,29 +1041,109 @@ func GetRegisteredSlaves(w http.ResponseWriter, r *http.Request) {
 	JsonAsResponse(w, message)
 }
 
-// route: register a new slave that call this web service
+// route: register a new slave that call this web service, the first registration of a slave needs an enrolment token
+// and returns the secret of the slave, the next registrations are signed with this secret
 func RegisterSlave(w http.ResponseWriter, r *http.Request) {
-	if r.Body == nil {
-		http.Error(w, "empty body", 400)
+	// in mutual tls the slaves present a certificate of the local CA and are called in https
+	if tlshandler.MutualTLS() && !tlshandler.VerifiedClient(r) {
+		http.Error(w, "a client certificate of the local CA is expected", http.StatusUnauthorized)
 		return
 	}
-	defer r.Body.Close()
-
-	slave := &slavehandler.Slave{}
-	err := json.NewDecoder(r.Body).Decode(slave)
+	body, err := slavehandler.ReadSignedBody(r)
 	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	registration := &slavehandler.Registration{}
+	if err := json.Unmarshal(body, registration); err != nil {
 		logger.Info("Cannot not decode body received for registering with error " + err.Error())
-		body, _ := ioutil.ReadAll(r.Body)
 		logger.Debug("Body received : " + string(body))
 		http.Error(w, "Cannot not decode body received for registering", 400)
 		return
 	}
-	slavehandler.AddSlave(slave)
-	logger.Infof("%v %s\n", *slave, "is registered")
+	if tlshandler.MutualTLS() && !strings.HasPrefix(registration.Url, "https://") {
+		http.Error(w, "the slave must serve https", 400)
+		return
+	}
+	if registration.EnrolmentToken != "" {
+		secret, err := slavehandler.Enrol(&registration.Slave, registration.EnrolmentToken)
+		if err != nil {
+			logger.Warnf("Enrolment of the slave %s from %s refused with error %v", registration.Name, r.RemoteAddr, err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		modele.PostActionMessage("slave " + registration.Name + " enrolled.")
+		JsonAsResponse(w, secret)
+		return
+	}
+	slave, err := slavehandler.VerifySlaveRequest(r, body)
+	if err != nil {
+		logger.Warnf("Registration of the slave %s from %s refused with error %v", r.Header.Get(slavehandler.MACHINE_HEADER), r.RemoteAddr, err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if registration.Name != slave.Name {
+		http.Error(w, "the name of the slave does not match its signature", 400)
+		return
+	}
+	registration.Secret = slave.Secret
+	slavehandler.AddSlave(&registration.Slave)
+	logger.Infof("%s %s\n", slave.Name, "is registered")
 
 	JsonAsResponse(w, "ok")
 }
 
+// route returns a new enrolment token for the registration of a slave (option -enrolmenttoken of photo-exif),
+// the token of the parameter machineId gives a new secret to this enrolled slave
+func NewEnrolmentToken(w http.ResponseWriter, r *http.Request) {
+	token, err := slavehandler.NewEnrolmentToken(r.URL.Query().Get("machineId"))
+	if errors.Cause(err) == slavehandler.SlaveNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	JsonAsResponse(w, token)
+}
+
+// route removes the slave machineId and its secret, the slave needs a new enrolment token to register again
+func RevokeSlave(w http.ResponseWriter, r *http.Request) {
+	machineId := r.URL.Query().Get("machineId")
+	if err := slavehandler.RevokeSlave(machineId); err != nil {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	modele.PostActionMessage("slave " + machineId + " revoked.")
+	JsonAsResponse(w, "Slave "+machineId+" revoked.")
+}
+
+// function returns the handler of the slave allowed to the requests signed by the controller with the secret of the slave
+func SlaveRoute(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret := slavehandler.GetSlaveSecret()
+		if secret == nil {
+			http.Error(w, "the slave is not enrolled", http.StatusServiceUnavailable)
+			return
+		}
+		body, err := slavehandler.ReadSignedBody(r)
+		if err == nil && r.Header.Get(slavehandler.MACHINE_HEADER) != secret.MachineId {
+			err = slavehandler.WrongSignature
+		}
+		if err == nil {
+			err = slavehandler.VerifyRequest(r, body, secret.Secret)
+		}
+		if err != nil {
+			logger.Warnf("Request %s from %s refused with error %v", r.URL.Path, r.RemoteAddr, err)
+			http.Error(w, "signed request expected", http.StatusUnauthorized)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		h(w, r)
+	}
+}
+
 // route : browse the directory (encoded in the value variable) on the machineId
 func Browse(w http.ResponseWriter, r *http.Request) {
 	//usr, _ := user.Current()
@@ -778,7 +1198,7 @@ func ScanFolders(w http.ResponseWriter, r *http.Request) {
 		response = "Scans launched."
 	}
 	modele.PostActionMessage("calling scan folders for machineid " + folders.MachineId)
-	go client.ScanFoldersClient(folders.Folders, folders.MachineId, conf)
+	go client.ScanFoldersClient(folders.Folders, folders.MachineId, folders.Full, conf)
 
 	JsonAsResponse(w, response)
 }
@@ -786,6 +1206,9 @@ func ScanFolders(w http.ResponseWriter, r *http.Request) {
 func GetFileInformations(w http.ResponseWriter, r *http.Request) {
 	starttime := time.Now()
 	filepathValue := r.URL.Query().Get("value")
+	if !scanRootAllowed(w, r, filepathValue) {
+		return
+	}
 	logger.Info("file to scan " + filepathValue)
 	response := &modele.PhotoResponse{
 		Version: modele.VERSION,
@@ -801,16 +1224,39 @@ func GetFileInformations(w http.ResponseWriter, r *http.Request) {
 	JsonAsResponse(w, response)
 }
 
+// route : writes the corrections of the body in the photo or its xmp sidecar on the slave
+func WriteMetadata(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		http.Error(w, "empty body", 400)
+		return
+	}
+	defer r.Body.Close()
+	update := &modele.MetadataUpdate{}
+	if err := json.NewDecoder(r.Body).Decode(update); err != nil {
+		logger.Info("Cannot not decode body received for metadata with error " + err.Error())
+		http.Error(w, "Cannot not decode body received for metadata", 400)
+		return
+	}
+	if !scanRootAllowed(w, r, update.Filepath) {
+		return
+	}
+	result, err := exifhandler.WriteMetadata(update, configurationexif.LoadConfigurationAtOnce())
+	if err != nil {
+		logger.Errorf("Cannot write the metadata of %s with error %v", update.Filepath, err)
+		result = &modele.MetadataResult{Md5Sum: update.Md5Sum, Filepath: update.Filepath, DryRun: update.DryRun, Message: err.Error()}
+	}
+	JsonAsResponse(w, result)
+}
+
 func GetDirectoryInformations(w http.ResponseWriter, r *http.Request) {
 	starttime := time.Now()
-	response := &modele.PhotoResponse{
-		Version: modele.VERSION,
-		Photos:  make([]*modele.PhotoInformations, 0),
-	}
 	directorypath := r.URL.Query().Get("value")
+	full := r.URL.Query().Get("full") == "true"
+	if !scanRootAllowed(w, r, directorypath) {
+		return
+	}
 	logger.Info("directory to scan " + directorypath)
-	pinfos, err := exifhandler.GetPhotosInformations(directorypath, configurationexif.LoadConfigurationAtOnce())
-	response.Photos = pinfos
+	response, err := exifhandler.ScanDirectory(directorypath, configurationexif.LoadConfigurationAtOnce(), full)
 	if err != nil {
 		response.Message = err.Error()
 	}
@@ -827,15 +1273,20 @@ func QueryExtension(w http.ResponseWriter, r *http.Request) {
 	if size == "" {
 		size = modele.FILESIZE_LITTLE
 	}
+	filter, err := curationFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 	modele.PostActionMessage("calling query extension with value : " + filename + " and filesize : " + size)
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
 	if err != nil {
 		logger.Error("Error while getting dabatabse with error" + err.Error())
 		JsonAsResponse(w, err)
 		return
 	}
 	response, err := db.QueryExtension(filename)
-	response = database.Reduce(response, size)
+	response = database.Reduce(filter.Records(response), size)
 	logger.Info("QueryExtension completed in " + strconv.FormatFloat(time.Now().Sub(starttime).Seconds(), 'g', 2, 64) + " seconds")
 	modele.PostActionMessage("calling query extension with value : " + filename + " and filesize : " + size + " ended.")
 	if err != nil {
@@ -853,15 +1304,29 @@ func QueryExif(w http.ResponseWriter, r *http.Request) {
 	if size == "" {
 		size = modele.FILESIZE_LITTLE
 	}
+	page, err := pageRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	filter, err := curationFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 	modele.PostActionMessage("calling query exif with value : " + pattern + " and exiftag : " + exiftag + " and filesize : " + size)
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
 	if err != nil {
 		logger.Error("Error while getting dabatabse with error" + err.Error())
 		JsonAsResponse(w, err)
 		return
 	}
+	if page != nil {
+		PageAsResponse(w, db, filter.Search(&database.SearchRequest{Field: database.SEARCH_EXIF, Tag: exiftag, Value: pattern}), page)
+		return
+	}
 	response, err := db.QueryExifTag(pattern, exiftag)
-	response = database.Reduce(response, size)
+	response = database.Reduce(filter.Records(response), size)
 	logger.Info("QueryExif completed in " + strconv.FormatFloat(time.Now().Sub(starttime).Seconds(), 'g', 2, 64) + " seconds")
 	modele.PostActionMessage("calling query exif with value : " + pattern + " and exiftag : " + exiftag + " and filesize : " + size + " ended.")
 	if err != nil {
@@ -878,34 +1343,118 @@ func QueryFilename(w http.ResponseWriter, r *http.Request) {
 	if size == "" {
 		size = modele.FILESIZE_LITTLE
 	}
+	page, err := pageRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	filter, err := curationFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 	modele.PostActionMessage("calling query filename with value : " + filename + " and filesize : " + size)
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
 	if err != nil {
 		logger.Error("Error while getting dabatabse with error" + err.Error())
 		JsonAsResponse(w, err)
 		return
 	}
+	if page != nil {
+		PageAsResponse(w, db, filter.Search(&database.SearchRequest{Field: database.SEARCH_FILENAME, Value: filename}), page)
+		return
+	}
 	response, err := db.QueryFilename(filename)
 	if err != nil {
 		JsonAsResponse(w, err)
 	}
 	logger.Infof("QueryFilename returns %d records", len(response))
-	response = database.Reduce(response, size)
+	response = database.Reduce(filter.Records(response), size)
 	logger.Info("QueryFilename completed in " + strconv.FormatFloat(time.Now().Sub(starttime).Seconds(), 'g', 2, 64) + " seconds")
 	modele.PostActionMessage("calling query filename with value : " + filename + " and filesize : " + size + " ended.")
 	JsonAsResponse(w, response)
 }
 
+// route searches the photos matching the and, or, not combination of predicates of the body
+func Search(w http.ResponseWriter, r *http.Request) {
+	starttime := time.Now()
+	size := r.URL.Query().Get("filesize")
+	if size == "" {
+		size = modele.FILESIZE_LITTLE
+	}
+	if r.Body == nil {
+		http.Error(w, "empty body", 400)
+		return
+	}
+	defer r.Body.Close()
+	request := &database.SearchRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		logger.Info("Cannot not decode body received for search with error " + err.Error())
+		http.Error(w, "Cannot not decode body received for search", 400)
+		return
+	}
+	if err := request.Validate(); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	page, err := pageRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	filter, err := curationFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	request = filter.Search(request)
+	modele.PostActionMessage("calling search.")
+	db, err := database.NewDatabase()
+	if err != nil {
+		logger.Error("Error while getting dabatabse with error" + err.Error())
+		JsonAsResponse(w, err)
+		return
+	}
+	if page != nil {
+		PageAsResponse(w, db, request, page)
+		return
+	}
+	response, err := db.Search(request)
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	response = database.Reduce(response, size)
+	logger.Info("Search completed in " + strconv.FormatFloat(time.Now().Sub(starttime).Seconds(), 'g', 2, 64) + " seconds")
+	modele.PostActionMessage("calling search ended and found " + strconv.Itoa(len(response)))
+	JsonAsResponse(w, response)
+}
+
 func QueryAll(w http.ResponseWriter, r *http.Request) {
 	starttime := time.Now()
+	page, err := pageRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	filter, err := curationFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 	modele.PostActionMessage("calling query all.")
-	db, err := database.NewDatabaseHandler()
+	db, err := database.NewDatabase()
 	if err != nil {
 		logger.Error("Error while getting dabatabse with error" + err.Error())
 		JsonAsResponse(w, err)
 		return
 	}
+	if page != nil {
+		PageAsResponse(w, db, filter.Search(nil), page)
+		return
+	}
 	response, err := db.QueryAll()
+	response = filter.Records(response)
 
 	logger.Info("QueryAll completed in " + strconv.FormatFloat(time.Now().Sub(starttime).Seconds(), 'g', 2, 64) + " seconds")
 	modele.PostActionMessage("calling query ended.")
@@ -916,6 +1465,153 @@ func QueryAll(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// function returns the filter of the rating (minimum stars), favourite and label parameters,
+// nil if the client does not filter the photos
+func curationFilter(r *http.Request) (*database.CurationFilter, error) {
+	q := r.URL.Query()
+	return database.NewCurationFilter(q.Get("rating"), q.Get("favourite"), q.Get("label"))
+}
+
+// function returns the value of the recursive parameter of the album routes, false by default
+func recursiveAlbum(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("recursive")
+	if value == "" {
+		return false, nil
+	}
+	recursive, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New("recursive must be true or false")
+	}
+	return recursive, nil
+}
+
+// function returns the photos of the album, with the photos of its subalbums if recursive is true
+func albumContent(db database.DatabaseInterface, albumName string, recursive bool) (*database.DatabaseAlbumRecord, error) {
+	if recursive {
+		return database.GetAlbumTreeData(db, albumName)
+	}
+	return db.GetAlbumData(albumName), nil
+}
+
+// function returns the page request of the limit, cursor and sort parameters,
+// nil if the client does not ask for a page
+func pageRequest(r *http.Request) (*database.PageRequest, error) {
+	q := r.URL.Query()
+	if q.Get("limit") == "" && q.Get("cursor") == "" && q.Get("sort") == "" {
+		return nil, nil
+	}
+	return database.NewPageRequest(q.Get("limit"), q.Get("cursor"), q.Get("sort"))
+}
+
+// function writes the page of the photos matching the search request (all photos if nil)
+func PageAsResponse(w http.ResponseWriter, db database.DatabaseInterface, request *database.SearchRequest, page *database.PageRequest) {
+	response, err := db.SearchPage(request, page)
+	if err != nil {
+		logger.Error("Error while getting page with error " + err.Error())
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	if response.Total != nil {
+		logger.Infof("page returns %d records on %d", len(response.Records), *response.Total)
+	} else {
+		logger.Infof("page returns %d records", len(response.Records))
+	}
+	JsonAsResponse(w, response)
+}
+
+// function returns the thumbnail of the photo /thumbnail/{md5sum}, the thumbnail identifier
+// is its content hash and is used as etag
+func GetStoredThumbnail(w http.ResponseWriter, r *http.Request) {
+	md5sum := strings.TrimPrefix(r.URL.Path, "/thumbnail/")
+	if md5sum == "" || strings.Contains(md5sum, "/") {
+		http.Error(w, "md5sum expected", 400)
+		return
+	}
+	db, err := database.NewDatabase()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	thumbnail, err := db.GetThumbnail(md5sum)
+	if err == database.ThumbnailNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Errorf("Error while getting thumbnail of %s with error %v", md5sum, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	// the route is authenticated, the shared caches must not serve the thumbnail to another user
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("ETag", "\""+thumbnail.Id+"\"")
+	http.ServeContent(w, r, md5sum+".png", time.Time{}, bytes.NewReader(thumbnail.Content))
+}
+
+// function returns the backup archive of the library, the archive is written in a temporary file
+// to block the writes in the database only while the archive is built
+func Backup(w http.ResponseWriter, r *http.Request) {
+	modele.PostActionMessage("calling backup.")
+	defer modele.PostActionMessage("calling backup ended.")
+	db, err := database.NewDatabase()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	f, err := os.CreateTemp("", "photo-backup-*.zip")
+	if err != nil {
+		logger.Error("Cannot create backup file with error " + err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := backup.Write(f, db); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	filename := "photo-backup-" + time.Now().Format("20060102-150405") + ".zip"
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	http.ServeContent(w, r, filename, time.Now(), f)
+}
+
+// function restores the backup archive sent in the body
+func Restore(w http.ResponseWriter, r *http.Request) {
+	modele.PostActionMessage("calling restore.")
+	defer modele.PostActionMessage("calling restore ended.")
+	if r.Body == nil {
+		http.Error(w, "empty body", 400)
+		return
+	}
+	defer r.Body.Close()
+	f, err := os.CreateTemp("", "photo-restore-*.zip")
+	if err != nil {
+		logger.Error("Cannot create restore file with error " + err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	size, err := io.Copy(f, r.Body)
+	if err != nil {
+		http.Error(w, "Cannot read the backup received", 400)
+		return
+	}
+	db, err := database.NewDatabase()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	report, err := backup.Restore(f, size, db)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	JsonAsResponse(w, report)
+}
+
 func JsonAsResponse(w http.ResponseWriter, o interface{}) {
 	js, err := json.Marshal(o)
 	if err != nil {
@@ -933,3 +1629,335 @@ func BinaryAsResponse(w http.ResponseWriter, o []byte, filename string) {
 	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
 	w.Write(o)
 }
+
+// function decodes the body of the album order routes
+func albumOrderRequest(w http.ResponseWriter, r *http.Request) *album.AlbumOrderMessage {
+	if r.Body == nil {
+		http.Error(w, "empty body", 400)
+		return nil
+	}
+	defer r.Body.Close()
+	message := &album.AlbumOrderMessage{}
+	if err := json.NewDecoder(r.Body).Decode(message); err != nil {
+		logger.Info("Cannot not decode body received for album order with error " + err.Error())
+		http.Error(w, "Cannot not decode body received for album order", 400)
+		return nil
+	}
+	return message
+}
+
+// route moves the md5sums of the body at the beginning of the album, in their order
+func ReorderAlbum(w http.ResponseWriter, r *http.Request) {
+	message := albumOrderRequest(w, r)
+	if message == nil {
+		return
+	}
+	db, err := database.NewDatabase()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	if !albumOwned(w, r, db, message.AlbumName) {
+		return
+	}
+	if err := db.ReorderAlbum(message.AlbumName, message.Md5sums); err != nil {
+		photosUpdateError(w, err)
+		return
+	}
+	JsonAsResponse(w, "Album "+message.AlbumName+" reordered.")
+}
+
+// route inserts the md5sums of the body at the position of the album, at the end without position
+func InsertAlbumPhotos(w http.ResponseWriter, r *http.Request) {
+	message := albumOrderRequest(w, r)
+	if message == nil {
+		return
+	}
+	position := -1
+	if message.Position != nil {
+		position = *message.Position
+	}
+	db, err := database.NewDatabase()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	if !albumOwned(w, r, db, message.AlbumName) {
+		return
+	}
+	if err := db.InsertAlbumPhotos(message.AlbumName, message.Md5sums, position); err != nil {
+		photosUpdateError(w, err)
+		return
+	}
+	JsonAsResponse(w, "Album "+message.AlbumName+" updated.")
+}
+
+// route sorts the photos of the album by date taken (sort date or -date for the descending order)
+func SortAlbum(w http.ResponseWriter, r *http.Request) {
+	message := albumOrderRequest(w, r)
+	if message == nil {
+		return
+	}
+	if message.Sort != "date" && message.Sort != "-date" {
+		http.Error(w, "sort must be date or -date", 400)
+		return
+	}
+	db, err := database.NewDatabase()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	if !albumOwned(w, r, db, message.AlbumName) {
+		return
+	}
+	if err := db.SortAlbumByDate(message.AlbumName, message.Sort == "-date"); err != nil {
+		photosUpdateError(w, err)
+		return
+	}
+	JsonAsResponse(w, "Album "+message.AlbumName+" sorted.")
+}
+
+// route sets the cover photo of the album, an empty cover sets the first photo
+func SetAlbumCover(w http.ResponseWriter, r *http.Request) {
+	message := albumOrderRequest(w, r)
+	if message == nil {
+		return
+	}
+	db, err := database.NewDatabase()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	if !albumOwned(w, r, db, message.AlbumName) {
+		return
+	}
+	if err := db.SetAlbumCover(message.AlbumName, message.Cover); err != nil {
+		photosUpdateError(w, err)
+		return
+	}
+	JsonAsResponse(w, "Cover of album "+message.AlbumName+" updated.")
+}
+
+// function decodes the md5sums and keywords of the body of the keywords routes
+func photoKeywordsRequest(w http.ResponseWriter, r *http.Request) *album.PhotoKeywordsMessage {
+	if r.Body == nil {
+		http.Error(w, "empty body", 400)
+		return nil
+	}
+	defer r.Body.Close()
+	message := &album.PhotoKeywordsMessage{}
+	if err := json.NewDecoder(r.Body).Decode(message); err != nil {
+		logger.Info("Cannot not decode body received for keywords with error " + err.Error())
+		http.Error(w, "Cannot not decode body received for keywords", 400)
+		return nil
+	}
+	return message
+}
+
+// function writes the status of the error of the update of the photos or the albums, 404 if a photo
+// or an album is not stored
+func photosUpdateError(w http.ResponseWriter, err error) {
+	if cause := errors.Cause(err); cause == database.PictureNotFound || cause == database.AlbumNotFound {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	http.Error(w, err.Error(), 400)
+}
+
+// route writes the corrections of the body (date, coordinates, keywords, rating, description) in a copy of the photo
+// by its slave and updates the photo with its new md5sum. a photo with several copies is corrected in xmp sidecars
+// so its copies keep the same md5sum
+func UpdateMetadata(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		http.Error(w, "empty body", 400)
+		return
+	}
+	defer r.Body.Close()
+	update := &modele.MetadataUpdate{}
+	if err := json.NewDecoder(r.Body).Decode(update); err != nil {
+		logger.Info("Cannot not decode body received for metadata with error " + err.Error())
+		http.Error(w, "Cannot not decode body received for metadata", 400)
+		return
+	}
+	if err := update.Validate(); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	if len(update.Keywords) > 0 {
+		if _, err := database.NormalizeKeywords(update.Keywords); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	}
+	db, err := database.NewDatabase()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	locations, err := db.GetPhotoLocations(update.Md5Sum)
+	if err != nil {
+		photosUpdateError(w, err)
+		return
+	}
+	location, err := metadataLocation(locations, update)
+	if err != nil {
+		photosUpdateError(w, err)
+		return
+	}
+	update.MachineId, update.Filepath = location.MachineId, location.Filepath
+	if len(locations) > 1 {
+		update.Sidecar = true
+	}
+	slave := slavehandler.GetSlaves().Slaves[location.MachineId]
+	if slave == nil || !slave.IsActive() {
+		http.Error(w, "the machine "+location.MachineId+" of the photo is offline", http.StatusServiceUnavailable)
+		return
+	}
+	err, result := webclient.NewPhotoExifClient().WriteMetadata(slave, update)
+	if err != nil {
+		logger.Errorf("Error while writing the metadata of %s on machine id %s with error %v", update.Filepath, update.MachineId, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if !update.DryRun {
+		if err := db.UpdatePhotoMetadata(update, result.NewMd5Sum); err != nil {
+			photosUpdateError(w, err)
+			return
+		}
+		modele.PostActionMessage("metadata of " + update.Filepath + " written in " + result.Written)
+	}
+	JsonAsResponse(w, result)
+}
+
+// function returns the copy of the photo corrected : the copy of update.MachineId and update.Filepath
+// or the first copy, the photos of flickr and google cannot be corrected
+func metadataLocation(locations []*database.PhotoLocation, update *modele.MetadataUpdate) (*database.PhotoLocation, error) {
+	if len(locations) == 0 {
+		return nil, errors.Wrap(database.PictureNotFound, update.Md5Sum)
+	}
+	location := locations[0]
+	if update.MachineId != "" || update.Filepath != "" {
+		location = nil
+		for _, l := range locations {
+			if l.MachineId == update.MachineId && (update.Filepath == "" || l.Filepath == update.Filepath) {
+				location = l
+				break
+			}
+		}
+		if location == nil {
+			return nil, errors.Wrapf(database.PictureNotFound, "%s on %s %s", update.Md5Sum, update.MachineId, update.Filepath)
+		}
+	}
+	if location.MachineId == modele.ORIGIN_FLICKR || location.MachineId == modele.ORIGIN_GOOGLE {
+		return nil, errors.Errorf("The photo %s of %s cannot be written", update.Md5Sum, location.MachineId)
+	}
+	return location, nil
+}
+
+// route adds the keywords of the body to its photos
+func AddKeywords(w http.ResponseWriter, r *http.Request) {
+	message := photoKeywordsRequest(w, r)
+	if message == nil {
+		return
+	}
+	db, err := database.NewDatabase()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	if err := db.AddKeywords(message.Md5sums, message.Keywords); err != nil {
+		photosUpdateError(w, err)
+		return
+	}
+	JsonAsResponse(w, "Keywords added to "+strconv.Itoa(len(message.Md5sums))+" photos.")
+}
+
+// route removes the keywords of the body from its photos
+func RemoveKeywords(w http.ResponseWriter, r *http.Request) {
+	message := photoKeywordsRequest(w, r)
+	if message == nil {
+		return
+	}
+	db, err := database.NewDatabase()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	if err := db.RemoveKeywords(message.Md5sums, message.Keywords); err != nil {
+		photosUpdateError(w, err)
+		return
+	}
+	JsonAsResponse(w, "Keywords removed from "+strconv.Itoa(len(message.Md5sums))+" photos.")
+}
+
+// route returns the keywords of the photo md5sum
+func GetPhotoKeywords(w http.ResponseWriter, r *http.Request) {
+	md5sum := r.URL.Query().Get("md5sum")
+	if md5sum == "" {
+		http.Error(w, "md5sum expected", 400)
+		return
+	}
+	db, err := database.NewDatabase()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	keywords, err := db.GetPhotoKeywords(md5sum)
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	JsonAsResponse(w, keywords)
+}
+
+// route returns the keywords starting with prefix, the most used first (limit 10 by default, 0 for all)
+func SuggestKeywords(w http.ResponseWriter, r *http.Request) {
+	limit := 10
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			http.Error(w, "limit must be a positive number", 400)
+			return
+		}
+	}
+	db, err := database.NewDatabase()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	response, err := db.SuggestKeywords(r.URL.Query().Get("prefix"), limit)
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	JsonAsResponse(w, response)
+}
+
+// route updates the rating, the favourite flag and the colour label of the photos of the body
+func UpdateCuration(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		http.Error(w, "empty body", 400)
+		return
+	}
+	defer r.Body.Close()
+	message := &album.CurationMessage{}
+	if err := json.NewDecoder(r.Body).Decode(message); err != nil {
+		logger.Info("Cannot not decode body received for curation with error " + err.Error())
+		http.Error(w, "Cannot not decode body received for curation", 400)
+		return
+	}
+	if err := database.ValidateCuration(message); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	db, err := database.NewDatabase()
+	if err != nil {
+		JsonAsResponse(w, err)
+		return
+	}
+	if err := db.UpdateCuration(message); err != nil {
+		photosUpdateError(w, err)
+		return
+	}
+	JsonAsResponse(w, "Curation of "+strconv.Itoa(len(message.Md5sums))+" photos updated.")
+}
@@ -1,10 +1,21 @@
 package routes
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/jeromelesaux/photo/configurationexif"
+	"github.com/jeromelesaux/photo/database"
+	"github.com/jeromelesaux/photo/modele"
+	"github.com/jeromelesaux/photo/slavehandler"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -23,3 +34,150 @@ func TestParsingArrayUrl(t *testing.T) {
 		t.Fatalf("expected 2 and received :%d", len(c["photosid"]))
 	}
 }
+
+func TestRegisterSlave(t *testing.T) {
+	dir := t.TempDir()
+	modele.InitActionsHistory()
+	if err := slavehandler.LoadSlaves(filepath.Join(dir, "slaves.json")); err != nil {
+		t.Fatal(err)
+	}
+	register := func(request *http.Request) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(request.Method, request.URL.RequestURI(), request.Body)
+		r.Header = request.Header.Clone()
+		w := httptest.NewRecorder()
+		RegisterSlave(w, r)
+		return w
+	}
+	body := `{"slave_url":"http://192.168.0.2","slave_port":3002,"slave_name":"mymachineid","slave_action":"/directory"}`
+	unsigned, _ := http.NewRequest("POST", "http://localhost:3001/register", strings.NewReader(body))
+	if w := register(unsigned); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an unknown slave, received %d", w.Code)
+	}
+	token, _ := slavehandler.NewEnrolmentToken("")
+	enrolment, _ := http.NewRequest("POST", "http://localhost:3001/register", strings.NewReader(strings.Replace(body, "}", `,"enrolment_token":"`+token.Token+`"}`, 1)))
+	w := register(enrolment)
+	secret := &slavehandler.SlaveSecret{}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), secret) != nil || secret.Secret == "" {
+		t.Fatalf("expected the secret of the slave, received %d %s", w.Code, w.Body.String())
+	}
+	signed, _ := slavehandler.NewSignedRequest("POST", "http://localhost:3001/register", []byte(body), "mymachineid", secret.Secret)
+	if w := register(signed); w.Code != http.StatusOK {
+		t.Fatalf("expected the slave registered, received %d %s", w.Code, w.Body.String())
+	}
+	// an enrolment token cannot give a new secret to an enrolled slave
+	token, _ = slavehandler.NewEnrolmentToken("")
+	takeover, _ := http.NewRequest("POST", "http://localhost:3001/register", strings.NewReader(strings.Replace(body, "}", `,"enrolment_token":"`+token.Token+`"}`, 1)))
+	if w := register(takeover); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for the enrolment of an enrolled slave, received %d", w.Code)
+	}
+	// a slave cannot register under the name of another slave
+	other, _ := slavehandler.NewSignedRequest("POST", "http://localhost:3001/register", []byte(strings.Replace(body, "mymachineid", "othermachineid", 1)), "mymachineid", secret.Secret)
+	if w := register(other); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for another name, received %d", w.Code)
+	}
+
+	// the routes of the slave answer the requests signed with its secret only
+	if err := slavehandler.LoadSlaveSecret(filepath.Join(dir, "secret.json")); err != nil {
+		t.Fatal(err)
+	}
+	ok := SlaveRoute(func(w http.ResponseWriter, r *http.Request) {})
+	call := func(request *http.Request) int {
+		r := httptest.NewRequest(request.Method, request.URL.RequestURI(), nil)
+		r.Header = request.Header.Clone()
+		w := httptest.NewRecorder()
+		ok(w, r)
+		return w.Code
+	}
+	slave := slavehandler.GetSlaves().Slaves["mymachineid"]
+	photo, _ := slave.NewRequest("GET", "http://192.168.0.2:3002/photo?filepath=/a.jpg", nil)
+	if code := call(photo); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 for a slave not enrolled, received %d", code)
+	}
+	if err := slavehandler.SaveSlaveSecret(secret); err != nil {
+		t.Fatal(err)
+	}
+	if code := call(photo); code != http.StatusOK {
+		t.Fatalf("expected 200 for a signed request, received %d", code)
+	}
+	if code := call(unsigned); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an unsigned request, received %d", code)
+	}
+}
+
+func TestMetadataLocation(t *testing.T) {
+	locations := []*database.PhotoLocation{{MachineId: "laptop", Filepath: "/a.jpg"}, {MachineId: "nas", Filepath: "/b.jpg"}, {MachineId: modele.ORIGIN_FLICKR, Filepath: "https://flickr/a.jpg"}}
+	if location, err := metadataLocation(locations, &modele.MetadataUpdate{Md5Sum: "md5-1"}); err != nil || location.MachineId != "laptop" {
+		t.Fatalf("expected the first copy, received %v %v", location, err)
+	}
+	if location, err := metadataLocation(locations, &modele.MetadataUpdate{Md5Sum: "md5-1", MachineId: "nas"}); err != nil || location.Filepath != "/b.jpg" {
+		t.Fatalf("expected the copy of the nas, received %v %v", location, err)
+	}
+	if _, err := metadataLocation(locations, &modele.MetadataUpdate{Md5Sum: "md5-1", MachineId: "nas", Filepath: "/a.jpg"}); errors.Cause(err) != database.PictureNotFound {
+		t.Fatalf("expected PictureNotFound for an unknown copy, received %v", err)
+	}
+	if _, err := metadataLocation(locations, &modele.MetadataUpdate{Md5Sum: "md5-1", MachineId: modele.ORIGIN_FLICKR}); err == nil {
+		t.Fatal("expected an error for a photo of flickr")
+	}
+	if _, err := metadataLocation(nil, &modele.MetadataUpdate{Md5Sum: "md5-1"}); errors.Cause(err) != database.PictureNotFound {
+		t.Fatalf("expected PictureNotFound without copy, received %v", err)
+	}
+}
+
+func TestPhotoLocations(t *testing.T) {
+	copies := []*database.PhotoLocation{{MachineId: "laptop", Filepath: "/a.jpg"}, {MachineId: "nas", Filepath: "/b.jpg"}}
+	locations, err := photoLocations(copies, "md5-1", "nas", "/b.jpg")
+	if err != nil || len(locations) != 2 || locations[0].MachineId != "nas" || locations[1].MachineId != "laptop" {
+		t.Fatalf("expected the requested copy first, received %v %v", locations, err)
+	}
+	if _, err := photoLocations(copies, "md5-1", "nas", "/etc/passwd"); errors.Cause(err) != database.PictureNotFound {
+		t.Fatalf("expected PictureNotFound for a file which is not a copy, received %v", err)
+	}
+}
+
+func TestScanRootAllowed(t *testing.T) {
+	dir := t.TempDir()
+	photo := filepath.Join(dir, "a.jpg")
+	if err := ioutil.WriteFile(photo, []byte("jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	previous, err := ioutil.ReadFile("extension-file.json")
+	if err == nil {
+		defer ioutil.WriteFile("extension-file.json", previous, 0644)
+	} else {
+		defer os.Remove("extension-file.json")
+	}
+	if err := ioutil.WriteFile("extension-file.json", []byte(`{"Extensions":[".jpg"],"ScanRoots":["`+dir+`"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if w := httptest.NewRecorder(); !scanRootAllowed(w, httptest.NewRequest(http.MethodGet, "/photo", nil), photo) {
+		t.Fatalf("expected the file of the scan root allowed, received %d", w.Code)
+	}
+	outside := filepath.Join(t.TempDir(), "b.jpg")
+	if err := ioutil.WriteFile(outside, []byte("jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "b.jpg")); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{outside, filepath.Join(dir, "..", filepath.Base(filepath.Dir(outside)), "b.jpg"), filepath.Join(dir, "b.jpg")} {
+		w := httptest.NewRecorder()
+		if scanRootAllowed(w, httptest.NewRequest(http.MethodGet, "/photo", nil), path) || w.Code != http.StatusForbidden {
+			t.Fatalf("expected 403 for %s, received %d", path, w.Code)
+		}
+	}
+	routes := map[string]*http.Request{
+		"/file":          httptest.NewRequest(http.MethodGet, "/file?value="+url.QueryEscape(outside), nil),
+		"/directory":     httptest.NewRequest(http.MethodGet, "/directory?value="+url.QueryEscape(filepath.Dir(outside)), nil),
+		"/writemetadata": httptest.NewRequest(http.MethodPost, "/writemetadata", strings.NewReader(`{"filepath":"`+outside+`"}`)),
+	}
+	handlers := map[string]http.HandlerFunc{"/file": GetFileInformations, "/directory": GetDirectoryInformations, "/writemetadata": WriteMetadata}
+	for route, r := range routes {
+		w := httptest.NewRecorder()
+		if handlers[route](w, r); w.Code != http.StatusForbidden {
+			t.Fatalf("expected 403 on %s outside the scan roots, received %d", route, w.Code)
+		}
+	}
+	if err := (configurationexif.FileExtension{}).CheckScanRoots(configurationexif.CONFIGURATION_FILE); err == nil {
+		t.Fatal("expected an error for the configuration without scan roots")
+	}
+}
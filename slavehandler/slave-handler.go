@@ -10,6 +10,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/jeromelesaux/photo/tlshandler"
+	"github.com/pkg/errors"
 	logger "github.com/sirupsen/logrus"
 )
 
@@ -19,6 +21,7 @@ type Slave struct {
 	Name           string    `json:"slave_name"`
 	Action         string    `json:"slave_action"`
 	LastConnection time.Time `json:"slave_lastconnection"`
+	Secret         string    `json:"slave_secret,omitempty"`
 }
 
 func (s *Slave) IsActive() bool {
@@ -32,8 +35,14 @@ type SlavesConfiguration struct {
 	Slaves map[string]*Slave `json:"slaves"`
 }
 
+// default file of the slaves registered on the controller
+const SLAVES_CONFIGURATION_FILE = "slaves_configuration.json"
+
 var slavesConfiguration *SlavesConfiguration
-var slavesConfigLock sync.Mutex
+var slavesConfigurationFile = SLAVES_CONFIGURATION_FILE
+
+// guards slavesConfiguration and its map of slaves, the readers get a copy of the map (GetSlaves)
+var slavesConfigLock sync.RWMutex
 var slaveIp string
 var slaveMacAddress string
 
@@ -78,20 +87,78 @@ func GetSlaveIPMacAddess() (error, string, string) {
 
 }
 
+// function returns a copy of the slaves registered on the controller
 func GetSlaves() *SlavesConfiguration {
+	slavesConfigLock.RLock()
+	defer slavesConfigLock.RUnlock()
+	slaves := &SlavesConfiguration{Slaves: make(map[string]*Slave, 0)}
+	if slavesConfiguration != nil {
+		for name, slave := range slavesConfiguration.Slaves {
+			slaves.Slaves[name] = slave
+		}
+	}
+	return slaves
+}
+
+// function returns the slaves registered on the controller, the caller holds slavesConfigLock
+func registeredSlaves() *SlavesConfiguration {
 	if slavesConfiguration == nil {
 		slavesConfiguration = &SlavesConfiguration{Slaves: make(map[string]*Slave, 0)}
 	}
 	return slavesConfiguration
 }
 
+// function loads the slaves registered on the controller from the file (slaves_configuration.json if file is empty),
+// the slaves keep their secrets between the restarts of the controller
+func LoadSlaves(file string) error {
+	slavesConfigLock.Lock()
+	defer slavesConfigLock.Unlock()
+	if file != "" {
+		slavesConfigurationFile = file
+	}
+	configuration := &SlavesConfiguration{Slaves: make(map[string]*Slave, 0)}
+	f, err := os.Open(slavesConfigurationFile)
+	if os.IsNotExist(err) {
+		slavesConfiguration = configuration
+		return nil
+	}
+	if err != nil {
+		logger.Error("Error while opening slaves configuration with error " + err.Error())
+		return err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(configuration); err != nil {
+		logger.Error("Error while reading slaves configuration with error " + err.Error())
+		return err
+	}
+	if configuration.Slaves == nil {
+		configuration.Slaves = make(map[string]*Slave, 0)
+	}
+	slavesConfiguration = configuration
+	return nil
+}
+
 func AddSlave(slave *Slave) error {
-	slavesConfig := GetSlaves()
+	slavesConfigLock.Lock()
+	defer slavesConfigLock.Unlock()
+	slavesConfig := registeredSlaves()
 	slave.LastConnection = time.Now()
 	slavesConfig.Slaves[slave.Name] = slave
 	return slavesConfig.saveConfiguration()
 }
 
+// function removes the slave and its secret, its requests are refused until a new enrolment
+func RevokeSlave(name string) error {
+	slavesConfigLock.Lock()
+	defer slavesConfigLock.Unlock()
+	slavesConfig := registeredSlaves()
+	if _, ok := slavesConfig.Slaves[name]; !ok {
+		return errors.Wrap(SlaveNotFound, name)
+	}
+	delete(slavesConfig.Slaves, name)
+	return slavesConfig.saveConfiguration()
+}
+
 func NewSlave(url string, port int, name string, action string) *Slave {
 	slave := &Slave{
 		Url:    url,
@@ -99,16 +166,32 @@ func NewSlave(url string, port int, name string, action string) *Slave {
 		Name:   name,
 		Action: action,
 	}
-	slavesConfig := GetSlaves()
+	slavesConfigLock.Lock()
+	defer slavesConfigLock.Unlock()
+	slavesConfig := registeredSlaves()
 	slavesConfig.Slaves[name] = slave
 	slavesConfig.saveConfiguration()
 	return slave
 }
 
-func (s *SlavesConfiguration) saveConfiguration() error {
+// function adds the slaves of a backup which are not registered yet, without their secrets so they enrol again,
+// the registered slaves are kept with their last connection
+func RestoreSlaves(slaves *SlavesConfiguration) error {
 	slavesConfigLock.Lock()
 	defer slavesConfigLock.Unlock()
-	f, err := os.Create("slaves_configuration.json")
+	slavesConfig := registeredSlaves()
+	for name, slave := range slaves.Slaves {
+		if _, ok := slavesConfig.Slaves[name]; !ok {
+			slave.Secret = ""
+			slavesConfig.Slaves[name] = slave
+		}
+	}
+	return slavesConfig.saveConfiguration()
+}
+
+// function saves the slaves in the configuration file, the caller holds slavesConfigLock
+func (s *SlavesConfiguration) saveConfiguration() error {
+	f, err := os.OpenFile(slavesConfigurationFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
 	if err != nil {
 		logger.Error("Error while saving slaves configuration with error " + err.Error())
 		return err
@@ -121,37 +204,22 @@ func (s *SlavesConfiguration) saveConfiguration() error {
 	return nil
 }
 
-func RegisterToMaster(masterUri string, localPort int, localAction string) {
+// function registers the slave to the controller every 30 seconds, the first registration uses the enrolment token
+// created by the controller and saves the secret received, the next ones are signed with this secret
+func RegisterToMaster(masterUri string, localPort int, localAction string, enrolmentToken string) {
 	go func() {
 		for {
 			logger.Info("Attempt to register to " + masterUri)
 			if err, ip, macAddress := GetSlaveIPMacAddess(); err != nil {
 				logger.Error("not enable to get local ip and macaddress")
 			} else {
-				conf := &Slave{
-					Url:    "http://" + ip,
+				conf := &Registration{Slave: Slave{
+					Url:    tlshandler.Scheme() + "://" + ip,
 					Port:   localPort,
 					Name:   macAddress,
 					Action: localAction,
-				}
-
-				body, _ := json.Marshal(conf)
-				logger.Info("Body to send ", *conf)
-				response, err := http.Post(masterUri, "application/json", bytes.NewBuffer(body))
-				if err == nil {
-					msg, _ := ioutil.ReadAll(response.Body)
-					if response.StatusCode != 200 {
-						logger.Error("Bad response from master " + masterUri + " with response " + string(msg))
-					} else {
-						errorMsg := string(msg)
-						if errorMsg != "\"ok\"" {
-							logger.Error("Bad response from master " + masterUri + " with response " + errorMsg)
-						} else {
-							logger.Info("Ok registered to " + masterUri + " with response " + errorMsg)
-						}
-					}
-					response.Body.Close()
-				} else {
+				}}
+				if err := registerToMaster(masterUri, conf, enrolmentToken); err != nil {
 					logger.Error("Error while registering to " + masterUri + " with error " + err.Error())
 				}
 			}
@@ -161,3 +229,51 @@ func RegisterToMaster(masterUri string, localPort int, localAction string) {
 	}()
 
 }
+
+func registerToMaster(masterUri string, conf *Registration, enrolmentToken string) error {
+	secret := GetSlaveSecret()
+	if secret == nil && enrolmentToken == "" {
+		return errors.New("the slave is not enrolled, an enrolment token of the controller is expected")
+	}
+	var request *http.Request
+	var err error
+	if secret == nil {
+		conf.EnrolmentToken = enrolmentToken
+		body, _ := json.Marshal(conf)
+		request, err = http.NewRequest("POST", masterUri, bytes.NewBuffer(body))
+	} else {
+		conf.Name = secret.MachineId
+		body, _ := json.Marshal(conf)
+		request, err = NewSignedRequest("POST", masterUri, body, secret.MachineId, secret.Secret)
+	}
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	logger.Info("Body to send ", conf.Slave.Name)
+	response, err := tlshandler.NewClient().Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	msg, _ := ioutil.ReadAll(response.Body)
+	if response.StatusCode != 200 {
+		return errors.Errorf("bad response from master with status %d and response %s", response.StatusCode, string(msg))
+	}
+	if secret == nil {
+		enrolment := &SlaveSecret{}
+		if err := json.Unmarshal(msg, enrolment); err != nil || enrolment.Secret == "" {
+			return errors.New("bad enrolment response from master " + string(msg))
+		}
+		if err := SaveSlaveSecret(enrolment); err != nil {
+			return err
+		}
+		logger.Info("Ok enrolled to " + masterUri + " as " + enrolment.MachineId)
+		return nil
+	}
+	if errorMsg := string(msg); errorMsg != "\"ok\"" {
+		return errors.New("bad response from master " + errorMsg)
+	}
+	logger.Info("Ok registered to " + masterUri)
+	return nil
+}
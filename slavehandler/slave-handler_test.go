@@ -0,0 +1,42 @@
+package slavehandler
+
+import (
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSlavesConcurrency(t *testing.T) {
+	if err := LoadSlaves(filepath.Join(t.TempDir(), SLAVES_CONFIGURATION_FILE)); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(name string) {
+			defer wg.Done()
+			AddSlave(&Slave{Name: name})
+		}("slave-" + strconv.Itoa(i))
+		go func() {
+			defer wg.Done()
+			for range GetSlaves().Slaves {
+			}
+		}()
+	}
+	wg.Wait()
+	slaves := GetSlaves()
+	if len(slaves.Slaves) != 10 {
+		t.Fatalf("expected the 10 slaves added, received %d", len(slaves.Slaves))
+	}
+	delete(slaves.Slaves, "slave-0")
+	if err := RevokeSlave("slave-0"); err != nil {
+		t.Fatalf("expected the copy of the slaves modified only, received %v", err)
+	}
+	if err := RestoreSlaves(&SlavesConfiguration{Slaves: map[string]*Slave{"slave-0": {Name: "slave-0", Secret: "secret"}}}); err != nil || len(GetSlaves().Slaves) != 10 {
+		t.Fatalf("expected the slave restored, received %v", err)
+	}
+	if secret := GetSlaves().Slaves["slave-0"].Secret; secret != "" {
+		t.Fatalf("expected the slave restored without secret, received %s", secret)
+	}
+}
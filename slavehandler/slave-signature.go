@@ -0,0 +1,299 @@
+package slavehandler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jeromelesaux/photo/credential"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	// headers of the signed requests between the controller and the slaves
+	MACHINE_HEADER   = "X-Photo-Machine"
+	TIMESTAMP_HEADER = "X-Photo-Timestamp"
+	NONCE_HEADER     = "X-Photo-Nonce"
+	SIGNATURE_HEADER = "X-Photo-Signature"
+	// maximal difference between the clocks of the controller and of the slaves
+	SIGNATURE_MAX_SKEW = 5 * time.Minute
+	// maximal size of the body of a signed request
+	SIGNED_BODY_MAX_SIZE = 1 << 20
+	// duration of the enrolment tokens created by the controller
+	ENROLMENT_TOKEN_DURATION = 24 * time.Hour
+	// default file of the secret of the slave
+	SLAVE_SECRET_FILE = "slave_secret.json"
+)
+
+var (
+	SlaveNotFound          = errors.New("Slave not found.")
+	EnrolmentTokenNotFound = errors.New("Enrolment token not found or expired.")
+	SlaveAlreadyEnrolled   = errors.New("Slave already enrolled, it needs an enrolment token of its name.")
+	WrongSignature         = errors.New("Wrong signature of the request.")
+)
+
+// secret shared by the slave with the controller, received at the enrolment
+type SlaveSecret struct {
+	MachineId string `json:"machine_id"`
+	Secret    string `json:"secret"`
+}
+
+// body of /register, the enrolment token is sent at the first contact only
+type Registration struct {
+	Slave
+	EnrolmentToken string `json:"enrolment_token,omitempty"`
+}
+
+// structure of the enrolment tokens returned by the controller, the token of a machine id re-keys this enrolled slave
+type EnrolmentTokenMessage struct {
+	Token     string    `json:"token"`
+	Expires   time.Time `json:"expires"`
+	MachineId string    `json:"machine_id,omitempty"`
+}
+
+// enrolment token kept by the controller, rekey is the name of the enrolled slave it may give a new secret
+type enrolmentToken struct {
+	expires time.Time
+	rekey   string
+}
+
+var enrolmentTokens = make(map[string]*enrolmentToken)
+var enrolmentTokensLock sync.Mutex
+var nonces = make(map[string]time.Time)
+var noncesLock sync.Mutex
+var slaveSecret *SlaveSecret
+var slaveSecretFile = SLAVE_SECRET_FILE
+var slaveSecretLock sync.Mutex
+
+func hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// function returns a new enrolment token valid ENROLMENT_TOKEN_DURATION, it is used once by a slave.
+// the token of a machine id (empty for a new slave) gives a new secret to this enrolled slave only
+func NewEnrolmentToken(machineId string) (*EnrolmentTokenMessage, error) {
+	if machineId != "" {
+		if _, ok := GetSlaves().Slaves[machineId]; !ok {
+			return nil, errors.Wrap(SlaveNotFound, machineId)
+		}
+	}
+	token, err := credential.NewRandomToken()
+	if err != nil {
+		return nil, err
+	}
+	expires := time.Now().Add(ENROLMENT_TOKEN_DURATION)
+	enrolmentTokensLock.Lock()
+	defer enrolmentTokensLock.Unlock()
+	for key, e := range enrolmentTokens {
+		if time.Now().After(e.expires) {
+			delete(enrolmentTokens, key)
+		}
+	}
+	enrolmentTokens[hash(token)] = &enrolmentToken{expires: expires, rekey: machineId}
+	return &EnrolmentTokenMessage{Token: token, Expires: expires, MachineId: machineId}, nil
+}
+
+// function removes the enrolment token and returns it if it was valid
+func useEnrolmentToken(token string) (*enrolmentToken, bool) {
+	enrolmentTokensLock.Lock()
+	defer enrolmentTokensLock.Unlock()
+	key := hash(token)
+	enrolment, ok := enrolmentTokens[key]
+	delete(enrolmentTokens, key)
+	if !ok || time.Now().After(enrolment.expires) {
+		return nil, false
+	}
+	return enrolment, true
+}
+
+// function registers the slave of the enrolment token and returns its new secret, a slave already enrolled
+// with the same name is refused unless the token was created for its name
+func Enrol(slave *Slave, token string) (*SlaveSecret, error) {
+	if slave.Name == "" {
+		return nil, errors.New("The name of the slave is missing")
+	}
+	enrolment, ok := useEnrolmentToken(token)
+	if !ok {
+		return nil, EnrolmentTokenNotFound
+	}
+	if enrolment.rekey != "" && enrolment.rekey != slave.Name {
+		return nil, errors.Wrapf(EnrolmentTokenNotFound, "the token is the token of the slave %s", enrolment.rekey)
+	}
+	secret, err := credential.NewRandomToken()
+	if err != nil {
+		return nil, err
+	}
+	slavesConfigLock.Lock()
+	defer slavesConfigLock.Unlock()
+	slavesConfig := registeredSlaves()
+	if stored, ok := slavesConfig.Slaves[slave.Name]; ok && stored.Secret != "" && enrolment.rekey != slave.Name {
+		return nil, errors.Wrap(SlaveAlreadyEnrolled, slave.Name)
+	}
+	slave.Secret = secret
+	slave.LastConnection = time.Now()
+	slavesConfig.Slaves[slave.Name] = slave
+	if err := slavesConfig.saveConfiguration(); err != nil {
+		return nil, err
+	}
+	return &SlaveSecret{MachineId: slave.Name, Secret: secret}, nil
+}
+
+// function returns the payload signed by the requests : method, uri, timestamp, nonce and hash of the body
+func signaturePayload(method string, uri string, timestamp string, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return method + "\n" + uri + "\n" + timestamp + "\n" + nonce + "\n" + hex.EncodeToString(sum[:])
+}
+
+func sign(secret string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// function returns the request signed with the secret of the machine
+func NewSignedRequest(method string, uri string, body []byte, machineId string, secret string) (*http.Request, error) {
+	request, err := http.NewRequest(method, uri, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := credential.NewRandomToken()
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set(MACHINE_HEADER, machineId)
+	request.Header.Set(TIMESTAMP_HEADER, timestamp)
+	request.Header.Set(NONCE_HEADER, nonce)
+	request.Header.Set(SIGNATURE_HEADER, sign(secret, signaturePayload(method, request.URL.RequestURI(), timestamp, nonce, body)))
+	return request, nil
+}
+
+// function returns the request to the slave signed with its secret
+func (s *Slave) NewRequest(method string, uri string, body []byte) (*http.Request, error) {
+	if s.Secret == "" {
+		return nil, errors.Errorf("The slave %s is not enrolled", s.Name)
+	}
+	return NewSignedRequest(method, uri, body, s.Name, s.Secret)
+}
+
+// function reads the body of the signed request, limited to SIGNED_BODY_MAX_SIZE
+func ReadSignedBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return []byte{}, nil
+	}
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, SIGNED_BODY_MAX_SIZE+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > SIGNED_BODY_MAX_SIZE {
+		return nil, errors.New("The body of the request is too large")
+	}
+	return body, nil
+}
+
+// function checks the signature of the request with the secret, the timestamp must be
+// within SIGNATURE_MAX_SKEW and the nonce must not be used twice
+func VerifyRequest(r *http.Request, body []byte, secret string) error {
+	timestamp := r.Header.Get(TIMESTAMP_HEADER)
+	nonce := r.Header.Get(NONCE_HEADER)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || nonce == "" || secret == "" {
+		return WrongSignature
+	}
+	date := time.Unix(seconds, 0)
+	if date.Before(time.Now().Add(-SIGNATURE_MAX_SKEW)) || date.After(time.Now().Add(SIGNATURE_MAX_SKEW)) {
+		return errors.Wrap(WrongSignature, "timestamp out of range")
+	}
+	expected := sign(secret, signaturePayload(r.Method, r.RequestURI, timestamp, nonce, body))
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(SIGNATURE_HEADER))) {
+		return WrongSignature
+	}
+	noncesLock.Lock()
+	defer noncesLock.Unlock()
+	for key, expires := range nonces {
+		if time.Now().After(expires) {
+			delete(nonces, key)
+		}
+	}
+	if _, ok := nonces[nonce]; ok {
+		return errors.Wrap(WrongSignature, "request replayed")
+	}
+	nonces[nonce] = date.Add(SIGNATURE_MAX_SKEW)
+	return nil
+}
+
+// function checks the request of the registered slave of the header MACHINE_HEADER and returns it
+func VerifySlaveRequest(r *http.Request, body []byte) (*Slave, error) {
+	slave := GetSlaves().Slaves[r.Header.Get(MACHINE_HEADER)]
+	if slave == nil || slave.Secret == "" {
+		return nil, SlaveNotFound
+	}
+	if err := VerifyRequest(r, body, slave.Secret); err != nil {
+		return nil, err
+	}
+	return slave, nil
+}
+
+// function loads the secret of the slave from the file (slave_secret.json if file is empty),
+// a missing file is a slave not enrolled yet
+func LoadSlaveSecret(file string) error {
+	slaveSecretLock.Lock()
+	defer slaveSecretLock.Unlock()
+	if file != "" {
+		slaveSecretFile = file
+	}
+	f, err := os.Open(slaveSecretFile)
+	if os.IsNotExist(err) {
+		slaveSecret = nil
+		return nil
+	}
+	if err != nil {
+		logger.Error("Error while opening slave secret with error " + err.Error())
+		return err
+	}
+	defer f.Close()
+	secret := &SlaveSecret{}
+	if err := json.NewDecoder(f).Decode(secret); err != nil {
+		logger.Error("Error while reading slave secret with error " + err.Error())
+		return err
+	}
+	slaveSecret = secret
+	return nil
+}
+
+// function returns the secret of the slave, nil if the slave is not enrolled
+func GetSlaveSecret() *SlaveSecret {
+	slaveSecretLock.Lock()
+	defer slaveSecretLock.Unlock()
+	return slaveSecret
+}
+
+// function saves the secret received at the enrolment of the slave
+func SaveSlaveSecret(secret *SlaveSecret) error {
+	slaveSecretLock.Lock()
+	defer slaveSecretLock.Unlock()
+	f, err := os.OpenFile(slaveSecretFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		logger.Error("Error while saving slave secret with error " + err.Error())
+		return err
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(secret); err != nil {
+		logger.Error("Error while saving slave secret with error " + err.Error())
+		return err
+	}
+	slaveSecret = secret
+	return nil
+}
@@ -0,0 +1,107 @@
+package slavehandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// function returns the server side request of the signed request
+func received(request *http.Request) *http.Request {
+	r := httptest.NewRequest(request.Method, request.URL.RequestURI(), nil)
+	r.Header = request.Header.Clone()
+	return r
+}
+
+func TestVerifyRequest(t *testing.T) {
+	request, err := NewSignedRequest("GET", "http://localhost:3002/photo?filepath=/photos/a%20b.jpg", nil, "mymachineid", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyRequest(received(request), []byte{}, "other secret"); err != WrongSignature {
+		t.Fatalf("expected WrongSignature for another secret and received %v", err)
+	}
+	if err := VerifyRequest(received(request), []byte("body"), "secret"); err != WrongSignature {
+		t.Fatalf("expected WrongSignature for another body and received %v", err)
+	}
+	tampered := received(request)
+	tampered.RequestURI = "/photo?filepath=/etc/passwd"
+	if err := VerifyRequest(tampered, []byte{}, "secret"); err != WrongSignature {
+		t.Fatalf("expected WrongSignature for another uri and received %v", err)
+	}
+	if err := VerifyRequest(received(request), []byte{}, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyRequest(received(request), []byte{}, "secret"); errors.Cause(err) != WrongSignature {
+		t.Fatalf("expected WrongSignature for a replayed request and received %v", err)
+	}
+
+	old, _ := NewSignedRequest("POST", "http://localhost:3001/register", []byte("{}"), "mymachineid", "secret")
+	old.Header.Set(TIMESTAMP_HEADER, strconv.FormatInt(time.Now().Add(-2*SIGNATURE_MAX_SKEW).Unix(), 10))
+	if err := VerifyRequest(received(old), []byte("{}"), "secret"); errors.Cause(err) != WrongSignature {
+		t.Fatalf("expected WrongSignature for an old request and received %v", err)
+	}
+}
+
+func TestEnrol(t *testing.T) {
+	if err := LoadSlaves(filepath.Join(t.TempDir(), SLAVES_CONFIGURATION_FILE)); err != nil {
+		t.Fatal(err)
+	}
+	token, err := NewEnrolmentToken("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Enrol(&Slave{Name: "mymachineid"}, "unknown"); err != EnrolmentTokenNotFound {
+		t.Fatalf("expected EnrolmentTokenNotFound and received %v", err)
+	}
+	secret, err := Enrol(&Slave{Name: "mymachineid", Url: "http://192.168.0.2", Port: 3002}, token.Token)
+	if err != nil || secret.MachineId != "mymachineid" || secret.Secret == "" {
+		t.Fatalf("expected the secret of mymachineid, received %v %v", secret, err)
+	}
+	if _, err := Enrol(&Slave{Name: "othermachineid"}, token.Token); err != EnrolmentTokenNotFound {
+		t.Fatalf("expected the enrolment token used once and received %v", err)
+	}
+
+	// an enrolled slave gets a new secret from a token of its name only
+	token, _ = NewEnrolmentToken("")
+	if _, err := Enrol(&Slave{Name: "mymachineid", Url: "http://192.168.0.66"}, token.Token); errors.Cause(err) != SlaveAlreadyEnrolled {
+		t.Fatalf("expected SlaveAlreadyEnrolled and received %v", err)
+	}
+	if _, err := NewEnrolmentToken("unknown"); errors.Cause(err) != SlaveNotFound {
+		t.Fatalf("expected SlaveNotFound and received %v", err)
+	}
+	token, _ = NewEnrolmentToken("mymachineid")
+	if _, err := Enrol(&Slave{Name: "othermachineid"}, token.Token); errors.Cause(err) != EnrolmentTokenNotFound {
+		t.Fatalf("expected the token of mymachineid refused to another slave and received %v", err)
+	}
+	token, _ = NewEnrolmentToken("mymachineid")
+	rekeyed, err := Enrol(&Slave{Name: "mymachineid", Url: "http://192.168.0.2", Port: 3002}, token.Token)
+	if err != nil || rekeyed.Secret == secret.Secret {
+		t.Fatalf("expected a new secret of mymachineid, received %v %v", rekeyed, err)
+	}
+	secret = rekeyed
+
+	// the slaves and their secrets are read again from the file
+	if err := LoadSlaves(""); err != nil {
+		t.Fatal(err)
+	}
+	request, _ := NewSignedRequest("POST", "http://localhost:3001/register", []byte("{}"), secret.MachineId, secret.Secret)
+	if slave, err := VerifySlaveRequest(received(request), []byte("{}")); err != nil || slave.Port != 3002 {
+		t.Fatalf("expected the slave mymachineid, received %v %v", slave, err)
+	}
+	if err := RevokeSlave("mymachineid"); err != nil {
+		t.Fatal(err)
+	}
+	request, _ = NewSignedRequest("POST", "http://localhost:3001/register", []byte("{}"), secret.MachineId, secret.Secret)
+	if _, err := VerifySlaveRequest(received(request), []byte("{}")); err != SlaveNotFound {
+		t.Fatalf("expected SlaveNotFound for a revoked slave and received %v", err)
+	}
+	if err := RevokeSlave("mymachineid"); errors.Cause(err) != SlaveNotFound {
+		t.Fatalf("expected SlaveNotFound and received %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+// package manages the https of the controller and of the slaves : the certificates of the servers,
+// the http clients between the controller and the slaves, the mutual tls with the certificates of a local CA
+// and the generation of this CA and of its certificates
+package tlshandler
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	// files of the local CA written by GenerateCA
+	CA_CERTIFICATE_FILE = "ca.pem"
+	CA_KEY_FILE         = "ca-key.pem"
+	// validity of the local CA and of the certificates it signs
+	CA_VALIDITY          = 10 * 365 * 24 * time.Hour
+	CERTIFICATE_VALIDITY = 2 * 365 * 24 * time.Hour
+)
+
+// tls configuration of the binary : certificate and key of the server and of its client,
+// and CA of the mutual tls
+type Configuration struct {
+	Certificate *tls.Certificate
+	CAs         *x509.CertPool
+}
+
+var configuration = &Configuration{}
+var configurationLock sync.RWMutex
+
+// function loads the certificate and the key of the binary (https if they are set) and the CA of the mutual tls
+// (the certificates of the slaves and of the controller must be signed by this CA if it is set)
+func Configure(certFile string, keyFile string, caFile string) error {
+	c := &Configuration{}
+	if certFile != "" || keyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return errors.Wrap(err, "Cannot load the certificate "+certFile)
+		}
+		c.Certificate = &certificate
+	}
+	if caFile != "" {
+		if c.Certificate == nil {
+			return errors.New("The mutual tls needs the certificate and the key of the binary")
+		}
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return errors.Wrap(err, "Cannot read the CA "+caFile)
+		}
+		c.CAs = x509.NewCertPool()
+		if !c.CAs.AppendCertsFromPEM(pem) {
+			return errors.New("No certificate found in the CA " + caFile)
+		}
+	}
+	configurationLock.Lock()
+	configuration = c
+	configurationLock.Unlock()
+	return nil
+}
+
+func getConfiguration() *Configuration {
+	configurationLock.RLock()
+	defer configurationLock.RUnlock()
+	return configuration
+}
+
+// function returns true if the binary serves https
+func Enabled() bool {
+	return getConfiguration().Certificate != nil
+}
+
+// function returns true if the controller and the slaves authenticate with the certificates of the local CA
+func MutualTLS() bool {
+	return getConfiguration().CAs != nil
+}
+
+// function returns the scheme of the urls of the binary, https or http
+func Scheme() string {
+	if Enabled() {
+		return "https"
+	}
+	return "http"
+}
+
+// function returns the tls configuration of the server, the certificate of the clients is required
+// by the slaves in mutual tls, it is verified if it is given for the controller (the browsers have none)
+func ServerConfig(requireClientCertificate bool) *tls.Config {
+	c := getConfiguration()
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.Certificate != nil {
+		config.Certificates = []tls.Certificate{*c.Certificate}
+	}
+	if c.CAs != nil {
+		config.ClientCAs = c.CAs
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if requireClientCertificate {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return config
+}
+
+// function serves the handler in https if the certificate is set, in http otherwise
+func ListenAndServe(addr string, handler http.Handler, requireClientCertificate bool) error {
+	if !Enabled() {
+		return http.ListenAndServe(addr, handler)
+	}
+	server := &http.Server{Addr: addr, Handler: handler, TLSConfig: ServerConfig(requireClientCertificate)}
+	logger.Info("Serving https on " + addr)
+	return server.ListenAndServeTLS("", "")
+}
+
+// function returns the http client of the requests between the controller and the slaves, in mutual tls
+// it presents the certificate of the binary and trusts the servers signed by the local CA
+func NewClient() *http.Client {
+	c := getConfiguration()
+	if c.CAs == nil {
+		return &http.Client{}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		RootCAs:      c.CAs,
+		Certificates: []tls.Certificate{*c.Certificate},
+	}
+	return &http.Client{Transport: transport}
+}
+
+// function returns true if the client of the request presented a certificate signed by the local CA
+func VerifiedClient(r *http.Request) bool {
+	return r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+}
+
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// function writes the certificate and the key in PEM files, the key is only readable by its owner
+func writeCertificate(certFile string, keyFile string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+}
+
+// function generates the local CA of the mutual tls in the directory (ca.pem and ca-key.pem),
+// an existing CA is not replaced
+func GenerateCA(dir string) error {
+	certFile, keyFile := filepath.Join(dir, CA_CERTIFICATE_FILE), filepath.Join(dir, CA_KEY_FILE)
+	if _, err := os.Stat(certFile); err == nil {
+		return errors.New("The CA " + certFile + " already exists")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := newSerialNumber()
+	if err != nil {
+		return err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "photo local CA", Organization: []string{"photo"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(CA_VALIDITY),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	return writeCertificate(certFile, keyFile, der, key)
+}
+
+// function loads the local CA of the directory
+func loadCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certificate, err := tls.LoadX509KeyPair(filepath.Join(dir, CA_CERTIFICATE_FILE), filepath.Join(dir, CA_KEY_FILE))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Cannot load the CA of "+dir)
+	}
+	ca, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	key, ok := certificate.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("The key of the CA is not an ecdsa key")
+	}
+	return ca, key, nil
+}
+
+// function generates the certificate of the name (name.pem and name-key.pem in the directory of the CA)
+// signed by the local CA, for the servers and for the clients. hosts are the names and the ip addresses of the machine
+func GenerateCertificate(dir string, name string, hosts []string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return errors.New("The name of the certificate is invalid")
+	}
+	ca, caKey, err := loadCA(dir)
+	if err != nil {
+		return err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := newSerialNumber()
+	if err != nil {
+		return err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"photo"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(CERTIFICATE_VALIDITY),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range hosts {
+		if host = strings.TrimSpace(host); host == "" {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+	return writeCertificate(filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem"), der, key)
+}
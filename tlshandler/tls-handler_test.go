@@ -0,0 +1,58 @@
+package tlshandler
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	if err := GenerateCA(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenerateCA(dir); err == nil {
+		t.Fatal("expected an error for an existing CA")
+	}
+	if err := GenerateCertificate(dir, "nas", []string{"localhost", "127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Configure("", "", filepath.Join(dir, CA_CERTIFICATE_FILE)); err == nil {
+		t.Fatal("expected an error for the mutual tls without certificate")
+	}
+	if err := Configure(filepath.Join(dir, "nas.pem"), filepath.Join(dir, "nas-key.pem"), filepath.Join(dir, CA_CERTIFICATE_FILE)); err != nil {
+		t.Fatal(err)
+	}
+	defer Configure("", "", "")
+	if !Enabled() || !MutualTLS() || Scheme() != "https" {
+		t.Fatal("expected the mutual tls enabled")
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !VerifiedClient(r) {
+			http.Error(w, "no client certificate", http.StatusUnauthorized)
+		}
+	}))
+	server.TLS = ServerConfig(true)
+	server.StartTLS()
+	defer server.Close()
+
+	response, err := NewClient().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for the client certificate of the CA, received %d", response.StatusCode)
+	}
+
+	// a client without certificate of the CA is refused
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: getConfiguration().CAs}
+	if response, err := (&http.Client{Transport: transport}).Get(server.URL); err == nil {
+		response.Body.Close()
+		t.Fatal("expected an error for a client without certificate")
+	}
+}
@@ -0,0 +1,387 @@
+// package manages the user accounts of the controller (hashed passwords and roles), their api tokens
+// and their sessions. the accounts are saved in a json file, the sessions are kept in memory
+package userhandler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jeromelesaux/photo/credential"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	// role of the users allowed to manage the slaves, the cloud accounts, the users and the maintenance of the library
+	ROLE_ADMIN = "admin"
+	// role of the users allowed to browse the library and to manage their albums
+	ROLE_USER = "user"
+	// default file of the users accounts
+	USERS_CONFIGURATION_FILE = "users_configuration.json"
+	// duration of a session opened by /login
+	SESSION_DURATION = 7 * 24 * time.Hour
+	// minimal length of the passwords of the users
+	PASSWORD_MIN_LENGTH = 8
+)
+
+var (
+	UserNotFound      = errors.New("User not found.")
+	UserAlreadyExists = errors.New("User already exists.")
+	TokenNotFound     = errors.New("Api token not found.")
+	WrongCredentials  = errors.New("Wrong user name or password.")
+	SessionNotFound   = errors.New("Session not found or expired.")
+)
+
+// api token of a user, only the hash of the token is saved
+type ApiToken struct {
+	Name    string    `json:"name"`
+	Hash    string    `json:"hash"`
+	Created time.Time `json:"created"`
+}
+
+// user account, the password is saved as a bcrypt hash
+type User struct {
+	Name     string      `json:"name"`
+	Password string      `json:"password"`
+	Role     string      `json:"role"`
+	Tokens   []*ApiToken `json:"tokens,omitempty"`
+}
+
+// structure of the users received and returned by the routes, the password is never returned
+type UserMessage struct {
+	Name     string `json:"name"`
+	Password string `json:"password,omitempty"`
+	Role     string `json:"role,omitempty"`
+}
+
+// structure of the api tokens returned by the routes, the token is only returned when it is created
+type TokenMessage struct {
+	Name    string    `json:"name"`
+	Token   string    `json:"token,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+type UsersConfiguration struct {
+	Users map[string]*User `json:"users"`
+}
+
+type session struct {
+	user    string
+	expires time.Time
+}
+
+var usersConfiguration = &UsersConfiguration{Users: make(map[string]*User)}
+var usersConfigurationFile = USERS_CONFIGURATION_FILE
+var usersLock sync.RWMutex
+var sessions = make(map[string]*session)
+var sessionsLock sync.Mutex
+
+// function returns true if the user has the admin role
+func (u *User) IsAdmin() bool {
+	return u.Role == ROLE_ADMIN
+}
+
+// function returns the message of the user, without password
+func (u *User) Message() *UserMessage {
+	return &UserMessage{Name: u.Name, Role: u.Role}
+}
+
+func (u *User) copy() *User {
+	c := *u
+	c.Tokens = append([]*ApiToken{}, u.Tokens...)
+	return &c
+}
+
+// function loads the users accounts of the file (users_configuration.json if file is empty),
+// a missing file is a configuration without user
+func LoadUsers(file string) error {
+	usersLock.Lock()
+	defer usersLock.Unlock()
+	if file != "" {
+		usersConfigurationFile = file
+	}
+	configuration := &UsersConfiguration{Users: make(map[string]*User)}
+	f, err := os.Open(usersConfigurationFile)
+	if os.IsNotExist(err) {
+		usersConfiguration = configuration
+		return nil
+	}
+	if err != nil {
+		logger.Error("Error while opening users configuration with error " + err.Error())
+		return err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(configuration); err != nil {
+		logger.Error("Error while reading users configuration with error " + err.Error())
+		return err
+	}
+	if configuration.Users == nil {
+		configuration.Users = make(map[string]*User)
+	}
+	usersConfiguration = configuration
+	return nil
+}
+
+// function saves the users accounts, the caller holds the lock of the users
+func saveUsers() error {
+	f, err := os.OpenFile(usersConfigurationFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		logger.Error("Error while saving users configuration with error " + err.Error())
+		return err
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(usersConfiguration); err != nil {
+		logger.Error("Error while saving users configuration with error " + err.Error())
+		return err
+	}
+	return nil
+}
+
+// function returns true if at least one user is registered
+func HasUsers() bool {
+	usersLock.RLock()
+	defer usersLock.RUnlock()
+	return len(usersConfiguration.Users) > 0
+}
+
+// function returns the user of the name
+func GetUser(name string) (*User, error) {
+	usersLock.RLock()
+	defer usersLock.RUnlock()
+	user, ok := usersConfiguration.Users[name]
+	if !ok {
+		return nil, UserNotFound
+	}
+	return user.copy(), nil
+}
+
+// function returns the users sorted by name
+func GetUsers() []*User {
+	usersLock.RLock()
+	defer usersLock.RUnlock()
+	users := make([]*User, 0, len(usersConfiguration.Users))
+	for _, user := range usersConfiguration.Users {
+		users = append(users, user.copy())
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return users
+}
+
+func checkPasswordLength(password string) error {
+	if len(password) < PASSWORD_MIN_LENGTH {
+		return errors.Errorf("The password must have at least %d characters", PASSWORD_MIN_LENGTH)
+	}
+	return nil
+}
+
+// function registers a new user with the role (user or admin)
+func AddUser(name string, password string, role string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("The name of the user is missing")
+	}
+	if role != ROLE_ADMIN && role != ROLE_USER {
+		return errors.Errorf("Unknown role %s", role)
+	}
+	if err := checkPasswordLength(password); err != nil {
+		return err
+	}
+	hash, err := credential.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	usersLock.Lock()
+	defer usersLock.Unlock()
+	if _, ok := usersConfiguration.Users[name]; ok {
+		return errors.Wrap(UserAlreadyExists, name)
+	}
+	usersConfiguration.Users[name] = &User{Name: name, Password: hash, Role: role}
+	return saveUsers()
+}
+
+// function removes the user and closes its sessions, the last admin cannot be removed
+func DeleteUser(name string) error {
+	usersLock.Lock()
+	defer usersLock.Unlock()
+	user, ok := usersConfiguration.Users[name]
+	if !ok {
+		return errors.Wrap(UserNotFound, name)
+	}
+	if user.IsAdmin() && countAdmins() == 1 {
+		return errors.New("The last admin cannot be removed")
+	}
+	delete(usersConfiguration.Users, name)
+	deleteSessions(name)
+	return saveUsers()
+}
+
+func countAdmins() int {
+	admins := 0
+	for _, user := range usersConfiguration.Users {
+		if user.IsAdmin() {
+			admins++
+		}
+	}
+	return admins
+}
+
+// function changes the password of the user and closes its sessions
+func SetPassword(name string, password string) error {
+	if err := checkPasswordLength(password); err != nil {
+		return err
+	}
+	hash, err := credential.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	usersLock.Lock()
+	defer usersLock.Unlock()
+	user, ok := usersConfiguration.Users[name]
+	if !ok {
+		return errors.Wrap(UserNotFound, name)
+	}
+	user.Password = hash
+	deleteSessions(name)
+	return saveUsers()
+}
+
+// function returns the user of the name if the password is its password, WrongCredentials otherwise
+func Authenticate(name string, password string) (*User, error) {
+	user, err := GetUser(name)
+	if err != nil {
+		// the password is hashed anyway to answer in the same time
+		credential.CheckPassword("", password)
+		return nil, WrongCredentials
+	}
+	if !credential.CheckPassword(user.Password, password) {
+		return nil, WrongCredentials
+	}
+	return user, nil
+}
+
+// function creates the api token tokenName of the user and returns it, it is not saved in clear
+func NewToken(name string, tokenName string) (*TokenMessage, error) {
+	tokenName = strings.TrimSpace(tokenName)
+	if tokenName == "" {
+		return nil, errors.New("The name of the api token is missing")
+	}
+	token, err := credential.NewRandomToken()
+	if err != nil {
+		return nil, err
+	}
+	usersLock.Lock()
+	defer usersLock.Unlock()
+	user, ok := usersConfiguration.Users[name]
+	if !ok {
+		return nil, errors.Wrap(UserNotFound, name)
+	}
+	for _, t := range user.Tokens {
+		if t.Name == tokenName {
+			return nil, errors.Errorf("The api token %s already exists", tokenName)
+		}
+	}
+	apiToken := &ApiToken{Name: tokenName, Hash: credential.HashToken(token), Created: time.Now().UTC().Truncate(time.Second)}
+	user.Tokens = append(user.Tokens, apiToken)
+	if err := saveUsers(); err != nil {
+		return nil, err
+	}
+	return &TokenMessage{Name: tokenName, Token: token, Created: apiToken.Created}, nil
+}
+
+// function returns the api tokens of the user, without the tokens
+func GetTokens(name string) ([]*TokenMessage, error) {
+	user, err := GetUser(name)
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]*TokenMessage, 0, len(user.Tokens))
+	for _, t := range user.Tokens {
+		tokens = append(tokens, &TokenMessage{Name: t.Name, Created: t.Created})
+	}
+	return tokens, nil
+}
+
+// function removes the api token tokenName of the user
+func DeleteToken(name string, tokenName string) error {
+	usersLock.Lock()
+	defer usersLock.Unlock()
+	user, ok := usersConfiguration.Users[name]
+	if !ok {
+		return errors.Wrap(UserNotFound, name)
+	}
+	for i, t := range user.Tokens {
+		if t.Name == tokenName {
+			user.Tokens = append(user.Tokens[:i], user.Tokens[i+1:]...)
+			return saveUsers()
+		}
+	}
+	return errors.Wrap(TokenNotFound, tokenName)
+}
+
+// function returns the user of the api token
+func TokenUser(token string) (*User, error) {
+	hash := []byte(credential.HashToken(token))
+	usersLock.RLock()
+	defer usersLock.RUnlock()
+	for _, user := range usersConfiguration.Users {
+		for _, t := range user.Tokens {
+			if subtle.ConstantTimeCompare(hash, []byte(t.Hash)) == 1 {
+				return user.copy(), nil
+			}
+		}
+	}
+	return nil, TokenNotFound
+}
+
+// function opens a session of the user and returns its identifier and its expiry date
+func NewSession(name string) (string, time.Time, error) {
+	id, err := credential.NewRandomToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expires := time.Now().Add(SESSION_DURATION)
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+	// the expired sessions are removed
+	for key, s := range sessions {
+		if time.Now().After(s.expires) {
+			delete(sessions, key)
+		}
+	}
+	sessions[credential.HashToken(id)] = &session{user: name, expires: expires}
+	return id, expires, nil
+}
+
+// function returns the user of the session
+func SessionUser(id string) (*User, error) {
+	sessionsLock.Lock()
+	s, ok := sessions[credential.HashToken(id)]
+	sessionsLock.Unlock()
+	if !ok || time.Now().After(s.expires) {
+		return nil, SessionNotFound
+	}
+	return GetUser(s.user)
+}
+
+// function closes the session
+func DeleteSession(id string) {
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+	delete(sessions, credential.HashToken(id))
+}
+
+// function closes the sessions of the user
+func deleteSessions(name string) {
+	sessionsLock.Lock()
+	defer sessionsLock.Unlock()
+	for key, s := range sessions {
+		if s.user == name {
+			delete(sessions, key)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package userhandler
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestUsers(t *testing.T) {
+	file := filepath.Join(t.TempDir(), USERS_CONFIGURATION_FILE)
+	if err := LoadUsers(file); err != nil {
+		t.Fatal(err)
+	}
+	if HasUsers() {
+		t.Fatal("expected no user without users configuration")
+	}
+	if err := AddUser("alice", "short", ROLE_ADMIN); err == nil {
+		t.Fatal("expected an error for a short password")
+	}
+	if err := AddUser("alice", "alice-password", ROLE_ADMIN); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddUser("bob", "bob-password", ROLE_USER); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddUser("bob", "bob-password", ROLE_USER); errors.Cause(err) != UserAlreadyExists {
+		t.Fatalf("expected UserAlreadyExists and received %v", err)
+	}
+	if _, err := Authenticate("bob", "wrong-password"); err != WrongCredentials {
+		t.Fatalf("expected WrongCredentials and received %v", err)
+	}
+	if _, err := Authenticate("carol", "bob-password"); err != WrongCredentials {
+		t.Fatalf("expected WrongCredentials and received %v", err)
+	}
+	bob, err := Authenticate("bob", "bob-password")
+	if err != nil || bob.IsAdmin() {
+		t.Fatalf("expected the user bob, received %v %v", bob, err)
+	}
+
+	// the accounts are read again from the file
+	if err := LoadUsers(file); err != nil {
+		t.Fatal(err)
+	}
+	if users := GetUsers(); len(users) != 2 || users[0].Name != "alice" || !users[0].IsAdmin() {
+		t.Fatalf("expected alice and bob, received %v", users)
+	}
+
+	token, err := NewToken("bob", "script")
+	if err != nil || token.Token == "" {
+		t.Fatalf("expected the api token script, received %v %v", token, err)
+	}
+	if user, err := TokenUser(token.Token); err != nil || user.Name != "bob" {
+		t.Fatalf("expected bob for the api token, received %v %v", user, err)
+	}
+	if tokens, _ := GetTokens("bob"); len(tokens) != 1 || tokens[0].Token != "" {
+		t.Fatalf("expected the api token without the token, received %v", tokens)
+	}
+	if err := DeleteToken("bob", "script"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TokenUser(token.Token); err != TokenNotFound {
+		t.Fatalf("expected TokenNotFound and received %v", err)
+	}
+
+	id, _, err := NewSession("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, err := SessionUser(id); err != nil || user.Name != "bob" {
+		t.Fatalf("expected bob for the session, received %v %v", user, err)
+	}
+	// a new password closes the sessions
+	if err := SetPassword("bob", "new-bob-password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SessionUser(id); err != SessionNotFound {
+		t.Fatalf("expected SessionNotFound and received %v", err)
+	}
+	if _, err := Authenticate("bob", "new-bob-password"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteUser("alice"); err == nil {
+		t.Fatal("expected an error for the last admin")
+	}
+	if err := DeleteUser("bob"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetUser("bob"); err != UserNotFound {
+		t.Fatalf("expected UserNotFound and received %v", err)
+	}
+}
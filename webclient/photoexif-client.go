@@ -6,11 +6,11 @@ import (
 
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"strconv"
 
 	"github.com/jeromelesaux/photo/database"
 	"github.com/jeromelesaux/photo/slavehandler"
+	"github.com/jeromelesaux/photo/tlshandler"
 
 	"sync"
 	"time"
@@ -27,7 +27,7 @@ func NewPhotoExifClient() *PhotoExifClient {
 	return &PhotoExifClient{photoResponseChan: make(chan *modele.PhotoResponse, 1)}
 }
 
-func (p *PhotoExifClient) scanExifClient(remotePath string, salve *slavehandler.Slave) {
+func (p *PhotoExifClient) scanExifClient(remotePath string, full bool, salve *slavehandler.Slave) {
 	var startTime time.Time
 
 	defer func() {
@@ -38,9 +38,9 @@ func (p *PhotoExifClient) scanExifClient(remotePath string, salve *slavehandler.
 	}()
 	startTime = time.Now()
 	logger.Info(remotePath + " started to scan ")
-	client := &http.Client{}
-	uri := fmt.Sprintf("%s:%d%s?value=%s", salve.Url, salve.Port, salve.Action, remotePath)
-	request, err := http.NewRequest("GET", uri, nil)
+	client := tlshandler.NewClient()
+	uri := fmt.Sprintf("%s:%d%s?value=%s&full=%t", salve.Url, salve.Port, salve.Action, remotePath, full)
+	request, err := salve.NewRequest("GET", uri, nil)
 	if err != nil {
 		logger.Error("error with : " + err.Error())
 		p.photoResponseChan <- &modele.PhotoResponse{}
@@ -65,7 +65,8 @@ func (p *PhotoExifClient) scanExifClient(remotePath string, salve *slavehandler.
 		p.photoResponseChan <- photoResponse
 		return
 	}
-	logger.Info("Found " + strconv.Itoa(len(photoResponse.Photos)) + " images in " + remotePath)
+	logger.Info("Found " + strconv.Itoa(len(photoResponse.Photos)) + " images, " + strconv.Itoa(len(photoResponse.Moved)) +
+		" moved and " + strconv.Itoa(len(photoResponse.Deleted)) + " deleted in " + remotePath)
 	photoResponse.MachineId = salve.Name
 	p.photoResponseChan <- photoResponse
 	return
@@ -76,15 +77,15 @@ type Job struct {
 	sid string
 }
 
-func (p *PhotoExifClient) ScanFoldersClient(remotepaths []string, slaveid string, conf *configurationapp.Configuration) {
+func (p *PhotoExifClient) ScanFoldersClient(remotepaths []string, slaveid string, full bool, conf *configurationapp.Configuration) {
 
 	wgp := sync.WaitGroup{}
 	wgp.Add(1)
 	go func() {
 		defer wgp.Done()
 		for pr := range p.photoResponseChan {
-			if len(pr.Photos) > 0 {
-				db, err := database.NewDatabaseHandler()
+			if len(pr.Photos) > 0 || len(pr.Moved) > 0 || len(pr.Deleted) > 0 {
+				db, err := database.NewDatabase()
 				if err != nil {
 					return
 				}
@@ -92,6 +93,16 @@ func (p *PhotoExifClient) ScanFoldersClient(remotepaths []string, slaveid string
 				if err != nil {
 					logger.Error("Error insert data with error" + err.Error())
 				}
+				for _, move := range pr.Moved {
+					if err = db.MovePhoto(pr.MachineId, move); err != nil {
+						logger.Error("Error move data with error" + err.Error())
+					}
+				}
+				for _, photo := range pr.Deleted {
+					if err = db.DeletePhoto(pr.MachineId, photo); err != nil {
+						logger.Error("Error delete data with error" + err.Error())
+					}
+				}
 			}
 			logger.Info("message received")
 			logger.Debug(*pr)
@@ -116,7 +127,7 @@ func (p *PhotoExifClient) ScanFoldersClient(remotepaths []string, slaveid string
 				logger.Info("Sending to traitment " + d.r)
 				if slave := slavesConfig.Slaves[d.sid]; slave != nil {
 					logger.Info("Exec search to " + slave.Name + " address " + slave.Url + " for directory " + d.r)
-					p.scanExifClient(d.r, slave)
+					p.scanExifClient(d.r, full, slave)
 				}
 
 			}
@@ -151,9 +162,9 @@ func (p *PhotoExifClient) GetFileExtensionValues(slave *slavehandler.Slave) (err
 
 	}()
 	startTime = time.Now()
-	client := &http.Client{}
+	client := tlshandler.NewClient()
 	uri := fmt.Sprintf("%s:%d/getfileextension", slave.Url, slave.Port)
-	request, err := http.NewRequest("GET", uri, nil)
+	request, err := slave.NewRequest("GET", uri, nil)
 	if err != nil {
 		logger.Error("error with : " + err.Error())
 		return err, &configurationexif.FileExtension{}
@@ -221,9 +232,9 @@ func (p *PhotoExifClient) GetOriginal(slave *slavehandler.Slave, path string) (e
 
 	}()
 	startTime = time.Now()
-	client := &http.Client{}
+	client := tlshandler.NewClient()
 	uri := fmt.Sprintf("%s:%d/photo?filepath=%s", slave.Url, slave.Port, path)
-	request, err := http.NewRequest("GET", uri, nil)
+	request, err := slave.NewRequest("GET", uri, nil)
 	if err != nil {
 		logger.Error("error with : " + err.Error())
 		return err, &modele.ExportRawPhoto{}
@@ -253,9 +264,9 @@ func (p *PhotoExifClient) GetThumbnail(slave *slavehandler.Slave, path string) (
 
 	}()
 	startTime = time.Now()
-	client := &http.Client{}
+	client := tlshandler.NewClient()
 	uri := fmt.Sprintf("%s:%d/thumbnail?filepath=%s", slave.Url, slave.Port, path)
-	request, err := http.NewRequest("GET", uri, nil)
+	request, err := slave.NewRequest("GET", uri, nil)
 	if err != nil {
 		logger.Error("error with : " + err.Error())
 		return err, ""
@@ -273,3 +284,36 @@ func (p *PhotoExifClient) GetThumbnail(slave *slavehandler.Slave, path string) (
 	}
 	return nil, image
 }
+
+// function asks the slave to write the corrections of the update in the photo update.Filepath,
+// the error message of the slave is returned as an error
+func (p *PhotoExifClient) WriteMetadata(slave *slavehandler.Slave, update *modele.MetadataUpdate) (error, *modele.MetadataResult) {
+	body, err := json.Marshal(update)
+	if err != nil {
+		return err, &modele.MetadataResult{}
+	}
+	client := tlshandler.NewClient()
+	uri := fmt.Sprintf("%s:%d/writemetadata", slave.Url, slave.Port)
+	request, err := slave.NewRequest("POST", uri, body)
+	if err != nil {
+		logger.Error("error with : " + err.Error())
+		return err, &modele.MetadataResult{}
+	}
+	request.Header.Set("Content-Type", "application/json")
+	logger.Info("Calling uri : " + uri)
+	response, err := client.Do(request)
+	if err != nil {
+		logger.Error("error with : " + err.Error())
+		return err, &modele.MetadataResult{}
+	}
+	defer response.Body.Close()
+	result := &modele.MetadataResult{}
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		logger.Error("error with : " + err.Error())
+		return fmt.Errorf("unexpected response of the slave %s, status %d", slave.Name, response.StatusCode), &modele.MetadataResult{}
+	}
+	if result.Message != "" {
+		return fmt.Errorf("%s", result.Message), result
+	}
+	return nil, result
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/jeromelesaux/photo/exifhandler"
 	"github.com/jeromelesaux/photo/modele"
 	"github.com/jeromelesaux/photo/slavehandler"
+	"github.com/jeromelesaux/photo/tlshandler"
 	logger "github.com/sirupsen/logrus"
 )
 
@@ -54,35 +55,46 @@ func (p *RawPhotoClient) GetRemoteRawPhotosAlbum(saveIntoAFile bool) []*modele.E
 
 	}()
 
-	// rawPhotoContent channel consumer
-	wgp := &sync.WaitGroup{}
-	wgp.Add(1)
-	go func() {
-		defer wgp.Done()
-		for filename := range p.rawPhotoChan {
-			photosFilenames = append(photosFilenames, filename)
-		}
-	}()
 	startTime = time.Now()
 	logger.Info("start generating album pdf. ")
 
+	// each photo is downloaded by its own client to return the photos in the order of the album
+	clients := make([]*RawPhotoClient, 0, len(p.Album.Records))
 	wg := &sync.WaitGroup{}
 	for _, record := range p.Album.Records {
 		logger.Info("call get photo content for " + record.Filepath + " at the machine " + record.MachineId)
+		c := &RawPhotoClient{rawPhotoChan: make(chan *modele.ExportRawPhoto, 1), Album: p.Album}
+		clients = append(clients, c)
 		wg.Add(1)
 		switch record.MachineId {
 		case modele.ORIGIN_GOOGLE:
-			go p.CallGetRemoteRawPhoto(record.Filepath, wg, saveIntoAFile)
+			go c.CallGetRemoteRawPhoto(record.Filepath, wg, saveIntoAFile)
 		case modele.ORIGIN_FLICKR:
-			go p.CallGetRemoteRawPhoto(record.Filepath, wg, saveIntoAFile)
+			go c.CallGetRemoteRawPhoto(record.Filepath, wg, saveIntoAFile)
 		default:
-			go p.CallGetRawPhoto(record.MachineId, record.Filepath, wg, saveIntoAFile)
+			// the photo is downloaded from an online copy if the machine of the record is offline
+			locations := database.OrderLocations(record.Locations, record.MachineId)
+			if len(locations) == 0 {
+				go c.CallGetRawPhoto(record.MachineId, record.Filepath, wg, saveIntoAFile)
+				continue
+			}
+			switch location := locations[0]; location.MachineId {
+			case modele.ORIGIN_GOOGLE, modele.ORIGIN_FLICKR:
+				go c.CallGetRemoteRawPhoto(location.Filepath, wg, saveIntoAFile)
+			default:
+				go c.CallGetRawPhoto(location.MachineId, location.Filepath, wg, saveIntoAFile)
+			}
 		}
 	}
 
 	wg.Wait()
-	close(p.rawPhotoChan)
-	wgp.Wait()
+	for _, c := range clients {
+		select {
+		case photo := <-c.rawPhotoChan:
+			photosFilenames = append(photosFilenames, photo)
+		default:
+		}
+	}
 	return photosFilenames
 }
 
@@ -183,9 +195,9 @@ func (p *RawPhotoClient) CallGetRawPhoto(machineid, remotePath string, wg *sync.
 		p.rawPhotoChan <- &modele.ExportRawPhoto{}
 		return
 	}
-	client := &http.Client{}
+	client := tlshandler.NewClient()
 	uri := fmt.Sprintf("%s:%d/photo?filepath=%s", slave.Url, slave.Port, strings.Replace(remotePath, " ", "%20", -1))
-	request, err := http.NewRequest("GET", uri, nil)
+	request, err := slave.NewRequest("GET", uri, nil)
 	if err != nil {
 		logger.Error("error with : " + err.Error())
 		p.rawPhotoChan <- &modele.ExportRawPhoto{}